@@ -119,19 +119,24 @@ func main() {
 	// API: CRUD endpoints
 	http.HandleFunc("/api/projects", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		projects, _ := database.ListProjects()
+		projects, _ := database.ListProjects(false)
 		json.NewEncoder(w).Encode(projects)
 	})
 
 	http.HandleFunc("/api/memories", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
+		projectID, err := projectParam(database, r)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
 		if r.Method == "POST" {
 			var req struct {
 				Content  string   `json:"content"`
 				Keywords []string `json:"keywords"`
 			}
 			json.NewDecoder(r.Body).Decode(&req)
-			mem, err := database.CreateMemory(nil, req.Content, req.Keywords)
+			mem, err := database.CreateMemory(projectID, req.Content, req.Keywords)
 			if err != nil {
 				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 				return
@@ -148,12 +153,17 @@ func main() {
 			json.NewEncoder(w).Encode(map[string]bool{"deleted": true})
 			return
 		}
-		memories, _ := database.SearchMemories(nil, "", nil, 100)
+		memories, _ := database.SearchMemories(projectID, "", db.MemoryFilter{Limit: 100})
 		json.NewEncoder(w).Encode(memories)
 	})
 
 	http.HandleFunc("/api/tasks", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
+		projectID, err := projectParam(database, r)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
 		if r.Method == "POST" {
 			var req struct {
 				Title       string `json:"title"`
@@ -161,7 +171,7 @@ func main() {
 				Priority    int    `json:"priority"`
 			}
 			json.NewDecoder(r.Body).Decode(&req)
-			task, err := database.CreateTask(nil, nil, req.Title, req.Description, req.Priority)
+			task, err := database.CreateTask(projectID, nil, req.Title, req.Description, req.Priority)
 			if err != nil {
 				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 				return
@@ -174,16 +184,21 @@ func main() {
 				ID int64 `json:"id"`
 			}
 			json.NewDecoder(r.Body).Decode(&req)
-			database.DeleteTask(req.ID)
+			database.DeleteTask(req.ID, false)
 			json.NewEncoder(w).Encode(map[string]bool{"deleted": true})
 			return
 		}
-		tasks, _ := database.ListTasks(nil, nil, nil)
+		tasks, _ := database.ListTasks(projectID, db.TaskFilter{})
 		json.NewEncoder(w).Encode(tasks)
 	})
 
 	http.HandleFunc("/api/guidelines", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
+		projectID, err := projectParam(database, r)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
 		if r.Method == "POST" {
 			var req struct {
 				Category string   `json:"category"`
@@ -193,7 +208,7 @@ func main() {
 				Priority int      `json:"priority"`
 			}
 			json.NewDecoder(r.Body).Decode(&req)
-			g, err := database.CreateGuideline(nil, req.Category, req.Title, req.Content, req.Tags, req.Priority)
+			g, err := database.CreateGuideline(projectID, req.Category, req.Title, req.Content, req.Tags, req.Priority)
 			if err != nil {
 				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 				return
@@ -210,12 +225,17 @@ func main() {
 			json.NewEncoder(w).Encode(map[string]bool{"deleted": true})
 			return
 		}
-		guidelines, _ := database.ListGuidelines(nil, nil)
+		guidelines, _ := database.ListGuidelines(projectID, nil)
 		json.NewEncoder(w).Encode(guidelines)
 	})
 
 	http.HandleFunc("/api/bookmarks", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
+		projectID, err := projectParam(database, r)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
 		if r.Method == "POST" {
 			var req struct {
 				URL           string   `json:"url"`
@@ -227,7 +247,7 @@ func main() {
 				Tags          []string `json:"tags"`
 			}
 			json.NewDecoder(r.Body).Decode(&req)
-			b, err := database.CreateBookmark(nil, req.URL, req.Title, req.Excerpt, req.Note, req.DocType, req.PageOrSection, req.Tags)
+			b, err := database.CreateBookmark(projectID, req.URL, req.Title, req.Excerpt, req.Note, req.DocType, req.PageOrSection, req.Tags)
 			if err != nil {
 				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 				return
@@ -244,7 +264,7 @@ func main() {
 			json.NewEncoder(w).Encode(map[string]bool{"deleted": true})
 			return
 		}
-		bookmarks, _ := database.ListBookmarks(nil)
+		bookmarks, _ := database.ListBookmarks(projectID)
 		json.NewEncoder(w).Encode(bookmarks)
 	})
 
@@ -253,6 +273,21 @@ func main() {
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
+// projectParam resolves the ?project=<slug> query parameter. The dashboard is
+// a separate process from any MCP session, so it never follows a session's
+// active project: without the parameter it reads and writes the global project.
+func projectParam(database *db.DB, r *http.Request) (*int64, error) {
+	slug := r.URL.Query().Get("project")
+	if slug == "" {
+		return nil, nil
+	}
+	p, err := database.GetProjectBySlug(slug)
+	if err != nil {
+		return nil, fmt.Errorf("unknown project %q", slug)
+	}
+	return &p.ID, nil
+}
+
 func categorizeTools(tools []mcp.ToolDefinition) map[string][]mcp.ToolDefinition {
 	categories := make(map[string][]mcp.ToolDefinition)
 
@@ -264,6 +299,9 @@ func categorizeTools(tools []mcp.ToolDefinition) map[string][]mcp.ToolDefinition
 		"guideline_": "Guideline",
 		"project_":   "Project",
 		"bookmark_":  "Bookmark",
+		"search_":    "Search",
+		"link":       "Link", // link_ and links_
+		"tag_":       "Tag",
 	}
 
 	for _, tool := range tools {
@@ -1,16 +1,111 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/rocket/mcp-memories/internal/db"
+	"github.com/rocket/mcp-memories/internal/embed"
 	"github.com/rocket/mcp-memories/internal/mcp"
 )
 
 func main() {
-	// Determine database path
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			runExport(os.Args[2:])
+			return
+		case "import":
+			runImport(os.Args[2:])
+			return
+		}
+	}
+
+	transport := flag.String("transport", "stdio", "Transport to serve: stdio or http")
+	addr := flag.String("addr", "127.0.0.1:8766", "Listen address used with -transport=http")
+	embedder := flag.String("embedder", "hash", "Embedder for semantic search: hash (offline) or http")
+	embedURL := flag.String("embed-url", "http://localhost:11434/api/embeddings", "Embedding endpoint used with -embedder=http")
+	embedModel := flag.String("embed-model", "nomic-embed-text", "Embedding model used with -embedder=http")
+	createWorkspaceProjects := flag.Bool("create-workspace-projects", false, "Create a project for an unknown git repository when detecting the session's project")
+	autoCreateProjects := flag.Bool("auto-create-projects", false, "Create a project when a tool call names an unknown project slug instead of failing")
+	sessionIdleTimeout := flag.Duration("session-idle-timeout", mcp.DefaultSessionIdleTimeout, "End an HTTP session after this long without requests or an open stream")
+	flag.Parse()
+
+	database := openDatabase()
+	defer database.Close()
+
+	switch *embedder {
+	case "hash":
+		// Default set by db.Open
+	case "http":
+		database.SetEmbedder(embed.NewHTTPEmbedder(*embedURL, *embedModel))
+	default:
+		log.Fatalf("Unknown embedder: %s", *embedder)
+	}
+	go indexEmbeddings(database)
+
+	// Create and run MCP server
+	var err error
+	server := mcp.NewServer(database, mcp.Config{
+		CreateWorkspaceProjects: *createWorkspaceProjects,
+		AutoCreateProjects:      *autoCreateProjects,
+		SessionIdleTimeout:      *sessionIdleTimeout,
+	})
+	switch *transport {
+	case "stdio":
+		err = server.Run()
+	case "http":
+		err = server.RunHTTP(*addr)
+	default:
+		log.Fatalf("Unknown transport: %s", *transport)
+	}
+	if err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+}
+
+// indexBatch caps how many rows one IndexEmbeddings call embeds
+const indexBatch = 100
+
+// indexEmbeddings keeps the vectors semantic search reads up to date. It runs
+// whenever a memory or guideline changes, and every minute to pick up
+// bookmarks, imports, a new embedder and rows that failed to embed.
+func indexEmbeddings(database *db.DB) {
+	wake := make(chan struct{}, 1)
+	database.OnChange(func(c db.Change) {
+		if c.Entity != "memory" && c.Entity != "guideline" {
+			return
+		}
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	})
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := database.IndexEmbeddings(indexBatch)
+			if err != nil {
+				log.Printf("Indexing embeddings: %v", err)
+			}
+			if n < indexBatch {
+				break
+			}
+		}
+		select {
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// openDatabase opens the database in ~/.mcp-memory
+func openDatabase() *db.DB {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		log.Fatalf("Failed to get home directory: %v", err)
@@ -18,16 +113,9 @@ func main() {
 
 	dbPath := filepath.Join(homeDir, ".mcp-memory", "memories.db")
 
-	// Open database
 	database, err := db.Open(dbPath)
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
-	defer database.Close()
-
-	// Create and run MCP server
-	server := mcp.NewServer(database)
-	if err := server.Run(); err != nil {
-		log.Fatalf("Server error: %v", err)
-	}
+	return database
 }
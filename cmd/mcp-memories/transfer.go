@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/rocket/mcp-memories/internal/db"
+)
+
+// runExport implements "mcp-memories export"
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	project := fs.String("project", "", "Slug of the project to export (default: every project)")
+	out := fs.String("out", "", "Output file (default: stdout)")
+	fs.Parse(args)
+
+	database := openDatabase()
+	defer database.Close()
+
+	var ids []int64
+	if *project != "" {
+		p, err := database.GetProjectBySlug(*project)
+		if err != nil {
+			log.Fatalf("Unknown project: %s", *project)
+		}
+		ids = append(ids, p.ID)
+	}
+
+	export, err := database.ExportProjects(ids...)
+	if err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+	data = append(data, '\n')
+
+	if *out == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		log.Fatalf("Writing %s: %v", *out, err)
+	}
+}
+
+// runImport implements "mcp-memories import"
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	in := fs.String("in", "", "Export file to import (default: stdin)")
+	strategy := fs.String("strategy", "skip", "How to resolve rows that already exist: skip, overwrite or duplicate")
+	project := fs.String("project", "", "Import a single-project export under this slug")
+	fs.Parse(args)
+
+	merge, err := db.ParseMergeStrategy(*strategy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var data []byte
+	if *in == "" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*in)
+	}
+	if err != nil {
+		log.Fatalf("Reading export: %v", err)
+	}
+	var export db.Export
+	if err := json.Unmarshal(data, &export); err != nil {
+		log.Fatalf("Invalid export: %v", err)
+	}
+
+	database := openDatabase()
+	defer database.Close()
+
+	result, err := database.Import(&export, db.ImportOptions{Strategy: merge, Project: *project})
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+	for _, slug := range result.Projects {
+		fmt.Printf("Imported into %s\n", slug)
+	}
+	fmt.Printf("Created: %v\nUpdated: %v\nSkipped: %v\n", result.Created, result.Updated, result.Skipped)
+}
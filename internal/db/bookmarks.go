@@ -4,42 +4,52 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"strings"
 	"time"
 )
 
 // Bookmark represents a reference to an external document
 type Bookmark struct {
-	ID            int64     `json:"id"`
-	ProjectID     int64     `json:"project_id"`
-	URL           string    `json:"url"`
-	Title         string    `json:"title"`
-	Excerpt       string    `json:"excerpt,omitempty"`
-	Note          string    `json:"note,omitempty"`
-	DocType       string    `json:"doc_type,omitempty"`
-	PageOrSection string    `json:"page_or_section,omitempty"`
-	Tags          []string  `json:"tags,omitempty"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID            int64          `json:"id"`
+	ProjectID     int64          `json:"project_id"`
+	URL           string         `json:"url"`
+	Title         string         `json:"title"`
+	Excerpt       string         `json:"excerpt,omitempty"`
+	Note          string         `json:"note,omitempty"`
+	DocType       string         `json:"doc_type,omitempty"`
+	PageOrSection string         `json:"page_or_section,omitempty"`
+	Tags          []string       `json:"tags,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Score         float64        `json:"score,omitempty"`     // semantic search relevance
+	Inherited     bool           `json:"inherited,omitempty"` // from an ancestor project
+	Links         []LinkedEntity `json:"links,omitempty"`
 }
 
 // CreateBookmark creates a new bookmark
 func (db *DB) CreateBookmark(projectID *int64, url, title, excerpt, note, docType, pageOrSection string, tags []string) (*Bookmark, error) {
 	pid := db.GetProjectID(projectID)
 
-	tagsJSON, err := json.Marshal(tags)
+	tags = normalizeTags(tags)
+	tx, err := db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("marshaling tags: %w", err)
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	result, err := db.Exec(
+	result, err := tx.Exec(
 		"INSERT INTO bookmarks (project_id, url, title, excerpt, note, doc_type, page_or_section, tags) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
-		pid, url, title, excerpt, note, docType, pageOrSection, string(tagsJSON),
+		pid, url, title, excerpt, note, docType, pageOrSection, tagsJSON(tags),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("creating bookmark: %w", err)
 	}
-
 	id, _ := result.LastInsertId()
+	if err := setTags(tx, "bookmark", id, tags); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	return db.GetBookmark(id)
 }
 
@@ -65,48 +75,49 @@ func (db *DB) GetBookmark(id int64) (*Bookmark, error) {
 }
 
 // SearchBookmarks searches bookmarks by query and/or tags
-func (db *DB) SearchBookmarks(projectID *int64, query string, tags []string, docType *string) ([]Bookmark, error) {
-	pid := db.GetProjectID(projectID)
+func (db *DB) SearchBookmarks(projectID *int64, query string, tags TagFilter, docType *string) ([]Bookmark, error) {
+	bookmarks, _, err := db.findBookmarks(projectID, false, query, tags, docType, nil)
+	return bookmarks, err
+}
 
-	var conditions []string
-	var args []interface{}
+// SearchBookmarksPage searches like SearchBookmarks or, with inherit,
+// SearchBookmarksInherited for a page of results, along with how many match
+func (db *DB) SearchBookmarksPage(projectID *int64, query string, tags TagFilter, docType *string, inherit bool, page PageRequest) (*Page[Bookmark], error) {
+	bookmarks, total, err := db.findBookmarks(projectID, inherit, query, tags, docType, &page)
+	if err != nil {
+		return nil, err
+	}
+	return NewPage(bookmarks, total, page), nil
+}
 
-	conditions = append(conditions, "project_id = ?")
-	args = append(args, pid)
+// findBookmarks lists the bookmarks a project sees that match a search, newest
+// first, and how many match. A nil page lists them all.
+func (db *DB) findBookmarks(projectID *int64, inherit bool, query string, tags TagFilter, docType *string, page *PageRequest) ([]Bookmark, int, error) {
+	q, err := db.newScopedQuery(projectID, inherit, "bookmarks",
+		"id, project_id, url, title, excerpt, note, doc_type, page_or_section, tags, created_at", "url", "page_or_section")
+	if err != nil {
+		return nil, 0, err
+	}
 
 	if query != "" {
-		conditions = append(conditions, "(title LIKE ? OR excerpt LIKE ? OR note LIKE ? OR url LIKE ?)")
 		likeQuery := "%" + query + "%"
-		args = append(args, likeQuery, likeQuery, likeQuery, likeQuery)
+		q.where("(title LIKE ? OR excerpt LIKE ? OR note LIKE ? OR url LIKE ?)", likeQuery, likeQuery, likeQuery, likeQuery)
 	}
 
-	for _, tag := range tags {
-		conditions = append(conditions, "tags LIKE ?")
-		args = append(args, "%\""+tag+"\"%")
-	}
+	tagConditions, tagArgs := tags.conditions("bookmark", "bookmarks.id")
+	q.conditions = append(q.conditions, tagConditions...)
+	q.args = append(q.args, tagArgs...)
 
 	if docType != nil && *docType != "" {
-		conditions = append(conditions, "doc_type = ?")
-		args = append(args, *docType)
-	}
-
-	sqlQuery := fmt.Sprintf(
-		"SELECT id, project_id, url, title, excerpt, note, doc_type, page_or_section, tags, created_at FROM bookmarks WHERE %s ORDER BY created_at DESC",
-		strings.Join(conditions, " AND "),
-	)
-
-	rows, err := db.Query(sqlQuery, args...)
-	if err != nil {
-		return nil, err
+		q.where("doc_type = ?", *docType)
 	}
-	defer rows.Close()
 
 	var bookmarks []Bookmark
-	for rows.Next() {
+	total, err := q.run(db, "created_at DESC, depth, id DESC", page, func(rows *sql.Rows) error {
 		var b Bookmark
 		var excerpt, note, docType, pageOrSection, tagsJSON sql.NullString
-		if err := rows.Scan(&b.ID, &b.ProjectID, &b.URL, &b.Title, &excerpt, &note, &docType, &pageOrSection, &tagsJSON, &b.CreatedAt); err != nil {
-			return nil, err
+		if err := rows.Scan(&b.ID, &b.ProjectID, &b.URL, &b.Title, &excerpt, &note, &docType, &pageOrSection, &tagsJSON, &b.CreatedAt, &b.Inherited); err != nil {
+			return err
 		}
 		b.Excerpt = excerpt.String
 		b.Note = note.String
@@ -116,13 +127,20 @@ func (db *DB) SearchBookmarks(projectID *int64, query string, tags []string, doc
 			json.Unmarshal([]byte(tagsJSON.String), &b.Tags)
 		}
 		bookmarks = append(bookmarks, b)
-	}
-	return bookmarks, rows.Err()
+		return nil
+	})
+	return bookmarks, total, err
 }
 
 // ListBookmarks lists all bookmarks for a project
 func (db *DB) ListBookmarks(projectID *int64) ([]Bookmark, error) {
-	return db.SearchBookmarks(projectID, "", nil, nil)
+	return db.SearchBookmarks(projectID, "", TagFilter{}, nil)
+}
+
+// ListBookmarksPage lists a page of the bookmarks ListBookmarks or, with
+// inherit, ListBookmarksInherited returns, along with how many there are
+func (db *DB) ListBookmarksPage(projectID *int64, inherit bool, page PageRequest) (*Page[Bookmark], error) {
+	return db.SearchBookmarksPage(projectID, "", TagFilter{}, nil, inherit, page)
 }
 
 // DeleteBookmark deletes a bookmark by ID
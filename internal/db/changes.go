@@ -0,0 +1,47 @@
+package db
+
+import "sync"
+
+// Change describes a committed write to an entity. When a project is
+// deleted or merged away, Entity is "project" and ID is the project that
+// takes its place.
+type Change struct {
+	Entity    string // memory, guideline, filetree, project
+	Op        string // create, update, delete
+	ProjectID int64
+	ID        int64  // row ID
+	Key       string // natural key, such as a file path
+}
+
+// Change operations
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// changeListeners holds the callbacks registered with OnChange
+type changeListeners struct {
+	mu        sync.RWMutex
+	listeners []func(Change)
+}
+
+// OnChange registers a callback that is invoked after every committed write to
+// memories, guidelines and file annotations, and every project deletion, made
+// through this DB. Writes by other processes sharing the database file and
+// rows loaded by Import or moved by MergeProjects are not reported.
+func (db *DB) OnChange(fn func(Change)) {
+	db.changes.mu.Lock()
+	defer db.changes.mu.Unlock()
+	db.changes.listeners = append(db.changes.listeners, fn)
+}
+
+func (db *DB) notify(c Change) {
+	db.changes.mu.RLock()
+	listeners := db.changes.listeners
+	db.changes.mu.RUnlock()
+
+	for _, fn := range listeners {
+		fn(c)
+	}
+}
@@ -8,13 +8,18 @@ import (
 
 	_ "modernc.org/sqlite"
 
-	"github.com/rocket/mcp-memories/internal/schema"
+	"github.com/rocket/mcp-memories/internal/embed"
 )
 
+// GlobalProjectID is the ID of the built-in "global" project, used whenever
+// no project is given
+const GlobalProjectID int64 = 1
+
 // DB wraps the SQLite database connection
 type DB struct {
 	*sql.DB
-	defaultProjectID int64
+	embedder embed.Embedder
+	changes  *changeListeners
 }
 
 // Open opens the SQLite database and runs migrations
@@ -25,46 +30,44 @@ func Open(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("creating db directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	// Foreign keys are a per-connection setting, so request them in the DSN
+	// to have every pooled connection enforce them
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=foreign_keys(1)")
 	if err != nil {
 		return nil, fmt.Errorf("opening database: %w", err)
 	}
 
+	// Every connection to :memory: is a separate database, so keep just one
+	if dbPath == ":memory:" {
+		db.SetMaxOpenConns(1)
+	}
+
 	// Enable WAL mode for better performance
 	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("enabling WAL mode: %w", err)
 	}
 
-	// Enable foreign keys
-	if _, err := db.Exec("PRAGMA foreign_keys=ON"); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("enabling foreign keys: %w", err)
-	}
-
 	// Run schema migrations
-	if _, err := db.Exec(schema.Schema); err != nil {
+	if err := migrate(db); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("running migrations: %w", err)
 	}
 
-	return &DB{DB: db, defaultProjectID: 1}, nil
-}
-
-// SetDefaultProject sets the default project for operations
-func (db *DB) SetDefaultProject(projectID int64) {
-	db.defaultProjectID = projectID
+	return &DB{DB: db, embedder: embed.NewHashEmbedder(), changes: &changeListeners{}}, nil
 }
 
-// DefaultProjectID returns the current default project ID
-func (db *DB) DefaultProjectID() int64 {
-	return db.defaultProjectID
+// SetEmbedder sets the embedder used for semantic search
+func (db *DB) SetEmbedder(e embed.Embedder) {
+	db.embedder = e
 }
 
-// GetProjectID returns the project ID to use, defaulting to the default project
+// GetProjectID returns the project ID to use, defaulting to the global project.
+// Callers that track an active project (such as an MCP session) resolve it
+// themselves and always pass an explicit ID.
 func (db *DB) GetProjectID(projectID *int64) int64 {
 	if projectID != nil && *projectID > 0 {
 		return *projectID
 	}
-	return db.defaultProjectID
+	return GlobalProjectID
 }
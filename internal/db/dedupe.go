@@ -0,0 +1,289 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DedupeMode selects what StoreMemory does when the content duplicates an
+// existing memory
+type DedupeMode string
+
+const (
+	DedupeSkip  DedupeMode = "skip"  // return the existing memory unchanged
+	DedupeMerge DedupeMode = "merge" // add the new keywords to the existing memory
+	DedupeForce DedupeMode = "force" // store a new memory anyway
+)
+
+// ParseDedupeMode validates a dedupe mode, defaulting to skip
+func ParseDedupeMode(s string) (DedupeMode, error) {
+	switch DedupeMode(s) {
+	case "", DedupeSkip:
+		return DedupeSkip, nil
+	case DedupeMerge, DedupeForce:
+		return DedupeMode(s), nil
+	}
+	return "", fmt.Errorf("invalid dedupe mode %q (expected skip, merge or force)", s)
+}
+
+// DuplicateThreshold is the shingle similarity at which two memories count
+// as near-duplicates
+const DuplicateThreshold = 0.7
+
+// DuplicateMemory is an existing memory found in place of a new one
+type DuplicateMemory struct {
+	*Memory
+	Similarity float64    `json:"similarity"` // 1 for the same normalized content
+	Dedupe     DedupeMode `json:"dedupe"`     // what was done instead of storing
+}
+
+// MemoryCluster is a group of memories that are duplicates or
+// near-duplicates of each other
+type MemoryCluster struct {
+	Memories   []Memory `json:"memories"`   // oldest first
+	Similarity float64  `json:"similarity"` // lowest similarity that joined two members
+}
+
+// normalizeContent lowercases text and reduces everything but letters and
+// digits to single spaces, so formatting and punctuation changes compare
+// equal
+func normalizeContent(content string) string {
+	return strings.Join(contentWords(content), " ")
+}
+
+func contentWords(content string) []string {
+	return strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// memoryHash is the content_hash of a memory
+func memoryHash(content string) string {
+	return contentHash(normalizeContent(content))
+}
+
+// shingles returns the set of adjacent word pairs in content, or its single
+// word
+func shingles(content string) map[string]struct{} {
+	words := contentWords(content)
+	set := make(map[string]struct{}, len(words))
+	if len(words) == 1 {
+		set[words[0]] = struct{}{}
+	}
+	for i := 1; i < len(words); i++ {
+		set[words[i-1]+" "+words[i]] = struct{}{}
+	}
+	return set
+}
+
+// jaccard is the share of shingles two sets have in common
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for s := range a {
+		if _, ok := b[s]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// StoreMemory creates a memory unless the project already has a live memory
+// with the same normalized content, or one at least DuplicateThreshold
+// similar. Then, depending on mode, it returns that memory as a duplicate,
+// merging the new keywords into it, instead of the new memory.
+func (db *DB) StoreMemory(projectID *int64, content string, keywords []string, opts MemoryOptions, mode DedupeMode) (*Memory, *DuplicateMemory, error) {
+	if mode != DedupeForce {
+		dup, err := db.FindDuplicateMemory(projectID, content, DuplicateThreshold)
+		if err != nil {
+			return nil, nil, err
+		}
+		if dup != nil {
+			dup.Dedupe = mode
+			if mode == DedupeMerge {
+				if dup.Memory, err = db.UpdateMemory(dup.ID, nil, nil, keywords, nil); err != nil {
+					return nil, nil, err
+				}
+			}
+			return nil, dup, nil
+		}
+	}
+	m, err := db.CreateMemoryWithOptions(projectID, content, keywords, opts)
+	return m, nil, err
+}
+
+// FindDuplicateMemory returns the project's live memory most similar to
+// content, if it is at least threshold similar. A memory with the same
+// normalized content is always a duplicate.
+func (db *DB) FindDuplicateMemory(projectID *int64, content string, threshold float64) (*DuplicateMemory, error) {
+	pid := db.GetProjectID(projectID)
+	if err := db.backfillMemoryHashes(pid); err != nil {
+		return nil, err
+	}
+
+	exact, err := db.listMemories("m.project_id = ? AND m.content_hash = ? AND "+liveMemory+" ORDER BY m.id LIMIT 1", pid, memoryHash(content))
+	if err != nil {
+		return nil, err
+	}
+	if len(exact) > 0 {
+		return &DuplicateMemory{Memory: &exact[0], Similarity: 1}, nil
+	}
+
+	candidates, err := db.listMemories("m.project_id = ? AND "+liveMemory+" ORDER BY m.id", pid)
+	if err != nil {
+		return nil, err
+	}
+	target := shingles(content)
+	var best *DuplicateMemory
+	for i := range candidates {
+		sim := jaccard(target, shingles(candidates[i].Content))
+		if sim >= threshold && (best == nil || sim > best.Similarity) {
+			best = &DuplicateMemory{Memory: &candidates[i], Similarity: sim}
+		}
+	}
+	return best, nil
+}
+
+// FindDuplicateMemories groups a project's live memories into clusters of
+// duplicates and near-duplicates at least threshold similar, largest
+// clusters first
+func (db *DB) FindDuplicateMemories(projectID *int64, threshold float64) ([]MemoryCluster, error) {
+	pid := db.GetProjectID(projectID)
+	memories, err := db.listMemories("m.project_id = ? AND "+liveMemory+" ORDER BY m.id", pid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count the shingles each pair of memories shares through an inverted
+	// index, so only pairs with something in common are compared
+	sets := make([]map[string]struct{}, len(memories))
+	index := map[string][]int{}
+	for i, m := range memories {
+		sets[i] = shingles(m.Content)
+		for s := range sets[i] {
+			index[s] = append(index[s], i)
+		}
+	}
+	type pair struct{ a, b int }
+	shared := map[pair]int{}
+	for _, members := range index {
+		for x := 0; x < len(members); x++ {
+			for y := x + 1; y < len(members); y++ {
+				shared[pair{members[x], members[y]}]++
+			}
+		}
+	}
+
+	type edge struct {
+		pair
+		sim float64
+	}
+	var edges []edge
+	hashes := map[string]int{}
+	for i, m := range memories {
+		h := memoryHash(m.Content)
+		if first, ok := hashes[h]; ok {
+			edges = append(edges, edge{pair{first, i}, 1})
+		} else {
+			hashes[h] = i
+		}
+	}
+	for p, n := range shared {
+		if sim := float64(n) / float64(len(sets[p.a])+len(sets[p.b])-n); sim >= threshold {
+			edges = append(edges, edge{p, sim})
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].sim != edges[j].sim {
+			return edges[i].sim > edges[j].sim
+		}
+		if edges[i].a != edges[j].a {
+			return edges[i].a < edges[j].a
+		}
+		return edges[i].b < edges[j].b
+	})
+
+	// Join the most similar pairs first with union-find, so the last pair
+	// that joins a cluster is its weakest link
+	parent := make([]int, len(memories))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	weakest := map[int]float64{}
+	for _, e := range edges {
+		ra, rb := find(e.a), find(e.b)
+		if ra == rb {
+			continue
+		}
+		if ra > rb {
+			ra, rb = rb, ra
+		}
+		parent[rb] = ra
+		delete(weakest, rb)
+		weakest[ra] = e.sim
+	}
+
+	groups := map[int][]Memory{}
+	for i, m := range memories {
+		r := find(i)
+		groups[r] = append(groups[r], m)
+	}
+	clusters := []MemoryCluster{}
+	for r, members := range groups {
+		if len(members) > 1 {
+			clusters = append(clusters, MemoryCluster{Memories: members, Similarity: weakest[r]})
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].Memories) != len(clusters[j].Memories) {
+			return len(clusters[i].Memories) > len(clusters[j].Memories)
+		}
+		return clusters[i].Memories[0].ID < clusters[j].Memories[0].ID
+	})
+	return clusters, nil
+}
+
+// listMemories returns the memories matching a condition on memories m
+func (db *DB) listMemories(where string, args ...interface{}) ([]Memory, error) {
+	rows, err := db.Query("SELECT "+memoryColumns+" FROM memories m WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memories []Memory
+	for rows.Next() {
+		m, err := scanMemory(rows)
+		if err != nil {
+			return nil, err
+		}
+		memories = append(memories, *m)
+	}
+	return memories, rows.Err()
+}
+
+// backfillMemoryHashes sets the content_hash of a project's memories stored
+// before hashes were recorded
+func (db *DB) backfillMemoryHashes(projectID int64) error {
+	missing, err := db.listMemories("m.project_id = ? AND m.content_hash IS NULL", projectID)
+	if err != nil {
+		return err
+	}
+	for _, m := range missing {
+		if _, err := db.Exec("UPDATE memories SET content_hash = ? WHERE id = ?", memoryHash(m.Content), m.ID); err != nil {
+			return fmt.Errorf("hashing memory %d: %w", m.ID, err)
+		}
+	}
+	return nil
+}
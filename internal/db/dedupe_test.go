@@ -0,0 +1,83 @@
+package db
+
+import "testing"
+
+// TestMemoryDedupe verifies exact and near-duplicate detection on store and
+// the clustering of existing duplicates
+func TestMemoryDedupe(t *testing.T) {
+	database, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	original, err := database.CreateMemory(nil, "The API authenticates requests with short-lived JWT tokens signed by the gateway", []string{"auth"})
+	if err != nil {
+		t.Fatalf("CreateMemory failed: %v", err)
+	}
+
+	t.Run("exact", func(t *testing.T) {
+		// Memories stored before content hashes were recorded are hashed on demand
+		database.Exec("UPDATE memories SET content_hash = NULL")
+		m, dup, err := database.StoreMemory(nil, "the api authenticates requests with short lived JWT tokens, signed by the gateway.", nil, MemoryOptions{}, DedupeSkip)
+		if err != nil {
+			t.Fatalf("StoreMemory failed: %v", err)
+		}
+		if m != nil || dup == nil || dup.ID != original.ID || dup.Similarity != 1 || dup.Dedupe != DedupeSkip {
+			t.Errorf("Expected the original as an exact duplicate, got %+v, %+v", m, dup)
+		}
+	})
+
+	t.Run("near merge", func(t *testing.T) {
+		_, dup, err := database.StoreMemory(nil, "The API authenticates requests with short-lived JWT tokens signed by the API gateway", []string{"jwt"}, MemoryOptions{}, DedupeMerge)
+		if err != nil {
+			t.Fatalf("StoreMemory failed: %v", err)
+		}
+		if dup == nil || dup.ID != original.ID || dup.Similarity >= 1 || dup.Similarity < DuplicateThreshold {
+			t.Fatalf("Expected a near duplicate of the original, got %+v", dup)
+		}
+		if len(dup.Keywords) != 2 || dup.Keywords[1] != "jwt" {
+			t.Errorf("Expected keywords merged into the original, got %v", dup.Keywords)
+		}
+	})
+
+	t.Run("distinct and force", func(t *testing.T) {
+		m, dup, _ := database.StoreMemory(nil, "Background jobs run on a separate worker pool", nil, MemoryOptions{}, DedupeSkip)
+		if m == nil || dup != nil {
+			t.Errorf("Expected unrelated content to be stored, got duplicate %+v", dup)
+		}
+		m, dup, _ = database.StoreMemory(nil, original.Content, nil, MemoryOptions{}, DedupeForce)
+		if m == nil || dup != nil || m.ID == original.ID {
+			t.Errorf("Expected force to store a copy, got %+v, %+v", m, dup)
+		}
+	})
+
+	t.Run("expired ignored", func(t *testing.T) {
+		past := original.CreatedAt.AddDate(-1, 0, 0)
+		stale, _ := database.CreateMemoryWithOptions(nil, "Deploy freeze until Friday", nil, MemoryOptions{ExpiresAt: &past})
+		m, dup, _ := database.StoreMemory(nil, stale.Content, nil, MemoryOptions{}, DedupeSkip)
+		if m == nil || dup != nil {
+			t.Errorf("Expected an expired memory not to count as a duplicate, got %+v", dup)
+		}
+	})
+
+	t.Run("clusters", func(t *testing.T) {
+		clusters, err := database.FindDuplicateMemories(nil, DuplicateThreshold)
+		if err != nil {
+			t.Fatalf("FindDuplicateMemories failed: %v", err)
+		}
+		if len(clusters) != 1 {
+			t.Fatalf("Expected one cluster, got %+v", clusters)
+		}
+		c := clusters[0]
+		if len(c.Memories) != 2 || c.Memories[0].ID != original.ID || c.Similarity != 1 {
+			t.Errorf("Expected the original and its forced copy, got %+v", c)
+		}
+
+		database.CreateMemory(nil, "The API authenticates all requests with short-lived JWT tokens signed by the gateway", nil)
+		clusters, _ = database.FindDuplicateMemories(nil, DuplicateThreshold)
+		if len(clusters) != 1 || len(clusters[0].Memories) != 3 || clusters[0].Similarity >= 1 {
+			t.Errorf("Expected the near duplicate to join the cluster, got %+v", clusters)
+		}
+	})
+}
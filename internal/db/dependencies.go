@@ -0,0 +1,173 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDependencyCycle is returned when a new dependency would make a task
+// wait, directly or indirectly, on itself
+var ErrDependencyCycle = errors.New("dependency would create a cycle")
+
+// openDependencies selects the unfinished dependencies of the task in the
+// enclosing query's tasks row. A task is finished once it reaches one of its
+// workflow's closed statuses.
+const openDependencies = `SELECT 1 FROM task_dependencies d JOIN tasks b ON b.id = d.depends_on_id
+	WHERE d.task_id = tasks.id AND b.completed_at IS NULL`
+
+// TaskDependencies describes the dependency edges of one task
+type TaskDependencies struct {
+	TaskID    int64  `json:"task_id"`
+	BlockedBy []Task `json:"blocked_by"`
+	Blocks    []Task `json:"blocks"`
+}
+
+// AddTaskDependency records that taskID is blocked by dependsOnID until the
+// latter is closed. Adding an existing dependency is a no-op.
+func (db *DB) AddTaskDependency(taskID, dependsOnID int64) error {
+	if taskID == dependsOnID {
+		return fmt.Errorf("task %d cannot depend on itself", taskID)
+	}
+	for _, id := range []int64{taskID, dependsOnID} {
+		if _, err := db.GetTask(id); err != nil {
+			return fmt.Errorf("task %d: %w", id, err)
+		}
+	}
+
+	// Walk everything dependsOnID waits on; reaching taskID means a cycle
+	var cycle int
+	err := db.QueryRow(`
+		WITH RECURSIVE upstream(id) AS (
+			SELECT ?
+			UNION
+			SELECT d.depends_on_id FROM task_dependencies d JOIN upstream u ON d.task_id = u.id
+		)
+		SELECT COUNT(*) FROM upstream WHERE id = ?`,
+		dependsOnID, taskID,
+	).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle > 0 {
+		return fmt.Errorf("task %d already waits on task %d: %w", dependsOnID, taskID, ErrDependencyCycle)
+	}
+
+	if _, err := db.Exec(
+		"INSERT OR IGNORE INTO task_dependencies (task_id, depends_on_id) VALUES (?, ?)",
+		taskID, dependsOnID,
+	); err != nil {
+		return fmt.Errorf("adding dependency: %w", err)
+	}
+	return nil
+}
+
+// RemoveTaskDependency removes a dependency, reporting whether it existed
+func (db *DB) RemoveTaskDependency(taskID, dependsOnID int64) (bool, error) {
+	result, err := db.Exec(
+		"DELETE FROM task_dependencies WHERE task_id = ? AND depends_on_id = ?",
+		taskID, dependsOnID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// GetTaskDependencies lists the tasks a task is blocked by and the tasks it blocks
+func (db *DB) GetTaskDependencies(taskID int64) (*TaskDependencies, error) {
+	deps := &TaskDependencies{TaskID: taskID, BlockedBy: []Task{}, Blocks: []Task{}}
+	var err error
+	if deps.BlockedBy, err = db.queryTasks(
+		"SELECT "+taskColumns+" FROM tasks WHERE id IN (SELECT depends_on_id FROM task_dependencies WHERE task_id = ?) ORDER BY id",
+		taskID,
+	); err != nil {
+		return nil, err
+	}
+	if deps.Blocks, err = db.queryTasks(
+		"SELECT "+taskColumns+" FROM tasks WHERE id IN (SELECT task_id FROM task_dependencies WHERE depends_on_id = ?) ORDER BY id",
+		taskID,
+	); err != nil {
+		return nil, err
+	}
+	return deps, nil
+}
+
+// UnblockedBy lists the unfinished tasks that were waiting on taskID and
+// have no other unfinished dependency. Call it once taskID is closed.
+func (db *DB) UnblockedBy(taskID int64) ([]Task, error) {
+	return db.queryTasks(
+		"SELECT "+taskColumns+" FROM tasks WHERE id IN (SELECT task_id FROM task_dependencies WHERE depends_on_id = ?) AND completed_at IS NULL AND NOT EXISTS ("+openDependencies+") ORDER BY priority DESC, created_at, id",
+		taskID,
+	)
+}
+
+// queryTasks runs a query selecting taskColumns and fills in each task's
+// labels and dependencies
+func (db *DB) queryTasks(query string, args ...interface{}) ([]Task, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := collectTasks(rows)
+	if err != nil {
+		return nil, err
+	}
+	if tasks == nil {
+		tasks = []Task{}
+	}
+	return tasks, db.fillTaskDetails(tasks)
+}
+
+// fillTaskDetails sets Labels and BlockedBy on each task
+func (db *DB) fillTaskDetails(tasks []Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(tasks))
+	for i, t := range tasks {
+		ids[i] = t.ID
+	}
+	blockedBy, err := db.blockedBy(ids...)
+	if err != nil {
+		return err
+	}
+	labels, err := db.taskLabels(ids...)
+	if err != nil {
+		return err
+	}
+	for i := range tasks {
+		tasks[i].BlockedBy = blockedBy[tasks[i].ID]
+		tasks[i].Labels = labels[tasks[i].ID]
+	}
+	return nil
+}
+
+// blockedBy maps each of the given tasks to the IDs of the tasks it depends on
+func (db *DB) blockedBy(taskIDs ...int64) (map[int64][]int64, error) {
+	placeholders := make([]string, len(taskIDs))
+	args := make([]interface{}, len(taskIDs))
+	for i, id := range taskIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	rows, err := db.Query(
+		"SELECT task_id, depends_on_id FROM task_dependencies WHERE task_id IN ("+strings.Join(placeholders, ", ")+") ORDER BY task_id, depends_on_id",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deps := make(map[int64][]int64)
+	for rows.Next() {
+		var taskID, dependsOnID int64
+		if err := rows.Scan(&taskID, &dependsOnID); err != nil {
+			return nil, err
+		}
+		deps[taskID] = append(deps[taskID], dependsOnID)
+	}
+	return deps, rows.Err()
+}
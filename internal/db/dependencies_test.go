@@ -0,0 +1,110 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestTaskDependencies verifies cycle detection, the ready filter and which
+// tasks a completion unblocks
+func TestTaskDependencies(t *testing.T) {
+	database, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	schema, _ := database.CreateTask(nil, nil, "Design schema", "", 0)
+	api, _ := database.CreateTask(nil, nil, "Build API", "", 0)
+	docs, _ := database.CreateTask(nil, nil, "Write docs", "", 0)
+	release, _ := database.CreateTask(nil, nil, "Release", "", 0)
+
+	for _, dep := range [][2]int64{{api.ID, schema.ID}, {release.ID, api.ID}, {release.ID, docs.ID}} {
+		if err := database.AddTaskDependency(dep[0], dep[1]); err != nil {
+			t.Fatalf("AddTaskDependency(%d, %d) failed: %v", dep[0], dep[1], err)
+		}
+	}
+	if err := database.AddTaskDependency(api.ID, schema.ID); err != nil {
+		t.Errorf("Expected adding an existing dependency to be a no-op, got %v", err)
+	}
+
+	t.Run("cycles", func(t *testing.T) {
+		if err := database.AddTaskDependency(schema.ID, release.ID); !errors.Is(err, ErrDependencyCycle) {
+			t.Errorf("Expected ErrDependencyCycle, got %v", err)
+		}
+		if err := database.AddTaskDependency(docs.ID, docs.ID); err == nil {
+			t.Error("Expected error for a self-dependency")
+		}
+		if err := database.AddTaskDependency(docs.ID, 999); err == nil {
+			t.Error("Expected error for a missing task")
+		}
+	})
+
+	t.Run("blocked_by", func(t *testing.T) {
+		task, _ := database.GetTask(release.ID)
+		if len(task.BlockedBy) != 2 || task.BlockedBy[0] != api.ID || task.BlockedBy[1] != docs.ID {
+			t.Errorf("Unexpected blocked_by: %v", task.BlockedBy)
+		}
+		deps, err := database.GetTaskDependencies(api.ID)
+		if err != nil {
+			t.Fatalf("GetTaskDependencies failed: %v", err)
+		}
+		if len(deps.BlockedBy) != 1 || deps.BlockedBy[0].ID != schema.ID || len(deps.Blocks) != 1 || deps.Blocks[0].ID != release.ID {
+			t.Errorf("Unexpected dependencies: %+v", deps)
+		}
+	})
+
+	ready := func() []int64 {
+		tasks, err := database.ListTasks(nil, TaskFilter{Ready: true})
+		if err != nil {
+			t.Fatalf("ListTasks failed: %v", err)
+		}
+		var ids []int64
+		for _, task := range tasks {
+			ids = append(ids, task.ID)
+		}
+		return ids
+	}
+
+	t.Run("ready", func(t *testing.T) {
+		if ids := ready(); len(ids) != 2 || ids[0] != schema.ID || ids[1] != docs.ID {
+			t.Errorf("Expected schema and docs to be ready, got %v", ids)
+		}
+
+		done := "done"
+		database.UpdateTask(schema.ID, nil, nil, &done, nil)
+		unblocked, _ := database.UnblockedBy(schema.ID)
+		if len(unblocked) != 1 || unblocked[0].ID != api.ID {
+			t.Errorf("Expected completing the schema to unblock the API, got %+v", unblocked)
+		}
+		if ids := ready(); len(ids) != 2 || ids[0] != api.ID || ids[1] != docs.ID {
+			t.Errorf("Expected API and docs to be ready, got %v", ids)
+		}
+
+		database.UpdateTask(api.ID, nil, nil, &done, nil)
+		if unblocked, _ := database.UnblockedBy(api.ID); len(unblocked) != 0 {
+			t.Errorf("Expected release to still wait on docs, got %+v", unblocked)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		removed, err := database.RemoveTaskDependency(release.ID, docs.ID)
+		if err != nil || !removed {
+			t.Fatalf("RemoveTaskDependency failed: %v", err)
+		}
+		if removed, _ := database.RemoveTaskDependency(release.ID, docs.ID); removed {
+			t.Error("Expected a second removal to report nothing removed")
+		}
+		if ids := ready(); len(ids) != 2 || ids[0] != docs.ID || ids[1] != release.ID {
+			t.Errorf("Expected docs and release to be ready, got %v", ids)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		database.DeleteTask(api.ID, false)
+		task, _ := database.GetTask(release.ID)
+		if len(task.BlockedBy) != 0 {
+			t.Errorf("Expected dependencies on a deleted task to go away, got %v", task.BlockedBy)
+		}
+	})
+}
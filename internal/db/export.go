@@ -0,0 +1,732 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ExportFormat is the version of the export file format
+const ExportFormat = 1
+
+// Export is a portable snapshot of one or more projects. IDs are those of the
+// source database; Import assigns new ones.
+type Export struct {
+	Format     int             `json:"format"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Projects   []ProjectExport `json:"projects"`
+}
+
+// ProjectExport holds a project and everything stored in it. Memory history,
+// task activity and embeddings are not exported; embeddings are recomputed by
+// IndexEmbeddings.
+type ProjectExport struct {
+	Project      Project          `json:"project"`
+	Parent       string           `json:"parent,omitempty"` // slug of the project this one inherits from
+	Memories     []Memory         `json:"memories"`
+	Tasks        []Task           `json:"tasks"`
+	TaskComments []TaskComment    `json:"task_comments,omitempty"`
+	Workflow     *Workflow        `json:"workflow,omitempty"`
+	Metadata     []Metadata       `json:"metadata"`
+	Filetree     []FileAnnotation `json:"filetree"`
+	Guidelines   []Guideline      `json:"guidelines"`
+	Bookmarks    []Bookmark       `json:"bookmarks"`
+	Links        []Link           `json:"links,omitempty"` // between entities of this project
+}
+
+// ExportProjects exports the given projects, or every project when
+// projectIDs is empty
+func (db *DB) ExportProjects(projectIDs ...int64) (*Export, error) {
+	if len(projectIDs) == 0 {
+		projects, err := db.ListProjects(true)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range projects {
+			projectIDs = append(projectIDs, p.ID)
+		}
+	}
+
+	export := &Export{Format: ExportFormat, ExportedAt: time.Now().UTC()}
+	for _, id := range projectIDs {
+		p, err := db.exportProject(id)
+		if err != nil {
+			return nil, err
+		}
+		export.Projects = append(export.Projects, *p)
+	}
+	return export, nil
+}
+
+func (db *DB) exportProject(id int64) (*ProjectExport, error) {
+	project, err := db.GetProjectByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("exporting project %d: %w", id, err)
+	}
+	p := &ProjectExport{Project: *project}
+	if project.ParentID != nil {
+		parent, err := db.GetProjectByID(*project.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		p.Parent = parent.Slug
+	}
+
+	if p.Memories, err = db.listAllMemories(id); err != nil {
+		return nil, err
+	}
+	if p.Tasks, err = db.ListTasks(&id, TaskFilter{}); err != nil {
+		return nil, err
+	}
+	workflow, err := db.GetWorkflow(&id)
+	if err != nil {
+		return nil, err
+	}
+	if workflow.ProjectID != nil && *workflow.ProjectID == id {
+		p.Workflow = workflow
+	}
+	for _, t := range p.Tasks {
+		comments, err := db.ListTaskComments(t.ID)
+		if err != nil {
+			return nil, err
+		}
+		p.TaskComments = append(p.TaskComments, comments...)
+	}
+	if p.Metadata, err = db.ListMetadata(&id); err != nil {
+		return nil, err
+	}
+	if p.Filetree, err = db.ListFileAnnotations(&id); err != nil {
+		return nil, err
+	}
+	if p.Guidelines, err = db.ListGuidelines(&id, nil); err != nil {
+		return nil, err
+	}
+	if p.Bookmarks, err = db.ListBookmarks(&id); err != nil {
+		return nil, err
+	}
+	if p.Links, err = db.listProjectLinks(id); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// listAllMemories returns every memory of a project, oldest first
+func (db *DB) listAllMemories(projectID int64) ([]Memory, error) {
+	rows, err := db.Query(
+		"SELECT "+memoryColumns+" FROM memories m WHERE m.project_id = ? ORDER BY m.id",
+		projectID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memories []Memory
+	for rows.Next() {
+		m, err := scanMemory(rows)
+		if err != nil {
+			return nil, err
+		}
+		memories = append(memories, *m)
+	}
+	return memories, rows.Err()
+}
+
+// MergeStrategy decides what Import does with a row that matches an existing
+// one: a memory with the same content, a task with the same title, a bookmark
+// with the same URL and page, a metadata key, a file annotation path, or a
+// guideline's category and title
+type MergeStrategy string
+
+// Merge strategies
+const (
+	MergeSkip      MergeStrategy = "skip"      // keep the existing row
+	MergeOverwrite MergeStrategy = "overwrite" // replace the existing row's values
+	MergeDuplicate MergeStrategy = "duplicate" // keep both, suffixing the imported key if it is unique
+)
+
+// ParseMergeStrategy validates a strategy name; empty means skip
+func ParseMergeStrategy(s string) (MergeStrategy, error) {
+	switch MergeStrategy(s) {
+	case "":
+		return MergeSkip, nil
+	case MergeSkip, MergeOverwrite, MergeDuplicate:
+		return MergeStrategy(s), nil
+	}
+	return "", fmt.Errorf("invalid merge strategy %q: must be skip, overwrite or duplicate", s)
+}
+
+// ImportOptions controls Import
+type ImportOptions struct {
+	Strategy MergeStrategy
+	// Project imports a single-project export under this slug instead of the
+	// exported one
+	Project string
+}
+
+// ImportResult counts what Import did, per entity type
+type ImportResult struct {
+	Projects []string       `json:"projects"`
+	Created  map[string]int `json:"created"`
+	Updated  map[string]int `json:"updated"`
+	Skipped  map[string]int `json:"skipped"`
+}
+
+// Import loads an export in a single transaction. Projects are matched by
+// slug and created when missing, inheriting from their exported parent if a
+// project has its slug and from the global project otherwise, and rows
+// matching existing ones are resolved by the strategy, so importing twice
+// adds nothing. Created tasks keep their hierarchy, dependencies and comments
+// under new IDs, and must be in statuses the project's workflow allows. Links
+// are kept between the imported or matching entities.
+// Change listeners are not notified of imported rows.
+func (db *DB) Import(data *Export, opts ImportOptions) (*ImportResult, error) {
+	if data.Format > ExportFormat {
+		return nil, fmt.Errorf("export format %d is newer than supported format %d", data.Format, ExportFormat)
+	}
+	if opts.Project != "" && len(data.Projects) != 1 {
+		return nil, errors.New("a target project can only be given for a single-project export")
+	}
+	if opts.Strategy == "" {
+		opts.Strategy = MergeSkip
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res := &ImportResult{
+		Created: map[string]int{},
+		Updated: map[string]int{},
+		Skipped: map[string]int{},
+	}
+	pids := make([]int64, len(data.Projects))
+	created := make([]bool, len(data.Projects))
+	for i := range data.Projects {
+		p := &data.Projects[i]
+		slug := p.Project.Slug
+		if opts.Project != "" {
+			slug = opts.Project
+		}
+		if pids[i], created[i], err = importProject(tx, p, slug, opts.Strategy, res); err != nil {
+			return nil, fmt.Errorf("importing project %s: %w", slug, err)
+		}
+		res.Projects = append(res.Projects, slug)
+	}
+
+	// Parents are resolved once every project exists, since a project may be
+	// exported before the one it inherits from, and before any tasks are
+	// checked against the workflows they inherit. Matched projects keep their
+	// own parent unless overwritten.
+	for i, p := range data.Projects {
+		if p.Parent == "" || !created[i] && opts.Strategy != MergeOverwrite {
+			continue
+		}
+		if err := importParent(tx, pids[i], p.Parent); err != nil {
+			return nil, fmt.Errorf("importing project %s: %w", res.Projects[i], err)
+		}
+	}
+
+	for i := range data.Projects {
+		if err := importProjectData(tx, &data.Projects[i], pids[i], opts.Strategy, res); err != nil {
+			return nil, fmt.Errorf("importing project %s: %w", res.Projects[i], err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// importProject finds or creates the project an export is imported into,
+// along with its workflow, and reports whether it was created
+func importProject(tx *sql.Tx, p *ProjectExport, slug string, strategy MergeStrategy, res *ImportResult) (int64, bool, error) {
+	if slug == "" {
+		return 0, false, errors.New("project slug is required")
+	}
+
+	var pid int64
+	var created bool
+	err := tx.QueryRow("SELECT id FROM projects WHERE slug = ?", slug).Scan(&pid)
+	switch {
+	case err == sql.ErrNoRows:
+		result, err := tx.Exec(
+			"INSERT INTO projects (slug, name, root_path, parent_id, created_at) VALUES (?, ?, ?, ?, ?)",
+			slug, p.Project.Name, p.Project.RootPath, GlobalProjectID, importTime(p.Project.CreatedAt),
+		)
+		if err != nil {
+			return 0, false, err
+		}
+		pid, _ = result.LastInsertId()
+		created = true
+		res.Created["projects"]++
+	case err != nil:
+		return 0, false, err
+	case strategy == MergeOverwrite:
+		if _, err := tx.Exec("UPDATE projects SET name = ?, root_path = ? WHERE id = ?", p.Project.Name, p.Project.RootPath, pid); err != nil {
+			return 0, false, err
+		}
+		res.Updated["projects"]++
+	default:
+		res.Skipped["projects"]++
+	}
+
+	if w := p.Workflow; w != nil {
+		if err := w.validate(); err != nil {
+			return 0, false, fmt.Errorf("workflow of %s: %w", slug, err)
+		}
+		existing, err := lookupID(tx, "SELECT project_id FROM task_workflows WHERE project_id = ?", pid)
+		if err != nil {
+			return 0, false, err
+		}
+		if existing != 0 && strategy != MergeOverwrite {
+			res.Skipped["workflows"]++
+		} else {
+			if err := storeWorkflow(tx, pid, w); err != nil {
+				return 0, false, err
+			}
+			if existing != 0 {
+				res.Updated["workflows"]++
+			} else {
+				res.Created["workflows"]++
+			}
+		}
+	}
+	return pid, created, nil
+}
+
+// importParent points an imported project at the project it inherited from
+// in the export, or at the global project when no project has that slug
+func importParent(tx *sql.Tx, pid int64, parent string) error {
+	if pid == GlobalProjectID {
+		return nil
+	}
+	parentID, err := lookupID(tx, "SELECT id FROM projects WHERE slug = ?", parent)
+	if err != nil {
+		return err
+	}
+	if parentID == 0 {
+		parentID = GlobalProjectID
+	}
+	return setProjectParent(tx, pid, &parentID)
+}
+
+// importProjectData imports the rows of an export into its project
+func importProjectData(tx *sql.Tx, p *ProjectExport, pid int64, strategy MergeStrategy, res *ImportResult) error {
+	// newIDs maps each link type's exported IDs to the rows they became
+	newIDs := map[string]map[int64]int64{}
+	for _, typ := range LinkTypes {
+		newIDs[typ] = map[int64]int64{}
+	}
+
+	// matched holds the existing rows each type's imported rows were matched
+	// with or created as, so two imported rows never share one
+	matched := map[string]map[int64]bool{}
+	for _, typ := range LinkTypes {
+		matched[typ] = map[int64]bool{}
+	}
+
+	for _, m := range p.Memories {
+		keywords := normalizeTags(m.Keywords)
+		importance := m.Importance
+		if importance == 0 {
+			importance = DefaultImportance
+		} else if err := checkImportance(importance); err != nil {
+			return fmt.Errorf("memory %d: %w", m.ID, err)
+		}
+		existing, err := matchRow(tx, matched["memory"],
+			"SELECT id FROM memories WHERE project_id = ? AND (content_hash = ? OR content_hash IS NULL AND content = ?) ORDER BY id",
+			pid, memoryHash(m.Content), m.Content)
+		if err != nil {
+			return err
+		}
+		if existing != 0 && strategy != MergeDuplicate {
+			newIDs["memory"][m.ID] = existing
+			if strategy != MergeOverwrite {
+				res.Skipped["memories"]++
+				continue
+			}
+			if _, err := tx.Exec(
+				"UPDATE memories SET keywords = ?, pinned = ?, importance = ?, expires_at = ?, archived_at = ?, updated_at = ? WHERE id = ?",
+				tagsJSON(keywords), m.Pinned, importance, optionalTime(m.ExpiresAt), optionalTime(m.ArchivedAt), importTime(m.UpdatedAt), existing,
+			); err != nil {
+				return err
+			}
+			if err := setTags(tx, "memory", existing, keywords); err != nil {
+				return err
+			}
+			res.Updated["memories"]++
+			continue
+		}
+		result, err := tx.Exec(
+			"INSERT INTO memories (project_id, content, content_hash, keywords, pinned, importance, expires_at, archived_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			pid, m.Content, memoryHash(m.Content), tagsJSON(keywords), m.Pinned, importance, optionalTime(m.ExpiresAt), optionalTime(m.ArchivedAt),
+			importTime(m.CreatedAt), importTime(m.UpdatedAt),
+		)
+		if err != nil {
+			return err
+		}
+		newIDs["memory"][m.ID], _ = result.LastInsertId()
+		matched["memory"][newIDs["memory"][m.ID]] = true
+		if err := setTags(tx, "memory", newIDs["memory"][m.ID], keywords); err != nil {
+			return err
+		}
+		res.Created["memories"]++
+	}
+
+	// Statuses must exist in the workflow the tasks will live under
+	workflow, err := getWorkflow(tx, pid)
+	if err != nil {
+		return err
+	}
+	for _, t := range p.Tasks {
+		if t.Status != "" && !slices.Contains(workflow.Statuses, t.Status) {
+			return fmt.Errorf("task %d has status %q, which the workflow does not allow (%s)", t.ID, t.Status, strings.Join(workflow.Statuses, ", "))
+		}
+	}
+
+	// Insert tasks first, then link parents once every task has its new ID.
+	// Only created tasks get the exported parents, dependencies and comments;
+	// matched tasks keep their own.
+	taskIDs := newIDs["task"]
+	created := map[int64]bool{}
+	for _, t := range p.Tasks {
+		if t.Status == "" {
+			t.Status = workflow.Statuses[0]
+		}
+		// Exports from before workflows carry no start and completion times
+		if t.CompletedAt == nil && workflow.IsClosed(t.Status) {
+			t.CompletedAt = &t.UpdatedAt
+		}
+		if t.StartedAt == nil && (workflow.IsStarted(t.Status) || workflow.IsClosed(t.Status)) {
+			t.StartedAt = &t.UpdatedAt
+		}
+		labels := t.Labels
+		details := TaskDetails{Labels: &labels}
+
+		existing, err := matchRow(tx, matched["task"], "SELECT id FROM tasks WHERE project_id = ? AND title = ? ORDER BY id", pid, t.Title)
+		if err != nil {
+			return err
+		}
+		if existing != 0 && strategy != MergeDuplicate {
+			taskIDs[t.ID] = existing
+			if strategy != MergeOverwrite {
+				res.Skipped["tasks"]++
+				continue
+			}
+			if _, err := tx.Exec(
+				`UPDATE tasks SET description = ?, status = ?, priority = ?, due_at = ?, estimate_minutes = NULLIF(?, 0), assignee = NULLIF(?, ''),
+				updated_at = ?, started_at = ?, completed_at = ? WHERE id = ?`,
+				t.Description, t.Status, t.Priority, optionalTime(t.DueAt), t.EstimateMinutes, t.Assignee,
+				importTime(t.UpdatedAt), optionalTime(t.StartedAt), optionalTime(t.CompletedAt), existing,
+			); err != nil {
+				return err
+			}
+			if err := setTaskDetails(tx, existing, details, false); err != nil {
+				return err
+			}
+			res.Updated["tasks"]++
+			continue
+		}
+		result, err := tx.Exec(
+			`INSERT INTO tasks (project_id, title, description, status, priority, due_at, estimate_minutes, assignee, created_at, updated_at, started_at, completed_at)
+			VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, 0), NULLIF(?, ''), ?, ?, ?, ?)`,
+			pid, t.Title, t.Description, t.Status, t.Priority, optionalTime(t.DueAt), t.EstimateMinutes, t.Assignee,
+			importTime(t.CreatedAt), importTime(t.UpdatedAt), optionalTime(t.StartedAt), optionalTime(t.CompletedAt),
+		)
+		if err != nil {
+			return err
+		}
+		taskIDs[t.ID], _ = result.LastInsertId()
+		matched["task"][taskIDs[t.ID]] = true
+		created[t.ID] = true
+		if err := setTaskDetails(tx, taskIDs[t.ID], details, false); err != nil {
+			return err
+		}
+		res.Created["tasks"]++
+	}
+	for _, t := range p.Tasks {
+		if t.ParentID == nil || !created[t.ID] {
+			continue
+		}
+		parent, ok := taskIDs[*t.ParentID]
+		if !ok {
+			continue // parent was not exported; keep the task at the top level
+		}
+		if _, err := tx.Exec("UPDATE tasks SET parent_id = ? WHERE id = ?", parent, taskIDs[t.ID]); err != nil {
+			return err
+		}
+	}
+	for _, c := range p.TaskComments {
+		if !created[c.TaskID] {
+			continue
+		}
+		if _, err := tx.Exec(
+			"INSERT INTO task_comments (task_id, author, content, created_at) VALUES (?, ?, ?, ?)",
+			taskIDs[c.TaskID], c.Author, c.Content, importTime(c.CreatedAt),
+		); err != nil {
+			return err
+		}
+		res.Created["task_comments"]++
+	}
+	for _, t := range p.Tasks {
+		if !created[t.ID] {
+			continue
+		}
+		for _, dep := range t.BlockedBy {
+			dependsOn, ok := taskIDs[dep]
+			if !ok {
+				continue
+			}
+			if _, err := tx.Exec(
+				"INSERT OR IGNORE INTO task_dependencies (task_id, depends_on_id) VALUES (?, ?)",
+				taskIDs[t.ID], dependsOn,
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, m := range p.Metadata {
+		key := m.Key
+		existing, err := lookupID(tx, "SELECT id FROM metadata WHERE project_id = ? AND key = ?", pid, key)
+		if err != nil {
+			return err
+		}
+		if existing != 0 {
+			switch strategy {
+			case MergeOverwrite:
+				if _, err := tx.Exec("UPDATE metadata SET value = ? WHERE id = ?", m.Value, existing); err != nil {
+					return err
+				}
+				res.Updated["metadata"]++
+				continue
+			case MergeDuplicate:
+				key, err = uniqueName(key, func(candidate string) (int64, error) {
+					return lookupID(tx, "SELECT id FROM metadata WHERE project_id = ? AND key = ?", pid, candidate)
+				})
+				if err != nil {
+					return err
+				}
+			default:
+				res.Skipped["metadata"]++
+				continue
+			}
+		}
+		if _, err := tx.Exec("INSERT INTO metadata (project_id, key, value) VALUES (?, ?, ?)", pid, key, m.Value); err != nil {
+			return err
+		}
+		res.Created["metadata"]++
+	}
+
+	// A file annotation's path names a real file, so duplicate keeps the
+	// existing note as skip does
+	for _, f := range p.Filetree {
+		existing, err := lookupID(tx, "SELECT id FROM filetree WHERE project_id = ? AND path = ?", pid, f.Path)
+		if err != nil {
+			return err
+		}
+		if existing != 0 {
+			newIDs["filetree"][f.ID] = existing
+			if strategy != MergeOverwrite {
+				res.Skipped["filetree"]++
+				continue
+			}
+			if _, err := tx.Exec("UPDATE filetree SET note = ?, is_dir = ? WHERE id = ?", f.Note, f.IsDir, existing); err != nil {
+				return err
+			}
+			res.Updated["filetree"]++
+			continue
+		}
+		result, err := tx.Exec("INSERT INTO filetree (project_id, path, note, is_dir) VALUES (?, ?, ?, ?)", pid, f.Path, f.Note, f.IsDir)
+		if err != nil {
+			return err
+		}
+		newIDs["filetree"][f.ID], _ = result.LastInsertId()
+		res.Created["filetree"]++
+	}
+
+	for _, g := range p.Guidelines {
+		title := g.Title
+		tags := normalizeTags(g.Tags)
+		existing, err := lookupID(tx, "SELECT id FROM guidelines WHERE project_id = ? AND category = ? AND title = ?", pid, g.Category, title)
+		if err != nil {
+			return err
+		}
+		if existing != 0 {
+			switch strategy {
+			case MergeOverwrite:
+				if _, err := tx.Exec(
+					"UPDATE guidelines SET content = ?, tags = ?, priority = ?, updated_at = ? WHERE id = ?",
+					g.Content, tagsJSON(tags), g.Priority, importTime(g.UpdatedAt), existing,
+				); err != nil {
+					return err
+				}
+				if err := setTags(tx, "guideline", existing, tags); err != nil {
+					return err
+				}
+				newIDs["guideline"][g.ID] = existing
+				res.Updated["guidelines"]++
+				continue
+			case MergeDuplicate:
+				title, err = uniqueName(title, func(candidate string) (int64, error) {
+					return lookupID(tx, "SELECT id FROM guidelines WHERE project_id = ? AND category = ? AND title = ?", pid, g.Category, candidate)
+				})
+				if err != nil {
+					return err
+				}
+			default:
+				newIDs["guideline"][g.ID] = existing
+				res.Skipped["guidelines"]++
+				continue
+			}
+		}
+		result, err := tx.Exec(
+			"INSERT INTO guidelines (project_id, category, title, content, tags, priority, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			pid, g.Category, title, g.Content, tagsJSON(tags), g.Priority, importTime(g.CreatedAt), importTime(g.UpdatedAt),
+		)
+		if err != nil {
+			return err
+		}
+		newIDs["guideline"][g.ID], _ = result.LastInsertId()
+		if err := setTags(tx, "guideline", newIDs["guideline"][g.ID], tags); err != nil {
+			return err
+		}
+		res.Created["guidelines"]++
+	}
+
+	for _, b := range p.Bookmarks {
+		tags := normalizeTags(b.Tags)
+		existing, err := matchRow(tx, matched["bookmark"],
+			"SELECT id FROM bookmarks WHERE project_id = ? AND url = ? AND page_or_section = ? ORDER BY id",
+			pid, b.URL, b.PageOrSection)
+		if err != nil {
+			return err
+		}
+		if existing != 0 && strategy != MergeDuplicate {
+			newIDs["bookmark"][b.ID] = existing
+			if strategy != MergeOverwrite {
+				res.Skipped["bookmarks"]++
+				continue
+			}
+			if _, err := tx.Exec(
+				"UPDATE bookmarks SET title = ?, excerpt = ?, note = ?, doc_type = ?, tags = ? WHERE id = ?",
+				b.Title, b.Excerpt, b.Note, b.DocType, tagsJSON(tags), existing,
+			); err != nil {
+				return err
+			}
+			if err := setTags(tx, "bookmark", existing, tags); err != nil {
+				return err
+			}
+			res.Updated["bookmarks"]++
+			continue
+		}
+		result, err := tx.Exec(
+			"INSERT INTO bookmarks (project_id, url, title, excerpt, note, doc_type, page_or_section, tags, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			pid, b.URL, b.Title, b.Excerpt, b.Note, b.DocType, b.PageOrSection, tagsJSON(tags), importTime(b.CreatedAt),
+		)
+		if err != nil {
+			return err
+		}
+		newIDs["bookmark"][b.ID], _ = result.LastInsertId()
+		matched["bookmark"][newIDs["bookmark"][b.ID]] = true
+		if err := setTags(tx, "bookmark", newIDs["bookmark"][b.ID], tags); err != nil {
+			return err
+		}
+		res.Created["bookmarks"]++
+	}
+
+	for _, l := range p.Links {
+		source, ok := newIDs[l.SourceType][l.SourceID]
+		if !ok {
+			continue
+		}
+		target, ok := newIDs[l.TargetType][l.TargetID]
+		if !ok || !slices.Contains(LinkRelations, l.Relation) {
+			continue
+		}
+		result, err := tx.Exec(
+			"INSERT INTO links (source_type, source_id, target_type, target_id, relation, created_at) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING",
+			l.SourceType, source, l.TargetType, target, l.Relation, importTime(l.CreatedAt),
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			res.Created["links"]++
+		} else {
+			res.Skipped["links"]++
+		}
+	}
+
+	return nil
+}
+
+// lookupID returns the ID a single-row query finds, or 0
+func lookupID(tx *sql.Tx, query string, args ...interface{}) (int64, error) {
+	var id int64
+	err := tx.QueryRow(query, args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// matchRow returns the first ID query finds that is not in used, or 0, and
+// marks it used
+func matchRow(tx *sql.Tx, used map[int64]bool, query string, args ...interface{}) (int64, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		if !used[id] {
+			used[id] = true
+			return id, nil
+		}
+	}
+	return 0, rows.Err()
+}
+
+// uniqueName appends " (2)", " (3)", ... to name until lookup finds no row
+// with that name
+func uniqueName(name string, lookup func(candidate string) (int64, error)) (string, error) {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)", name, n)
+		id, err := lookup(candidate)
+		if err != nil {
+			return "", err
+		}
+		if id == 0 {
+			return candidate, nil
+		}
+	}
+}
+
+// optionalTime converts a nullable time for a DATETIME column
+func optionalTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return sqliteTime(*t)
+}
+
+// importTime keeps an exported timestamp, or uses the current time when the
+// export lacks one
+func importTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return sqliteTime(t)
+}
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestExportImport verifies that an export round-trips into another database
+// and that merge strategies resolve unique-key collisions
+func TestExportImport(t *testing.T) {
+	src, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer src.Close()
+
+	app, err := src.CreateProject("app", "App", "/src/app")
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	parent, _ := src.CreateTask(&app.ID, nil, "Parent", "", 1)
+	child, _ := src.CreateTask(&app.ID, &parent.ID, "Child", "", 0)
+	grandchild, _ := src.CreateTask(&app.ID, &child.ID, "Grandchild", "", 0)
+	src.AddTaskDependency(parent.ID, grandchild.ID)
+	src.AddTaskComment(child.ID, "agent", "Waiting on review")
+	assignee, labels := "agent", []string{"backend"}
+	src.UpdateTaskWithDetails(child.ID, nil, nil, nil, nil, TaskDetails{Assignee: &assignee, Labels: &labels})
+	src.CreateMemory(&app.ID, "Exports keep timestamps", []string{"export"})
+	src.SetMetadata(&app.ID, "language", "go")
+	src.AnnotateFile(&app.ID, "main.go", "Entry point", false)
+	src.CreateGuideline(&app.ID, "style", "Errors", "Wrap them", []string{"go"}, 3)
+	src.CreateBookmark(&app.ID, "https://go.dev", "Go", "", "", "url", "", nil)
+
+	export, err := src.ExportProjects(app.ID)
+	if err != nil {
+		t.Fatalf("ExportProjects failed: %v", err)
+	}
+	if len(export.Projects) != 1 || len(export.Projects[0].Tasks) != 3 {
+		t.Fatalf("Unexpected export: %+v", export)
+	}
+
+	dst, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer dst.Close()
+	// Occupy the source IDs so the import has to remap them
+	dst.CreateTask(nil, nil, "Existing", "", 0)
+	dst.CreateTask(nil, nil, "Existing", "", 0)
+
+	t.Run("round trip", func(t *testing.T) {
+		res, err := dst.Import(export, ImportOptions{})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if res.Created["tasks"] != 3 || res.Created["guidelines"] != 1 || res.Created["projects"] != 1 {
+			t.Errorf("Unexpected counts: %+v", res)
+		}
+
+		p, err := dst.GetProjectBySlug("app")
+		if err != nil {
+			t.Fatalf("imported project missing: %v", err)
+		}
+		if p.RootPath != "/src/app" {
+			t.Errorf("Expected root_path to be kept, got %q", p.RootPath)
+		}
+		tasks, _ := dst.ListTasks(&p.ID, TaskFilter{})
+		byTitle := map[string]Task{}
+		for _, task := range tasks {
+			byTitle[task.Title] = task
+		}
+		if byTitle["Parent"].ParentID != nil ||
+			byTitle["Child"].ParentID == nil || *byTitle["Child"].ParentID != byTitle["Parent"].ID ||
+			byTitle["Grandchild"].ParentID == nil || *byTitle["Grandchild"].ParentID != byTitle["Child"].ID {
+			t.Errorf("Task hierarchy not preserved: %+v", tasks)
+		}
+		if blockedBy := byTitle["Parent"].BlockedBy; len(blockedBy) != 1 || blockedBy[0] != byTitle["Grandchild"].ID {
+			t.Errorf("Task dependencies not preserved: %+v", tasks)
+		}
+		if child := byTitle["Child"]; child.Assignee != "agent" || len(child.Labels) != 1 || child.Labels[0] != "backend" {
+			t.Errorf("Task details not preserved: %+v", child)
+		}
+		if comments, _ := dst.ListTaskComments(byTitle["Child"].ID); len(comments) != 1 || comments[0].Author != "agent" {
+			t.Errorf("Task comments not preserved: %+v", comments)
+		}
+
+		memories, _ := dst.SearchMemories(&p.ID, "timestamps", MemoryFilter{Limit: 10})
+		if len(memories) != 1 {
+			t.Errorf("Expected the imported memory to be searchable, got %d results", len(memories))
+		}
+	})
+
+	export.Projects[0].Guidelines[0].Content = "Wrap them with %w"
+	export.Projects[0].Metadata[0].Value = "golang"
+
+	t.Run("skip", func(t *testing.T) {
+		res, err := dst.Import(export, ImportOptions{Strategy: MergeSkip})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if res.Skipped["guidelines"] != 1 || res.Skipped["metadata"] != 1 || res.Skipped["filetree"] != 1 ||
+			res.Skipped["memories"] != 1 || res.Skipped["tasks"] != 3 || res.Skipped["bookmarks"] != 1 {
+			t.Errorf("Unexpected counts: %+v", res)
+		}
+		if len(res.Created) != 0 {
+			t.Errorf("Importing again created rows: %+v", res.Created)
+		}
+		pid := projectIDOf(t, dst, "app")
+		if tasks, _ := dst.ListTasks(pid, TaskFilter{}); len(tasks) != 3 {
+			t.Errorf("Expected the tasks not to be duplicated, got %d", len(tasks))
+		}
+		if comments, _ := dst.ListTaskComments(mustTaskID(t, dst, pid, "Child")); len(comments) != 1 {
+			t.Errorf("Expected the comments not to be duplicated, got %d", len(comments))
+		}
+		m, _ := dst.GetMetadata(projectIDOf(t, dst, "app"), "language")
+		if m.Value != "go" {
+			t.Errorf("skip changed existing metadata to %q", m.Value)
+		}
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		res, err := dst.Import(export, ImportOptions{Strategy: MergeOverwrite})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if res.Updated["guidelines"] != 1 || res.Updated["metadata"] != 1 {
+			t.Errorf("Unexpected counts: %+v", res)
+		}
+		pid := projectIDOf(t, dst, "app")
+		m, _ := dst.GetMetadata(pid, "language")
+		if m.Value != "golang" {
+			t.Errorf("Expected overwritten metadata, got %q", m.Value)
+		}
+		guidelines, _ := dst.ListGuidelines(pid, nil)
+		if len(guidelines) != 1 || guidelines[0].Content != "Wrap them with %w" {
+			t.Errorf("Expected one overwritten guideline, got %+v", guidelines)
+		}
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		if _, err := dst.Import(export, ImportOptions{Strategy: MergeDuplicate}); err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		pid := projectIDOf(t, dst, "app")
+		guidelines, _ := dst.ListGuidelines(pid, nil)
+		titles := map[string]bool{}
+		for _, g := range guidelines {
+			titles[g.Title] = true
+		}
+		if !titles["Errors"] || !titles["Errors (2)"] {
+			t.Errorf("Expected both guidelines, got %v", titles)
+		}
+		if m, _ := dst.GetMetadata(pid, "language (2)"); m == nil {
+			t.Error("Expected duplicated metadata key")
+		}
+	})
+
+	t.Run("target project", func(t *testing.T) {
+		res, err := dst.Import(export, ImportOptions{Project: "copy"})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if len(res.Projects) != 1 || res.Projects[0] != "copy" || res.Created["projects"] != 1 {
+			t.Errorf("Unexpected result: %+v", res)
+		}
+	})
+
+	t.Run("statuses follow the workflow", func(t *testing.T) {
+		pid := projectIDOf(t, dst, "app")
+		if _, err := dst.SetWorkflow(pid, Workflow{Statuses: []string{"todo", "in_progress", "done", "blocked", "review"}}); err != nil {
+			t.Fatalf("SetWorkflow failed: %v", err)
+		}
+		export.Projects[0].Tasks[0].Status = "shipped"
+		defer func() { export.Projects[0].Tasks[0].Status = "todo" }()
+		if _, err := dst.Import(export, ImportOptions{Strategy: MergeDuplicate}); err == nil || !strings.Contains(err.Error(), `"shipped"`) {
+			t.Errorf("Expected an unknown status to be refused, got %v", err)
+		}
+		if tasks, _ := dst.ListTasks(pid, TaskFilter{}); len(tasks) != 6 {
+			t.Errorf("Expected the refused import to add nothing, got %d tasks", len(tasks))
+		}
+	})
+
+	t.Run("newer format is refused", func(t *testing.T) {
+		if _, err := dst.Import(&Export{Format: ExportFormat + 1}, ImportOptions{}); err == nil {
+			t.Error("Expected an error for a newer export format")
+		}
+	})
+}
+
+func mustTaskID(t *testing.T, database *DB, projectID *int64, title string) int64 {
+	t.Helper()
+	tasks, _ := database.ListTasks(projectID, TaskFilter{Query: title})
+	for _, task := range tasks {
+		if task.Title == title {
+			return task.ID
+		}
+	}
+	t.Fatalf("task %s missing", title)
+	return 0
+}
+
+func projectIDOf(t *testing.T, database *DB, slug string) *int64 {
+	t.Helper()
+	p, err := database.GetProjectBySlug(slug)
+	if err != nil {
+		t.Fatalf("project %s missing: %v", slug, err)
+	}
+	return &p.ID
+}
+
+// TestExportImportParents verifies that an import restores the projects'
+// inheritance, whatever order they were exported in
+func TestExportImportParents(t *testing.T) {
+	src, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer src.Close()
+
+	org, _ := src.CreateProject("org", "", "")
+	team, _ := src.CreateProject("team", "", "")
+	app, _ := src.CreateProject("app", "", "")
+	src.SetProjectParent(team.ID, &org.ID)
+	src.SetProjectParent(app.ID, &team.ID)
+	// app's task is in a status only the workflow it inherits from org allows
+	if _, err := src.SetWorkflow(&org.ID, Workflow{Statuses: []string{"idea", "shipped"}, Closed: []string{"shipped"}}); err != nil {
+		t.Fatalf("SetWorkflow failed: %v", err)
+	}
+	src.CreateTask(&app.ID, nil, "Launch", "", 0)
+
+	export, err := src.ExportProjects()
+	if err != nil {
+		t.Fatalf("ExportProjects failed: %v", err)
+	}
+	slices.Reverse(export.Projects)
+
+	dst, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer dst.Close()
+
+	t.Run("three-level chain", func(t *testing.T) {
+		if _, err := dst.Import(export, ImportOptions{}); err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		chain, err := dst.ProjectChain(*projectIDOf(t, dst, "app"))
+		if err != nil {
+			t.Fatalf("ProjectChain failed: %v", err)
+		}
+		want := []int64{*projectIDOf(t, dst, "app"), *projectIDOf(t, dst, "team"), *projectIDOf(t, dst, "org"), GlobalProjectID}
+		if !slices.Equal(chain, want) {
+			t.Errorf("Expected chain %v, got %v", want, chain)
+		}
+		tasks, _ := dst.ListTasks(projectIDOf(t, dst, "app"), TaskFilter{})
+		if len(tasks) != 1 || tasks[0].Status != "idea" {
+			t.Errorf("Expected the task in the inherited workflow's status, got %+v", tasks)
+		}
+	})
+
+	t.Run("missing parent", func(t *testing.T) {
+		single, err := src.ExportProjects(team.ID)
+		if err != nil {
+			t.Fatalf("ExportProjects failed: %v", err)
+		}
+		if single.Projects[0].Parent != "org" {
+			t.Fatalf("Expected the parent slug to be exported, got %q", single.Projects[0].Parent)
+		}
+		if _, err := dst.Import(single, ImportOptions{Project: "other"}); err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		chain, _ := dst.ProjectChain(*projectIDOf(t, dst, "other"))
+		if len(chain) != 3 || chain[1] != *projectIDOf(t, dst, "org") {
+			t.Errorf("Expected other to inherit from org, got %v", chain)
+		}
+
+		single.Projects[0].Parent = "nowhere"
+		if _, err := dst.Import(single, ImportOptions{Project: "orphan"}); err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		chain, _ = dst.ProjectChain(*projectIDOf(t, dst, "orphan"))
+		if !slices.Equal(chain, []int64{*projectIDOf(t, dst, "orphan"), GlobalProjectID}) {
+			t.Errorf("Expected orphan to fall back to the global project, got %v", chain)
+		}
+	})
+}
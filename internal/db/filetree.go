@@ -6,18 +6,24 @@ import (
 
 // FileAnnotation represents a file/directory annotation
 type FileAnnotation struct {
-	ID        int64  `json:"id"`
-	ProjectID int64  `json:"project_id"`
-	Path      string `json:"path"`
-	Note      string `json:"note"`
-	IsDir     bool   `json:"is_dir"`
+	ID        int64          `json:"id"`
+	ProjectID int64          `json:"project_id"`
+	Path      string         `json:"path"`
+	Note      string         `json:"note"`
+	IsDir     bool           `json:"is_dir"`
+	Links     []LinkedEntity `json:"links,omitempty"`
 }
 
 // AnnotateFile adds or updates a note on a file path
 func (db *DB) AnnotateFile(projectID *int64, path, note string, isDir bool) (*FileAnnotation, error) {
 	pid := db.GetProjectID(projectID)
 
-	_, err := db.Exec(
+	existing, err := db.GetFileAnnotation(&pid, path)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(
 		"INSERT INTO filetree (project_id, path, note, is_dir) VALUES (?, ?, ?, ?) ON CONFLICT(project_id, path) DO UPDATE SET note = ?, is_dir = ?",
 		pid, path, note, isDir, note, isDir,
 	)
@@ -25,7 +31,16 @@ func (db *DB) AnnotateFile(projectID *int64, path, note string, isDir bool) (*Fi
 		return nil, err
 	}
 
-	return db.GetFileAnnotation(projectID, path)
+	f, err := db.GetFileAnnotation(&pid, path)
+	if err != nil {
+		return nil, err
+	}
+	op := OpCreate
+	if existing != nil {
+		op = OpUpdate
+	}
+	db.notify(Change{Entity: "filetree", Op: op, ProjectID: pid, ID: f.ID, Key: path})
+	return f, nil
 }
 
 // GetFileAnnotation gets an annotation for a specific path
@@ -48,12 +63,31 @@ func (db *DB) GetFileAnnotation(projectID *int64, path string) (*FileAnnotation,
 
 // ListFileAnnotations lists all annotations for a project
 func (db *DB) ListFileAnnotations(projectID *int64) ([]FileAnnotation, error) {
+	return db.listFileAnnotations(db.GetProjectID(projectID), nil)
+}
+
+// ListFileAnnotationsPage lists a page of a project's annotations, ordered by
+// path, along with how many there are
+func (db *DB) ListFileAnnotationsPage(projectID *int64, page PageRequest) (*Page[FileAnnotation], error) {
 	pid := db.GetProjectID(projectID)
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM filetree WHERE project_id = ?", pid).Scan(&total); err != nil {
+		return nil, err
+	}
+	items, err := db.listFileAnnotations(pid, &page)
+	if err != nil {
+		return nil, err
+	}
+	return NewPage(items, total, page), nil
+}
 
-	rows, err := db.Query(
+// listFileAnnotations lists a project's annotations, or a page of them
+func (db *DB) listFileAnnotations(pid int64, page *PageRequest) ([]FileAnnotation, error) {
+	query, args := pageClause(
 		"SELECT id, project_id, path, note, is_dir FROM filetree WHERE project_id = ? ORDER BY path",
-		pid,
+		[]interface{}{pid}, page,
 	)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -73,6 +107,12 @@ func (db *DB) ListFileAnnotations(projectID *int64) ([]FileAnnotation, error) {
 // DeleteFileAnnotation deletes an annotation
 func (db *DB) DeleteFileAnnotation(projectID *int64, path string) error {
 	pid := db.GetProjectID(projectID)
-	_, err := db.Exec("DELETE FROM filetree WHERE project_id = ? AND path = ?", pid, path)
-	return err
+	result, err := db.Exec("DELETE FROM filetree WHERE project_id = ? AND path = ?", pid, path)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		db.notify(Change{Entity: "filetree", Op: OpDelete, ProjectID: pid, Key: path})
+	}
+	return nil
 }
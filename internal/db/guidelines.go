@@ -10,35 +10,47 @@ import (
 
 // Guideline represents a how-to or pattern documentation
 type Guideline struct {
-	ID        int64     `json:"id"`
-	ProjectID int64     `json:"project_id"`
-	Category  string    `json:"category"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	Tags      []string  `json:"tags"`
-	Priority  int       `json:"priority"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        int64          `json:"id"`
+	ProjectID int64          `json:"project_id"`
+	Category  string         `json:"category"`
+	Title     string         `json:"title"`
+	Content   string         `json:"content"`
+	Tags      []string       `json:"tags"`
+	Priority  int            `json:"priority"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Score     float64        `json:"score,omitempty"`     // semantic search relevance
+	Inherited bool           `json:"inherited,omitempty"` // from an ancestor project
+	Links     []LinkedEntity `json:"links,omitempty"`
 }
 
 // CreateGuideline creates a new guideline
 func (db *DB) CreateGuideline(projectID *int64, category, title, content string, tags []string, priority int) (*Guideline, error) {
 	pid := db.GetProjectID(projectID)
 
-	tagsJSON, err := json.Marshal(tags)
+	tags = normalizeTags(tags)
+	tx, err := db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("marshaling tags: %w", err)
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	result, err := db.Exec(
+	result, err := tx.Exec(
 		"INSERT INTO guidelines (project_id, category, title, content, tags, priority) VALUES (?, ?, ?, ?, ?, ?)",
-		pid, category, title, content, string(tagsJSON), priority,
+		pid, category, title, content, tagsJSON(tags), priority,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("creating guideline: %w", err)
 	}
-
 	id, _ := result.LastInsertId()
+	if err := setTags(tx, "guideline", id, tags); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	db.notify(Change{Entity: "guideline", Op: OpCreate, ProjectID: pid, ID: id})
 	return db.GetGuideline(id)
 }
 
@@ -68,10 +80,11 @@ func (db *DB) UpdateGuideline(id int64, content *string, tags *[]string, priorit
 		sets = append(sets, "content = ?")
 		args = append(args, *content)
 	}
+	var newTags []string
 	if tags != nil {
-		tagsJSON, _ := json.Marshal(*tags)
+		newTags = normalizeTags(*tags)
 		sets = append(sets, "tags = ?")
-		args = append(args, string(tagsJSON))
+		args = append(args, tagsJSON(newTags))
 	}
 	if priority != nil {
 		sets = append(sets, "priority = ?")
@@ -85,107 +98,126 @@ func (db *DB) UpdateGuideline(id int64, content *string, tags *[]string, priorit
 	sets = append(sets, "updated_at = CURRENT_TIMESTAMP")
 	args = append(args, id)
 
-	_, err := db.Exec(
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
 		fmt.Sprintf("UPDATE guidelines SET %s WHERE id = ?", strings.Join(sets, ", ")),
 		args...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("updating guideline: %w", err)
 	}
+	if tags != nil {
+		if err := setTags(tx, "guideline", id, newTags); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 
-	return db.GetGuideline(id)
+	g, err := db.GetGuideline(id)
+	if err != nil {
+		return nil, err
+	}
+	db.notify(Change{Entity: "guideline", Op: OpUpdate, ProjectID: g.ProjectID, ID: id})
+	return g, nil
 }
 
+// Guideline orders: ListGuidelines groups them by category, SearchGuidelines
+// puts the most recently updated first
+const (
+	guidelineListOrder   = "priority DESC, category, title"
+	guidelineSearchOrder = "priority DESC, updated_at DESC, depth, id"
+)
+
 // ListGuidelines lists guidelines with optional category filter
 func (db *DB) ListGuidelines(projectID *int64, category *string) ([]Guideline, error) {
-	pid := db.GetProjectID(projectID)
-
-	var conditions []string
-	var args []interface{}
-
-	conditions = append(conditions, "project_id = ?")
-	args = append(args, pid)
+	guidelines, _, err := db.findGuidelines(projectID, false, "", category, TagFilter{}, guidelineListOrder, nil)
+	return guidelines, err
+}
 
-	if category != nil {
-		conditions = append(conditions, "category = ?")
-		args = append(args, *category)
+// ListGuidelinesPage lists a page of the guidelines ListGuidelines or, with
+// inherit, ListGuidelinesInherited returns, along with how many there are
+func (db *DB) ListGuidelinesPage(projectID *int64, category *string, inherit bool, page PageRequest) (*Page[Guideline], error) {
+	guidelines, total, err := db.findGuidelines(projectID, inherit, "", category, TagFilter{}, guidelineListOrder, &page)
+	if err != nil {
+		return nil, err
 	}
+	return NewPage(guidelines, total, page), nil
+}
 
-	query := fmt.Sprintf(
-		"SELECT id, project_id, category, title, content, tags, priority, created_at, updated_at FROM guidelines WHERE %s ORDER BY priority DESC, category, title",
-		strings.Join(conditions, " AND "),
-	)
+// SearchGuidelines searches guidelines by content and tags. A non-empty
+// query matches the title, content or tags; tags filters on the tags alone.
+func (db *DB) SearchGuidelines(projectID *int64, query string, category *string, tags TagFilter) ([]Guideline, error) {
+	guidelines, _, err := db.findGuidelines(projectID, false, query, category, tags, guidelineSearchOrder, nil)
+	return guidelines, err
+}
 
-	rows, err := db.Query(query, args...)
+// SearchGuidelinesPage searches like SearchGuidelines or, with inherit,
+// SearchGuidelinesInherited for a page of results, along with how many match
+func (db *DB) SearchGuidelinesPage(projectID *int64, query string, category *string, tags TagFilter, inherit bool, page PageRequest) (*Page[Guideline], error) {
+	guidelines, total, err := db.findGuidelines(projectID, inherit, query, category, tags, guidelineSearchOrder, &page)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var guidelines []Guideline
-	for rows.Next() {
-		var g Guideline
-		var tagsJSON sql.NullString
-		if err := rows.Scan(&g.ID, &g.ProjectID, &g.Category, &g.Title, &g.Content, &tagsJSON, &g.Priority, &g.CreatedAt, &g.UpdatedAt); err != nil {
-			return nil, err
-		}
-		if tagsJSON.Valid {
-			json.Unmarshal([]byte(tagsJSON.String), &g.Tags)
-		}
-		guidelines = append(guidelines, g)
-	}
-	return guidelines, rows.Err()
+	return NewPage(guidelines, total, page), nil
 }
 
-// SearchGuidelines searches guidelines by content and tags
-func (db *DB) SearchGuidelines(projectID *int64, query string, category *string) ([]Guideline, error) {
-	pid := db.GetProjectID(projectID)
-
-	var conditions []string
-	var args []interface{}
-
-	conditions = append(conditions, "project_id = ?")
-	args = append(args, pid)
+// findGuidelines lists the guidelines a project sees that match a search, in
+// order, and how many match. A nil page lists them all.
+func (db *DB) findGuidelines(projectID *int64, inherit bool, query string, category *string, tags TagFilter, order string, page *PageRequest) ([]Guideline, int, error) {
+	q, err := db.newScopedQuery(projectID, inherit, "guidelines",
+		"id, project_id, category, title, content, tags, priority, created_at, updated_at", "category", "title")
+	if err != nil {
+		return nil, 0, err
+	}
 
 	if query != "" {
-		conditions = append(conditions, "(content LIKE ? OR title LIKE ? OR tags LIKE ?)")
 		likeQuery := "%" + query + "%"
-		args = append(args, likeQuery, likeQuery, likeQuery)
+		q.where("(content LIKE ? OR title LIKE ? OR tags LIKE ?)", likeQuery, likeQuery, likeQuery)
 	}
 
 	if category != nil {
-		conditions = append(conditions, "category = ?")
-		args = append(args, *category)
+		q.where("category = ?", *category)
 	}
 
-	sqlQuery := fmt.Sprintf(
-		"SELECT id, project_id, category, title, content, tags, priority, created_at, updated_at FROM guidelines WHERE %s ORDER BY priority DESC, updated_at DESC",
-		strings.Join(conditions, " AND "),
-	)
-
-	rows, err := db.Query(sqlQuery, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	tagConditions, tagArgs := tags.conditions("guideline", "guidelines.id")
+	q.conditions = append(q.conditions, tagConditions...)
+	q.args = append(q.args, tagArgs...)
 
 	var guidelines []Guideline
-	for rows.Next() {
+	total, err := q.run(db, order, page, func(rows *sql.Rows) error {
 		var g Guideline
 		var tagsJSON sql.NullString
-		if err := rows.Scan(&g.ID, &g.ProjectID, &g.Category, &g.Title, &g.Content, &tagsJSON, &g.Priority, &g.CreatedAt, &g.UpdatedAt); err != nil {
-			return nil, err
+		if err := rows.Scan(&g.ID, &g.ProjectID, &g.Category, &g.Title, &g.Content, &tagsJSON, &g.Priority, &g.CreatedAt, &g.UpdatedAt, &g.Inherited); err != nil {
+			return err
 		}
 		if tagsJSON.Valid {
 			json.Unmarshal([]byte(tagsJSON.String), &g.Tags)
 		}
 		guidelines = append(guidelines, g)
-	}
-	return guidelines, rows.Err()
+		return nil
+	})
+	return guidelines, total, err
 }
 
 // DeleteGuideline deletes a guideline
 func (db *DB) DeleteGuideline(id int64) error {
-	_, err := db.Exec("DELETE FROM guidelines WHERE id = ?", id)
-	return err
+	var pid int64
+	if err := db.QueryRow("SELECT project_id FROM guidelines WHERE id = ?", id).Scan(&pid); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	if _, err := db.Exec("DELETE FROM guidelines WHERE id = ?", id); err != nil {
+		return err
+	}
+	db.notify(Change{Entity: "guideline", Op: OpDelete, ProjectID: pid, ID: id})
+	return nil
 }
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// A project sees its ancestors' guidelines, metadata and bookmarks as if they
+// were its own, unless it has its own row with the same key: a guideline's
+// category and title, a metadata key, or a bookmark's URL and section.
+
+// scopedQuery selects the rows of a table that a project sees: its own and,
+// when it inherits, its ancestors'. An ancestor's row is hidden when a nearer
+// project has a row with the same key columns.
+type scopedQuery struct {
+	table      string
+	columns    string   // selected ahead of the inherited flag
+	key        []string // columns that identify a row across projects
+	scope      []int64  // project IDs, nearest first
+	conditions []string
+	args       []interface{}
+}
+
+// newScopedQuery starts a query on a project's rows of table, and with
+// inherit its ancestors' rows too
+func (db *DB) newScopedQuery(projectID *int64, inherit bool, table, columns string, key ...string) (*scopedQuery, error) {
+	pid := db.GetProjectID(projectID)
+	scope := []int64{pid}
+	if inherit {
+		var err error
+		if scope, err = db.ProjectChain(pid); err != nil {
+			return nil, err
+		}
+	}
+	return &scopedQuery{table: table, columns: columns, key: key, scope: scope}, nil
+}
+
+// where adds a condition the rows must meet
+func (q *scopedQuery) where(condition string, args ...interface{}) {
+	q.conditions = append(q.conditions, condition)
+	q.args = append(q.args, args...)
+}
+
+// clauses returns the WITH clause that numbers the scope's projects by depth,
+// 0 for the project itself, and the FROM and WHERE clauses, with their
+// arguments
+func (q *scopedQuery) clauses() (string, string, []interface{}) {
+	var values []string
+	var args []interface{}
+	for depth, id := range q.scope {
+		values = append(values, "(?, ?)")
+		args = append(args, id, depth)
+	}
+	var same []string
+	for _, column := range q.key {
+		same = append(same, fmt.Sprintf("IFNULL(nearer.%[1]s, '') = IFNULL(%[2]s.%[1]s, '')", column, q.table))
+	}
+	conditions := append([]string{fmt.Sprintf(
+		"NOT EXISTS (SELECT 1 FROM %s nearer JOIN scope s ON s.scope_id = nearer.project_id WHERE s.depth < scope.depth AND %s)",
+		q.table, strings.Join(same, " AND "),
+	)}, q.conditions...)
+
+	with := "WITH scope (scope_id, depth) AS (VALUES " + strings.Join(values, ", ") + ")"
+	from := fmt.Sprintf(
+		"FROM %[1]s JOIN scope ON scope.scope_id = %[1]s.project_id WHERE %[2]s",
+		q.table, strings.Join(conditions, " AND "),
+	)
+	return with, from, append(args, q.args...)
+}
+
+// run scans the matching rows in order, each followed by whether it is
+// inherited. With a page it scans only that page and returns how many rows
+// match in total; without one it scans every row.
+func (q *scopedQuery) run(db *DB, order string, page *PageRequest, scan func(*sql.Rows) error) (int, error) {
+	with, from, args := q.clauses()
+	total := -1
+	if page != nil {
+		if err := db.QueryRow(with+" SELECT COUNT(*) "+from, args...).Scan(&total); err != nil {
+			return 0, err
+		}
+	}
+
+	query, args := pageClause(fmt.Sprintf("%s SELECT %s, scope.depth > 0 %s ORDER BY %s", with, q.columns, from, order), args, page)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	if total < 0 {
+		total = n
+	}
+	return total, rows.Err()
+}
+
+// ListGuidelinesInherited lists a project's guidelines together with those it
+// inherits, ordered like ListGuidelines
+func (db *DB) ListGuidelinesInherited(projectID *int64, category *string) ([]Guideline, error) {
+	guidelines, _, err := db.findGuidelines(projectID, true, "", category, TagFilter{}, guidelineListOrder, nil)
+	return guidelines, err
+}
+
+// SearchGuidelinesInherited searches a project's guidelines together with
+// those it inherits, ordered like SearchGuidelines
+func (db *DB) SearchGuidelinesInherited(projectID *int64, query string, category *string, tags TagFilter) ([]Guideline, error) {
+	guidelines, _, err := db.findGuidelines(projectID, true, query, category, tags, guidelineSearchOrder, nil)
+	return guidelines, err
+}
+
+// GetMetadataInherited gets a metadata value, falling back to the nearest
+// ancestor that sets the key
+func (db *DB) GetMetadataInherited(projectID *int64, key string) (*Metadata, error) {
+	chain, err := db.ProjectChain(db.GetProjectID(projectID))
+	if err != nil {
+		return nil, err
+	}
+	for depth, id := range chain {
+		m, err := db.GetMetadata(&id, key)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			m.Inherited = depth > 0
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListMetadataInherited lists a project's metadata together with the keys it
+// inherits, ordered by key
+func (db *DB) ListMetadataInherited(projectID *int64) ([]Metadata, error) {
+	items, _, err := db.findMetadata(projectID, true, nil)
+	return items, err
+}
+
+// SearchBookmarksInherited searches a project's bookmarks together with those
+// it inherits, newest first
+func (db *DB) SearchBookmarksInherited(projectID *int64, query string, tags TagFilter, docType *string) ([]Bookmark, error) {
+	bookmarks, _, err := db.findBookmarks(projectID, true, query, tags, docType, nil)
+	return bookmarks, err
+}
+
+// ListBookmarksInherited lists a project's bookmarks together with those it
+// inherits
+func (db *DB) ListBookmarksInherited(projectID *int64) ([]Bookmark, error) {
+	return db.SearchBookmarksInherited(projectID, "", TagFilter{}, nil)
+}
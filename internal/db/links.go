@@ -0,0 +1,299 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// LinkTypes lists the entity types a link can connect
+var LinkTypes = []string{"memory", "task", "guideline", "bookmark", "filetree"}
+
+// LinkRelations lists the relations a link can have. A link reads from its
+// source to its target: a memory explains a task, a task implements a
+// guideline, a memory supersedes an older one.
+var LinkRelations = []string{"relates_to", "explains", "supersedes", "implements"}
+
+// linkEntity describes the table behind a link type
+type linkEntity struct {
+	table string
+	title string // expression that summarizes a row
+}
+
+var linkEntities = map[string]linkEntity{
+	"memory":    {table: "memories", title: "substr(content, 1, 80)"},
+	"task":      {table: "tasks", title: "title"},
+	"guideline": {table: "guidelines", title: "title"},
+	"bookmark":  {table: "bookmarks", title: "title"},
+	"filetree":  {table: "filetree", title: "path"},
+}
+
+// Link is a typed relation from one entity to another
+type Link struct {
+	ID         int64     `json:"id"`
+	SourceType string    `json:"source_type"`
+	SourceID   int64     `json:"source_id"`
+	TargetType string    `json:"target_type"`
+	TargetID   int64     `json:"target_id"`
+	Relation   string    `json:"relation"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// LinkedEntity is the other end of a link, seen from one entity
+type LinkedEntity struct {
+	LinkID    int64  `json:"link_id"`
+	Relation  string `json:"relation"`
+	Direction string `json:"direction"` // outgoing when the entity is the link's source
+	Type      string `json:"type"`
+	ID        int64  `json:"id"`
+	Project   string `json:"project"`
+	Title     string `json:"title"`
+}
+
+const linkColumns = "id, source_type, source_id, target_type, target_id, relation, created_at"
+
+func scanLink(row interface{ Scan(...interface{}) error }) (*Link, error) {
+	l := &Link{}
+	if err := row.Scan(&l.ID, &l.SourceType, &l.SourceID, &l.TargetType, &l.TargetID, &l.Relation, &l.CreatedAt); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func checkLinkType(typ string) error {
+	if _, ok := linkEntities[typ]; !ok {
+		return fmt.Errorf("invalid entity type %q (expected %s)", typ, strings.Join(LinkTypes, ", "))
+	}
+	return nil
+}
+
+// EntityExists reports whether an entity of a link type exists
+func (db *DB) EntityExists(typ string, id int64) (bool, error) {
+	if err := checkLinkType(typ); err != nil {
+		return false, err
+	}
+	var found int
+	err := db.QueryRow("SELECT 1 FROM "+linkEntities[typ].table+" WHERE id = ?", id).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CreateLink links two entities, which may belong to different projects.
+// Creating a link that already exists returns it unchanged.
+func (db *DB) CreateLink(sourceType string, sourceID int64, targetType string, targetID int64, relation string) (*Link, error) {
+	if !slices.Contains(LinkRelations, relation) {
+		return nil, fmt.Errorf("invalid relation %q (expected %s)", relation, strings.Join(LinkRelations, ", "))
+	}
+	if sourceType == targetType && sourceID == targetID {
+		return nil, fmt.Errorf("cannot link %s %d to itself", sourceType, sourceID)
+	}
+	for _, end := range []struct {
+		typ string
+		id  int64
+	}{{sourceType, sourceID}, {targetType, targetID}} {
+		ok, err := db.EntityExists(end.typ, end.id)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s %d not found", end.typ, end.id)
+		}
+	}
+
+	_, err := db.Exec(
+		"INSERT INTO links (source_type, source_id, target_type, target_id, relation) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING",
+		sourceType, sourceID, targetType, targetID, relation,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating link: %w", err)
+	}
+	return scanLink(db.QueryRow(
+		"SELECT "+linkColumns+" FROM links WHERE source_type = ? AND source_id = ? AND target_type = ? AND target_id = ? AND relation = ?",
+		sourceType, sourceID, targetType, targetID, relation,
+	))
+}
+
+// DeleteLink deletes a link by ID, reporting whether it existed
+func (db *DB) DeleteLink(id int64) (bool, error) {
+	result, err := db.Exec("DELETE FROM links WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// GetLinks lists an entity's links in both directions, oldest first. A
+// non-empty relation keeps only links of that relation.
+func (db *DB) GetLinks(typ string, id int64, relation string) ([]LinkedEntity, error) {
+	links, err := db.linksFor(typ, []int64{id}, relation, nil)
+	if err != nil {
+		return nil, err
+	}
+	if links[id] == nil {
+		return []LinkedEntity{}, nil
+	}
+	return links[id], nil
+}
+
+// GetLinksPage lists a page of the links GetLinks returns, along with how
+// many there are
+func (db *DB) GetLinksPage(typ string, id int64, relation string, page PageRequest) (*Page[LinkedEntity], error) {
+	if err := checkLinkType(typ); err != nil {
+		return nil, err
+	}
+	query, args := linkQuery(typ, []int64{id}, relation)
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM ("+query+")", args...).Scan(&total); err != nil {
+		return nil, err
+	}
+	links, err := db.linksFor(typ, []int64{id}, relation, &page)
+	if err != nil {
+		return nil, err
+	}
+	return NewPage(links[id], total, page), nil
+}
+
+// LinksFor returns the links of several entities of one type, keyed by
+// entity ID
+func (db *DB) LinksFor(typ string, ids ...int64) (map[int64][]LinkedEntity, error) {
+	return db.linksFor(typ, ids, "", nil)
+}
+
+// linkQuery returns the query that selects the links of entities of one type
+// in both directions, optionally of one relation, with its arguments
+func linkQuery(typ string, ids []int64, relation string) (string, []interface{}) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := []interface{}{typ}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	var where string
+	if relation != "" {
+		where = " AND relation = ?"
+		args = append(args, relation)
+	}
+	args = append(args, args...)
+	return fmt.Sprintf(
+		`SELECT id, relation, 'outgoing', source_id, target_type, target_id FROM links WHERE source_type = ? AND source_id IN (%[1]s)%[2]s
+		UNION ALL
+		SELECT id, relation, 'incoming', target_id, source_type, source_id FROM links WHERE target_type = ? AND target_id IN (%[1]s)%[2]s`,
+		placeholders, where,
+	), args
+}
+
+// linksFor returns the links of several entities of one type, keyed by
+// entity ID, or a page of them in link order
+func (db *DB) linksFor(typ string, ids []int64, relation string, page *PageRequest) (map[int64][]LinkedEntity, error) {
+	if err := checkLinkType(typ); err != nil {
+		return nil, err
+	}
+	result := make(map[int64][]LinkedEntity, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	query, args := linkQuery(typ, ids, relation)
+	query, args = pageClause(query+" ORDER BY id", args, page)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	type entry struct {
+		owner int64
+		link  LinkedEntity
+	}
+	var entries []entry
+	others := map[string][]int64{}
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.link.LinkID, &e.link.Relation, &e.link.Direction, &e.owner, &e.link.Type, &e.link.ID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entries = append(entries, e)
+		others[e.link.Type] = append(others[e.link.Type], e.link.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	summaries := map[string]map[int64]LinkedEntity{}
+	for otherType, otherIDs := range others {
+		if summaries[otherType], err = db.summarizeEntities(otherType, otherIDs); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range entries {
+		s := summaries[e.link.Type][e.link.ID]
+		e.link.Project, e.link.Title = s.Project, s.Title
+		result[e.owner] = append(result[e.owner], e.link)
+	}
+	return result, nil
+}
+
+// summarizeEntities looks up the project and title of entities of one type
+func (db *DB) summarizeEntities(typ string, ids []int64) (map[int64]LinkedEntity, error) {
+	entity, ok := linkEntities[typ]
+	if !ok {
+		return nil, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := db.Query(fmt.Sprintf(
+		"SELECT e.id, p.slug, %s FROM %s e JOIN projects p ON p.id = e.project_id WHERE e.id IN (%s)",
+		entity.title, entity.table, strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "),
+	), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int64]LinkedEntity, len(ids))
+	for rows.Next() {
+		var s LinkedEntity
+		if err := rows.Scan(&s.ID, &s.Project, &s.Title); err != nil {
+			return nil, err
+		}
+		result[s.ID] = s
+	}
+	return result, rows.Err()
+}
+
+// listProjectLinks returns the links between entities of one project, for
+// export
+func (db *DB) listProjectLinks(projectID int64) ([]Link, error) {
+	var entities []string
+	var args []interface{}
+	for _, typ := range LinkTypes {
+		entities = append(entities, fmt.Sprintf("SELECT '%s', id FROM %s WHERE project_id = ?", typ, linkEntities[typ].table))
+		args = append(args, projectID)
+	}
+	inProject := strings.Join(entities, " UNION ALL ")
+	rows, err := db.Query(fmt.Sprintf(
+		"SELECT %s FROM links WHERE (source_type, source_id) IN (%s) AND (target_type, target_id) IN (%s) ORDER BY id",
+		linkColumns, inProject, inProject,
+	), append(args, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []Link
+	for rows.Next() {
+		l, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *l)
+	}
+	return links, rows.Err()
+}
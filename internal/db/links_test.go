@@ -0,0 +1,105 @@
+package db
+
+import "testing"
+
+// TestLinks verifies creating, listing and deleting links, their cleanup
+// when an entity is deleted, and their export
+func TestLinks(t *testing.T) {
+	database, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	p, _ := database.CreateProject("app", "App", "")
+	memory, _ := database.CreateMemory(&p.ID, "Retries hide the timeout bug", nil)
+	task, _ := database.CreateTask(&p.ID, nil, "Fix timeout", "", 0)
+	file, _ := database.AnnotateFile(&p.ID, "internal/client.go", "HTTP client", false)
+	guideline, _ := database.CreateGuideline(nil, "style", "Wrap errors", "Use %w", nil, 0)
+
+	explains, err := database.CreateLink("memory", memory.ID, "task", task.ID, "explains")
+	if err != nil {
+		t.Fatalf("CreateLink failed: %v", err)
+	}
+	if again, _ := database.CreateLink("memory", memory.ID, "task", task.ID, "explains"); again == nil || again.ID != explains.ID {
+		t.Errorf("Expected an existing link to be returned, got %+v", again)
+	}
+	database.CreateLink("memory", memory.ID, "filetree", file.ID, "relates_to")
+	database.CreateLink("task", task.ID, "guideline", guideline.ID, "implements")
+
+	for _, bad := range []struct {
+		name                   string
+		sourceType, targetType string
+		sourceID, targetID     int64
+		relation               string
+	}{
+		{"relation", "memory", "task", memory.ID, task.ID, "blocks"},
+		{"type", "project", "task", p.ID, task.ID, "relates_to"},
+		{"missing entity", "memory", "task", memory.ID, 999, "relates_to"},
+		{"self link", "task", "task", task.ID, task.ID, "relates_to"},
+	} {
+		if _, err := database.CreateLink(bad.sourceType, bad.sourceID, bad.targetType, bad.targetID, bad.relation); err == nil {
+			t.Errorf("Expected an error for an invalid %s", bad.name)
+		}
+	}
+
+	links, err := database.GetLinks("task", task.ID, "")
+	if err != nil {
+		t.Fatalf("GetLinks failed: %v", err)
+	}
+	if len(links) != 2 {
+		t.Fatalf("Expected 2 links, got %+v", links)
+	}
+	if l := links[0]; l.Direction != "incoming" || l.Type != "memory" || l.ID != memory.ID || l.Relation != "explains" || l.Project != "app" {
+		t.Errorf("Unexpected incoming link: %+v", l)
+	}
+	if l := links[1]; l.Direction != "outgoing" || l.Type != "guideline" || l.Title != "Wrap errors" || l.Project != "global" {
+		t.Errorf("Unexpected outgoing link: %+v", l)
+	}
+	if links, _ := database.GetLinks("task", task.ID, "implements"); len(links) != 1 {
+		t.Errorf("Expected the relation filter to keep 1 link, got %+v", links)
+	}
+
+	t.Run("export", func(t *testing.T) {
+		data, err := database.ExportProjects(p.ID)
+		if err != nil {
+			t.Fatalf("ExportProjects failed: %v", err)
+		}
+		if n := len(data.Projects[0].Links); n != 2 {
+			t.Fatalf("Expected the 2 links within the project, got %d", n)
+		}
+
+		dst, _ := Open(":memory:")
+		defer dst.Close()
+		res, err := dst.Import(data, ImportOptions{})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if res.Created["links"] != 2 {
+			t.Errorf("Expected 2 links imported, got %v", res.Created)
+		}
+		app, _ := dst.GetProjectBySlug("app")
+		imported, _ := dst.SearchMemories(&app.ID, "", MemoryFilter{})
+		if links, _ := dst.GetLinks("memory", imported[0].ID, ""); len(links) != 2 || links[1].Title != "internal/client.go" {
+			t.Errorf("Expected links remapped to the imported entities, got %+v", links)
+		}
+	})
+
+	t.Run("cleanup", func(t *testing.T) {
+		if ok, _ := database.DeleteLink(explains.ID); !ok {
+			t.Error("Expected DeleteLink to report the deleted link")
+		}
+		if ok, _ := database.DeleteLink(explains.ID); ok {
+			t.Error("Expected DeleteLink to report a missing link")
+		}
+		if err := database.DeleteMemory(memory.ID); err != nil {
+			t.Fatalf("DeleteMemory failed: %v", err)
+		}
+		if links, _ := database.GetLinks("filetree", file.ID, ""); len(links) != 0 {
+			t.Errorf("Expected links of a deleted memory to be removed, got %+v", links)
+		}
+		if links, _ := database.GetLinks("task", task.ID, ""); len(links) != 1 {
+			t.Errorf("Expected other links to be kept, got %+v", links)
+		}
+	})
+}
@@ -4,85 +4,520 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 )
 
 // Memory represents a stored memory
 type Memory struct {
-	ID        int64     `json:"id"`
-	ProjectID int64     `json:"project_id"`
-	Content   string    `json:"content"`
-	Keywords  []string  `json:"keywords"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         int64          `json:"id"`
+	ProjectID  int64          `json:"project_id"`
+	Content    string         `json:"content"`
+	Keywords   []string       `json:"keywords"`
+	Pinned     bool           `json:"pinned,omitempty"`
+	Importance int            `json:"importance"`
+	ExpiresAt  *time.Time     `json:"expires_at,omitempty"`
+	ArchivedAt *time.Time     `json:"archived_at,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	Score      float64        `json:"score,omitempty"`   // search relevance, higher is better
+	Snippet    string         `json:"snippet,omitempty"` // highlighted match from full-text search
+	Links      []LinkedEntity `json:"links,omitempty"`
+}
+
+// Memory importance ranges from MinImportance to MaxImportance
+const (
+	MinImportance     = 1
+	MaxImportance     = 5
+	DefaultImportance = 3
+)
+
+// importanceWeight scales a memory's relevance by its importance: 0.5 for
+// the least important, 1 by default and 1.5 for the most important
+func importanceWeight(importance int) float64 {
+	return float64(1+importance) / 4
+}
+
+// liveMemory is the condition for memories that are neither archived nor
+// expired
+const liveMemory = "m.archived_at IS NULL AND (m.expires_at IS NULL OR m.expires_at > CURRENT_TIMESTAMP)"
+
+// memoryColumns lists the columns scanMemory reads, for a query over
+// memories aliased as m
+const memoryColumns = "m.id, m.project_id, m.content, m.keywords, m.pinned, m.importance, m.expires_at, m.archived_at, m.created_at, m.updated_at"
+
+// scanMemory scans a row selected with memoryColumns followed by extra
+func scanMemory(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*Memory, error) {
+	m := &Memory{}
+	var keywordsJSON sql.NullString
+	var expiresAt, archivedAt sql.NullTime
+	dest := append([]interface{}{&m.ID, &m.ProjectID, &m.Content, &keywordsJSON, &m.Pinned, &m.Importance, &expiresAt, &archivedAt, &m.CreatedAt, &m.UpdatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if keywordsJSON.Valid {
+		json.Unmarshal([]byte(keywordsJSON.String), &m.Keywords)
+	}
+	if expiresAt.Valid {
+		m.ExpiresAt = &expiresAt.Time
+	}
+	if archivedAt.Valid {
+		m.ArchivedAt = &archivedAt.Time
+	}
+	return m, nil
+}
+
+// MemoryOptions holds the optional ranking and lifetime fields of a memory.
+// Nil fields are left unchanged, or take their defaults on create; a zero
+// ExpiresAt clears the expiry.
+type MemoryOptions struct {
+	ExpiresAt  *time.Time
+	Pinned     *bool
+	Importance *int
 }
 
 // CreateMemory creates a new memory
 func (db *DB) CreateMemory(projectID *int64, content string, keywords []string) (*Memory, error) {
+	return db.CreateMemoryWithOptions(projectID, content, keywords, MemoryOptions{})
+}
+
+// CreateMemoryWithOptions creates a new memory with an expiry, pin or
+// importance
+func (db *DB) CreateMemoryWithOptions(projectID *int64, content string, keywords []string, opts MemoryOptions) (*Memory, error) {
 	pid := db.GetProjectID(projectID)
 
-	keywordsJSON, err := json.Marshal(keywords)
+	keywords = normalizeTags(keywords)
+	importance := DefaultImportance
+	if opts.Importance != nil {
+		importance = *opts.Importance
+	}
+	if err := checkImportance(importance); err != nil {
+		return nil, err
+	}
+	pinned := opts.Pinned != nil && *opts.Pinned
+	var expiresAt interface{}
+	if opts.ExpiresAt != nil && !opts.ExpiresAt.IsZero() {
+		expiresAt = sqliteTime(*opts.ExpiresAt)
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("marshaling keywords: %w", err)
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	result, err := db.Exec(
-		"INSERT INTO memories (project_id, content, keywords) VALUES (?, ?, ?)",
-		pid, content, string(keywordsJSON),
+	result, err := tx.Exec(
+		"INSERT INTO memories (project_id, content, content_hash, keywords, pinned, importance, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		pid, content, memoryHash(content), tagsJSON(keywords), pinned, importance, expiresAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("creating memory: %w", err)
 	}
-
 	id, _ := result.LastInsertId()
+	if err := setTags(tx, "memory", id, keywords); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	db.notify(Change{Entity: "memory", Op: OpCreate, ProjectID: pid, ID: id})
 	return db.GetMemory(id)
 }
 
+func checkImportance(importance int) error {
+	if importance < MinImportance || importance > MaxImportance {
+		return fmt.Errorf("importance must be between %d and %d", MinImportance, MaxImportance)
+	}
+	return nil
+}
+
 // GetMemory gets a memory by ID
 func (db *DB) GetMemory(id int64) (*Memory, error) {
-	m := &Memory{}
+	return scanMemory(db.QueryRow("SELECT "+memoryColumns+" FROM memories m WHERE m.id = ?", id))
+}
+
+// PruneMemories archives a project's expired memories, or every project's
+// when projectID is nil, in one transaction and returns the IDs it archived.
+// Archived memories are kept but hidden from searches unless expired ones are
+// included.
+func (db *DB) PruneMemories(projectID *int64, dryRun bool) ([]int64, error) {
+	where := " WHERE archived_at IS NULL AND expires_at <= CURRENT_TIMESTAMP"
+	var args []interface{}
+	if projectID != nil {
+		where += " AND project_id = ?"
+		args = append(args, *projectID)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE memories SET archived_at = CURRENT_TIMESTAMP" + where + " RETURNING id, project_id"
+	if dryRun {
+		query = "SELECT id, project_id FROM memories" + where
+	}
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("archiving memories: %w", err)
+	}
+	var changes []Change
+	for rows.Next() {
+		c := Change{Entity: "memory", Op: OpUpdate}
+		if err := rows.Scan(&c.ID, &c.ProjectID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("archiving memories: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	ids := []int64{}
+	for _, c := range changes {
+		ids = append(ids, c.ID)
+	}
+	slices.Sort(ids)
+	if !dryRun {
+		for _, c := range changes {
+			db.notify(c)
+		}
+	}
+	return ids, nil
+}
+
+// MemoryRevision is a prior version of a memory, recorded before each update
+type MemoryRevision struct {
+	ID         int64     `json:"id"`
+	MemoryID   int64     `json:"memory_id"`
+	Content    string    `json:"content"`
+	Keywords   []string  `json:"keywords"`
+	ValidFrom  time.Time `json:"valid_from"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// UpdateMemory patches a memory's content and keywords, recording the previous
+// revision in the history table. Content cannot be blank. keywords replaces
+// the whole list; addKeywords and removeKeywords are then applied on top of it.
+func (db *DB) UpdateMemory(id int64, content *string, keywords *[]string, addKeywords, removeKeywords []string) (*Memory, error) {
+	return db.UpdateMemoryWithOptions(id, content, keywords, addKeywords, removeKeywords, MemoryOptions{})
+}
+
+// UpdateMemoryWithOptions patches a memory as UpdateMemory does and changes
+// its expiry, pin or importance in the same transaction. Option changes are
+// not recorded in the memory's history; changing the expiry restores an
+// archived memory.
+func (db *DB) UpdateMemoryWithOptions(id int64, content *string, keywords *[]string, addKeywords, removeKeywords []string, opts MemoryOptions) (*Memory, error) {
+	if content != nil && strings.TrimSpace(*content) == "" {
+		return nil, fmt.Errorf("content cannot be empty")
+	}
+
+	var sets []string
+	var args []interface{}
+
+	if opts.ExpiresAt != nil {
+		var expiresAt interface{}
+		if !opts.ExpiresAt.IsZero() {
+			expiresAt = sqliteTime(*opts.ExpiresAt)
+		}
+		sets = append(sets, "expires_at = ?", "archived_at = NULL")
+		args = append(args, expiresAt)
+	}
+	if opts.Pinned != nil {
+		sets = append(sets, "pinned = ?")
+		args = append(args, *opts.Pinned)
+	}
+	if opts.Importance != nil {
+		if err := checkImportance(*opts.Importance); err != nil {
+			return nil, err
+		}
+		sets = append(sets, "importance = ?")
+		args = append(args, *opts.Importance)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var currentContent string
 	var keywordsJSON sql.NullString
-	err := db.QueryRow(
-		"SELECT id, project_id, content, keywords, created_at, updated_at FROM memories WHERE id = ?",
-		id,
-	).Scan(&m.ID, &m.ProjectID, &m.Content, &keywordsJSON, &m.CreatedAt, &m.UpdatedAt)
+	err = tx.QueryRow("SELECT content, keywords FROM memories WHERE id = ?", id).Scan(&currentContent, &keywordsJSON)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("memory %d not found", id)
+		}
 		return nil, err
 	}
+	var currentKeywords []string
 	if keywordsJSON.Valid {
-		json.Unmarshal([]byte(keywordsJSON.String), &m.Keywords)
+		json.Unmarshal([]byte(keywordsJSON.String), &currentKeywords)
+	}
+
+	newContent := currentContent
+	if content != nil {
+		newContent = *content
+	}
+	newKeywords := currentKeywords
+	if keywords != nil {
+		newKeywords = *keywords
+	}
+	newKeywords = patchKeywords(normalizeTags(newKeywords), normalizeTags(addKeywords), normalizeTags(removeKeywords))
+
+	revised := newContent != currentContent || !equalStrings(newKeywords, currentKeywords)
+	if !revised && len(sets) == 0 {
+		tx.Rollback()
+		return db.GetMemory(id)
 	}
+
+	if revised {
+		_, err = tx.Exec(
+			"INSERT INTO memory_history (memory_id, content, keywords, valid_from) SELECT id, content, keywords, updated_at FROM memories WHERE id = ?",
+			id,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("recording memory history: %w", err)
+		}
+
+		_, err = tx.Exec(
+			"UPDATE memories SET content = ?, content_hash = ?, keywords = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			newContent, memoryHash(newContent), tagsJSON(newKeywords), id,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("updating memory: %w", err)
+		}
+		if err := setTags(tx, "memory", id, newKeywords); err != nil {
+			return nil, err
+		}
+	}
+	if len(sets) > 0 {
+		if _, err := tx.Exec(
+			fmt.Sprintf("UPDATE memories SET %s WHERE id = ?", strings.Join(sets, ", ")),
+			append(args, id)...,
+		); err != nil {
+			return nil, fmt.Errorf("updating memory: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	m, err := db.GetMemory(id)
+	if err != nil {
+		return nil, err
+	}
+	db.notify(Change{Entity: "memory", Op: OpUpdate, ProjectID: m.ProjectID, ID: id})
 	return m, nil
 }
 
-// SearchMemories searches memories by content and/or keywords
-func (db *DB) SearchMemories(projectID *int64, query string, keywords []string, limit int) ([]Memory, error) {
-	pid := db.GetProjectID(projectID)
+// GetMemoryHistory lists the prior revisions of a memory, newest first
+func (db *DB) GetMemoryHistory(id int64) ([]MemoryRevision, error) {
+	return db.memoryHistory(id, nil)
+}
+
+// GetMemoryHistoryPage lists a page of a memory's prior revisions, newest
+// first, along with how many there are
+func (db *DB) GetMemoryHistoryPage(id int64, page PageRequest) (*Page[MemoryRevision], error) {
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM memory_history WHERE memory_id = ?", id).Scan(&total); err != nil {
+		return nil, err
+	}
+	revisions, err := db.memoryHistory(id, &page)
+	if err != nil {
+		return nil, err
+	}
+	return NewPage(revisions, total, page), nil
+}
+
+// memoryHistory lists a memory's prior revisions, or a page of them
+func (db *DB) memoryHistory(id int64, page *PageRequest) ([]MemoryRevision, error) {
+	query, args := pageClause(
+		"SELECT id, memory_id, content, keywords, valid_from, replaced_at FROM memory_history WHERE memory_id = ? ORDER BY id DESC",
+		[]interface{}{id}, page,
+	)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []MemoryRevision
+	for rows.Next() {
+		var r MemoryRevision
+		var keywordsJSON sql.NullString
+		var validFrom sql.NullTime
+		if err := rows.Scan(&r.ID, &r.MemoryID, &r.Content, &keywordsJSON, &validFrom, &r.ReplacedAt); err != nil {
+			return nil, err
+		}
+		if keywordsJSON.Valid {
+			json.Unmarshal([]byte(keywordsJSON.String), &r.Keywords)
+		}
+		r.ValidFrom = validFrom.Time
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// patchKeywords adds and removes individual keywords, keeping order and
+// dropping duplicates
+func patchKeywords(keywords, add, remove []string) []string {
+	removed := make(map[string]bool, len(remove))
+	for _, kw := range remove {
+		removed[kw] = true
+	}
+
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(keywords)+len(add))
+	for _, list := range [][]string{keywords, add} {
+		for _, kw := range list {
+			if kw == "" || removed[kw] || seen[kw] {
+				continue
+			}
+			seen[kw] = true
+			result = append(result, kw)
+		}
+	}
+	return result
+}
 
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// MemoryFilter narrows a memory search. Expired and archived memories are
+// hidden unless IncludeExpired is set.
+type MemoryFilter struct {
+	Keywords       TagFilter
+	IncludeExpired bool
+	Limit          int
+	Offset         int
+}
+
+// SearchMemories searches memories by content and/or keywords.
+//
+// A non-empty query is matched against the full-text index and supports the
+// FTS5 query syntax: "exact phrases", prefix* terms and AND/OR/NOT operators.
+// Results are ranked by BM25 relevance weighted by importance and carry a
+// highlighted snippet. Without a query, memories are returned most important
+// first, then most recently updated. Pinned memories always come first.
+func (db *DB) SearchMemories(projectID *int64, query string, f MemoryFilter) ([]Memory, error) {
+	var memories []Memory
+	err := withFTSQuery(query, func(match string) error {
+		var err error
+		memories, err = db.searchMemories(projectID, match, f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return memories, nil
+}
+
+// SearchMemoriesPage searches like SearchMemories for a page of results, in
+// place of the filter's Limit and Offset, along with how many match in total
+func (db *DB) SearchMemoriesPage(projectID *int64, query string, f MemoryFilter, page PageRequest) (*Page[Memory], error) {
+	f.Limit, f.Offset = page.limit(), page.Offset
+	var memories []Memory
+	var total int
+	err := withFTSQuery(query, func(match string) error {
+		from, where, args := memoryConditions(db.GetProjectID(projectID), match, f)
+		if err := db.QueryRow("SELECT COUNT(*) "+from+" WHERE "+where, args...).Scan(&total); err != nil {
+			return err
+		}
+		var err error
+		memories, err = db.searchMemories(projectID, match, f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewPage(memories, total, page), nil
+}
+
+// withFTSQuery runs search with a trimmed full-text query. Plain text with
+// stray punctuation is not valid FTS5 syntax, so a failed search is retried
+// with every term quoted as a literal.
+func withFTSQuery(query string, search func(match string) error) error {
+	query = strings.TrimSpace(query)
+	err := search(query)
+	if err != nil && query != "" {
+		if quoted := quoteFTSQuery(query); quoted != query {
+			return search(quoted)
+		}
+	}
+	return err
+}
+
+// memoryConditions returns the FROM and WHERE clauses that select a
+// project's memories matching a full-text query and the filter
+func memoryConditions(pid int64, match string, f MemoryFilter) (string, string, []interface{}) {
 	var conditions []string
 	var args []interface{}
 
-	conditions = append(conditions, "project_id = ?")
+	conditions = append(conditions, "m.project_id = ?")
 	args = append(args, pid)
 
-	if query != "" {
-		conditions = append(conditions, "content LIKE ?")
-		args = append(args, "%"+query+"%")
+	if !f.IncludeExpired {
+		conditions = append(conditions, liveMemory)
 	}
 
-	for _, kw := range keywords {
-		conditions = append(conditions, "keywords LIKE ?")
-		args = append(args, "%\""+kw+"\"%")
+	from := "FROM memories m"
+	if match != "" {
+		from = "FROM memories_fts JOIN memories m ON m.id = memories_fts.rowid"
+		conditions = append(conditions, "memories_fts MATCH ?")
+		args = append(args, match)
 	}
 
-	sqlQuery := fmt.Sprintf(
-		"SELECT id, project_id, content, keywords, created_at, updated_at FROM memories WHERE %s ORDER BY updated_at DESC",
-		strings.Join(conditions, " AND "),
-	)
+	tagConditions, tagArgs := f.Keywords.conditions("memory", "m.id")
+	conditions = append(conditions, tagConditions...)
+	args = append(args, tagArgs...)
+
+	return from, strings.Join(conditions, " AND "), args
+}
 
-	if limit > 0 {
-		sqlQuery += fmt.Sprintf(" LIMIT %d", limit)
+func (db *DB) searchMemories(projectID *int64, match string, f MemoryFilter) ([]Memory, error) {
+	from, where, args := memoryConditions(db.GetProjectID(projectID), match, f)
+
+	var sqlQuery string
+	if match != "" {
+		sqlQuery = fmt.Sprintf(
+			`SELECT %s, bm25(memories_fts, 1.0, 2.0) * (1 + m.importance) / 4.0 AS rank,
+				snippet(memories_fts, 0, '**', '**', '…', 16)
+			%s WHERE %s ORDER BY m.pinned DESC, rank, m.updated_at DESC, m.id DESC`,
+			memoryColumns, from, where,
+		)
+	} else {
+		sqlQuery = fmt.Sprintf(
+			`SELECT %s, 0.0, '' %s
+			WHERE %s ORDER BY m.pinned DESC, m.importance DESC, m.updated_at DESC, m.id DESC`,
+			memoryColumns, from, where,
+		)
+	}
+
+	if f.Limit > 0 || f.Offset > 0 {
+		limit := f.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		sqlQuery += " LIMIT ? OFFSET ?"
+		args = append(args, limit, f.Offset)
 	}
 
 	rows, err := db.Query(sqlQuery, args...)
@@ -93,21 +528,52 @@ func (db *DB) SearchMemories(projectID *int64, query string, keywords []string,
 
 	var memories []Memory
 	for rows.Next() {
-		var m Memory
-		var keywordsJSON sql.NullString
-		if err := rows.Scan(&m.ID, &m.ProjectID, &m.Content, &keywordsJSON, &m.CreatedAt, &m.UpdatedAt); err != nil {
+		var rank float64
+		var snippet string
+		m, err := scanMemory(rows, &rank, &snippet)
+		if err != nil {
 			return nil, err
 		}
-		if keywordsJSON.Valid {
-			json.Unmarshal([]byte(keywordsJSON.String), &m.Keywords)
-		}
-		memories = append(memories, m)
+		// bm25 is lower-is-better; flip it so higher scores are more relevant
+		m.Score = -rank
+		m.Snippet = snippet
+		memories = append(memories, *m)
 	}
 	return memories, rows.Err()
 }
 
+// quoteFTSQuery turns free text into an FTS5 query that matches every term
+// literally, keeping a trailing * as a prefix match.
+func quoteFTSQuery(query string) string {
+	fields := strings.Fields(query)
+	terms := make([]string, 0, len(fields))
+	for _, f := range fields {
+		prefix := strings.HasSuffix(f, "*")
+		f = strings.Trim(f, "*\"")
+		if f == "" {
+			continue
+		}
+		term := `"` + strings.ReplaceAll(f, `"`, `""`) + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " ")
+}
+
 // DeleteMemory deletes a memory by ID
 func (db *DB) DeleteMemory(id int64) error {
-	_, err := db.Exec("DELETE FROM memories WHERE id = ?", id)
-	return err
+	var pid int64
+	if err := db.QueryRow("SELECT project_id FROM memories WHERE id = ?", id).Scan(&pid); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	if _, err := db.Exec("DELETE FROM memories WHERE id = ?", id); err != nil {
+		return err
+	}
+	db.notify(Change{Entity: "memory", Op: OpDelete, ProjectID: pid, ID: id})
+	return nil
 }
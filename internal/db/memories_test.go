@@ -0,0 +1,187 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMemoryExpiryAndRanking verifies that expired memories are hidden and
+// pruned, and that pinned and important memories rank first
+func TestMemoryExpiryAndRanking(t *testing.T) {
+	database, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(24 * time.Hour)
+	pinned, low, high := true, 1, 5
+
+	create := func(content string, opts MemoryOptions) *Memory {
+		m, err := database.CreateMemoryWithOptions(nil, content, nil, opts)
+		if err != nil {
+			t.Fatalf("CreateMemoryWithOptions failed: %v", err)
+		}
+		return m
+	}
+	plain := create("cache layer uses redis", MemoryOptions{})
+	trivial := create("cache layer debug note", MemoryOptions{Importance: &low})
+	core := create("cache layer architecture", MemoryOptions{Importance: &high})
+	pin := create("cache layer owner", MemoryOptions{Pinned: &pinned, Importance: &low})
+	stale := create("cache layer workaround", MemoryOptions{ExpiresAt: &past})
+	soon := create("cache layer freeze", MemoryOptions{ExpiresAt: &future})
+
+	if plain.Importance != DefaultImportance || plain.Pinned || plain.ExpiresAt != nil {
+		t.Errorf("Expected defaults, got %+v", plain)
+	}
+	if soon.ExpiresAt == nil || soon.ExpiresAt.Unix() != future.Unix() {
+		t.Errorf("Expected expiry to round-trip, got %v", soon.ExpiresAt)
+	}
+	if _, err := database.CreateMemoryWithOptions(nil, "x", nil, MemoryOptions{Importance: new(int)}); err == nil {
+		t.Error("Expected an error for importance 0")
+	}
+
+	ids := func(memories []Memory) []int64 {
+		var ids []int64
+		for _, m := range memories {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+
+	t.Run("ranking", func(t *testing.T) {
+		for _, query := range []string{"", "cache layer"} {
+			memories, err := database.SearchMemories(nil, query, MemoryFilter{})
+			if err != nil {
+				t.Fatalf("SearchMemories(%q) failed: %v", query, err)
+			}
+			got := ids(memories)
+			if len(got) != 5 || got[0] != pin.ID || got[1] != core.ID || got[4] != trivial.ID {
+				t.Errorf("Query %q: expected pinned, important, ..., trivial, got %v", query, got)
+			}
+		}
+	})
+
+	t.Run("expired hidden", func(t *testing.T) {
+		memories, _ := database.SearchMemories(nil, "workaround", MemoryFilter{})
+		if len(memories) != 0 {
+			t.Errorf("Expected expired memory to be hidden, got %v", ids(memories))
+		}
+		memories, _ = database.SearchMemories(nil, "workaround", MemoryFilter{IncludeExpired: true})
+		if len(memories) != 1 || memories[0].ID != stale.ID {
+			t.Errorf("Expected expired memory with IncludeExpired, got %v", ids(memories))
+		}
+		res, err := database.SearchEverything(SearchAllOptions{Query: "workaround", Types: []string{"memory"}})
+		if err != nil {
+			t.Fatalf("SearchEverything failed: %v", err)
+		}
+		if res.Total != 0 {
+			t.Errorf("Expected search_all to skip expired memories, got %+v", res.Results)
+		}
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		archived, err := database.PruneMemories(nil, true)
+		if err != nil {
+			t.Fatalf("PruneMemories failed: %v", err)
+		}
+		if len(archived) != 1 || archived[0] != stale.ID {
+			t.Errorf("Expected dry run to list the expired memory, got %v", archived)
+		}
+		if m, _ := database.GetMemory(stale.ID); m.ArchivedAt != nil {
+			t.Error("Expected dry run not to archive")
+		}
+
+		if archived, _ = database.PruneMemories(nil, false); len(archived) != 1 {
+			t.Errorf("Expected one memory archived, got %v", archived)
+		}
+		if m, _ := database.GetMemory(stale.ID); m.ArchivedAt == nil {
+			t.Error("Expected memory to be archived, not deleted")
+		}
+		if archived, _ = database.PruneMemories(nil, false); len(archived) != 0 {
+			t.Errorf("Expected nothing left to prune, got %v", archived)
+		}
+	})
+
+	t.Run("update restores", func(t *testing.T) {
+		m, err := database.UpdateMemoryWithOptions(stale.ID, nil, nil, nil, nil, MemoryOptions{ExpiresAt: &time.Time{}, Importance: &high})
+		if err != nil {
+			t.Fatalf("UpdateMemoryWithOptions failed: %v", err)
+		}
+		if m.ExpiresAt != nil || m.ArchivedAt != nil || m.Importance != high {
+			t.Errorf("Expected expiry cleared and memory restored, got %+v", m)
+		}
+		if memories, _ := database.SearchMemories(nil, "workaround", MemoryFilter{}); len(memories) != 1 {
+			t.Errorf("Expected restored memory to be searchable, got %v", ids(memories))
+		}
+		if _, err := database.UpdateMemoryWithOptions(stale.ID, nil, nil, nil, nil, MemoryOptions{Importance: new(int)}); err == nil {
+			t.Error("Expected an error for importance 0")
+		}
+
+		content, tooHigh := "Rewritten", 9
+		if _, err := database.UpdateMemoryWithOptions(stale.ID, &content, nil, nil, nil, MemoryOptions{Importance: &tooHigh}); err == nil {
+			t.Error("Expected an error for importance 9")
+		}
+		if m, _ := database.GetMemory(stale.ID); m.Content == content {
+			t.Error("Expected a rejected update to keep the content")
+		}
+		if history, _ := database.GetMemoryHistory(stale.ID); len(history) != 0 {
+			t.Errorf("Expected no revision for a rejected update, got %d", len(history))
+		}
+
+		blank := " \n"
+		if _, err := database.UpdateMemory(stale.ID, &blank, nil, nil, nil); err == nil {
+			t.Error("Expected an error for blank content")
+		}
+		if m, _ := database.GetMemory(stale.ID); strings.TrimSpace(m.Content) == "" {
+			t.Error("Expected blank content to be rejected")
+		}
+		if history, _ := database.GetMemoryHistory(stale.ID); len(history) != 0 {
+			t.Errorf("Expected no revision for blank content, got %d", len(history))
+		}
+	})
+}
+
+// TestPruneMemoriesAtomic verifies that a prune archives every expired memory
+// or none, and reports them once it has committed
+func TestPruneMemoriesAtomic(t *testing.T) {
+	database, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	past := time.Now().Add(-time.Hour)
+	app, _ := database.CreateProject("app", "", "")
+	first, _ := database.CreateMemoryWithOptions(nil, "old deploy notes", nil, MemoryOptions{ExpiresAt: &past})
+	second, _ := database.CreateMemoryWithOptions(&app.ID, "old release notes", nil, MemoryOptions{ExpiresAt: &past})
+
+	var changes []Change
+	database.OnChange(func(c Change) { changes = append(changes, c) })
+
+	database.Exec(fmt.Sprintf("CREATE TRIGGER reject_archive BEFORE UPDATE OF archived_at ON memories WHEN new.id = %d BEGIN SELECT RAISE(ABORT, 'rejected'); END", second.ID))
+	if _, err := database.PruneMemories(nil, false); err == nil {
+		t.Fatal("Expected an error when archiving is rejected")
+	}
+	if m, _ := database.GetMemory(first.ID); m.ArchivedAt != nil {
+		t.Error("Expected a failed prune to archive nothing")
+	}
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes reported for a failed prune, got %+v", changes)
+	}
+
+	database.Exec("DROP TRIGGER reject_archive")
+	archived, err := database.PruneMemories(nil, false)
+	if err != nil {
+		t.Fatalf("PruneMemories failed: %v", err)
+	}
+	if len(archived) != 2 || archived[0] != first.ID || archived[1] != second.ID {
+		t.Errorf("Expected both memories archived, got %v", archived)
+	}
+	if len(changes) != 2 || changes[0].ProjectID == changes[1].ProjectID {
+		t.Errorf("Expected a change per memory in its own project, got %+v", changes)
+	}
+}
@@ -10,6 +10,7 @@ type Metadata struct {
 	ProjectID int64  `json:"project_id"`
 	Key       string `json:"key"`
 	Value     string `json:"value"`
+	Inherited bool   `json:"inherited,omitempty"` // from an ancestor project
 }
 
 // SetMetadata sets a metadata key-value pair
@@ -47,26 +48,38 @@ func (db *DB) GetMetadata(projectID *int64, key string) (*Metadata, error) {
 
 // ListMetadata lists all metadata for a project
 func (db *DB) ListMetadata(projectID *int64) ([]Metadata, error) {
-	pid := db.GetProjectID(projectID)
+	items, _, err := db.findMetadata(projectID, false, nil)
+	return items, err
+}
 
-	rows, err := db.Query(
-		"SELECT id, project_id, key, value FROM metadata WHERE project_id = ? ORDER BY key",
-		pid,
-	)
+// ListMetadataPage lists a page of the metadata ListMetadata or, with inherit,
+// ListMetadataInherited returns, along with how many keys there are
+func (db *DB) ListMetadataPage(projectID *int64, inherit bool, page PageRequest) (*Page[Metadata], error) {
+	items, total, err := db.findMetadata(projectID, inherit, &page)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return NewPage(items, total, page), nil
+}
+
+// findMetadata lists the metadata a project sees, ordered by key, and how
+// many keys there are. A nil page lists them all.
+func (db *DB) findMetadata(projectID *int64, inherit bool, page *PageRequest) ([]Metadata, int, error) {
+	q, err := db.newScopedQuery(projectID, inherit, "metadata", "id, project_id, key, value", "key")
+	if err != nil {
+		return nil, 0, err
+	}
 
 	var items []Metadata
-	for rows.Next() {
+	total, err := q.run(db, "key", page, func(rows *sql.Rows) error {
 		var m Metadata
-		if err := rows.Scan(&m.ID, &m.ProjectID, &m.Key, &m.Value); err != nil {
-			return nil, err
+		if err := rows.Scan(&m.ID, &m.ProjectID, &m.Key, &m.Value, &m.Inherited); err != nil {
+			return err
 		}
 		items = append(items, m)
-	}
-	return items, rows.Err()
+		return nil
+	})
+	return items, total, err
 }
 
 // DeleteMetadata deletes a metadata key
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/rocket/mcp-memories/internal/schema"
+)
+
+// ErrSchemaTooNew is returned when the database was upgraded by a newer build
+// of the server than the one opening it
+var ErrSchemaTooNew = errors.New("database schema is newer than this server supports")
+
+// SchemaVersion returns the schema version recorded in the database
+func (db *DB) SchemaVersion() (int, error) {
+	return schemaVersion(db.DB)
+}
+
+func schemaVersion(conn *sql.DB) (int, error) {
+	var version int
+	if err := conn.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	return version, nil
+}
+
+// migrate applies every pending migration in order
+func migrate(conn *sql.DB) error {
+	current, err := schemaVersion(conn)
+	if err != nil {
+		return err
+	}
+
+	latest := schema.Latest()
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d, this build supports up to %d", ErrSchemaTooNew, current, latest)
+	}
+
+	for _, m := range schema.Migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := applyMigration(conn, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration runs a single migration and records its version atomically
+func applyMigration(conn *sql.DB, m schema.Migration) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return err
+	}
+	// user_version is stored in the database header, so it commits with the migration
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", m.Version)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/rocket/mcp-memories/internal/schema"
+)
+
+func TestMigrations(t *testing.T) {
+	t.Run("fresh database is at latest version", func(t *testing.T) {
+		database, err := Open(filepath.Join(t.TempDir(), "fresh.db"))
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer database.Close()
+
+		version, err := database.SchemaVersion()
+		if err != nil {
+			t.Fatalf("SchemaVersion failed: %v", err)
+		}
+		if version != schema.Latest() {
+			t.Errorf("expected version %d, got %d", schema.Latest(), version)
+		}
+
+		var fk int
+		if err := database.QueryRow("PRAGMA foreign_keys").Scan(&fk); err != nil || fk != 1 {
+			t.Errorf("foreign keys not enabled: %d (%v)", fk, err)
+		}
+	})
+
+	t.Run("unversioned database is upgraded", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "legacy.db")
+		legacy, err := sql.Open("sqlite", path)
+		if err != nil {
+			t.Fatalf("sql.Open failed: %v", err)
+		}
+		if _, err := legacy.Exec(schema.Migrations[0].SQL); err != nil {
+			t.Fatalf("creating legacy schema: %v", err)
+		}
+		if _, err := legacy.Exec("INSERT INTO memories (project_id, content, keywords) VALUES (1, 'legacy sprite notes', '[]')"); err != nil {
+			t.Fatalf("inserting legacy memory: %v", err)
+		}
+		legacy.Close()
+
+		database, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer database.Close()
+
+		memories, err := database.SearchMemories(nil, "sprite", MemoryFilter{Limit: 10})
+		if err != nil {
+			t.Fatalf("SearchMemories failed: %v", err)
+		}
+		if len(memories) != 1 {
+			t.Errorf("expected legacy memory to be indexed, got %d results", len(memories))
+		}
+	})
+
+	t.Run("newer database is refused", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "newer.db")
+		database, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		if _, err := database.Exec("PRAGMA user_version = 9999"); err != nil {
+			t.Fatalf("setting user_version: %v", err)
+		}
+		database.Close()
+
+		if _, err := Open(path); !errors.Is(err, ErrSchemaTooNew) {
+			t.Errorf("expected ErrSchemaTooNew, got %v", err)
+		}
+	})
+}
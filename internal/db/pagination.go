@@ -0,0 +1,84 @@
+package db
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultPageSize is the number of items a page holds when no limit is given
+const DefaultPageSize = 50
+
+// PageRequest selects a page of a list: up to Limit items starting at Offset.
+// A Limit of zero or less means DefaultPageSize.
+type PageRequest struct {
+	Limit  int
+	Offset int
+}
+
+// Page is one page of a list, with the number of items in the whole list and
+// the cursor of the next page, if there is one
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+const cursorPrefix = "offset:"
+
+// EncodeCursor returns the opaque cursor of the page starting at offset
+func EncodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+// DecodeCursor returns the offset a cursor from EncodeCursor points to. The
+// empty cursor is the first page.
+func DecodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil && strings.HasPrefix(string(data), cursorPrefix) {
+		offset, err := strconv.Atoi(strings.TrimPrefix(string(data), cursorPrefix))
+		if err == nil && offset >= 0 {
+			return offset, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid cursor %q", cursor)
+}
+
+func (r PageRequest) limit() int {
+	if r.Limit <= 0 {
+		return DefaultPageSize
+	}
+	return r.Limit
+}
+
+// NewPage wraps items already fetched for r out of total
+func NewPage[T any](items []T, total int, r PageRequest) *Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	page := &Page[T]{Items: items, Total: total}
+	if next := r.Offset + len(items); len(items) > 0 && next < total {
+		page.NextCursor = EncodeCursor(next)
+	}
+	return page
+}
+
+// Paginate cuts the page r selects out of a complete list
+func Paginate[T any](items []T, r PageRequest) *Page[T] {
+	start := min(r.Offset, len(items))
+	end := min(start+r.limit(), len(items))
+	return NewPage(items[start:end], len(items), r)
+}
+
+// pageClause appends the LIMIT and OFFSET clause that selects page r to a
+// query and its arguments. A nil r selects every row.
+func pageClause(query string, args []interface{}, r *PageRequest) (string, []interface{}) {
+	if r == nil {
+		return query, args
+	}
+	return query + " LIMIT ? OFFSET ?", append(args, r.limit(), r.Offset)
+}
@@ -0,0 +1,91 @@
+package db
+
+import "testing"
+
+// TestPagination verifies cursors, in-memory pages and SQL-backed pages
+func TestPagination(t *testing.T) {
+	for _, offset := range []int{0, 7, 1234} {
+		got, err := DecodeCursor(EncodeCursor(offset))
+		if err != nil || got != offset {
+			t.Errorf("Cursor for %d decoded to %d (%v)", offset, got, err)
+		}
+	}
+	for _, bad := range []string{"7", "not base64!", EncodeCursor(-1)} {
+		if _, err := DecodeCursor(bad); err == nil {
+			t.Errorf("Expected an error for cursor %q", bad)
+		}
+	}
+
+	items := []int{1, 2, 3, 4, 5}
+	page := Paginate(items, PageRequest{Limit: 2})
+	if len(page.Items) != 2 || page.Total != 5 || page.NextCursor == "" {
+		t.Fatalf("Unexpected first page: %+v", page)
+	}
+	offset, _ := DecodeCursor(page.NextCursor)
+	page = Paginate(items, PageRequest{Limit: 2, Offset: 4})
+	if offset != 2 || len(page.Items) != 1 || page.Items[0] != 5 || page.NextCursor != "" {
+		t.Errorf("Unexpected last page: %+v", page)
+	}
+	if page := Paginate(items, PageRequest{Offset: 10}); page.Items == nil || len(page.Items) != 0 || page.Total != 5 {
+		t.Errorf("Expected an empty page past the end, got %+v", page)
+	}
+
+	database, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	for _, title := range []string{"a", "b", "c"} {
+		database.CreateTask(nil, nil, title, "", 0)
+	}
+	database.CreateTask(nil, nil, "other", "", 0)
+
+	filter := TaskFilter{Sort: "title", Statuses: []string{"todo"}}
+	var titles []string
+	req := PageRequest{Limit: 3}
+	for {
+		page, err := database.ListTasksPage(nil, filter, req)
+		if err != nil {
+			t.Fatalf("ListTasksPage failed: %v", err)
+		}
+		if page.Total != 4 {
+			t.Errorf("Expected a total of 4, got %d", page.Total)
+		}
+		for _, task := range page.Items {
+			titles = append(titles, task.Title)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		req.Offset, _ = DecodeCursor(page.NextCursor)
+	}
+	if len(titles) != 4 || titles[0] != "a" || titles[3] != "other" {
+		t.Errorf("Expected every task once in order, got %v", titles)
+	}
+
+	team, _ := database.CreateProject("team", "", "")
+	app, _ := database.CreateProject("app", "", "")
+	database.SetProjectParent(app.ID, &team.ID)
+	for _, title := range []string{"a", "b", "c"} {
+		database.CreateGuideline(&team.ID, "style", title, "team", nil, 0)
+	}
+	database.CreateGuideline(&app.ID, "style", "b", "app", nil, 0)
+	guidelines, err := database.ListGuidelinesPage(&app.ID, nil, true, PageRequest{Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatalf("ListGuidelinesPage failed: %v", err)
+	}
+	if guidelines.Total != 3 || len(guidelines.Items) != 2 || guidelines.Items[0].Content != "app" || !guidelines.Items[1].Inherited || guidelines.NextCursor != "" {
+		t.Errorf("Expected the app's override and an inherited guideline, got %+v", guidelines)
+	}
+
+	for _, content := range []string{"alpha one", "alpha two", "alpha three", "beta"} {
+		database.CreateMemory(nil, content, nil)
+	}
+	memories, err := database.SearchMemoriesPage(nil, "alpha", MemoryFilter{}, PageRequest{Limit: 2})
+	if err != nil {
+		t.Fatalf("SearchMemoriesPage failed: %v", err)
+	}
+	if memories.Total != 3 || len(memories.Items) != 2 || memories.NextCursor == "" {
+		t.Errorf("Expected the first 2 of 3 matches, got %+v", memories)
+	}
+}
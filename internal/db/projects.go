@@ -2,68 +2,142 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 )
 
 // Project represents a project namespace
 type Project struct {
-	ID        int64     `json:"id"`
-	Slug      string    `json:"slug"`
-	Name      string    `json:"name,omitempty"`
-	RootPath  string    `json:"root_path,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         int64      `json:"id"`
+	Slug       string     `json:"slug"`
+	Name       string     `json:"name,omitempty"`
+	RootPath   string     `json:"root_path,omitempty"`
+	ParentID   *int64     `json:"parent_id,omitempty"` // project to inherit guidelines, metadata and bookmarks from
+	CreatedAt  time.Time  `json:"created_at"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
 }
 
-// CreateProject creates a new project
+// projectColumns lists the columns scanProject reads
+const projectColumns = "id, slug, name, root_path, parent_id, created_at, archived_at"
+
+// scanProject scans a row selected with projectColumns
+func scanProject(row interface{ Scan(...interface{}) error }) (*Project, error) {
+	p := &Project{}
+	var name, rootPath sql.NullString
+	var parentID sql.NullInt64
+	var archivedAt sql.NullTime
+	if err := row.Scan(&p.ID, &p.Slug, &name, &rootPath, &parentID, &p.CreatedAt, &archivedAt); err != nil {
+		return nil, err
+	}
+	p.Name = name.String
+	p.RootPath = rootPath.String
+	if parentID.Valid {
+		p.ParentID = &parentID.Int64
+	}
+	if archivedAt.Valid {
+		p.ArchivedAt = &archivedAt.Time
+	}
+	return p, nil
+}
+
+// ProjectOptions holds the optional fields of a project. Nil fields are left
+// unchanged, or take their defaults on create; a zero Parent stops the project
+// inheriting from another.
+type ProjectOptions struct {
+	Parent *int64 // defaults to the global project
+}
+
+// parentID returns the parent opts sets, or nil to stop inheriting
+func (opts ProjectOptions) parentID() *int64 {
+	if *opts.Parent == 0 {
+		return nil
+	}
+	return opts.Parent
+}
+
+// CreateProject creates a new project that inherits from the global project
 func (db *DB) CreateProject(slug, name, rootPath string) (*Project, error) {
-	result, err := db.Exec(
-		"INSERT INTO projects (slug, name, root_path) VALUES (?, ?, ?)",
-		slug, name, rootPath,
+	return db.CreateProjectWithOptions(slug, name, rootPath, ProjectOptions{})
+}
+
+// CreateProjectWithOptions creates a new project and sets its parent in one
+// transaction, so nothing is created if the parent is rejected
+func (db *DB) CreateProjectWithOptions(slug, name, rootPath string, opts ProjectOptions) (*Project, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO projects (slug, name, root_path, parent_id) VALUES (?, ?, ?, ?)",
+		slug, name, rootPath, GlobalProjectID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("creating project: %w", err)
 	}
-
 	id, _ := result.LastInsertId()
+
+	if opts.Parent != nil {
+		if err := setProjectParent(tx, id, opts.parentID()); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return db.GetProjectByID(id)
 }
 
 // GetProjectByID gets a project by ID
 func (db *DB) GetProjectByID(id int64) (*Project, error) {
-	p := &Project{}
-	var name, rootPath sql.NullString
-	err := db.QueryRow(
-		"SELECT id, slug, name, root_path, created_at FROM projects WHERE id = ?",
-		id,
-	).Scan(&p.ID, &p.Slug, &name, &rootPath, &p.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
-	p.Name = name.String
-	p.RootPath = rootPath.String
-	return p, nil
+	return scanProject(db.QueryRow("SELECT "+projectColumns+" FROM projects WHERE id = ?", id))
 }
 
 // GetProjectBySlug gets a project by slug
 func (db *DB) GetProjectBySlug(slug string) (*Project, error) {
-	p := &Project{}
-	var name, rootPath sql.NullString
-	err := db.QueryRow(
-		"SELECT id, slug, name, root_path, created_at FROM projects WHERE slug = ?",
-		slug,
-	).Scan(&p.ID, &p.Slug, &name, &rootPath, &p.CreatedAt)
+	return scanProject(db.QueryRow("SELECT "+projectColumns+" FROM projects WHERE slug = ?", slug))
+}
+
+// ListProjects lists projects, leaving out archived ones unless includeArchived
+func (db *DB) ListProjects(includeArchived bool) ([]Project, error) {
+	return db.listProjects(includeArchived, nil)
+}
+
+// ListProjectsPage lists a page of the projects ListProjects returns, along
+// with how many there are
+func (db *DB) ListProjectsPage(includeArchived bool, page PageRequest) (*Page[Project], error) {
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM projects" + projectsWhere(includeArchived)).Scan(&total); err != nil {
+		return nil, err
+	}
+	projects, err := db.listProjects(includeArchived, &page)
 	if err != nil {
 		return nil, err
 	}
-	p.Name = name.String
-	p.RootPath = rootPath.String
-	return p, nil
+	return NewPage(projects, total, page), nil
 }
 
-// ListProjects lists all projects
-func (db *DB) ListProjects() ([]Project, error) {
-	rows, err := db.Query("SELECT id, slug, name, root_path, created_at FROM projects ORDER BY id")
+// projectsWhere returns the WHERE clause, if any, that leaves out archived
+// projects unless includeArchived
+func projectsWhere(includeArchived bool) string {
+	if includeArchived {
+		return ""
+	}
+	return " WHERE archived_at IS NULL"
+}
+
+// listProjects lists projects, or a page of them, in creation order
+func (db *DB) listProjects(includeArchived bool, page *PageRequest) ([]Project, error) {
+	query, args := pageClause("SELECT "+projectColumns+" FROM projects"+projectsWhere(includeArchived)+" ORDER BY id", nil, page)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -71,14 +145,11 @@ func (db *DB) ListProjects() ([]Project, error) {
 
 	var projects []Project
 	for rows.Next() {
-		var p Project
-		var name, rootPath sql.NullString
-		if err := rows.Scan(&p.ID, &p.Slug, &name, &rootPath, &p.CreatedAt); err != nil {
+		p, err := scanProject(rows)
+		if err != nil {
 			return nil, err
 		}
-		p.Name = name.String
-		p.RootPath = rootPath.String
-		projects = append(projects, p)
+		projects = append(projects, *p)
 	}
 	return projects, rows.Err()
 }
@@ -94,3 +165,541 @@ func (db *DB) GetOrCreateProject(slug string) (*Project, error) {
 	}
 	return db.CreateProject(slug, "", "")
 }
+
+// ErrGlobalProject is returned when trying to rename, archive, delete or merge
+// away the global project
+var ErrGlobalProject = errors.New("the global project cannot be renamed, archived, deleted or merged away")
+
+// UpdateProject changes a project's name and root path
+func (db *DB) UpdateProject(id int64, name, rootPath *string) (*Project, error) {
+	return db.UpdateProjectWithOptions(id, name, rootPath, ProjectOptions{})
+}
+
+// UpdateProjectWithOptions changes a project's name, root path and parent in
+// one transaction, so nothing is saved if any change is rejected
+func (db *DB) UpdateProjectWithOptions(id int64, name, rootPath *string, opts ProjectOptions) (*Project, error) {
+	var sets []string
+	var args []interface{}
+
+	if name != nil {
+		sets = append(sets, "name = ?")
+		args = append(args, *name)
+	}
+	if rootPath != nil {
+		sets = append(sets, "root_path = ?")
+		args = append(args, *rootPath)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if len(sets) > 0 {
+		args = append(args, id)
+		if _, err := tx.Exec(
+			fmt.Sprintf("UPDATE projects SET %s WHERE id = ?", strings.Join(sets, ", ")),
+			args...,
+		); err != nil {
+			return nil, fmt.Errorf("updating project: %w", err)
+		}
+	}
+	if opts.Parent != nil {
+		if err := setProjectParent(tx, id, opts.parentID()); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return db.GetProjectByID(id)
+}
+
+// RenameProject changes a project's slug
+func (db *DB) RenameProject(id int64, slug string) (*Project, error) {
+	if id == GlobalProjectID {
+		return nil, ErrGlobalProject
+	}
+	if _, err := db.GetProjectBySlug(slug); err == nil {
+		return nil, fmt.Errorf("project %s already exists", slug)
+	}
+
+	if _, err := db.Exec("UPDATE projects SET slug = ? WHERE id = ?", slug, id); err != nil {
+		return nil, fmt.Errorf("renaming project: %w", err)
+	}
+	return db.GetProjectByID(id)
+}
+
+// ArchiveProject archives or restores a project. Archived projects keep their
+// data but are left out of ListProjects and workspace detection.
+func (db *DB) ArchiveProject(id int64, archived bool) (*Project, error) {
+	if id == GlobalProjectID {
+		return nil, ErrGlobalProject
+	}
+
+	query := "UPDATE projects SET archived_at = NULL WHERE id = ?"
+	if archived {
+		query = "UPDATE projects SET archived_at = COALESCE(archived_at, CURRENT_TIMESTAMP) WHERE id = ?"
+	}
+	if _, err := db.Exec(query, id); err != nil {
+		return nil, fmt.Errorf("archiving project: %w", err)
+	}
+	return db.GetProjectByID(id)
+}
+
+// SetProjectParent changes the project a project inherits from; nil stops
+// inheriting. A project cannot inherit from itself or its descendants, and
+// the workflow it inherits as a result must allow the statuses of its and its
+// descendants' tasks.
+func (db *DB) SetProjectParent(id int64, parentID *int64) (*Project, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := setProjectParent(tx, id, parentID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return db.GetProjectByID(id)
+}
+
+// setProjectParent changes a project's parent inside a transaction, checking
+// for cycles and for tasks the new workflow would not allow
+func setProjectParent(tx *sql.Tx, id int64, parentID *int64) error {
+	if parentID != nil {
+		chain, err := projectChain(tx, *parentID)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(chain, id) {
+			return fmt.Errorf("project %d cannot inherit from itself or a descendant", id)
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE projects SET parent_id = ? WHERE id = ?", parentID, id); err != nil {
+		return fmt.Errorf("setting project parent: %w", err)
+	}
+	return checkWorkflows(tx, id)
+}
+
+// ProjectChain returns a project's ID followed by its ancestors' IDs, nearest
+// first
+func (db *DB) ProjectChain(id int64) ([]int64, error) {
+	return projectChain(db, id)
+}
+
+func projectChain(q querier, id int64) ([]int64, error) {
+	chain := []int64{id}
+	seen := map[int64]bool{id: true}
+	for {
+		var parentID sql.NullInt64
+		err := q.QueryRow("SELECT parent_id FROM projects WHERE id = ?", chain[len(chain)-1]).Scan(&parentID)
+		if err == sql.ErrNoRows && len(chain) == 1 {
+			return nil, fmt.Errorf("project %d not found", id)
+		}
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if !parentID.Valid || seen[parentID.Int64] {
+			return chain, nil
+		}
+		chain = append(chain, parentID.Int64)
+		seen[parentID.Int64] = true
+	}
+}
+
+// childProjects lists the IDs of a project's children
+func childProjects(tx *sql.Tx, id int64) ([]int64, error) {
+	rows, err := tx.Query("SELECT id FROM projects WHERE parent_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var child int64
+		if err := rows.Scan(&child); err != nil {
+			return nil, err
+		}
+		ids = append(ids, child)
+	}
+	return ids, rows.Err()
+}
+
+// projectTables lists the tables that hold per-project rows
+var projectTables = []string{"memories", "tasks", "metadata", "filetree", "guidelines", "bookmarks"}
+
+// DeleteProject deletes a project and every row stored in it. Its children
+// inherit from its parent instead, or from the global project if it had none,
+// and must have tasks that the workflow they inherit then allows.
+func (db *DB) DeleteProject(id int64) error {
+	if id == GlobalProjectID {
+		return ErrGlobalProject
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range projectTables {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE project_id = ?", table), id); err != nil {
+			return fmt.Errorf("deleting %s: %w", table, err)
+		}
+	}
+	children, err := childProjects(tx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"UPDATE projects SET parent_id = COALESCE((SELECT parent_id FROM projects WHERE id = ?), ?) WHERE parent_id = ?",
+		id, GlobalProjectID, id,
+	); err != nil {
+		return fmt.Errorf("reparenting children: %w", err)
+	}
+	result, err := tx.Exec("DELETE FROM projects WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("deleting project: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("project %d not found", id)
+	}
+	for _, child := range children {
+		if err := checkWorkflows(tx, child); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	db.notify(Change{Entity: "project", Op: OpDelete, ProjectID: id, ID: GlobalProjectID})
+	return nil
+}
+
+// MergeResult counts what MergeProjects did, per entity type
+type MergeResult struct {
+	Target  *Project       `json:"target"`
+	Moved   map[string]int `json:"moved"`
+	Updated map[string]int `json:"updated"`
+	Skipped map[string]int `json:"skipped"`
+	Renamed map[string]int `json:"renamed"`
+	Source  string         `json:"deleted_source"`
+}
+
+// MergeProjects moves every row from one project into another and deletes
+// the source project. Metadata keys, file paths and guideline titles that
+// exist in both are resolved by strategy, as in Import: skip keeps the
+// target's row, overwrite replaces it with the source's, and duplicate keeps
+// both by suffixing the source's key.
+func (db *DB) MergeProjects(sourceID, targetID int64, strategy MergeStrategy) (*MergeResult, error) {
+	if sourceID == GlobalProjectID {
+		return nil, ErrGlobalProject
+	}
+	if sourceID == targetID {
+		return nil, errors.New("cannot merge a project into itself")
+	}
+	source, err := db.GetProjectByID(sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("source project %d: %w", sourceID, err)
+	}
+	if _, err := db.GetProjectByID(targetID); err != nil {
+		return nil, fmt.Errorf("target project %d: %w", targetID, err)
+	}
+	if strategy == "" {
+		strategy = MergeSkip
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res := &MergeResult{
+		Moved:   map[string]int{},
+		Updated: map[string]int{},
+		Skipped: map[string]int{},
+		Renamed: map[string]int{},
+		Source:  source.Slug,
+	}
+
+	// Rows with a unique key: resolve collisions, then move what is left
+	collisions := []struct {
+		table string
+		key   []string // unique key columns besides project_id
+		value []string // columns overwrite copies to the target row
+	}{
+		{"metadata", []string{"key"}, []string{"value"}},
+		{"filetree", []string{"path"}, []string{"note", "is_dir"}},
+		{"guidelines", []string{"category", "title"}, []string{"content", "tags", "priority", "updated_at"}},
+	}
+	for _, c := range collisions {
+		if err := mergeCollisions(tx, c.table, c.key, c.value, sourceID, targetID, strategy, res); err != nil {
+			return nil, fmt.Errorf("merging %s: %w", c.table, err)
+		}
+	}
+
+	for _, table := range projectTables {
+		result, err := tx.Exec(fmt.Sprintf("UPDATE %s SET project_id = ? WHERE project_id = ?", table), targetID, sourceID)
+		if err != nil {
+			return nil, fmt.Errorf("moving %s: %w", table, err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			res.Moved[table] += int(n)
+		}
+	}
+
+	// Children of the source inherit from the target instead. A target below
+	// the source first takes the source's parent, so it does not become its
+	// own ancestor.
+	chain, err := projectChain(tx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(chain, sourceID) {
+		if _, err := tx.Exec("UPDATE projects SET parent_id = ? WHERE id = ?", source.ParentID, targetID); err != nil {
+			return nil, fmt.Errorf("reparenting target: %w", err)
+		}
+	}
+	if _, err := tx.Exec("UPDATE projects SET parent_id = ? WHERE parent_id = ?", targetID, sourceID); err != nil {
+		return nil, fmt.Errorf("reparenting children: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM projects WHERE id = ?", sourceID); err != nil {
+		return nil, fmt.Errorf("deleting source project: %w", err)
+	}
+	// The moved tasks and the source's children now follow the target's
+	// workflow, and the source's own workflow is gone
+	if err := checkWorkflows(tx, targetID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	db.notify(Change{Entity: "project", Op: OpDelete, ProjectID: sourceID, ID: targetID})
+	if res.Target, err = db.GetProjectByID(targetID); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// mergeCollisions resolves the source rows of a table whose unique key already
+// exists in the target project, so the remaining rows can be moved as is
+func mergeCollisions(tx *sql.Tx, table string, key, value []string, sourceID, targetID int64, strategy MergeStrategy, res *MergeResult) error {
+	var match []string
+	for _, col := range key {
+		match = append(match, fmt.Sprintf("t.%s = s.%s", col, col))
+	}
+	rows, err := tx.Query(fmt.Sprintf(
+		"SELECT s.id, t.id FROM %s s JOIN %s t ON t.project_id = ? AND %s WHERE s.project_id = ?",
+		table, table, strings.Join(match, " AND "),
+	), targetID, sourceID)
+	if err != nil {
+		return err
+	}
+	type pair struct{ source, target int64 }
+	var pairs []pair
+	for rows.Next() {
+		var p pair
+		if err := rows.Scan(&p.source, &p.target); err != nil {
+			rows.Close()
+			return err
+		}
+		pairs = append(pairs, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// File paths name real files, so duplicate keeps the target's note as
+	// skip does
+	if strategy == MergeDuplicate && table == "filetree" {
+		strategy = MergeSkip
+	}
+
+	for _, p := range pairs {
+		switch strategy {
+		case MergeOverwrite:
+			var sets []string
+			for _, col := range value {
+				sets = append(sets, fmt.Sprintf("%s = (SELECT %s FROM %s WHERE id = ?)", col, col, table))
+			}
+			args := make([]interface{}, 0, len(value)+1)
+			for range value {
+				args = append(args, p.source)
+			}
+			args = append(args, p.target)
+			if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", table, strings.Join(sets, ", ")), args...); err != nil {
+				return err
+			}
+			if err := retagCopied(tx, table, p.target); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ?", table), p.source); err != nil {
+				return err
+			}
+			res.Updated[table]++
+
+		case MergeDuplicate:
+			// The last key column is the name that gets the suffix
+			col := key[len(key)-1]
+			var name string
+			if err := tx.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE id = ?", col, table), p.source).Scan(&name); err != nil {
+				return err
+			}
+			var others []string
+			for _, c := range key[:len(key)-1] {
+				others = append(others, fmt.Sprintf("%s = (SELECT %s FROM %s WHERE id = %d)", c, c, table, p.source))
+			}
+			others = append(others, col+" = ?")
+			lookup := fmt.Sprintf("SELECT id FROM %s WHERE project_id = ? AND %s", table, strings.Join(others, " AND "))
+			renamed, err := uniqueName(name, func(candidate string) (int64, error) {
+				return lookupID(tx, lookup, targetID, candidate)
+			})
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", table, col), renamed, p.source); err != nil {
+				return err
+			}
+			res.Renamed[table]++
+
+		default:
+			if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ?", table), p.source); err != nil {
+				return err
+			}
+			res.Skipped[table]++
+		}
+	}
+	return nil
+}
+
+// retagCopied points a row's tag join rows at the tags in its JSON copy,
+// after the copy was overwritten from another row
+func retagCopied(tx *sql.Tx, table string, id int64) error {
+	for _, typ := range TagTypes {
+		e := taggedEntities[typ]
+		if e.table != table {
+			continue
+		}
+		var data sql.NullString
+		if err := tx.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE id = ?", e.column, table), id).Scan(&data); err != nil {
+			return err
+		}
+		var tags []string
+		json.Unmarshal([]byte(data.String), &tags)
+		return setTags(tx, typ, id, normalizeTags(tags))
+	}
+	return nil
+}
+
+// FindProjectByPath returns the unarchived project whose root_path is the
+// given path or its closest ancestor, or nil if no project root contains it
+func (db *DB) FindProjectByPath(path string) (*Project, error) {
+	projects, err := db.ListProjects(false)
+	if err != nil {
+		return nil, err
+	}
+
+	target := normalizePath(path)
+	var best *Project
+	bestLen := -1
+	for i := range projects {
+		if projects[i].RootPath == "" {
+			continue
+		}
+		root := normalizePath(projects[i].RootPath)
+		if pathWithin(root, target) && len(root) > bestLen {
+			best = &projects[i]
+			bestLen = len(root)
+		}
+	}
+	return best, nil
+}
+
+// SimilarProjects returns up to limit unarchived projects whose slug looks
+// like a misspelling of slug, closest first. A slug is similar when it is a
+// few edits away or one slug contains the other.
+func (db *DB) SimilarProjects(slug string, limit int) ([]Project, error) {
+	projects, err := db.ListProjects(false)
+	if err != nil {
+		return nil, err
+	}
+
+	target := strings.ToLower(slug)
+	maxDistance := max(2, len(target)/3)
+	type candidate struct {
+		project  Project
+		distance int
+	}
+	var candidates []candidate
+	for _, p := range projects {
+		other := strings.ToLower(p.Slug)
+		d := levenshtein(target, other)
+		if d <= maxDistance || strings.Contains(other, target) || strings.Contains(target, other) {
+			candidates = append(candidates, candidate{p, d})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	var similar []Project
+	for i := 0; i < len(candidates) && i < limit; i++ {
+		similar = append(similar, candidates[i].project)
+	}
+	return similar, nil
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// normalizePath cleans a path for comparison. Windows paths compare
+// case-insensitively.
+func normalizePath(path string) string {
+	path = filepath.Clean(filepath.FromSlash(path))
+	if runtime.GOOS == "windows" {
+		path = strings.ToLower(path)
+	}
+	return path
+}
+
+// pathWithin reports whether path is root or nested inside it
+func pathWithin(root, path string) bool {
+	if path == root {
+		return true
+	}
+	if !strings.HasSuffix(root, string(filepath.Separator)) {
+		root += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, root)
+}
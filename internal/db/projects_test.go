@@ -0,0 +1,276 @@
+package db
+
+import (
+	"testing"
+)
+
+// TestProjectLifecycle verifies updating, renaming, archiving, deleting and
+// merging projects
+func TestProjectLifecycle(t *testing.T) {
+	database, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	t.Run("update and rename", func(t *testing.T) {
+		p, _ := database.CreateProject("tpyo", "Typo", "")
+		name, root := "Fixed", "/src/fixed"
+		p, err := database.UpdateProject(p.ID, &name, &root)
+		if err != nil || p.Name != "Fixed" || p.RootPath != "/src/fixed" {
+			t.Fatalf("UpdateProject: %+v, %v", p, err)
+		}
+		p, err = database.RenameProject(p.ID, "typo")
+		if err != nil || p.Slug != "typo" {
+			t.Fatalf("RenameProject: %+v, %v", p, err)
+		}
+		if _, err := database.RenameProject(p.ID, "global"); err == nil {
+			t.Error("Expected error renaming onto an existing slug")
+		}
+		if _, err := database.RenameProject(GlobalProjectID, "other"); err != ErrGlobalProject {
+			t.Errorf("Expected ErrGlobalProject, got %v", err)
+		}
+	})
+
+	t.Run("archive", func(t *testing.T) {
+		p, _ := database.CreateProject("old", "", "/src/old")
+		p, err := database.ArchiveProject(p.ID, true)
+		if err != nil || p.ArchivedAt == nil {
+			t.Fatalf("ArchiveProject: %+v, %v", p, err)
+		}
+		active, _ := database.ListProjects(false)
+		for _, a := range active {
+			if a.ID == p.ID {
+				t.Error("Archived project listed")
+			}
+		}
+		if found, _ := database.FindProjectByPath("/src/old/pkg"); found != nil {
+			t.Errorf("Archived project detected from path: %+v", found)
+		}
+		all, _ := database.ListProjects(true)
+		if len(all) != len(active)+1 {
+			t.Errorf("Expected archived project with includeArchived, got %d of %d", len(all), len(active))
+		}
+		if p, _ = database.ArchiveProject(p.ID, false); p.ArchivedAt != nil {
+			t.Error("Expected project to be restored")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		p, _ := database.CreateProject("doomed", "", "")
+		parent, _ := database.CreateTask(&p.ID, nil, "Parent", "", 0)
+		database.CreateTask(&p.ID, &parent.ID, "Child", "", 0)
+		m, _ := database.CreateMemory(&p.ID, "Doomed memory", nil)
+		content := "Edited"
+		database.UpdateMemory(m.ID, &content, nil, nil, nil)
+		database.CreateGuideline(&p.ID, "style", "Doomed", "x", nil, 0)
+		database.SetMetadata(&p.ID, "k", "v")
+		database.AnnotateFile(&p.ID, "a.go", "note", false)
+		database.CreateBookmark(&p.ID, "https://example.com", "Example", "", "", "", "", nil)
+
+		if err := database.DeleteProject(p.ID); err != nil {
+			t.Fatalf("DeleteProject failed: %v", err)
+		}
+		for _, table := range append(projectTables, "memory_history") {
+			var n int
+			database.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n)
+			if n != 0 {
+				t.Errorf("%s still has %d rows", table, n)
+			}
+		}
+		if err := database.DeleteProject(GlobalProjectID); err != ErrGlobalProject {
+			t.Errorf("Expected ErrGlobalProject, got %v", err)
+		}
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		src, _ := database.CreateProject("src", "", "")
+		dst, _ := database.CreateProject("dst", "", "")
+		database.CreateMemory(&src.ID, "Moved memory", nil)
+		database.CreateTask(&src.ID, nil, "Moved task", "", 0)
+		database.SetMetadata(&src.ID, "lang", "golang")
+		database.SetMetadata(&dst.ID, "lang", "go")
+		database.SetMetadata(&src.ID, "only-src", "x")
+		database.CreateGuideline(&src.ID, "style", "Errors", "source", nil, 0)
+		database.CreateGuideline(&dst.ID, "style", "Errors", "target", nil, 0)
+		database.AnnotateFile(&src.ID, "main.go", "source note", false)
+		database.AnnotateFile(&dst.ID, "main.go", "target note", false)
+
+		res, err := database.MergeProjects(src.ID, dst.ID, MergeDuplicate)
+		if err != nil {
+			t.Fatalf("MergeProjects failed: %v", err)
+		}
+		if res.Moved["memories"] != 1 || res.Moved["tasks"] != 1 || res.Renamed["metadata"] != 1 || res.Renamed["guidelines"] != 1 || res.Skipped["filetree"] != 1 {
+			t.Errorf("Unexpected counts: %+v", res)
+		}
+		if _, err := database.GetProjectBySlug("src"); err == nil {
+			t.Error("Source project still exists")
+		}
+		if m, _ := database.GetMetadata(&dst.ID, "lang (2)"); m == nil || m.Value != "golang" {
+			t.Errorf("Expected suffixed source metadata, got %+v", m)
+		}
+		if f, _ := database.GetFileAnnotation(&dst.ID, "main.go"); f.Note != "target note" {
+			t.Errorf("Expected target annotation kept, got %q", f.Note)
+		}
+		guidelines, _ := database.ListGuidelines(&dst.ID, nil)
+		if len(guidelines) != 2 {
+			t.Errorf("Expected both guidelines, got %+v", guidelines)
+		}
+
+		// Overwrite takes the source's values
+		other, _ := database.CreateProject("other", "", "")
+		database.SetMetadata(&other.ID, "lang", "rust")
+		database.CreateGuideline(&dst.ID, "style", "Naming", "target", []string{"old"}, 0)
+		database.CreateGuideline(&other.ID, "style", "Naming", "source", []string{"new"}, 0)
+		if _, err := database.MergeProjects(other.ID, dst.ID, MergeOverwrite); err != nil {
+			t.Fatalf("MergeProjects failed: %v", err)
+		}
+		if m, _ := database.GetMetadata(&dst.ID, "lang"); m.Value != "rust" {
+			t.Errorf("Expected overwritten metadata, got %q", m.Value)
+		}
+		if found, _ := database.SearchGuidelines(&dst.ID, "", nil, TagFilter{All: []string{"new"}}); len(found) != 1 || found[0].Content != "source" {
+			t.Errorf("Expected the overwritten guideline to carry the source's tags, got %+v", found)
+		}
+		tags, _ := database.ListTags(&dst.ID)
+		if len(tags) != 1 || tags[0].Name != "new" {
+			t.Errorf("Expected only the source's tag in use, got %+v", tags)
+		}
+
+		if _, err := database.MergeProjects(dst.ID, dst.ID, MergeSkip); err == nil {
+			t.Error("Expected error merging a project into itself")
+		}
+		if _, err := database.MergeProjects(GlobalProjectID, dst.ID, MergeSkip); err != ErrGlobalProject {
+			t.Errorf("Expected ErrGlobalProject, got %v", err)
+		}
+	})
+}
+
+// TestProjectInheritance verifies that projects see their ancestors'
+// guidelines, metadata and bookmarks, with their own rows taking precedence
+func TestProjectInheritance(t *testing.T) {
+	database, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	team, _ := database.CreateProject("team", "", "")
+	app, _ := database.CreateProject("app", "", "")
+	if app.ParentID == nil || *app.ParentID != GlobalProjectID {
+		t.Fatalf("Expected new projects to inherit from global, got %v", app.ParentID)
+	}
+	if _, err := database.SetProjectParent(app.ID, &team.ID); err != nil {
+		t.Fatalf("SetProjectParent failed: %v", err)
+	}
+	if _, err := database.SetProjectParent(GlobalProjectID, &app.ID); err == nil {
+		t.Error("Expected error for an inheritance cycle")
+	}
+	chain, _ := database.ProjectChain(app.ID)
+	if len(chain) != 3 || chain[0] != app.ID || chain[1] != team.ID || chain[2] != GlobalProjectID {
+		t.Errorf("Unexpected chain: %v", chain)
+	}
+
+	database.CreateGuideline(nil, "git", "Commit messages", "Imperative mood", nil, 5)
+	database.CreateGuideline(&team.ID, "style", "Errors", "Team rule", nil, 3)
+	database.CreateGuideline(&app.ID, "style", "Errors", "App rule", nil, 1)
+	database.SetMetadata(nil, "license", "MIT")
+	database.SetMetadata(&team.ID, "language", "go")
+	database.SetMetadata(&app.ID, "language", "go1.25")
+	database.CreateBookmark(nil, "https://go.dev/doc/effective_go", "Effective Go", "", "", "url", "", nil)
+
+	t.Run("guidelines", func(t *testing.T) {
+		guidelines, err := database.ListGuidelinesInherited(&app.ID, nil)
+		if err != nil {
+			t.Fatalf("ListGuidelinesInherited failed: %v", err)
+		}
+		if len(guidelines) != 2 {
+			t.Fatalf("Expected 2 guidelines, got %+v", guidelines)
+		}
+		if guidelines[0].Title != "Commit messages" || !guidelines[0].Inherited {
+			t.Errorf("Expected inherited global guideline first by priority, got %+v", guidelines[0])
+		}
+		if guidelines[1].Content != "App rule" || guidelines[1].Inherited {
+			t.Errorf("Expected the app's own guideline to override the team's, got %+v", guidelines[1])
+		}
+
+		found, _ := database.SearchGuidelinesInherited(&app.ID, "mood", nil, TagFilter{})
+		if len(found) != 1 {
+			t.Errorf("Expected to find the inherited guideline, got %+v", found)
+		}
+		own, _ := database.ListGuidelines(&app.ID, nil)
+		if len(own) != 1 {
+			t.Errorf("Expected ListGuidelines to stay project-local, got %d", len(own))
+		}
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		m, _ := database.GetMetadataInherited(&app.ID, "license")
+		if m == nil || m.Value != "MIT" || !m.Inherited {
+			t.Errorf("Expected inherited license, got %+v", m)
+		}
+		m, _ = database.GetMetadataInherited(&app.ID, "language")
+		if m == nil || m.Value != "go1.25" || m.Inherited {
+			t.Errorf("Expected the app's own language, got %+v", m)
+		}
+		if m, _ = database.GetMetadataInherited(&app.ID, "missing"); m != nil {
+			t.Errorf("Expected nil for a missing key, got %+v", m)
+		}
+		items, _ := database.ListMetadataInherited(&app.ID)
+		if len(items) != 2 || items[0].Key != "language" || items[1].Key != "license" {
+			t.Errorf("Unexpected metadata: %+v", items)
+		}
+	})
+
+	t.Run("bookmarks", func(t *testing.T) {
+		bookmarks, _ := database.ListBookmarksInherited(&app.ID)
+		if len(bookmarks) != 1 || !bookmarks[0].Inherited {
+			t.Errorf("Expected the inherited bookmark, got %+v", bookmarks)
+		}
+	})
+
+	t.Run("deleting a middle project", func(t *testing.T) {
+		tool, _ := database.CreateProject("tool", "", "")
+		database.SetProjectParent(tool.ID, &app.ID)
+		mid, _ := database.CreateProject("mid", "", "")
+		database.SetProjectParent(mid.ID, &tool.ID)
+		leaf, _ := database.CreateProject("leaf", "", "")
+		database.SetProjectParent(leaf.ID, &mid.ID)
+		if err := database.DeleteProject(mid.ID); err != nil {
+			t.Fatalf("DeleteProject failed: %v", err)
+		}
+		chain, _ := database.ProjectChain(leaf.ID)
+		if len(chain) != 5 || chain[1] != tool.ID || chain[4] != GlobalProjectID {
+			t.Errorf("Expected the leaf to inherit from the deleted project's parent, got %v", chain)
+		}
+		database.SetProjectParent(tool.ID, nil)
+		if err := database.DeleteProject(tool.ID); err != nil {
+			t.Fatalf("DeleteProject failed: %v", err)
+		}
+		if chain, _ := database.ProjectChain(leaf.ID); len(chain) != 2 || chain[1] != GlobalProjectID {
+			t.Errorf("Expected the leaf to fall back to global, got %v", chain)
+		}
+	})
+
+	t.Run("merging into a grandchild", func(t *testing.T) {
+		top, _ := database.CreateProject("top", "", "")
+		middle, _ := database.CreateProject("middle", "", "")
+		database.SetProjectParent(middle.ID, &top.ID)
+		bottom, _ := database.CreateProject("bottom", "", "")
+		database.SetProjectParent(bottom.ID, &middle.ID)
+		if _, err := database.MergeProjects(top.ID, bottom.ID, MergeSkip); err != nil {
+			t.Fatalf("MergeProjects failed: %v", err)
+		}
+		chain, _ := database.ProjectChain(middle.ID)
+		if len(chain) != 3 || chain[1] != bottom.ID || chain[2] != GlobalProjectID {
+			t.Errorf("Expected middle under bottom under global, got %v", chain)
+		}
+	})
+
+	t.Run("detached", func(t *testing.T) {
+		database.SetProjectParent(app.ID, nil)
+		guidelines, _ := database.ListGuidelinesInherited(&app.ID, nil)
+		if len(guidelines) != 1 {
+			t.Errorf("Expected only the app's guideline once detached, got %+v", guidelines)
+		}
+	})
+}
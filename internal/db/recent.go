@@ -0,0 +1,104 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// Activity lists what changed in a project since a point in time. Deletions
+// are not recorded, so removed items simply do not appear.
+type Activity struct {
+	Since      time.Time   `json:"since"`
+	Memories   []Memory    `json:"memories"`
+	Tasks      []Task      `json:"tasks"`
+	Guidelines []Guideline `json:"guidelines"`
+	Bookmarks  []Bookmark  `json:"bookmarks"`
+}
+
+// ActivitySince returns the memories, tasks and guidelines created or updated
+// and the bookmarks created at or after since, newest first, at most limit of
+// each
+func (db *DB) ActivitySince(projectID *int64, since time.Time, limit int) (*Activity, error) {
+	pid := db.GetProjectID(projectID)
+	if limit <= 0 {
+		limit = 20
+	}
+	a := &Activity{Since: since}
+
+	ids, err := db.changedIDs("memories", "updated_at", pid, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		m, err := db.GetMemory(id)
+		if err != nil {
+			return nil, err
+		}
+		a.Memories = append(a.Memories, *m)
+	}
+
+	if ids, err = db.changedIDs("tasks", "updated_at", pid, since, limit); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		t, err := db.GetTask(id)
+		if err != nil {
+			return nil, err
+		}
+		a.Tasks = append(a.Tasks, *t)
+	}
+
+	if ids, err = db.changedIDs("guidelines", "updated_at", pid, since, limit); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		g, err := db.GetGuideline(id)
+		if err != nil {
+			return nil, err
+		}
+		a.Guidelines = append(a.Guidelines, *g)
+	}
+
+	if ids, err = db.changedIDs("bookmarks", "created_at", pid, since, limit); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		b, err := db.GetBookmark(id)
+		if err != nil {
+			return nil, err
+		}
+		a.Bookmarks = append(a.Bookmarks, *b)
+	}
+
+	return a, nil
+}
+
+// changedIDs returns the IDs of a table's rows whose timestamp column is at or
+// after since, newest first. The IDs are collected before any row is loaded so
+// the query's connection is released first.
+func (db *DB) changedIDs(table, column string, projectID int64, since time.Time, limit int) ([]int64, error) {
+	rows, err := db.Query(
+		fmt.Sprintf("SELECT id FROM %s WHERE project_id = ? AND %s >= ? ORDER BY %s DESC, id DESC LIMIT ?", table, column, column),
+		projectID, sqliteTime(since), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// sqliteTime formats a time the way CURRENT_TIMESTAMP stores it, so the two
+// compare correctly as text
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
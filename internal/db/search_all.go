@@ -0,0 +1,264 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// SearchTypes lists the entity types SearchEverything can return
+var SearchTypes = []string{"memory", "guideline", "bookmark", "task", "filetree"}
+
+// SearchAllOptions selects what SearchEverything searches
+type SearchAllOptions struct {
+	Query        string
+	ProjectIDs   []int64  // projects to search; empty means every unarchived project
+	Types        []string // entity types to search; empty means all of SearchTypes
+	PerTypeLimit int      // best matches kept per type before merging (default 20)
+	Limit        int      // page size (default 20)
+	Offset       int
+}
+
+// SearchHit is one result of SearchEverything
+type SearchHit struct {
+	Type    string  `json:"type"`
+	ID      int64   `json:"id"`
+	Project string  `json:"project"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet,omitempty"`
+	Score   float64 `json:"score"`
+}
+
+// SearchAllResult is a page of merged results
+type SearchAllResult struct {
+	Results    []SearchHit    `json:"results"`
+	Counts     map[string]int `json:"counts"` // matches per type, up to PerTypeLimit
+	Total      int            `json:"total"`
+	NextOffset *int           `json:"next_offset,omitempty"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// searchSource describes how to match one entity type
+type searchSource struct {
+	table   string
+	title   string // expression shown as the hit's title; matches in it score extra
+	body    string // expression searched besides the title
+	snippet string // expression the snippet is cut from
+	order   string // tie-break among equal scores
+	where   string // optional condition rows must also meet
+}
+
+var searchSources = map[string]searchSource{
+	"memory": {
+		table:   "memories m",
+		title:   "content",
+		body:    "COALESCE(keywords, '')",
+		snippet: "content",
+		order:   "pinned DESC, importance DESC, updated_at DESC",
+		where:   liveMemory,
+	},
+	"guideline": {
+		table:   "guidelines",
+		title:   "title",
+		body:    "content || ' ' || category || ' ' || COALESCE(tags, '')",
+		snippet: "content",
+		order:   "priority DESC, updated_at DESC",
+	},
+	"bookmark": {
+		table:   "bookmarks",
+		title:   "title",
+		body:    "url || ' ' || COALESCE(excerpt, '') || ' ' || COALESCE(note, '') || ' ' || COALESCE(tags, '')",
+		snippet: "COALESCE(NULLIF(excerpt, ''), note, '')",
+		order:   "created_at DESC",
+	},
+	"task": {
+		table:   "tasks",
+		title:   "title",
+		body:    "COALESCE(description, '')",
+		snippet: "COALESCE(description, '')",
+		order:   "priority DESC, updated_at DESC",
+	},
+	"filetree": {
+		table:   "filetree",
+		title:   "path",
+		body:    "COALESCE(note, '')",
+		snippet: "COALESCE(note, '')",
+		order:   "path",
+	},
+}
+
+// SearchEverything searches several entity types across projects and merges
+// the matches into one ranked list. A row's score is the share of query terms
+// it contains, with terms found in its title counting extra, so scores are
+// comparable across types.
+func (db *DB) SearchEverything(opts SearchAllOptions) (*SearchAllResult, error) {
+	terms := strings.Fields(strings.ToLower(opts.Query))
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("query is required")
+	}
+	if opts.PerTypeLimit <= 0 {
+		opts.PerTypeLimit = 20
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 20
+	}
+	types := opts.Types
+	if len(types) == 0 {
+		types = SearchTypes
+	}
+
+	projects, err := db.ListProjects(true)
+	if err != nil {
+		return nil, err
+	}
+	slugs := make(map[int64]string, len(projects))
+	for _, p := range projects {
+		slugs[p.ID] = p.Slug
+	}
+	projectIDs := opts.ProjectIDs
+	if len(projectIDs) == 0 {
+		for _, p := range projects {
+			if p.ArchivedAt == nil {
+				projectIDs = append(projectIDs, p.ID)
+			}
+		}
+	}
+
+	result := &SearchAllResult{Counts: map[string]int{}}
+	var hits []SearchHit
+	for _, typ := range types {
+		src, ok := searchSources[typ]
+		if !ok {
+			return nil, fmt.Errorf("unknown search type %q: must be one of %s", typ, strings.Join(SearchTypes, ", "))
+		}
+		typeHits, err := db.searchSource(typ, src, terms, projectIDs, slugs, opts.PerTypeLimit)
+		if err != nil {
+			return nil, fmt.Errorf("searching %s: %w", typ, err)
+		}
+		result.Counts[typ] = len(typeHits)
+		hits = append(hits, typeHits...)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+
+	result.Total = len(hits)
+	start := min(opts.Offset, len(hits))
+	end := min(start+opts.Limit, len(hits))
+	result.Results = hits[start:end]
+	if end < len(hits) {
+		result.NextOffset = &end
+		result.NextCursor = EncodeCursor(end)
+	}
+	return result, nil
+}
+
+// searchSource returns the best matches of one entity type
+func (db *DB) searchSource(typ string, src searchSource, terms []string, projectIDs []int64, slugs map[int64]string, limit int) ([]SearchHit, error) {
+	if len(projectIDs) == 0 {
+		return nil, nil
+	}
+
+	var scores []string
+	var args []interface{}
+	for _, term := range terms {
+		pattern := "%" + escapeLike(term) + "%"
+		scores = append(scores, fmt.Sprintf(
+			`CASE WHEN %s LIKE ? ESCAPE '\' THEN 1.5 WHEN %s LIKE ? ESCAPE '\' THEN 1.0 ELSE 0 END`,
+			src.title, src.body,
+		))
+		args = append(args, pattern, pattern)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(projectIDs)), ", ")
+	for _, id := range projectIDs {
+		args = append(args, id)
+	}
+	args = append(args, limit)
+
+	where := ""
+	if src.where != "" {
+		where = " AND " + src.where
+	}
+	query := fmt.Sprintf(
+		"SELECT id, project_id, %s, %s, (%s) / %.1f AS score FROM %s WHERE project_id IN (%s)%s AND score > 0 ORDER BY score DESC, %s LIMIT ?",
+		src.title, src.snippet, strings.Join(scores, " + "), 1.5*float64(len(terms)),
+		src.table, placeholders, where, src.order,
+	)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []SearchHit
+	for rows.Next() {
+		var h SearchHit
+		var projectID int64
+		var snippet string
+		if err := rows.Scan(&h.ID, &projectID, &h.Title, &snippet, &h.Score); err != nil {
+			return nil, err
+		}
+		h.Type = typ
+		h.Project = slugs[projectID]
+		if typ == "memory" {
+			h.Title = firstLine(h.Title, 80)
+		}
+		h.Snippet = matchSnippet(snippet, terms, 160)
+		hits = append(hits, h)
+	}
+	return hits, rows.Err()
+}
+
+// escapeLike escapes LIKE wildcards so a term matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// firstLine returns the first line of text, cut to size runes
+func firstLine(text string, size int) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return truncateRunes(line, size)
+}
+
+// matchSnippet returns about size runes of text around the first query term
+func matchSnippet(text string, terms []string, size int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= size {
+		return text
+	}
+
+	lower := strings.ToLower(text)
+	pos := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 && (pos < 0 || i < pos) {
+			pos = i
+		}
+	}
+	runes := []rune(text)
+	start := 0
+	if pos > 0 {
+		start = max(0, utf8.RuneCountInString(text[:pos])-size/4)
+	}
+	end := min(len(runes), start+size)
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// truncateRunes cuts s to size runes, marking the cut
+func truncateRunes(s string, size int) string {
+	runes := []rune(s)
+	if len(runes) <= size {
+		return s
+	}
+	return string(runes[:size]) + "…"
+}
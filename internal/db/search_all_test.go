@@ -0,0 +1,95 @@
+package db
+
+import (
+	"testing"
+)
+
+// TestSearchEverything verifies cross-project search over every entity type
+func TestSearchEverything(t *testing.T) {
+	database, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	app, _ := database.CreateProject("app", "", "")
+	lib, _ := database.CreateProject("lib", "", "")
+	old, _ := database.CreateProject("old", "", "")
+	database.ArchiveProject(old.ID, true)
+
+	database.CreateMemory(nil, "Retry transient sqlite busy errors with backoff", []string{"sqlite"})
+	database.CreateGuideline(&app.ID, "errors", "Retry policy", "Use exponential backoff for network calls", nil, 5)
+	database.CreateBookmark(&lib.ID, "https://example.com/backoff", "Backoff strategies", "Exponential backoff with jitter", "", "url", "", nil)
+	database.CreateTask(&app.ID, nil, "Add retry backoff to the HTTP embedder", "", 1)
+	database.AnnotateFile(&lib.ID, "internal/retry/backoff.go", "Retry helpers", false)
+	database.CreateMemory(&old.ID, "Archived backoff notes", nil)
+	database.CreateMemory(&app.ID, "100% of 50_50 splits", nil)
+
+	t.Run("all projects and types", func(t *testing.T) {
+		res, err := database.SearchEverything(SearchAllOptions{Query: "retry backoff"})
+		if err != nil {
+			t.Fatalf("SearchEverything failed: %v", err)
+		}
+		seen := map[string]string{}
+		for _, h := range res.Results {
+			seen[h.Type] = h.Project
+		}
+		want := map[string]string{"memory": "global", "guideline": "app", "bookmark": "lib", "task": "app", "filetree": "lib"}
+		for typ, project := range want {
+			if seen[typ] != project {
+				t.Errorf("Expected a %s hit from %s, got %q", typ, project, seen[typ])
+			}
+		}
+		for _, h := range res.Results {
+			if h.Project == "old" {
+				t.Error("Archived project searched by default")
+			}
+		}
+		// Matching both terms in the title ranks above matching one
+		if res.Results[0].Score < res.Results[len(res.Results)-1].Score {
+			t.Error("Results are not sorted by score")
+		}
+		if res.Results[0].Score != 1 {
+			t.Errorf("Expected a full title match first, got %+v", res.Results[0])
+		}
+	})
+
+	t.Run("project and type filters", func(t *testing.T) {
+		res, err := database.SearchEverything(SearchAllOptions{Query: "backoff", ProjectIDs: []int64{lib.ID, old.ID}, Types: []string{"bookmark", "memory"}})
+		if err != nil {
+			t.Fatalf("SearchEverything failed: %v", err)
+		}
+		if res.Total != 2 || res.Counts["bookmark"] != 1 || res.Counts["memory"] != 1 {
+			t.Errorf("Unexpected results: %+v", res)
+		}
+		if _, err := database.SearchEverything(SearchAllOptions{Query: "x", Types: []string{"widget"}}); err == nil {
+			t.Error("Expected error for an unknown type")
+		}
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		first, _ := database.SearchEverything(SearchAllOptions{Query: "backoff", Limit: 2})
+		if len(first.Results) != 2 || first.NextOffset == nil || *first.NextOffset != 2 {
+			t.Fatalf("Unexpected first page: %+v", first)
+		}
+		second, _ := database.SearchEverything(SearchAllOptions{Query: "backoff", Limit: 2, Offset: *first.NextOffset})
+		if len(second.Results) == 0 || second.Results[0] == first.Results[0] {
+			t.Errorf("Unexpected second page: %+v", second)
+		}
+		res, _ := database.SearchEverything(SearchAllOptions{Query: "backoff", PerTypeLimit: 1})
+		if res.Counts["memory"] != 1 {
+			t.Errorf("Expected per-type limit to apply, got %+v", res.Counts)
+		}
+	})
+
+	t.Run("wildcards match literally", func(t *testing.T) {
+		res, _ := database.SearchEverything(SearchAllOptions{Query: "50_50"})
+		if res.Total != 1 {
+			t.Errorf("Expected one literal match, got %+v", res.Results)
+		}
+		res, _ = database.SearchEverything(SearchAllOptions{Query: "%"})
+		if res.Total != 1 {
+			t.Errorf("Expected one literal match for %%, got %+v", res.Results)
+		}
+	})
+}
@@ -0,0 +1,434 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rocket/mcp-memories/internal/embed"
+)
+
+// SearchMode selects how a search query is matched
+type SearchMode string
+
+const (
+	SearchLexical  SearchMode = "lexical"  // keyword and full-text matching
+	SearchSemantic SearchMode = "semantic" // embedding similarity only
+	SearchHybrid   SearchMode = "hybrid"   // similarity blended with the lexical score
+)
+
+// ParseSearchMode validates a search mode, defaulting to lexical
+func ParseSearchMode(s string) (SearchMode, error) {
+	switch SearchMode(s) {
+	case "", SearchLexical:
+		return SearchLexical, nil
+	case SearchSemantic, SearchHybrid:
+		return SearchMode(s), nil
+	}
+	return "", fmt.Errorf("invalid search mode %q (expected lexical, semantic or hybrid)", s)
+}
+
+const (
+	// hybridWeight is the share of a hybrid score that comes from similarity
+	hybridWeight = 0.6
+	// minScore drops results that are effectively unrelated to the query
+	minScore = 0.1
+)
+
+// SemanticSearchMemories ranks memories by embedding similarity to the query.
+// In hybrid mode the similarity is blended with the full-text relevance. Scores
+// are weighted by importance, and pinned memories are ranked first.
+func (db *DB) SemanticSearchMemories(projectID *int64, query string, f MemoryFilter, mode SearchMode) ([]Memory, error) {
+	limit := f.Limit
+	f.Limit = 0
+	candidates, err := db.searchMemories(projectID, "", f)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(candidates))
+	for i, m := range candidates {
+		ids[i] = m.ID
+	}
+	similarity, err := db.similarities("memory", query, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	lexical := map[int64]float64{}
+	snippets := map[int64]string{}
+	if mode == SearchHybrid {
+		matches, err := db.SearchMemories(projectID, query, f)
+		if err != nil {
+			return nil, err
+		}
+		var best float64
+		for _, m := range matches {
+			if m.Score > best {
+				best = m.Score
+			}
+		}
+		for _, m := range matches {
+			lexical[m.ID] = 1
+			if best > 0 {
+				lexical[m.ID] = m.Score / best
+			}
+			snippets[m.ID] = m.Snippet
+		}
+	}
+
+	scores := make([]float64, len(candidates))
+	for i, m := range candidates {
+		scores[i] = blendScore(mode, similarity[m.ID], lexical[m.ID])
+	}
+
+	var results []Memory
+	for _, i := range rankIndices(scores, 0) {
+		m := candidates[i]
+		m.Score = scores[i] * importanceWeight(m.Importance)
+		m.Snippet = snippets[m.ID]
+		results = append(results, m)
+	}
+	sort.SliceStable(results, func(a, b int) bool {
+		if results[a].Pinned != results[b].Pinned {
+			return results[a].Pinned
+		}
+		return results[a].Score > results[b].Score
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// SemanticSearchGuidelines ranks guidelines by embedding similarity to the
+// query. In hybrid mode, guidelines that also match the text search get a boost.
+// With inherit, the project's inherited guidelines are ranked too.
+func (db *DB) SemanticSearchGuidelines(projectID *int64, query string, category *string, tags TagFilter, limit int, mode SearchMode, inherit bool) ([]Guideline, error) {
+	search := db.SearchGuidelines
+	if inherit {
+		search = db.SearchGuidelinesInherited
+	}
+
+	candidates, err := search(projectID, "", category, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(candidates))
+	for i, g := range candidates {
+		ids[i] = g.ID
+	}
+	similarity, err := db.similarities("guideline", query, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	lexical := map[int64]float64{}
+	if mode == SearchHybrid {
+		matches, err := search(projectID, query, category, tags)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range matches {
+			lexical[g.ID] = 1
+		}
+	}
+
+	scores := make([]float64, len(candidates))
+	for i, g := range candidates {
+		scores[i] = blendScore(mode, similarity[g.ID], lexical[g.ID])
+	}
+
+	var results []Guideline
+	for _, i := range rankIndices(scores, limit) {
+		g := candidates[i]
+		g.Score = scores[i]
+		results = append(results, g)
+	}
+	return results, nil
+}
+
+// SemanticSearchBookmarks ranks bookmarks by embedding similarity to the
+// query. In hybrid mode, bookmarks that also match the text search get a boost.
+// With inherit, the project's inherited bookmarks are ranked too.
+func (db *DB) SemanticSearchBookmarks(projectID *int64, query string, tags TagFilter, docType *string, limit int, mode SearchMode, inherit bool) ([]Bookmark, error) {
+	search := db.SearchBookmarks
+	if inherit {
+		search = db.SearchBookmarksInherited
+	}
+
+	candidates, err := search(projectID, "", tags, docType)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(candidates))
+	for i, b := range candidates {
+		ids[i] = b.ID
+	}
+	similarity, err := db.similarities("bookmark", query, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	lexical := map[int64]float64{}
+	if mode == SearchHybrid {
+		matches, err := search(projectID, query, tags, docType)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range matches {
+			lexical[b.ID] = 1
+		}
+	}
+
+	scores := make([]float64, len(candidates))
+	for i, b := range candidates {
+		scores[i] = blendScore(mode, similarity[b.ID], lexical[b.ID])
+	}
+
+	var results []Bookmark
+	for _, i := range rankIndices(scores, limit) {
+		b := candidates[i]
+		b.Score = scores[i]
+		results = append(results, b)
+	}
+	return results, nil
+}
+
+func blendScore(mode SearchMode, similarity, lexical float64) float64 {
+	if mode == SearchHybrid {
+		return hybridWeight*similarity + (1-hybridWeight)*lexical
+	}
+	return similarity
+}
+
+// rankIndices returns the indices of scores at or above minScore, best first
+func rankIndices(scores []float64, limit int) []int {
+	var indices []int
+	for i, s := range scores {
+		if s >= minScore {
+			indices = append(indices, i)
+		}
+	}
+	sort.SliceStable(indices, func(a, b int) bool {
+		return scores[indices[a]] > scores[indices[b]]
+	})
+	if limit > 0 && len(indices) > limit {
+		indices = indices[:limit]
+	}
+	return indices
+}
+
+// similarities embeds the query and returns its cosine similarity to each
+// row's stored vector. Only the query is embedded: rows are embedded by
+// IndexEmbeddings, and rows it has not reached yet, or whose vector is from
+// another embedder, have no similarity.
+func (db *DB) similarities(entityType, query string, ids []int64) (map[int64]float64, error) {
+	if len(ids) == 0 {
+		return map[int64]float64{}, nil
+	}
+
+	queryVec, err := db.embedder.Embed(query)
+	if err != nil {
+		return nil, fmt.Errorf("embedding query: %w", err)
+	}
+
+	vectors, err := db.loadEmbeddings(entityType, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	model := db.embedder.Name()
+	result := make(map[int64]float64, len(ids))
+	for id, stored := range vectors {
+		if stored.model == model {
+			result[id] = embed.Cosine(queryVec, stored.vector)
+		}
+	}
+	return result, nil
+}
+
+type storedVector struct {
+	model  string
+	hash   string
+	vector []float32
+}
+
+// loadEmbeddings reads the stored vectors of a set of rows
+func (db *DB) loadEmbeddings(entityType string, ids []int64) (map[int64]storedVector, error) {
+	const batch = 500
+	vectors := make(map[int64]storedVector, len(ids))
+	for start := 0; start < len(ids); start += batch {
+		end := min(start+batch, len(ids))
+
+		placeholders := make([]string, 0, end-start)
+		args := []interface{}{entityType}
+		for _, id := range ids[start:end] {
+			placeholders = append(placeholders, "?")
+			args = append(args, id)
+		}
+
+		rows, err := db.Query(
+			fmt.Sprintf("SELECT entity_id, model, content_hash, vector FROM embeddings WHERE entity_type = ? AND entity_id IN (%s)", strings.Join(placeholders, ", ")),
+			args...,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int64
+			var sv storedVector
+			var blob []byte
+			if err := rows.Scan(&id, &sv.model, &sv.hash, &blob); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if sv.vector, err = embed.Decode(blob); err != nil {
+				continue // re-embedded by IndexEmbeddings
+			}
+			vectors[id] = sv
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return vectors, nil
+}
+
+// embeddedEntities lists the entities semantic search ranks, with the columns
+// whose text, followed by the tags, is embedded
+var embeddedEntities = []struct {
+	entityType string
+	table      string
+	columns    []string
+	tags       string
+}{
+	{"memory", "memories", []string{"content"}, "keywords"},
+	{"guideline", "guidelines", []string{"title", "category", "content"}, "tags"},
+	{"bookmark", "bookmarks", []string{"title", "excerpt", "note", "url"}, "tags"},
+}
+
+type embedDoc struct {
+	entityType string
+	id         int64
+	text       string
+}
+
+// IndexEmbeddings embeds up to limit rows that have no stored vector, or whose
+// text or embedder changed since they were embedded, and stores the vectors
+// in one transaction. It returns how many rows it embedded; fewer than limit
+// means the index is current, apart from rows that failed to embed, which are
+// retried on the next call and reported in the error.
+func (db *DB) IndexEmbeddings(limit int) (int, error) {
+	docs, err := db.staleEmbeddings(limit)
+	if err != nil {
+		return 0, err
+	}
+
+	// Embed before opening the transaction, since embedders may call out to
+	// a server
+	model := db.embedder.Name()
+	vectors := make([][]float32, len(docs))
+	var embedErr error
+	for i, d := range docs {
+		vec, err := db.embedder.Embed(d.text)
+		if err != nil {
+			embedErr = errors.Join(embedErr, fmt.Errorf("embedding %s %d: %w", d.entityType, d.id, err))
+			continue
+		}
+		vectors[i] = vec
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	indexed := 0
+	for i, d := range docs {
+		if vectors[i] == nil {
+			continue
+		}
+		_, err := tx.Exec(
+			"INSERT INTO embeddings (entity_type, entity_id, model, content_hash, vector) VALUES (?, ?, ?, ?, ?) ON CONFLICT(entity_type, entity_id) DO UPDATE SET model = excluded.model, content_hash = excluded.content_hash, vector = excluded.vector",
+			d.entityType, d.id, model, contentHash(d.text), embed.Encode(vectors[i]),
+		)
+		if err != nil {
+			return 0, fmt.Errorf("storing embedding: %w", err)
+		}
+		indexed++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return indexed, embedErr
+}
+
+// staleEmbeddings returns up to limit rows whose stored vector is missing or
+// out of date, with the text to embed
+func (db *DB) staleEmbeddings(limit int) ([]embedDoc, error) {
+	model := db.embedder.Name()
+	var docs []embedDoc
+	for _, e := range embeddedEntities {
+		if len(docs) >= limit {
+			break
+		}
+		columns := make([]string, len(e.columns))
+		for i, c := range e.columns {
+			columns[i] = "COALESCE(t." + c + ", '')"
+		}
+		rows, err := db.Query(
+			fmt.Sprintf(`SELECT t.id, %s, t.%s, COALESCE(e.model, ''), COALESCE(e.content_hash, '')
+				FROM %s t LEFT JOIN embeddings e ON e.entity_type = ? AND e.entity_id = t.id
+				ORDER BY t.id`, strings.Join(columns, ", "), e.tags, e.table),
+			e.entityType,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for len(docs) < limit && rows.Next() {
+			d := embedDoc{entityType: e.entityType}
+			text := make([]string, len(e.columns))
+			var tags sql.NullString
+			var storedModel, storedHash string
+			dest := []interface{}{&d.id}
+			for i := range text {
+				dest = append(dest, &text[i])
+			}
+			dest = append(dest, &tags, &storedModel, &storedHash)
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			var tagList []string
+			if tags.Valid {
+				json.Unmarshal([]byte(tags.String), &tagList)
+			}
+			d.text = strings.Join(text, "\n") + "\n" + strings.Join(tagList, " ")
+			if storedModel != model || storedHash != contentHash(d.text) {
+				docs = append(docs, d)
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/rocket/mcp-memories/internal/embed"
+)
+
+// countingEmbedder records the texts it is asked to embed
+type countingEmbedder struct {
+	embed.HashEmbedder
+	texts []string
+}
+
+func (e *countingEmbedder) Embed(text string) ([]float32, error) {
+	e.texts = append(e.texts, text)
+	return e.HashEmbedder.Embed(text)
+}
+
+// TestIndexEmbeddings verifies that searches only read stored vectors and that
+// IndexEmbeddings embeds missing and stale rows in capped batches
+func TestIndexEmbeddings(t *testing.T) {
+	database, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	embedder := &countingEmbedder{HashEmbedder: *embed.NewHashEmbedder()}
+	database.SetEmbedder(embedder)
+
+	first, _ := database.CreateMemory(nil, "Schema migrations run on startup", []string{"sqlite"})
+	database.CreateMemory(nil, "Release notes live in the changelog", nil)
+	database.CreateGuideline(nil, "workflow", "Migrations", "Append a new migration", nil, 0)
+
+	t.Run("search reads stored vectors", func(t *testing.T) {
+		results, err := database.SemanticSearchMemories(nil, "schema migrations", MemoryFilter{}, SearchSemantic)
+		if err != nil {
+			t.Fatalf("SemanticSearchMemories failed: %v", err)
+		}
+		if len(results) != 0 || len(embedder.texts) != 1 {
+			t.Errorf("Expected only the query to be embedded, got %d results and texts %q", len(results), embedder.texts)
+		}
+	})
+
+	t.Run("batches", func(t *testing.T) {
+		embedder.texts = nil
+		if n, err := database.IndexEmbeddings(2); err != nil || n != 2 {
+			t.Fatalf("Expected 2 rows indexed, got %d, %v", n, err)
+		}
+		if n, err := database.IndexEmbeddings(2); err != nil || n != 1 {
+			t.Fatalf("Expected 1 row indexed, got %d, %v", n, err)
+		}
+		if n, err := database.IndexEmbeddings(2); err != nil || n != 0 {
+			t.Fatalf("Expected an up-to-date index, got %d, %v", n, err)
+		}
+		if len(embedder.texts) != 3 || embedder.texts[0] != "Schema migrations run on startup\nsqlite" {
+			t.Errorf("Unexpected embedded texts: %q", embedder.texts)
+		}
+
+		results, err := database.SemanticSearchMemories(nil, "schema migrations", MemoryFilter{}, SearchSemantic)
+		if err != nil {
+			t.Fatalf("SemanticSearchMemories failed: %v", err)
+		}
+		if len(results) == 0 || results[0].ID != first.ID {
+			t.Errorf("Expected the indexed memory first, got %+v", results)
+		}
+	})
+
+	t.Run("changed text", func(t *testing.T) {
+		content := "Schema migrations run before serving"
+		database.UpdateMemory(first.ID, &content, nil, nil, nil)
+		embedder.texts = nil
+		if n, err := database.IndexEmbeddings(10); err != nil || n != 1 {
+			t.Fatalf("Expected the updated memory to be re-indexed, got %d, %v", n, err)
+		}
+		if len(embedder.texts) != 1 || embedder.texts[0] != content+"\nsqlite" {
+			t.Errorf("Unexpected embedded texts: %q", embedder.texts)
+		}
+	})
+}
@@ -0,0 +1,391 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// TagTypes lists the entity types that carry tags. Memories call their tags
+// keywords.
+var TagTypes = []string{"memory", "guideline", "bookmark"}
+
+// taggedEntity describes where an entity type keeps its tags
+type taggedEntity struct {
+	table  string
+	column string // JSON copy of the tags, kept in their original order
+	join   string // join table to tags
+	key    string // join table column referencing the entity
+	change string // Change entity to notify, if any
+}
+
+var taggedEntities = map[string]taggedEntity{
+	"memory":    {table: "memories", column: "keywords", join: "memory_tags", key: "memory_id", change: "memory"},
+	"guideline": {table: "guidelines", column: "tags", join: "guideline_tags", key: "guideline_id", change: "guideline"},
+	"bookmark":  {table: "bookmarks", column: "tags", join: "bookmark_tags", key: "bookmark_id"},
+}
+
+// Tag is a tag with the number of entities that carry it
+type Tag struct {
+	Name       string `json:"name"`
+	Count      int    `json:"count"`
+	Memories   int    `json:"memories"`
+	Guidelines int    `json:"guidelines"`
+	Bookmarks  int    `json:"bookmarks"`
+}
+
+// TagFilter matches entities by their tags: they must have every tag in All,
+// at least one in Any, and none in None. Tags compare case-insensitively.
+type TagFilter struct {
+	All  []string
+	Any  []string
+	None []string
+}
+
+// conditions returns the SQL conditions for f on an entity type, whose ID is
+// the expression id
+func (f TagFilter) conditions(typ, id string) ([]string, []interface{}) {
+	e := taggedEntities[typ]
+	tagged := func(n int) string {
+		return fmt.Sprintf(
+			"SELECT jt.%s FROM %s jt JOIN tags t ON t.id = jt.tag_id WHERE t.name IN (%s)",
+			e.key, e.join, strings.TrimSuffix(strings.Repeat("?, ", n), ", "),
+		)
+	}
+
+	var conditions []string
+	var args []interface{}
+	for _, tag := range normalizeTags(f.All) {
+		conditions = append(conditions, id+" IN ("+tagged(1)+")")
+		args = append(args, tag)
+	}
+	for _, set := range []struct {
+		tags []string
+		op   string
+	}{{normalizeTags(f.Any), "IN"}, {normalizeTags(f.None), "NOT IN"}} {
+		if len(set.tags) == 0 {
+			continue
+		}
+		conditions = append(conditions, fmt.Sprintf("%s %s (%s)", id, set.op, tagged(len(set.tags))))
+		for _, tag := range set.tags {
+			args = append(args, tag)
+		}
+	}
+	return conditions, args
+}
+
+// normalizeTags lowercases and trims tags, dropping empty and repeated ones
+// but keeping their order
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	out := []string{}
+	for _, tag := range normalizeLabels(tags) {
+		if !seen[tag] {
+			seen[tag] = true
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// tagsJSON is the JSON copy of normalized tags stored on the entity
+func tagsJSON(tags []string) string {
+	data, _ := json.Marshal(tags)
+	return string(data)
+}
+
+// setTags replaces the join rows of an entity with normalized tags,
+// creating tags that don't exist yet
+func setTags(e execer, typ string, id int64, tags []string) error {
+	entity := taggedEntities[typ]
+	if _, err := e.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = ?", entity.join, entity.key), id); err != nil {
+		return fmt.Errorf("clearing tags: %w", err)
+	}
+	for _, tag := range tags {
+		if _, err := e.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", tag); err != nil {
+			return fmt.Errorf("creating tag: %w", err)
+		}
+		if _, err := e.Exec(
+			fmt.Sprintf("INSERT OR IGNORE INTO %s (%s, tag_id) SELECT ?, id FROM tags WHERE name = ?", entity.join, entity.key),
+			id, tag,
+		); err != nil {
+			return fmt.Errorf("tagging %s %d: %w", typ, id, err)
+		}
+	}
+	return nil
+}
+
+// ListTags lists the tags used in a project, or in every project when
+// projectID is nil, most used first
+func (db *DB) ListTags(projectID *int64) ([]Tag, error) {
+	return db.listTags(projectID, nil)
+}
+
+// ListTagsPage lists a page of the tags ListTags returns, along with how many
+// there are
+func (db *DB) ListTagsPage(projectID *int64, page PageRequest) (*Page[Tag], error) {
+	uses, args := tagUses(projectID)
+	var total int
+	if err := db.QueryRow("SELECT COUNT(DISTINCT tag_id) FROM ("+uses+")", args...).Scan(&total); err != nil {
+		return nil, err
+	}
+	tags, err := db.listTags(projectID, &page)
+	if err != nil {
+		return nil, err
+	}
+	return NewPage(tags, total, page), nil
+}
+
+// tagUses returns the query that selects each use of a tag in a project, or
+// in every project when projectID is nil, with the type of entity tagged
+func tagUses(projectID *int64) (string, []interface{}) {
+	var counts []string
+	var args []interface{}
+	for _, typ := range TagTypes {
+		e := taggedEntities[typ]
+		query := fmt.Sprintf(
+			"SELECT jt.tag_id, '%s' AS type FROM %s jt JOIN %s e ON e.id = jt.%s",
+			typ, e.join, e.table, e.key,
+		)
+		if projectID != nil {
+			query += " WHERE e.project_id = ?"
+			args = append(args, *projectID)
+		}
+		counts = append(counts, query)
+	}
+	return strings.Join(counts, " UNION ALL "), args
+}
+
+// listTags lists the tags ListTags returns, or a page of them
+func (db *DB) listTags(projectID *int64, page *PageRequest) ([]Tag, error) {
+	uses, args := tagUses(projectID)
+	query, args := pageClause(fmt.Sprintf(
+		`SELECT t.name, COUNT(*),
+			SUM(u.type = 'memory'), SUM(u.type = 'guideline'), SUM(u.type = 'bookmark')
+		FROM (%s) u JOIN tags t ON t.id = u.tag_id
+		GROUP BY t.id ORDER BY COUNT(*) DESC, t.name`,
+		uses,
+	), args, page)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.Name, &t.Count, &t.Memories, &t.Guidelines, &t.Bookmarks); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// RenameTag renames a tag in every project, returning the number of entities
+// of each type that carried it. Use MergeTags to rename a tag onto one that
+// already exists.
+func (db *DB) RenameTag(from, to string) (map[string]int, error) {
+	from, to = strings.ToLower(strings.TrimSpace(from)), strings.ToLower(strings.TrimSpace(to))
+	if from == "" || to == "" {
+		return nil, fmt.Errorf("both tag names are required")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id, err := lookupID(tx, "SELECT id FROM tags WHERE name = ?", from)
+	if err != nil {
+		return nil, err
+	}
+	if id == 0 {
+		return nil, fmt.Errorf("tag %q not found", from)
+	}
+	if from == to {
+		tx.Rollback()
+		return db.countTagged(id)
+	}
+	if existing, err := lookupID(tx, "SELECT id FROM tags WHERE name = ?", to); err != nil {
+		return nil, err
+	} else if existing != 0 {
+		return nil, fmt.Errorf("tag %q already exists; merge the tags instead", to)
+	}
+
+	if _, err := tx.Exec("UPDATE tags SET name = ? WHERE id = ?", to, id); err != nil {
+		return nil, fmt.Errorf("renaming tag: %w", err)
+	}
+	changes, err := retagColumns(tx, []int64{id}, map[string]string{from: to})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return db.notifyRetagged(changes), nil
+}
+
+// MergeTags moves every entity tagged with one of sources to the tag into,
+// creating it if needed, and deletes the source tags. It returns the number
+// of entities of each type that were retagged.
+func (db *DB) MergeTags(sources []string, into string) (map[string]int, error) {
+	into = strings.ToLower(strings.TrimSpace(into))
+	if into == "" {
+		return nil, fmt.Errorf("target tag is required")
+	}
+	sources = normalizeTags(sources)
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("at least one source tag is required")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var sourceIDs []int64
+	rename := map[string]string{}
+	for _, name := range sources {
+		if name == into {
+			continue
+		}
+		id, err := lookupID(tx, "SELECT id FROM tags WHERE name = ?", name)
+		if err != nil {
+			return nil, err
+		}
+		if id == 0 {
+			return nil, fmt.Errorf("tag %q not found", name)
+		}
+		sourceIDs = append(sourceIDs, id)
+		rename[name] = into
+	}
+	if _, err := tx.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", into); err != nil {
+		return nil, err
+	}
+
+	// Rewrite the JSON copies while the source tags still have their rows
+	changes, err := retagColumns(tx, sourceIDs, rename)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range sourceIDs {
+		for _, typ := range TagTypes {
+			e := taggedEntities[typ]
+			if _, err := tx.Exec(fmt.Sprintf(
+				"INSERT OR IGNORE INTO %[1]s (%[2]s, tag_id) SELECT %[2]s, (SELECT id FROM tags WHERE name = ?) FROM %[1]s WHERE tag_id = ?",
+				e.join, e.key,
+			), into, id); err != nil {
+				return nil, fmt.Errorf("merging tags: %w", err)
+			}
+		}
+		if _, err := tx.Exec("DELETE FROM tags WHERE id = ?", id); err != nil {
+			return nil, fmt.Errorf("deleting tag: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return db.notifyRetagged(changes), nil
+}
+
+// retagged is an entity whose tags were renamed
+type retagged struct {
+	typ       string
+	id        int64
+	projectID int64
+}
+
+// retagColumns rewrites the JSON tag copies of every entity carrying one of
+// tagIDs, renaming tags as given
+func retagColumns(tx *sql.Tx, tagIDs []int64, rename map[string]string) ([]retagged, error) {
+	if len(tagIDs) == 0 {
+		return nil, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(tagIDs)), ", ")
+	args := make([]interface{}, len(tagIDs))
+	for i, id := range tagIDs {
+		args[i] = id
+	}
+
+	var changes []retagged
+	for _, typ := range TagTypes {
+		e := taggedEntities[typ]
+		rows, err := tx.Query(fmt.Sprintf(
+			"SELECT id, project_id, %s FROM %s WHERE id IN (SELECT %s FROM %s WHERE tag_id IN (%s))",
+			e.column, e.table, e.key, e.join, placeholders,
+		), args...)
+		if err != nil {
+			return nil, err
+		}
+		type entity struct {
+			retagged
+			tags []string
+		}
+		var entities []entity
+		for rows.Next() {
+			var ent entity
+			var data sql.NullString
+			if err := rows.Scan(&ent.id, &ent.projectID, &data); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			ent.typ = typ
+			json.Unmarshal([]byte(data.String), &ent.tags)
+			entities = append(entities, ent)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		for _, ent := range entities {
+			for i, tag := range ent.tags {
+				if to, ok := rename[strings.ToLower(tag)]; ok {
+					ent.tags[i] = to
+				}
+			}
+			if _, err := tx.Exec(
+				fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", e.table, e.column),
+				tagsJSON(normalizeTags(ent.tags)), ent.id,
+			); err != nil {
+				return nil, err
+			}
+			changes = append(changes, ent.retagged)
+		}
+	}
+	return changes, nil
+}
+
+// notifyRetagged reports retagged entities to change listeners and counts
+// them by type
+func (db *DB) notifyRetagged(changes []retagged) map[string]int {
+	counts := map[string]int{}
+	for _, typ := range TagTypes {
+		counts[typ] = 0
+	}
+	for _, c := range changes {
+		counts[c.typ]++
+		if entity := taggedEntities[c.typ].change; entity != "" {
+			db.notify(Change{Entity: entity, Op: OpUpdate, ProjectID: c.projectID, ID: c.id})
+		}
+	}
+	return counts
+}
+
+// countTagged counts the entities of each type carrying a tag
+func (db *DB) countTagged(tagID int64) (map[string]int, error) {
+	counts := map[string]int{}
+	for _, typ := range TagTypes {
+		e := taggedEntities[typ]
+		var n int
+		if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE tag_id = ?", e.join), tagID).Scan(&n); err != nil {
+			return nil, err
+		}
+		counts[typ] = n
+	}
+	return counts, nil
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/rocket/mcp-memories/internal/schema"
+)
+
+// TestTags verifies tag normalization, any/all/none filters, counting, and
+// renaming and merging tags across entity types
+func TestTags(t *testing.T) {
+	database, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	p, _ := database.CreateProject("app", "App", "")
+	auth, err := database.CreateMemory(&p.ID, "Tokens expire after an hour", []string{"Auth", " JWT ", "auth"})
+	if err != nil {
+		t.Fatalf("CreateMemory failed: %v", err)
+	}
+	if len(auth.Keywords) != 2 || auth.Keywords[0] != "auth" || auth.Keywords[1] != "jwt" {
+		t.Errorf("Expected normalized keywords, got %v", auth.Keywords)
+	}
+	cache, _ := database.CreateMemory(&p.ID, "Sessions are cached in Redis", []string{"cache", "auth"})
+	database.CreateMemory(&p.ID, "Redis runs on port 6379", []string{"cache"})
+	database.CreateGuideline(&p.ID, "security", "Rotate keys", "Rotate signing keys monthly", []string{"Auth"}, 0)
+	database.CreateBookmark(&p.ID, "https://jwt.io", "JWT debugger", "", "", "", "", []string{"jwt", "tools"})
+
+	for _, tc := range []struct {
+		name   string
+		filter TagFilter
+		want   int
+	}{
+		{"all", TagFilter{All: []string{"AUTH", "cache"}}, 1},
+		{"any", TagFilter{Any: []string{"jwt", "cache"}}, 3},
+		{"none", TagFilter{None: []string{"auth"}}, 1},
+		{"combined", TagFilter{All: []string{"auth"}, None: []string{"jwt"}}, 1},
+	} {
+		memories, err := database.SearchMemories(&p.ID, "", MemoryFilter{Keywords: tc.filter})
+		if err != nil {
+			t.Fatalf("SearchMemories failed: %v", err)
+		}
+		if len(memories) != tc.want {
+			t.Errorf("%s: expected %d memories, got %d", tc.name, tc.want, len(memories))
+		}
+	}
+	if guidelines, _ := database.SearchGuidelines(&p.ID, "", nil, TagFilter{All: []string{"auth"}}); len(guidelines) != 1 {
+		t.Errorf("Expected the tagged guideline, got %+v", guidelines)
+	}
+	if bookmarks, _ := database.SearchBookmarks(&p.ID, "", TagFilter{None: []string{"jwt"}}, nil); len(bookmarks) != 0 {
+		t.Errorf("Expected the jwt bookmark to be excluded, got %+v", bookmarks)
+	}
+
+	database.UpdateMemory(cache.ID, nil, nil, []string{"Redis"}, []string{"AUTH"})
+	tags, err := database.ListTags(&p.ID)
+	if err != nil {
+		t.Fatalf("ListTags failed: %v", err)
+	}
+	want := []string{"auth:2", "cache:2", "jwt:2", "redis:1", "tools:1"}
+	if len(tags) != len(want) {
+		t.Fatalf("Expected tags %v, got %+v", want, tags)
+	}
+	for i, tag := range tags {
+		if got := fmt.Sprintf("%s:%d", tag.Name, tag.Count); got != want[i] {
+			t.Errorf("Tag %d: expected %s, got %s", i, want[i], got)
+		}
+	}
+	if tags[0].Memories != 1 || tags[0].Guidelines != 1 {
+		t.Errorf("Expected auth counted per type, got %+v", tags[0])
+	}
+
+	t.Run("rename", func(t *testing.T) {
+		if _, err := database.RenameTag("auth", "cache"); err == nil {
+			t.Error("Expected renaming onto an existing tag to fail")
+		}
+		retagged, err := database.RenameTag("Auth", "authentication")
+		if err != nil {
+			t.Fatalf("RenameTag failed: %v", err)
+		}
+		if retagged["memory"] != 1 || retagged["guideline"] != 1 {
+			t.Errorf("Unexpected retagged counts: %v", retagged)
+		}
+		m, _ := database.GetMemory(auth.ID)
+		if len(m.Keywords) != 2 || m.Keywords[0] != "authentication" {
+			t.Errorf("Expected the keyword renamed in place, got %v", m.Keywords)
+		}
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		retagged, err := database.MergeTags([]string{"jwt", "authentication"}, "security")
+		if err != nil {
+			t.Fatalf("MergeTags failed: %v", err)
+		}
+		if retagged["memory"] != 1 || retagged["guideline"] != 1 || retagged["bookmark"] != 1 {
+			t.Errorf("Unexpected retagged counts: %v", retagged)
+		}
+		m, _ := database.GetMemory(auth.ID)
+		if len(m.Keywords) != 1 || m.Keywords[0] != "security" {
+			t.Errorf("Expected merged keywords to collapse, got %v", m.Keywords)
+		}
+		tags, _ := database.ListTags(nil)
+		if tags[0].Name != "security" || tags[0].Count != 3 {
+			t.Errorf("Expected security on 3 entities, got %+v", tags)
+		}
+		if _, err := database.MergeTags([]string{"missing"}, "security"); err == nil {
+			t.Error("Expected merging a missing tag to fail")
+		}
+	})
+}
+
+// TestTagsMigration verifies that tags stored as JSON are normalized into
+// the tags tables on upgrade
+func TestTagsMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	legacy, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("sql.Open failed: %v", err)
+	}
+	for _, m := range schema.Migrations[:len(schema.Migrations)-1] {
+		if _, err := legacy.Exec(m.SQL); err != nil {
+			t.Fatalf("applying migration %d: %v", m.Version, err)
+		}
+	}
+	for _, stmt := range []string{
+		fmt.Sprintf("PRAGMA user_version = %d", schema.Migrations[len(schema.Migrations)-2].Version),
+		`INSERT INTO memories (project_id, content, keywords) VALUES (1, 'legacy', '["Go", " go ", "", "DB"]')`,
+		`INSERT INTO guidelines (project_id, category, title, content, tags) VALUES (1, 'style', 'Legacy', '', 'null')`,
+		`INSERT INTO bookmarks (project_id, url, title, tags) VALUES (1, 'https://go.dev', 'Go', '["go"]')`,
+	} {
+		if _, err := legacy.Exec(stmt); err != nil {
+			t.Fatalf("preparing legacy database: %v", err)
+		}
+	}
+	legacy.Close()
+
+	database, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer database.Close()
+
+	memories, _ := database.SearchMemories(nil, "", MemoryFilter{Keywords: TagFilter{All: []string{"go", "db"}}})
+	if len(memories) != 1 || len(memories[0].Keywords) != 2 || memories[0].Keywords[0] != "go" {
+		t.Fatalf("Expected normalized legacy keywords, got %+v", memories)
+	}
+	tags, _ := database.ListTags(nil)
+	if len(tags) != 2 || tags[0].Name != "go" || tags[0].Memories != 1 || tags[0].Bookmarks != 1 {
+		t.Errorf("Expected go and db tags, got %+v", tags)
+	}
+}
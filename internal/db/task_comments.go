@@ -0,0 +1,129 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TaskComment is a note left on a task
+type TaskComment struct {
+	ID        int64     `json:"id"`
+	TaskID    int64     `json:"task_id"`
+	Author    string    `json:"author,omitempty"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TaskActivity records one change to a task's title, status or priority
+type TaskActivity struct {
+	ID        int64     `json:"id"`
+	TaskID    int64     `json:"task_id"`
+	Field     string    `json:"field"`
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddTaskComment adds a comment to a task
+func (db *DB) AddTaskComment(taskID int64, author, content string) (*TaskComment, error) {
+	if _, err := db.GetTask(taskID); err != nil {
+		return nil, fmt.Errorf("task %d: %w", taskID, err)
+	}
+	id, err := addTaskComment(db, taskID, author, content)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &TaskComment{}
+	var authorCol sql.NullString
+	err = db.QueryRow(
+		"SELECT id, task_id, author, content, created_at FROM task_comments WHERE id = ?", id,
+	).Scan(&c.ID, &c.TaskID, &authorCol, &c.Content, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	c.Author = authorCol.String
+	return c, nil
+}
+
+// addTaskComment inserts a comment and returns its ID
+func addTaskComment(e execer, taskID int64, author, content string) (int64, error) {
+	result, err := e.Exec(
+		"INSERT INTO task_comments (task_id, author, content) VALUES (?, ?, ?)",
+		taskID, author, content,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("adding comment: %w", err)
+	}
+	id, _ := result.LastInsertId()
+	return id, nil
+}
+
+// ListTaskComments lists a task's comments, oldest first
+func (db *DB) ListTaskComments(taskID int64) ([]TaskComment, error) {
+	return db.listTaskComments(taskID, nil)
+}
+
+// ListTaskCommentsPage lists a page of a task's comments, oldest first, along
+// with how many there are
+func (db *DB) ListTaskCommentsPage(taskID int64, page PageRequest) (*Page[TaskComment], error) {
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM task_comments WHERE task_id = ?", taskID).Scan(&total); err != nil {
+		return nil, err
+	}
+	comments, err := db.listTaskComments(taskID, &page)
+	if err != nil {
+		return nil, err
+	}
+	return NewPage(comments, total, page), nil
+}
+
+// listTaskComments lists a task's comments, or a page of them
+func (db *DB) listTaskComments(taskID int64, page *PageRequest) ([]TaskComment, error) {
+	query, args := pageClause(
+		"SELECT id, task_id, author, content, created_at FROM task_comments WHERE task_id = ? ORDER BY created_at, id",
+		[]interface{}{taskID}, page,
+	)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []TaskComment{}
+	for rows.Next() {
+		var c TaskComment
+		var author sql.NullString
+		if err := rows.Scan(&c.ID, &c.TaskID, &author, &c.Content, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		c.Author = author.String
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+// ListTaskActivity lists the recorded changes to a task, oldest first
+func (db *DB) ListTaskActivity(taskID int64) ([]TaskActivity, error) {
+	rows, err := db.Query(
+		"SELECT id, task_id, field, old_value, new_value, created_at FROM task_activity WHERE task_id = ? ORDER BY created_at, id",
+		taskID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activity := []TaskActivity{}
+	for rows.Next() {
+		var a TaskActivity
+		var oldValue, newValue sql.NullString
+		if err := rows.Scan(&a.ID, &a.TaskID, &a.Field, &oldValue, &newValue, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.OldValue, a.NewValue = oldValue.String, newValue.String
+		activity = append(activity, a)
+	}
+	return activity, rows.Err()
+}
@@ -0,0 +1,60 @@
+package db
+
+import "testing"
+
+// TestTaskCommentsAndActivity verifies that comments are kept per task and
+// that UpdateTask logs title, status and priority changes
+func TestTaskCommentsAndActivity(t *testing.T) {
+	database, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	task, _ := database.CreateTask(nil, nil, "Fix flaky test", "", 1)
+
+	first, err := database.AddTaskComment(task.ID, "agent-a", "Tried a longer timeout, still flaky")
+	if err != nil {
+		t.Fatalf("AddTaskComment failed: %v", err)
+	}
+	if first.Author != "agent-a" || first.TaskID != task.ID {
+		t.Errorf("Unexpected comment: %+v", first)
+	}
+	database.AddTaskComment(task.ID, "", "Race in the fixture setup")
+	if _, err := database.AddTaskComment(999, "", "Nowhere"); err == nil {
+		t.Error("Expected error commenting on a missing task")
+	}
+
+	comments, _ := database.ListTaskComments(task.ID)
+	if len(comments) != 2 || comments[0].ID != first.ID || comments[1].Author != "" {
+		t.Errorf("Unexpected comments: %+v", comments)
+	}
+
+	blocked, title, description, priority := "blocked", "Fix flaky fixture", "Details", 3
+	database.UpdateTask(task.ID, &title, &description, &blocked, &priority)
+	database.UpdateTask(task.ID, &title, nil, &blocked, nil) // no change, nothing logged
+
+	activity, err := database.ListTaskActivity(task.ID)
+	if err != nil {
+		t.Fatalf("ListTaskActivity failed: %v", err)
+	}
+	want := []TaskActivity{
+		{Field: "title", OldValue: "Fix flaky test", NewValue: "Fix flaky fixture"},
+		{Field: "status", OldValue: "todo", NewValue: "blocked"},
+		{Field: "priority", OldValue: "1", NewValue: "3"},
+	}
+	if len(activity) != len(want) {
+		t.Fatalf("Expected %d activity entries, got %+v", len(want), activity)
+	}
+	for i, w := range want {
+		a := activity[i]
+		if a.Field != w.Field || a.OldValue != w.OldValue || a.NewValue != w.NewValue || a.CreatedAt.IsZero() {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, w, a)
+		}
+	}
+
+	database.DeleteTask(task.ID, false)
+	if comments, _ := database.ListTaskComments(task.ID); len(comments) != 0 {
+		t.Errorf("Expected comments to be deleted with the task, got %+v", comments)
+	}
+}
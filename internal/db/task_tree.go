@@ -0,0 +1,120 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// TaskNode is a task with its subtasks nested beneath it
+type TaskNode struct {
+	Task
+	Progress *TaskProgress `json:"progress,omitempty"`
+	Subtasks []*TaskNode   `json:"subtasks,omitempty"`
+}
+
+// TaskProgress counts a task's descendants at every depth and how many of
+// them are closed
+type TaskProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// GetTaskTree returns the task rootID with all its descendants nested beneath
+// it, or every task of the project as a forest of root tasks when rootID is
+// nil. Siblings are ordered like ListTasks.
+func (db *DB) GetTaskTree(projectID *int64, rootID *int64) ([]*TaskNode, error) {
+	var tasks []Task
+	var err error
+	if rootID != nil {
+		tasks, err = db.queryTasks(
+			"SELECT "+taskColumns+" FROM tasks WHERE id IN ("+subtreeIDs+") ORDER BY priority DESC, created_at, id",
+			*rootID,
+		)
+		if err == nil && len(tasks) == 0 {
+			err = fmt.Errorf("task %d: %w", *rootID, sql.ErrNoRows)
+		}
+	} else {
+		tasks, err = db.ListTasks(projectID, TaskFilter{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int64]*TaskNode, len(tasks))
+	for i := range tasks {
+		nodes[tasks[i].ID] = &TaskNode{Task: tasks[i]}
+	}
+	roots := []*TaskNode{}
+	for i := range tasks {
+		node := nodes[tasks[i].ID]
+		var parent *TaskNode
+		if node.ParentID != nil {
+			parent = nodes[*node.ParentID]
+		}
+		if parent != nil {
+			parent.Subtasks = append(parent.Subtasks, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	for _, root := range roots {
+		root.rollUp()
+	}
+	return roots, nil
+}
+
+// rollUp fills in Progress for the node and its descendants and returns the
+// node's own counts
+func (n *TaskNode) rollUp() TaskProgress {
+	var p TaskProgress
+	for _, child := range n.Subtasks {
+		sub := child.rollUp()
+		p.Done += sub.Done
+		p.Total += sub.Total + 1
+		if child.CompletedAt != nil {
+			p.Done++
+		}
+	}
+	if p.Total > 0 {
+		n.Progress = &p
+	}
+	return p
+}
+
+// ErrTaskCycle is returned when moving a task beneath itself or one of its
+// descendants
+var ErrTaskCycle = errors.New("a task cannot be moved beneath itself or one of its subtasks")
+
+// MoveTask re-parents a task within its project; a nil parentID makes it a
+// root task. Its subtasks move with it.
+func (db *DB) MoveTask(id int64, parentID *int64) (*Task, error) {
+	task, err := db.GetTask(id)
+	if err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		parent, err := db.GetTask(*parentID)
+		if err != nil {
+			return nil, fmt.Errorf("parent task %d: %w", *parentID, err)
+		}
+		if parent.ProjectID != task.ProjectID {
+			return nil, fmt.Errorf("parent task %d belongs to another project", *parentID)
+		}
+		var inSubtree int
+		if err := db.QueryRow("SELECT COUNT(*) FROM ("+subtreeIDs+") WHERE id = ?", id, *parentID).Scan(&inSubtree); err != nil {
+			return nil, err
+		}
+		if inSubtree > 0 {
+			return nil, ErrTaskCycle
+		}
+	}
+
+	if _, err := db.Exec(
+		"UPDATE tasks SET parent_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		parentID, id,
+	); err != nil {
+		return nil, fmt.Errorf("moving task: %w", err)
+	}
+	return db.GetTask(id)
+}
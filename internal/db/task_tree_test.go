@@ -0,0 +1,107 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestTaskTree verifies nesting, rolled-up progress, recursive deletion and
+// moving tasks without creating cycles
+func TestTaskTree(t *testing.T) {
+	database, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	done := "done"
+	release, _ := database.CreateTask(nil, nil, "Release", "", 1)
+	backend, _ := database.CreateTask(nil, &release.ID, "Backend", "", 0)
+	schema, _ := database.CreateTask(nil, &backend.ID, "Schema", "", 0)
+	database.CreateTask(nil, &backend.ID, "API", "", 0)
+	docs, _ := database.CreateTask(nil, &release.ID, "Docs", "", 0)
+	standalone, _ := database.CreateTask(nil, nil, "Standalone", "", 0)
+	database.UpdateTask(schema.ID, nil, nil, &done, nil)
+	database.UpdateTask(docs.ID, nil, nil, &done, nil)
+
+	t.Run("tree", func(t *testing.T) {
+		roots, err := database.GetTaskTree(nil, nil)
+		if err != nil {
+			t.Fatalf("GetTaskTree failed: %v", err)
+		}
+		if len(roots) != 2 || roots[0].ID != release.ID || roots[1].ID != standalone.ID {
+			t.Fatalf("Unexpected roots: %+v", roots)
+		}
+		root := roots[0]
+		if root.Progress == nil || root.Progress.Done != 2 || root.Progress.Total != 4 {
+			t.Errorf("Expected 2/4 done under release, got %+v", root.Progress)
+		}
+		if len(root.Subtasks) != 2 || len(root.Subtasks[0].Subtasks) != 2 {
+			t.Fatalf("Unexpected nesting: %+v", root.Subtasks)
+		}
+		if p := root.Subtasks[0].Progress; p == nil || p.Done != 1 || p.Total != 2 {
+			t.Errorf("Expected 1/2 done under backend, got %+v", p)
+		}
+		if roots[1].Progress != nil {
+			t.Errorf("Expected no progress on a leaf task, got %+v", roots[1].Progress)
+		}
+
+		sub, err := database.GetTaskTree(nil, &backend.ID)
+		if err != nil || len(sub) != 1 || sub[0].ID != backend.ID || len(sub[0].Subtasks) != 2 {
+			t.Errorf("Unexpected subtree: %+v, %v", sub, err)
+		}
+		missing := int64(999)
+		if _, err := database.GetTaskTree(nil, &missing); err == nil {
+			t.Error("Expected error for a missing root task")
+		}
+	})
+
+	t.Run("move", func(t *testing.T) {
+		if _, err := database.MoveTask(release.ID, &schema.ID); !errors.Is(err, ErrTaskCycle) {
+			t.Errorf("Expected ErrTaskCycle moving a task beneath its descendant, got %v", err)
+		}
+		if _, err := database.MoveTask(release.ID, &release.ID); !errors.Is(err, ErrTaskCycle) {
+			t.Errorf("Expected ErrTaskCycle moving a task beneath itself, got %v", err)
+		}
+		other, _ := database.CreateProject("other", "", "")
+		foreign, _ := database.CreateTask(&other.ID, nil, "Foreign", "", 0)
+		if _, err := database.MoveTask(docs.ID, &foreign.ID); err == nil {
+			t.Error("Expected error moving a task under another project's task")
+		}
+
+		moved, err := database.MoveTask(docs.ID, &standalone.ID)
+		if err != nil || moved.ParentID == nil || *moved.ParentID != standalone.ID {
+			t.Fatalf("MoveTask failed: %+v, %v", moved, err)
+		}
+		moved, _ = database.MoveTask(docs.ID, nil)
+		if moved.ParentID != nil {
+			t.Errorf("Expected docs at the top level, got parent %v", *moved.ParentID)
+		}
+	})
+
+	t.Run("delete reparent", func(t *testing.T) {
+		deleted, err := database.DeleteTask(backend.ID, true)
+		if err != nil || deleted != 1 {
+			t.Fatalf("Expected one task deleted, got %d, %v", deleted, err)
+		}
+		task, _ := database.GetTask(schema.ID)
+		if task.ParentID == nil || *task.ParentID != release.ID {
+			t.Errorf("Expected schema to move up to release, got %v", task.ParentID)
+		}
+	})
+
+	t.Run("delete cascade", func(t *testing.T) {
+		grandchild, _ := database.CreateTask(nil, &schema.ID, "Migration", "", 0)
+		deleted, err := database.DeleteTask(release.ID, false)
+		if err != nil || deleted != 4 {
+			t.Fatalf("Expected release, schema, API and migration deleted, got %d, %v", deleted, err)
+		}
+		if _, err := database.GetTask(grandchild.ID); err == nil {
+			t.Error("Expected the grandchild to be deleted")
+		}
+		tasks, _ := database.ListTasks(nil, TaskFilter{})
+		if len(tasks) != 2 {
+			t.Errorf("Expected standalone and docs to remain, got %+v", tasks)
+		}
+	})
+}
@@ -3,63 +3,261 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
 
 // Task represents a task
 type Task struct {
-	ID          int64     `json:"id"`
-	ProjectID   int64     `json:"project_id"`
-	ParentID    *int64    `json:"parent_id,omitempty"`
-	Title       string    `json:"title"`
-	Description string    `json:"description,omitempty"`
-	Status      string    `json:"status"`
-	Priority    int       `json:"priority"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID              int64          `json:"id"`
+	ProjectID       int64          `json:"project_id"`
+	ParentID        *int64         `json:"parent_id,omitempty"`
+	Title           string         `json:"title"`
+	Description     string         `json:"description,omitempty"`
+	Status          string         `json:"status"`
+	Priority        int            `json:"priority"`
+	DueAt           *time.Time     `json:"due_at,omitempty"`
+	EstimateMinutes int            `json:"estimate_minutes,omitempty"`
+	Assignee        string         `json:"assignee,omitempty"`
+	Labels          []string       `json:"labels,omitempty"`
+	BlockedBy       []int64        `json:"blocked_by,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	StartedAt       *time.Time     `json:"started_at,omitempty"`
+	CompletedAt     *time.Time     `json:"completed_at,omitempty"`
+	Links           []LinkedEntity `json:"links,omitempty"`
+}
+
+// taskColumns lists the columns scanTask reads
+const taskColumns = "id, project_id, parent_id, title, description, status, priority, due_at, estimate_minutes, assignee, created_at, updated_at, started_at, completed_at"
+
+// scanTask scans a row selected with taskColumns. Labels and BlockedBy are
+// left for fillTaskDetails.
+func scanTask(row interface{ Scan(...interface{}) error }) (*Task, error) {
+	t := &Task{}
+	var parentID, estimate sql.NullInt64
+	var description, assignee sql.NullString
+	var dueAt, startedAt, completedAt sql.NullTime
+	if err := row.Scan(&t.ID, &t.ProjectID, &parentID, &t.Title, &description, &t.Status, &t.Priority, &dueAt, &estimate, &assignee, &t.CreatedAt, &t.UpdatedAt, &startedAt, &completedAt); err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		t.ParentID = &parentID.Int64
+	}
+	if dueAt.Valid {
+		t.DueAt = &dueAt.Time
+	}
+	if startedAt.Valid {
+		t.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		t.CompletedAt = &completedAt.Time
+	}
+	t.Description = description.String
+	t.EstimateMinutes = int(estimate.Int64)
+	t.Assignee = assignee.String
+	return t, nil
+}
+
+// TaskDetails holds the optional planning fields of a task. Nil fields are
+// left unchanged; a zero DueAt, a zero estimate or an empty assignee clears
+// the field, Labels replaces the task's labels, and a Comment's author and
+// content are added as a comment in the same transaction.
+type TaskDetails struct {
+	DueAt           *time.Time
+	EstimateMinutes *int
+	Assignee        *string
+	Labels          *[]string
+	Comment         *TaskComment
 }
 
 // CreateTask creates a new task
 func (db *DB) CreateTask(projectID *int64, parentID *int64, title, description string, priority int) (*Task, error) {
+	return db.CreateTaskWithDetails(projectID, parentID, title, description, priority, TaskDetails{})
+}
+
+// CreateTaskWithDetails creates a new task with its planning fields set. The
+// task starts in the first status of its project's workflow.
+func (db *DB) CreateTaskWithDetails(projectID *int64, parentID *int64, title, description string, priority int, d TaskDetails) (*Task, error) {
 	pid := db.GetProjectID(projectID)
+	workflow, err := db.GetWorkflow(&pid)
+	if err != nil {
+		return nil, err
+	}
+	status := workflow.Statuses[0]
 
-	result, err := db.Exec(
-		"INSERT INTO tasks (project_id, parent_id, title, description, priority) VALUES (?, ?, ?, ?, ?)",
-		pid, parentID, title, description, priority,
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`INSERT INTO tasks (project_id, parent_id, title, description, priority, status, started_at, completed_at)
+		VALUES (?, ?, ?, ?, ?, ?, CASE WHEN ? THEN CURRENT_TIMESTAMP END, CASE WHEN ? THEN CURRENT_TIMESTAMP END)`,
+		pid, parentID, title, description, priority, status, workflow.IsStarted(status), workflow.IsClosed(status),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("creating task: %w", err)
 	}
-
 	id, _ := result.LastInsertId()
+	if err := setTaskDetails(tx, id, d, false); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return db.GetTask(id)
 }
 
 // GetTask gets a task by ID
 func (db *DB) GetTask(id int64) (*Task, error) {
-	t := &Task{}
-	var parentID sql.NullInt64
-	var description sql.NullString
-	err := db.QueryRow(
-		"SELECT id, project_id, parent_id, title, description, status, priority, created_at, updated_at FROM tasks WHERE id = ?",
-		id,
-	).Scan(&t.ID, &t.ProjectID, &parentID, &t.Title, &description, &t.Status, &t.Priority, &t.CreatedAt, &t.UpdatedAt)
+	t, err := scanTask(db.QueryRow("SELECT "+taskColumns+" FROM tasks WHERE id = ?", id))
 	if err != nil {
 		return nil, err
 	}
-	if parentID.Valid {
-		t.ParentID = &parentID.Int64
+	tasks := []Task{*t}
+	if err := db.fillTaskDetails(tasks); err != nil {
+		return nil, err
 	}
-	t.Description = description.String
-	return t, nil
+	return &tasks[0], nil
+}
+
+// setTaskDetails applies d to a task, logging an assignee change when
+// logActivity is set
+func setTaskDetails(tx *sql.Tx, id int64, d TaskDetails, logActivity bool) error {
+	var sets []string
+	var args []interface{}
+
+	if d.DueAt != nil {
+		sets = append(sets, "due_at = ?")
+		if d.DueAt.IsZero() {
+			args = append(args, nil)
+		} else {
+			args = append(args, sqliteTime(*d.DueAt))
+		}
+	}
+	if d.EstimateMinutes != nil {
+		if *d.EstimateMinutes < 0 {
+			return fmt.Errorf("estimate cannot be negative")
+		}
+		sets = append(sets, "estimate_minutes = NULLIF(?, 0)")
+		args = append(args, *d.EstimateMinutes)
+	}
+	if d.Assignee != nil {
+		sets = append(sets, "assignee = NULLIF(?, '')")
+		args = append(args, *d.Assignee)
+	}
+
+	var oldAssignee sql.NullString
+	if err := tx.QueryRow("SELECT assignee FROM tasks WHERE id = ?", id).Scan(&oldAssignee); err != nil {
+		return err
+	}
+
+	if len(sets) > 0 {
+		sets = append(sets, "updated_at = CURRENT_TIMESTAMP")
+		args = append(args, id)
+		if _, err := tx.Exec(
+			fmt.Sprintf("UPDATE tasks SET %s WHERE id = ?", strings.Join(sets, ", ")),
+			args...,
+		); err != nil {
+			return fmt.Errorf("updating task: %w", err)
+		}
+	}
+	if logActivity && d.Assignee != nil && *d.Assignee != oldAssignee.String {
+		if _, err := tx.Exec(
+			"INSERT INTO task_activity (task_id, field, old_value, new_value) VALUES (?, ?, ?, ?)",
+			id, "assignee", oldAssignee.String, *d.Assignee,
+		); err != nil {
+			return fmt.Errorf("recording task activity: %w", err)
+		}
+	}
+	if d.Labels != nil {
+		if _, err := tx.Exec("DELETE FROM task_labels WHERE task_id = ?", id); err != nil {
+			return err
+		}
+		for _, label := range normalizeLabels(*d.Labels) {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO task_labels (task_id, label) VALUES (?, ?)", id, label); err != nil {
+				return fmt.Errorf("setting labels: %w", err)
+			}
+		}
+	}
+	if d.Comment != nil {
+		if _, err := addTaskComment(tx, id, d.Comment.Author, d.Comment.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// taskLabels maps each of the given tasks to its labels, sorted
+func (db *DB) taskLabels(taskIDs ...int64) (map[int64][]string, error) {
+	placeholders := make([]string, len(taskIDs))
+	args := make([]interface{}, len(taskIDs))
+	for i, id := range taskIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	rows, err := db.Query(
+		"SELECT task_id, label FROM task_labels WHERE task_id IN ("+strings.Join(placeholders, ", ")+") ORDER BY task_id, label",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := make(map[int64][]string)
+	for rows.Next() {
+		var taskID int64
+		var label string
+		if err := rows.Scan(&taskID, &label); err != nil {
+			return nil, err
+		}
+		labels[taskID] = append(labels[taskID], label)
+	}
+	return labels, rows.Err()
+}
+
+// normalizeLabels trims and lowercases labels, dropping empty ones
+func normalizeLabels(labels []string) []string {
+	var out []string
+	for _, l := range labels {
+		if l = strings.ToLower(strings.TrimSpace(l)); l != "" {
+			out = append(out, l)
+		}
+	}
+	return out
 }
 
-// UpdateTask updates a task
+// UpdateTask updates a task. A status change must be allowed by the
+// project's workflow and updates started_at and completed_at. Changes to the
+// title, status or priority are recorded in the task's activity log.
 func (db *DB) UpdateTask(id int64, title, description, status *string, priority *int) (*Task, error) {
+	return db.UpdateTaskWithDetails(id, title, description, status, priority, TaskDetails{})
+}
+
+// UpdateTaskWithDetails updates a task and its planning fields in one
+// transaction, so nothing is saved if any change is rejected. Assignee
+// changes are also recorded in the activity log.
+func (db *DB) UpdateTaskWithDetails(id int64, title, description, status *string, priority *int, d TaskDetails) (*Task, error) {
 	var sets []string
 	var args []interface{}
 
+	var workflow *Workflow
+	if status != nil {
+		var projectID int64
+		if err := db.QueryRow("SELECT project_id FROM tasks WHERE id = ?", id).Scan(&projectID); err != nil {
+			return nil, err
+		}
+		var err error
+		if workflow, err = db.GetWorkflow(&projectID); err != nil {
+			return nil, err
+		}
+	}
+
 	if title != nil {
 		sets = append(sets, "title = ?")
 		args = append(args, *title)
@@ -71,89 +269,251 @@ func (db *DB) UpdateTask(id int64, title, description, status *string, priority
 	if status != nil {
 		sets = append(sets, "status = ?")
 		args = append(args, *status)
+		if workflow.IsStarted(*status) {
+			sets = append(sets, "started_at = COALESCE(started_at, CURRENT_TIMESTAMP)")
+		}
+		if workflow.IsClosed(*status) {
+			sets = append(sets, "completed_at = COALESCE(completed_at, CURRENT_TIMESTAMP)")
+		} else {
+			sets = append(sets, "completed_at = NULL")
+		}
 	}
 	if priority != nil {
 		sets = append(sets, "priority = ?")
 		args = append(args, *priority)
 	}
 
-	if len(sets) == 0 {
-		return db.GetTask(id)
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	sets = append(sets, "updated_at = CURRENT_TIMESTAMP")
-	args = append(args, id)
+	var old struct {
+		title, status string
+		priority      int
+	}
+	if err := tx.QueryRow("SELECT title, status, priority FROM tasks WHERE id = ?", id).Scan(&old.title, &old.status, &old.priority); err != nil {
+		return nil, err
+	}
+	if status != nil {
+		if err := workflow.CheckTransition(old.status, *status); err != nil {
+			return nil, err
+		}
+	}
 
-	_, err := db.Exec(
-		fmt.Sprintf("UPDATE tasks SET %s WHERE id = ?", strings.Join(sets, ", ")),
-		args...,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("updating task: %w", err)
+	if len(sets) > 0 {
+		sets = append(sets, "updated_at = CURRENT_TIMESTAMP")
+		args = append(args, id)
+		if _, err := tx.Exec(
+			fmt.Sprintf("UPDATE tasks SET %s WHERE id = ?", strings.Join(sets, ", ")),
+			args...,
+		); err != nil {
+			return nil, fmt.Errorf("updating task: %w", err)
+		}
+	}
+	if err := setTaskDetails(tx, id, d, true); err != nil {
+		return nil, err
 	}
 
+	var changes [][3]string
+	if title != nil && *title != old.title {
+		changes = append(changes, [3]string{"title", old.title, *title})
+	}
+	if status != nil && *status != old.status {
+		changes = append(changes, [3]string{"status", old.status, *status})
+	}
+	if priority != nil && *priority != old.priority {
+		changes = append(changes, [3]string{"priority", strconv.Itoa(old.priority), strconv.Itoa(*priority)})
+	}
+	for _, c := range changes {
+		if _, err := tx.Exec(
+			"INSERT INTO task_activity (task_id, field, old_value, new_value) VALUES (?, ?, ?, ?)",
+			id, c[0], c[1], c[2],
+		); err != nil {
+			return nil, fmt.Errorf("recording task activity: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return db.GetTask(id)
 }
 
-// ListTasks lists tasks with optional filters
-func (db *DB) ListTasks(projectID *int64, status *string, parentID *int64) ([]Task, error) {
-	pid := db.GetProjectID(projectID)
+// TaskFilter narrows and orders ListTasks. Zero fields don't filter.
+type TaskFilter struct {
+	Statuses  []string
+	ParentID  *int64 // 0 for root tasks
+	Ready     bool   // not closed, with every dependency closed
+	Labels    []string
+	Assignee  *string // "" for unassigned tasks
+	DueBefore *time.Time
+	DueAfter  *time.Time
+	Query     string // substring of the title or description
+	Sort      string // one of TaskSorts; priority by default
+	Limit     int
+	Offset    int
+}
 
+// TaskSorts maps the supported TaskFilter.Sort values to their ORDER BY
+var TaskSorts = map[string]string{
+	"priority": "priority DESC, created_at, id",
+	"due":      "due_at IS NULL, due_at, priority DESC, id",
+	"created":  "created_at DESC, id DESC",
+	"updated":  "updated_at DESC, id DESC",
+	"title":    "title COLLATE NOCASE, id",
+}
+
+// ListTasks lists a project's tasks matching the filter. A task matches when
+// it has every label in Labels.
+func (db *DB) ListTasks(projectID *int64, f TaskFilter) ([]Task, error) {
+	where, args := taskConditions(db.GetProjectID(projectID), f)
+
+	order := TaskSorts["priority"]
+	if f.Sort != "" {
+		var ok bool
+		if order, ok = TaskSorts[f.Sort]; !ok {
+			return nil, fmt.Errorf("unknown sort: %s", f.Sort)
+		}
+	}
+
+	query := fmt.Sprintf("SELECT "+taskColumns+" FROM tasks WHERE %s ORDER BY %s", where, order)
+	if f.Limit > 0 || f.Offset > 0 {
+		limit := f.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, f.Offset)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := collectTasks(rows)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, db.fillTaskDetails(tasks)
+}
+
+// ListTasksPage lists a page of a project's tasks matching the filter, in
+// place of the filter's Limit and Offset, along with how many match in total
+func (db *DB) ListTasksPage(projectID *int64, f TaskFilter, page PageRequest) (*Page[Task], error) {
+	where, args := taskConditions(db.GetProjectID(projectID), f)
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM tasks WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+	f.Limit, f.Offset = page.limit(), page.Offset
+	tasks, err := db.ListTasks(projectID, f)
+	if err != nil {
+		return nil, err
+	}
+	return NewPage(tasks, total, page), nil
+}
+
+// taskConditions returns the WHERE clause that selects a project's tasks
+// matching the filter
+func taskConditions(pid int64, f TaskFilter) (string, []interface{}) {
 	var conditions []string
 	var args []interface{}
 
 	conditions = append(conditions, "project_id = ?")
 	args = append(args, pid)
 
-	if status != nil {
-		conditions = append(conditions, "status = ?")
-		args = append(args, *status)
+	if len(f.Statuses) > 0 {
+		conditions = append(conditions, "status IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(f.Statuses)), ", ")+")")
+		for _, status := range f.Statuses {
+			args = append(args, status)
+		}
 	}
 
-	if parentID != nil {
-		if *parentID == 0 {
+	if f.ParentID != nil {
+		if *f.ParentID == 0 {
 			conditions = append(conditions, "parent_id IS NULL")
 		} else {
 			conditions = append(conditions, "parent_id = ?")
-			args = append(args, *parentID)
+			args = append(args, *f.ParentID)
 		}
 	}
 
-	query := fmt.Sprintf(
-		"SELECT id, project_id, parent_id, title, description, status, priority, created_at, updated_at FROM tasks WHERE %s ORDER BY priority DESC, created_at",
-		strings.Join(conditions, " AND "),
-	)
+	if f.Ready {
+		conditions = append(conditions, "completed_at IS NULL", "NOT EXISTS ("+openDependencies+")")
+	}
 
-	rows, err := db.Query(query, args...)
-	if err != nil {
-		return nil, err
+	for _, label := range normalizeLabels(f.Labels) {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM task_labels l WHERE l.task_id = tasks.id AND l.label = ?)")
+		args = append(args, label)
 	}
-	defer rows.Close()
 
+	if f.Assignee != nil {
+		conditions = append(conditions, "COALESCE(assignee, '') = ?")
+		args = append(args, *f.Assignee)
+	}
+	if f.DueBefore != nil && !f.DueBefore.IsZero() {
+		conditions = append(conditions, "due_at < ?")
+		args = append(args, sqliteTime(*f.DueBefore))
+	}
+	if f.DueAfter != nil && !f.DueAfter.IsZero() {
+		conditions = append(conditions, "due_at >= ?")
+		args = append(args, sqliteTime(*f.DueAfter))
+	}
+
+	if f.Query != "" {
+		conditions = append(conditions, `(title LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\')`)
+		pattern := "%" + escapeLike(f.Query) + "%"
+		args = append(args, pattern, pattern)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// collectTasks scans and closes rows selected with taskColumns
+func collectTasks(rows *sql.Rows) ([]Task, error) {
+	defer rows.Close()
 	var tasks []Task
 	for rows.Next() {
-		var t Task
-		var parentID sql.NullInt64
-		var description sql.NullString
-		if err := rows.Scan(&t.ID, &t.ProjectID, &parentID, &t.Title, &description, &t.Status, &t.Priority, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		t, err := scanTask(rows)
+		if err != nil {
 			return nil, err
 		}
-		if parentID.Valid {
-			t.ParentID = &parentID.Int64
-		}
-		t.Description = description.String
-		tasks = append(tasks, t)
+		tasks = append(tasks, *t)
 	}
 	return tasks, rows.Err()
 }
 
-// DeleteTask deletes a task and its subtasks
-func (db *DB) DeleteTask(id int64) error {
-	// First delete all subtasks recursively
-	_, err := db.Exec("DELETE FROM tasks WHERE parent_id = ?", id)
+// subtreeIDs selects the IDs of a task and all its descendants
+const subtreeIDs = `WITH RECURSIVE subtree(id) AS (
+	SELECT id FROM tasks WHERE id = ?
+	UNION ALL
+	SELECT t.id FROM tasks t JOIN subtree s ON t.parent_id = s.id
+) SELECT id FROM subtree`
+
+// DeleteTask deletes a task and all its descendants, returning how many tasks
+// were deleted. With reparent, the task's children move up to its parent
+// instead and only the task itself is deleted.
+func (db *DB) DeleteTask(id int64, reparent bool) (int64, error) {
+	tx, err := db.Begin()
 	if err != nil {
-		return err
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if reparent {
+		if _, err := tx.Exec(
+			"UPDATE tasks SET parent_id = (SELECT parent_id FROM tasks WHERE id = ?), updated_at = CURRENT_TIMESTAMP WHERE parent_id = ?",
+			id, id,
+		); err != nil {
+			return 0, fmt.Errorf("reparenting subtasks: %w", err)
+		}
+	}
+	result, err := tx.Exec("DELETE FROM tasks WHERE id IN ("+subtreeIDs+")", id)
+	if err != nil {
+		return 0, fmt.Errorf("deleting task: %w", err)
 	}
-	_, err = db.Exec("DELETE FROM tasks WHERE id = ?", id)
-	return err
+	n, _ := result.RowsAffected()
+	return n, tx.Commit()
 }
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTaskDetailsAndFilters verifies the planning fields and every
+// TaskFilter option
+func TestTaskDetailsAndFilters(t *testing.T) {
+	database, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	day := func(d int) *time.Time {
+		t := time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	create := func(title string, priority int, due *time.Time, assignee string, labels ...string) *Task {
+		task, err := database.CreateTaskWithDetails(nil, nil, title, "", priority, TaskDetails{DueAt: due, Assignee: &assignee, Labels: &labels})
+		if err != nil {
+			t.Fatalf("CreateTaskWithDetails failed: %v", err)
+		}
+		return task
+	}
+	migrate := create("Migrate schema", 2, day(10), "agent-a", "Backend", " db ")
+	docs := create("Write docs", 1, day(5), "", "docs")
+	api := create("Build API", 3, nil, "agent-b", "backend")
+
+	if migrate.DueAt == nil || !migrate.DueAt.Equal(*day(10)) {
+		t.Errorf("Expected due date to round-trip, got %v", migrate.DueAt)
+	}
+	if len(migrate.Labels) != 2 || migrate.Labels[0] != "backend" || migrate.Labels[1] != "db" {
+		t.Errorf("Expected normalized labels, got %v", migrate.Labels)
+	}
+	if docs.Assignee != "" {
+		t.Errorf("Expected unassigned task, got %q", docs.Assignee)
+	}
+
+	t.Run("update details", func(t *testing.T) {
+		estimate, assignee, labels := 90, "agent-c", []string{"docs", "urgent"}
+		task, err := database.UpdateTaskWithDetails(docs.ID, nil, nil, nil, nil, TaskDetails{EstimateMinutes: &estimate, Assignee: &assignee, Labels: &labels})
+		if err != nil {
+			t.Fatalf("UpdateTaskWithDetails failed: %v", err)
+		}
+		if task.EstimateMinutes != 90 || task.Assignee != "agent-c" || len(task.Labels) != 2 || !task.DueAt.Equal(*day(5)) {
+			t.Errorf("Unexpected task: %+v", task)
+		}
+		activity, _ := database.ListTaskActivity(docs.ID)
+		if len(activity) != 1 || activity[0].Field != "assignee" || activity[0].NewValue != "agent-c" {
+			t.Errorf("Expected the assignee change to be logged, got %+v", activity)
+		}
+
+		zero, none := 0, ""
+		task, _ = database.UpdateTaskWithDetails(docs.ID, nil, nil, nil, nil, TaskDetails{DueAt: &time.Time{}, EstimateMinutes: &zero, Assignee: &none})
+		if task.DueAt != nil || task.EstimateMinutes != 0 || task.Assignee != "" || len(task.Labels) != 2 {
+			t.Errorf("Expected due date, estimate and assignee cleared and labels kept, got %+v", task)
+		}
+	})
+
+	titles := func(f TaskFilter) []string {
+		tasks, err := database.ListTasks(nil, f)
+		if err != nil {
+			t.Fatalf("ListTasks(%+v) failed: %v", f, err)
+		}
+		var out []string
+		for _, task := range tasks {
+			out = append(out, task.Title)
+		}
+		return out
+	}
+	equal := func(got []string, want ...string) bool {
+		if len(got) != len(want) {
+			return false
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	unassigned, agentA := "", "agent-a"
+	done := "done"
+	database.UpdateTask(api.ID, nil, nil, &done, nil)
+	tests := []struct {
+		name   string
+		filter TaskFilter
+		want   []string
+	}{
+		{"default order", TaskFilter{}, []string{"Build API", "Migrate schema", "Write docs"}},
+		{"label", TaskFilter{Labels: []string{"backend"}}, []string{"Build API", "Migrate schema"}},
+		{"all labels", TaskFilter{Labels: []string{"backend", "db"}}, []string{"Migrate schema"}},
+		{"assignee", TaskFilter{Assignee: &agentA}, []string{"Migrate schema"}},
+		{"unassigned", TaskFilter{Assignee: &unassigned}, []string{"Write docs"}},
+		{"statuses", TaskFilter{Statuses: []string{"todo", "blocked"}}, []string{"Migrate schema", "Write docs"}},
+		{"due before", TaskFilter{DueBefore: day(10)}, nil},
+		{"due after", TaskFilter{DueAfter: day(6)}, []string{"Migrate schema"}},
+		{"query", TaskFilter{Query: "api"}, []string{"Build API"}},
+		{"sort by due", TaskFilter{Sort: "due"}, []string{"Migrate schema", "Build API", "Write docs"}},
+		{"sort by title", TaskFilter{Sort: "title"}, []string{"Build API", "Migrate schema", "Write docs"}},
+		{"limit", TaskFilter{Limit: 2}, []string{"Build API", "Migrate schema"}},
+		{"offset", TaskFilter{Offset: 1}, []string{"Migrate schema", "Write docs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := titles(tt.filter); !equal(got, tt.want...) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := database.ListTasks(nil, TaskFilter{Sort: "random"}); err == nil {
+		t.Error("Expected error for an unknown sort")
+	}
+}
@@ -0,0 +1,309 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Workflow defines the statuses a project's tasks move through. A project
+// without its own workflow uses its nearest ancestor's, and the built-in
+// DefaultWorkflow when none has one.
+type Workflow struct {
+	// ProjectID is the project that defines the workflow; nil for the default
+	ProjectID *int64 `json:"project_id,omitempty"`
+	// Statuses lists every allowed status; new tasks start in the first
+	Statuses []string `json:"statuses"`
+	// Transitions maps a status to the statuses a task may move to from it.
+	// When empty, any move is allowed; otherwise unlisted moves are rejected.
+	Transitions map[string][]string `json:"transitions,omitempty"`
+	// Started statuses set a task's started_at the first time it enters one
+	Started []string `json:"started"`
+	// Closed statuses count as finished: they set completed_at, satisfy
+	// dependencies and count as done in progress roll-ups
+	Closed []string `json:"closed"`
+}
+
+// DefaultWorkflow is the workflow of projects that don't define one
+func DefaultWorkflow() *Workflow {
+	return &Workflow{
+		Statuses: []string{"todo", "in_progress", "done", "blocked"},
+		Started:  []string{"in_progress"},
+		Closed:   []string{"done"},
+	}
+}
+
+// ErrInvalidTransition is returned when a task's status change is not
+// allowed by its project's workflow
+var ErrInvalidTransition = errors.New("status change not allowed by the project's workflow")
+
+// IsClosed reports whether status counts as finished
+func (w *Workflow) IsClosed(status string) bool {
+	return slices.Contains(w.Closed, status)
+}
+
+// IsStarted reports whether status marks a task as started
+func (w *Workflow) IsStarted(status string) bool {
+	return slices.Contains(w.Started, status)
+}
+
+// CheckTransition returns an error unless a task may move from one status to
+// another. Staying in the same status is always allowed.
+func (w *Workflow) CheckTransition(from, to string) error {
+	if !slices.Contains(w.Statuses, to) {
+		return fmt.Errorf("unknown status %q; the workflow allows %s", to, strings.Join(w.Statuses, ", "))
+	}
+	if from == to || len(w.Transitions) == 0 || slices.Contains(w.Transitions[from], to) {
+		return nil
+	}
+	allowed := "none"
+	if next := w.Transitions[from]; len(next) > 0 {
+		allowed = strings.Join(next, ", ")
+	}
+	return fmt.Errorf("%w: %s -> %s (allowed from %s: %s)", ErrInvalidTransition, from, to, from, allowed)
+}
+
+// validate checks that every status a workflow refers to is one it defines
+func (w *Workflow) validate() error {
+	if len(w.Statuses) == 0 {
+		return errors.New("a workflow needs at least one status")
+	}
+	seen := make(map[string]bool, len(w.Statuses))
+	for _, s := range w.Statuses {
+		if strings.TrimSpace(s) == "" {
+			return errors.New("statuses cannot be empty")
+		}
+		if seen[s] {
+			return fmt.Errorf("duplicate status %q", s)
+		}
+		seen[s] = true
+	}
+	check := func(what string, statuses []string) error {
+		for _, s := range statuses {
+			if !seen[s] {
+				return fmt.Errorf("%s refers to unknown status %q", what, s)
+			}
+		}
+		return nil
+	}
+	if err := check("closed", w.Closed); err != nil {
+		return err
+	}
+	if err := check("started", w.Started); err != nil {
+		return err
+	}
+	for from, to := range w.Transitions {
+		if err := check("transitions", append([]string{from}, to...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetWorkflow returns the workflow that applies to a project's tasks
+func (db *DB) GetWorkflow(projectID *int64) (*Workflow, error) {
+	return getWorkflow(db, db.GetProjectID(projectID))
+}
+
+func getWorkflow(q querier, projectID int64) (*Workflow, error) {
+	chain, err := projectChain(q, projectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range chain {
+		var statuses, transitions, started, closed string
+		err := q.QueryRow(
+			"SELECT statuses, transitions, started, closed FROM task_workflows WHERE project_id = ?", id,
+		).Scan(&statuses, &transitions, &started, &closed)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		w := &Workflow{ProjectID: &id}
+		for _, f := range []struct {
+			data string
+			into interface{}
+		}{{statuses, &w.Statuses}, {transitions, &w.Transitions}, {started, &w.Started}, {closed, &w.Closed}} {
+			if err := json.Unmarshal([]byte(f.data), f.into); err != nil {
+				return nil, fmt.Errorf("reading workflow of project %d: %w", id, err)
+			}
+		}
+		return w, nil
+	}
+	return DefaultWorkflow(), nil
+}
+
+// SetWorkflow gives a project its own workflow, which its descendants
+// inherit unless they define one. It fails if a task governed by the
+// workflow is in a status the workflow drops.
+func (db *DB) SetWorkflow(projectID *int64, w Workflow) (*Workflow, error) {
+	pid := db.GetProjectID(projectID)
+	if err := w.validate(); err != nil {
+		return nil, err
+	}
+
+	// Tasks in this project, and in descendants that inherit its workflow
+	rows, err := db.Query(`
+		WITH RECURSIVE governed(id) AS (
+			SELECT ?
+			UNION ALL
+			SELECT p.id FROM projects p JOIN governed g ON p.parent_id = g.id
+			WHERE p.id NOT IN (SELECT project_id FROM task_workflows)
+		)
+		SELECT DISTINCT status FROM tasks WHERE project_id IN governed ORDER BY status`,
+		pid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var orphaned []string
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if !slices.Contains(w.Statuses, status) {
+			orphaned = append(orphaned, status)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(orphaned) > 0 {
+		return nil, fmt.Errorf("tasks are still in statuses the workflow drops: %s", strings.Join(orphaned, ", "))
+	}
+
+	if err := storeWorkflow(db, pid, &w); err != nil {
+		return nil, err
+	}
+	db.notify(Change{Entity: "workflow", Op: OpUpdate, ProjectID: pid})
+	return db.GetWorkflow(&pid)
+}
+
+// checkWorkflows is run inside a transaction that changes which workflow
+// applies to a project and its descendants, such as a merge or a new parent.
+// It fails if a task there is in a status its workflow does not allow, and
+// otherwise sets or clears completed_at to match the closed statuses.
+func checkWorkflows(tx *sql.Tx, projectID int64) error {
+	rows, err := tx.Query(`
+		WITH RECURSIVE subtree(id) AS (
+			SELECT ?
+			UNION
+			SELECT p.id FROM projects p JOIN subtree s ON p.parent_id = s.id
+		)
+		SELECT id FROM subtree ORDER BY id`,
+		projectID,
+	)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	in := func(statuses []string) (string, []interface{}) {
+		args := make([]interface{}, len(statuses))
+		for i, status := range statuses {
+			args[i] = status
+		}
+		return "(" + strings.TrimSuffix(strings.Repeat("?, ", len(statuses)), ", ") + ")", args
+	}
+	for _, id := range ids {
+		w, err := getWorkflow(tx, id)
+		if err != nil {
+			return err
+		}
+
+		allowed, allowedArgs := in(w.Statuses)
+		var orphaned sql.NullString
+		if err := tx.QueryRow(
+			"SELECT GROUP_CONCAT(DISTINCT status) FROM tasks WHERE project_id = ? AND status NOT IN "+allowed,
+			append([]interface{}{id}, allowedArgs...)...,
+		).Scan(&orphaned); err != nil {
+			return err
+		}
+		if orphaned.Valid {
+			return fmt.Errorf("project %d has tasks in statuses its workflow would not allow (%s): %s",
+				id, strings.Join(w.Statuses, ", "), orphaned.String)
+		}
+
+		closed, closedArgs := in(w.Closed)
+		if _, err := tx.Exec(
+			"UPDATE tasks SET completed_at = CURRENT_TIMESTAMP WHERE project_id = ? AND completed_at IS NULL AND status IN "+closed,
+			append([]interface{}{id}, closedArgs...)...,
+		); err != nil {
+			return fmt.Errorf("completing tasks: %w", err)
+		}
+		if _, err := tx.Exec(
+			"UPDATE tasks SET completed_at = NULL WHERE project_id = ? AND completed_at IS NOT NULL AND status NOT IN "+closed,
+			append([]interface{}{id}, closedArgs...)...,
+		); err != nil {
+			return fmt.Errorf("reopening tasks: %w", err)
+		}
+	}
+	return nil
+}
+
+// ResetWorkflow removes a project's own workflow so it inherits one again
+func (db *DB) ResetWorkflow(projectID *int64) (*Workflow, error) {
+	pid := db.GetProjectID(projectID)
+	result, err := db.Exec("DELETE FROM task_workflows WHERE project_id = ?", pid)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		db.notify(Change{Entity: "workflow", Op: OpDelete, ProjectID: pid})
+	}
+	return db.GetWorkflow(&pid)
+}
+
+// execer is satisfied by both *DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// querier is satisfied by both *DB and *sql.Tx
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// storeWorkflow writes a project's workflow, replacing any it had
+func storeWorkflow(e execer, projectID int64, w *Workflow) error {
+	statuses, _ := json.Marshal(w.Statuses)
+	transitions, _ := json.Marshal(w.Transitions)
+	started, _ := json.Marshal(nonNil(w.Started))
+	closed, _ := json.Marshal(nonNil(w.Closed))
+	if _, err := e.Exec(
+		`INSERT INTO task_workflows (project_id, statuses, transitions, started, closed) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(project_id) DO UPDATE SET statuses = excluded.statuses, transitions = excluded.transitions,
+			started = excluded.started, closed = excluded.closed, updated_at = CURRENT_TIMESTAMP`,
+		projectID, string(statuses), string(transitions), string(started), string(closed),
+	); err != nil {
+		return fmt.Errorf("setting workflow: %w", err)
+	}
+	return nil
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestWorkflows verifies per-project workflows: inheritance, transition
+// checks, and the started and completed timestamps
+func TestWorkflows(t *testing.T) {
+	database, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	app, _ := database.CreateProject("app", "", "")
+	lib, _ := database.CreateProject("lib", "", "")
+	database.SetProjectParent(lib.ID, &app.ID)
+
+	w, err := database.GetWorkflow(&lib.ID)
+	if err != nil || w.ProjectID != nil || len(w.Statuses) != 4 {
+		t.Fatalf("Expected the default workflow, got %+v, %v", w, err)
+	}
+
+	t.Run("validation", func(t *testing.T) {
+		for _, bad := range []Workflow{
+			{},
+			{Statuses: []string{"open", "open"}},
+			{Statuses: []string{"open"}, Closed: []string{"shipped"}},
+			{Statuses: []string{"open"}, Transitions: map[string][]string{"open": {"gone"}}},
+		} {
+			if _, err := database.SetWorkflow(&app.ID, bad); err == nil {
+				t.Errorf("Expected %+v to be rejected", bad)
+			}
+		}
+		database.CreateTask(&lib.ID, nil, "Legacy", "", 0)
+		if _, err := database.SetWorkflow(&app.ID, Workflow{Statuses: []string{"open"}}); err == nil {
+			t.Error("Expected an error dropping a status an inheriting project's task uses")
+		}
+	})
+
+	review := Workflow{
+		Statuses: []string{"todo", "in_progress", "review", "done"},
+		Transitions: map[string][]string{
+			"todo":        {"in_progress"},
+			"in_progress": {"review", "todo"},
+			"review":      {"done", "in_progress"},
+		},
+		Started: []string{"in_progress"},
+		Closed:  []string{"done"},
+	}
+	if _, err := database.SetWorkflow(&app.ID, review); err != nil {
+		t.Fatalf("SetWorkflow failed: %v", err)
+	}
+	w, _ = database.GetWorkflow(&lib.ID)
+	if w.ProjectID == nil || *w.ProjectID != app.ID || len(w.Statuses) != 4 {
+		t.Fatalf("Expected lib to inherit app's workflow, got %+v", w)
+	}
+
+	t.Run("transitions", func(t *testing.T) {
+		task, _ := database.CreateTask(&lib.ID, nil, "Feature", "", 0)
+		if task.Status != "todo" || task.StartedAt != nil {
+			t.Fatalf("Unexpected new task: %+v", task)
+		}
+		move := func(status string) (*Task, error) {
+			return database.UpdateTask(task.ID, nil, nil, &status, nil)
+		}
+		if _, err := move("done"); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("Expected ErrInvalidTransition for todo -> done, got %v", err)
+		}
+		if _, err := move("blocked"); err == nil {
+			t.Error("Expected an error for a status outside the workflow")
+		}
+		done, assignee, labels := "done", "agent", []string{"release"}
+		if _, err := database.UpdateTaskWithDetails(task.ID, nil, nil, &done, nil, TaskDetails{Assignee: &assignee, Labels: &labels}); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("Expected ErrInvalidTransition with details, got %v", err)
+		}
+		if got, _ := database.GetTask(task.ID); got.Assignee != "" || len(got.Labels) != 0 {
+			t.Errorf("Expected a rejected update to leave the details unchanged, got %+v", got)
+		}
+		if activity, _ := database.ListTaskActivity(task.ID); len(activity) != 0 {
+			t.Errorf("Expected no activity for a rejected update, got %+v", activity)
+		}
+
+		task, err := move("in_progress")
+		if err != nil || task.StartedAt == nil || task.CompletedAt != nil {
+			t.Fatalf("Expected started_at set, got %+v, %v", task, err)
+		}
+		started := *task.StartedAt
+		move("review")
+		task, _ = move("done")
+		if task.CompletedAt == nil || !task.StartedAt.Equal(started) {
+			t.Errorf("Expected completed_at set and started_at kept, got %+v", task)
+		}
+		if _, err := move("in_progress"); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("Expected done to be terminal, got %v", err)
+		}
+	})
+
+	t.Run("closed statuses", func(t *testing.T) {
+		other, _ := database.CreateProject("other", "", "")
+		database.SetWorkflow(&other.ID, Workflow{Statuses: []string{"open", "shipped", "wontfix"}, Closed: []string{"shipped", "wontfix"}})
+		blocker, _ := database.CreateTask(&other.ID, nil, "Blocker", "", 0)
+		waiting, _ := database.CreateTask(&other.ID, nil, "Waiting", "", 0)
+		database.AddTaskDependency(waiting.ID, blocker.ID)
+
+		wontfix := "wontfix"
+		database.UpdateTask(blocker.ID, nil, nil, &wontfix, nil)
+		unblocked, _ := database.UnblockedBy(blocker.ID)
+		if len(unblocked) != 1 || unblocked[0].ID != waiting.ID {
+			t.Errorf("Expected a custom closed status to unblock dependents, got %+v", unblocked)
+		}
+
+		open := "open"
+		task, _ := database.UpdateTask(blocker.ID, nil, nil, &open, nil)
+		if task.CompletedAt != nil {
+			t.Errorf("Expected reopening to clear completed_at, got %v", task.CompletedAt)
+		}
+	})
+
+	t.Run("new parent and merge", func(t *testing.T) {
+		team, _ := database.CreateProject("team", "", "")
+		database.SetWorkflow(&team.ID, Workflow{Statuses: []string{"backlog", "shipped"}, Closed: []string{"shipped"}})
+		tool, _ := database.CreateProject("tool", "", "")
+		task, _ := database.CreateTask(&tool.ID, nil, "Ship it", "", 0)
+		if _, err := database.SetProjectParent(tool.ID, &team.ID); err == nil {
+			t.Error("Expected an error moving a todo task under a workflow without todo")
+		}
+		if p, _ := database.GetProjectByID(tool.ID); p.ParentID == nil || *p.ParentID != GlobalProjectID {
+			t.Errorf("Expected the parent unchanged, got %v", p.ParentID)
+		}
+
+		database.DeleteTask(task.ID, false)
+		shipped, _ := database.CreateTask(&team.ID, nil, "Shipped", "", 0)
+		status := "shipped"
+		shipped, _ = database.UpdateTask(shipped.ID, nil, nil, &status, nil)
+		if shipped.CompletedAt == nil {
+			t.Fatal("Expected shipped to be closed")
+		}
+		res, err := database.MergeProjects(team.ID, tool.ID, MergeSkip)
+		if err == nil {
+			t.Fatalf("Expected an error merging shipped tasks into the default workflow, got %+v", res)
+		}
+		if p, _ := database.GetProjectBySlug("team"); p == nil {
+			t.Error("Expected the rejected merge to keep the source project")
+		}
+
+		status = "backlog"
+		database.UpdateTask(shipped.ID, nil, nil, &status, nil)
+		database.SetWorkflow(&tool.ID, Workflow{Statuses: []string{"backlog", "done"}, Closed: []string{"backlog"}})
+		if _, err := database.MergeProjects(team.ID, tool.ID, MergeSkip); err != nil {
+			t.Fatalf("MergeProjects failed: %v", err)
+		}
+		if moved, _ := database.GetTask(shipped.ID); moved.Status != "backlog" || moved.CompletedAt == nil {
+			t.Errorf("Expected the moved task closed under the target's workflow, got %+v", moved)
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		w, err := database.ResetWorkflow(&app.ID)
+		if err != nil || w.ProjectID != nil {
+			t.Errorf("Expected the default workflow after reset, got %+v, %v", w, err)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+// Package embed turns text into vectors for semantic search.
+package embed
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Embedder turns text into a fixed-size vector
+type Embedder interface {
+	// Name identifies the model. Vectors from different models are never
+	// compared, so changing embedders re-indexes stored rows.
+	Name() string
+	// Embed returns the vector for a piece of text
+	Embed(text string) ([]float32, error)
+}
+
+// Cosine returns the cosine similarity of two vectors, or 0 if their
+// dimensions differ or either is all zeros
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// Encode packs a vector into little-endian float32 bytes for storage
+func Encode(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return buf
+}
+
+// Decode unpacks a vector written by Encode
+func Decode(buf []byte) ([]float32, error) {
+	if len(buf)%4 != 0 {
+		return nil, fmt.Errorf("invalid vector length: %d bytes", len(buf))
+	}
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v, nil
+}
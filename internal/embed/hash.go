@@ -0,0 +1,81 @@
+package embed
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// HashEmbedder is an offline embedder that hashes word unigrams and character
+// trigrams into a fixed number of buckets. It needs no model files and catches
+// shared word stems ("render", "renderer", "rendering") that exact keyword
+// matching misses.
+type HashEmbedder struct {
+	Dims int
+}
+
+// NewHashEmbedder creates a hashed n-gram embedder with the default size
+func NewHashEmbedder() *HashEmbedder {
+	return &HashEmbedder{Dims: 512}
+}
+
+// Name implements Embedder
+func (e *HashEmbedder) Name() string {
+	return fmt.Sprintf("hash-ngram-%d", e.Dims)
+}
+
+// Embed implements Embedder
+func (e *HashEmbedder) Embed(text string) ([]float32, error) {
+	v := make([]float32, e.Dims)
+	for _, word := range tokenize(text) {
+		if stopWords[word] {
+			continue
+		}
+		e.add(v, "w:"+word, 1.0)
+
+		padded := []rune("^" + word + "$")
+		for i := 0; i+3 <= len(padded); i++ {
+			e.add(v, "t:"+string(padded[i:i+3]), 0.5)
+		}
+	}
+
+	var norm float64
+	for _, f := range v {
+		norm += float64(f) * float64(f)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range v {
+			v[i] *= scale
+		}
+	}
+	return v, nil
+}
+
+// add hashes a feature into a bucket, using a second hash bit for the sign so
+// collisions tend to cancel out rather than accumulate
+func (e *HashEmbedder) add(v []float32, feature string, weight float32) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	v[sum%uint64(len(v))] += weight
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "do": true, "for": true, "from": true, "how": true,
+	"in": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"that": true, "the": true, "this": true, "to": true, "we": true, "what": true,
+	"when": true, "where": true, "which": true, "with": true,
+}
@@ -0,0 +1,75 @@
+package embed
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HTTPEmbedder calls a local embedding server. It speaks both the
+// OpenAI-compatible /v1/embeddings format (used by llama.cpp, LM Studio and
+// vLLM) and Ollama's /api/embeddings and /api/embed endpoints.
+type HTTPEmbedder struct {
+	URL    string
+	Model  string
+	Client *http.Client
+}
+
+// NewHTTPEmbedder creates an embedder for the given endpoint and model
+func NewHTTPEmbedder(url, model string) *HTTPEmbedder {
+	return &HTTPEmbedder{
+		URL:    url,
+		Model:  model,
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name implements Embedder
+func (e *HTTPEmbedder) Name() string {
+	return "http:" + e.Model
+}
+
+// Embed implements Embedder
+func (e *HTTPEmbedder) Embed(text string) ([]float32, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model":  e.Model,
+		"input":  text, // OpenAI-compatible and Ollama /api/embed
+		"prompt": text, // Ollama /api/embeddings
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.Client.Post(e.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("calling embedding endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding endpoint returned %s", resp.Status)
+	}
+
+	var out struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+		Embedding  []float32   `json:"embedding"`
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decoding embedding response: %w", err)
+	}
+
+	switch {
+	case len(out.Data) > 0 && len(out.Data[0].Embedding) > 0:
+		return out.Data[0].Embedding, nil
+	case len(out.Embeddings) > 0 && len(out.Embeddings[0]) > 0:
+		return out.Embeddings[0], nil
+	case len(out.Embedding) > 0:
+		return out.Embedding, nil
+	}
+	return nil, fmt.Errorf("embedding response contained no vector")
+}
@@ -0,0 +1,590 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rocket/mcp-memories/internal/db"
+)
+
+// Output shaping trims a tool result before it reaches the model: fields
+// keeps only some fields of each record, format picks how it is rendered, and
+// max_chars or max_tokens cuts long text until the rendered result fits.
+
+// outputFormats lists the values of the format argument
+var outputFormats = []string{"json", "markdown", "compact"}
+
+// charsPerToken estimates how many characters a token holds, to turn
+// max_tokens into a character budget
+const charsPerToken = 4
+
+// minCutRunes is the shortest a string is cut to before records are dropped
+const minCutRunes = 40
+
+// noiseFields are left out of compact output unless asked for with fields
+var noiseFields = []string{"project_id", "created_at", "updated_at"}
+
+// wholeFields are never cut, since part of them is useless
+var wholeFields = []string{"id", "url", "path", "root_path", "next_cursor", "project", "slug"}
+
+// fullTextHints tells the reader of a cut result where to find the full text,
+// by entity type
+var fullTextHints = map[string]string{
+	"guideline": "use guideline_get for full text",
+	"filetree":  "use filetree_get with the path for full text",
+}
+
+// outputOptions are the shaping arguments every tool accepts
+type outputOptions struct {
+	fields   []string
+	format   string
+	maxChars int // 0 for no budget
+	offset   int // of the requested page, where records dropped from it start
+}
+
+// getOutputOptions reads the fields, format, max_chars and max_tokens
+// arguments
+func getOutputOptions(args map[string]interface{}) (outputOptions, error) {
+	o := outputOptions{fields: getStringArray(args, "fields"), format: getString(args, "format")}
+	if o.format == "" {
+		o.format = "json"
+	} else if !slices.Contains(outputFormats, o.format) {
+		return o, fmt.Errorf("invalid format %q (expected %s)", o.format, strings.Join(outputFormats, ", "))
+	}
+	maxChars, maxTokens := getInt(args, "max_chars"), getInt(args, "max_tokens")
+	if maxChars < 0 || maxTokens < 0 {
+		return o, fmt.Errorf("max_chars and max_tokens must not be negative")
+	}
+	o.maxChars = maxChars
+	if budget := maxTokens * charsPerToken; budget > 0 && (o.maxChars == 0 || budget < o.maxChars) {
+		o.maxChars = budget
+	}
+	// The tool itself reports a bad cursor
+	if page, err := getPage(args, 0); err == nil {
+		o.offset = page.Offset
+	}
+	return o, nil
+}
+
+// addOutputOptions adds the shaping arguments to every tool's schema
+func addOutputOptions(tools []ToolDefinition) {
+	for _, tool := range tools {
+		props, ok := tool.InputSchema["properties"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		props["fields"] = map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Only return these fields of each result; id is always kept"}
+		props["format"] = map[string]interface{}{"type": "string", "enum": outputFormats, "description": "json (default), compact (JSON without empty values, project_id and timestamps) or markdown"}
+		props["max_chars"] = map[string]interface{}{"type": "integer", "description": "Cut long text so the result fits in this many characters"}
+		props["max_tokens"] = map[string]interface{}{"type": "integer", "description": "Like max_chars, at about 4 characters per token"}
+	}
+}
+
+// formatResult renders a tool result as the text blocks of its response: the
+// result, and a note when it had to be cut to fit the budget
+func formatResult(tool string, result interface{}, o outputOptions) ([]string, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.fields) == 0 && o.format == "json" && o.maxChars == 0 {
+		return []string{string(data)}, nil
+	}
+
+	v, err := decodeOrdered(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.fields) > 0 {
+		for _, r := range records(v) {
+			if obj, ok := r.(*object); ok {
+				obj.keep(append([]string{"id"}, o.fields...))
+			}
+		}
+	}
+	if o.format == "compact" {
+		var drop []string
+		for _, f := range noiseFields {
+			if !slices.Contains(o.fields, f) {
+				drop = append(drop, f)
+			}
+		}
+		v = compact(v, drop)
+	}
+
+	text, err := o.render(v)
+	if err != nil || o.maxChars == 0 || utf8.RuneCountInString(text) <= o.maxChars {
+		return []string{text}, err
+	}
+	return o.fit(tool, v)
+}
+
+// fit cuts the longest strings of v as little as possible for it to render
+// within the budget, then drops records from the end if that is not enough. A
+// page's next_cursor then points at the first dropped record.
+func (o outputOptions) fit(tool string, v interface{}) ([]string, error) {
+	fits := func(v interface{}) (string, bool, error) {
+		text, err := o.render(v)
+		return text, utf8.RuneCountInString(text) <= o.maxChars, err
+	}
+
+	// Cutting to a shorter length never makes the output longer, so search
+	// for the longest cut that fits
+	best := -1
+	lo, hi := minCutRunes, longestString(v)-1
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		_, ok, err := fits(cutStrings(v, mid, "", nil))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			best, lo = mid, mid+1
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	var cut []cutString
+	if best >= 0 {
+		v = cutStrings(v, best, "", &cut)
+		text, _, err := fits(v)
+		return []string{text, cutNote(tool, cut, o.maxChars)}, err
+	}
+
+	v = cutStrings(v, minCutRunes, "", &cut)
+	list := records(v)
+	for n := len(list) - 1; n >= 0; n-- {
+		text, ok, err := fits(o.withRecords(v, list[:n]))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			note := fmt.Sprintf("[%d of %d results shown to fit %d characters; request fewer with limit or fields]", n, len(list), o.maxChars)
+			if isPage(v) {
+				note = fmt.Sprintf("[%d of %d results shown to fit %d characters; next_cursor continues from the first one left out]", n, len(list), o.maxChars)
+			}
+			return []string{text, note}, nil
+		}
+	}
+
+	// Nothing fits: cut the rendered text itself
+	text, err := o.render(v)
+	if err != nil {
+		return nil, err
+	}
+	return []string{truncatePrompt(text, o.maxChars), cutNote(tool, cut, o.maxChars)}, nil
+}
+
+// render writes v in the output format
+func (o outputOptions) render(v interface{}) (string, error) {
+	if o.format == "markdown" {
+		var b strings.Builder
+		writeMarkdown(&b, v, "")
+		return strings.TrimRight(b.String(), "\n"), nil
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// cutString records a string that was cut, with the record it belongs to
+type cutString struct {
+	typ string // the record's type field, if any
+	id  string
+}
+
+// cutNote explains which records were cut and where to find their full text
+func cutNote(tool string, cut []cutString, maxChars int) string {
+	var ids []string
+	hint := ""
+	for _, c := range cut {
+		if c.id != "" && !slices.Contains(ids, c.id) {
+			ids = append(ids, c.id)
+		}
+		typ := c.typ
+		if typ == "" {
+			typ, _, _ = strings.Cut(tool, "_")
+		}
+		if hint == "" {
+			hint = fullTextHints[typ]
+		}
+	}
+	if hint == "" {
+		hint = "raise max_chars or max_tokens for full text"
+	}
+	if len(ids) == 0 {
+		return fmt.Sprintf("[long text was cut to fit %d characters; %s]", maxChars, hint)
+	}
+	return fmt.Sprintf("[long text of id %s was cut to fit %d characters; %s]", strings.Join(ids, ", "), maxChars, hint)
+}
+
+// records returns the entities of a result: the elements of a list, the
+// items or results of a page, or the result itself
+func records(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return v
+	case *object:
+		if key := v.listKey(); key != "" {
+			return v.vals[key].([]interface{})
+		}
+		return []interface{}{v}
+	}
+	return nil
+}
+
+// withRecords returns v with its records replaced by kept, the first records
+// of the list. A page's cursor moves to the first record left out.
+func (o outputOptions) withRecords(v interface{}, kept []interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return kept
+	case *object:
+		if key := v.listKey(); key != "" {
+			out := &object{keys: slices.Clone(v.keys), vals: make(map[string]interface{}, len(v.keys))}
+			for k, val := range v.vals {
+				out.vals[k] = val
+			}
+			out.vals[key] = kept
+			if isPage(v) {
+				next := o.offset + len(kept)
+				out.set("next_cursor", db.EncodeCursor(next))
+				if key == "results" {
+					// search_all also reports the next page as an offset
+					out.set("next_offset", float64(next))
+				}
+			}
+			return out
+		}
+	}
+	return v
+}
+
+// isPage reports whether v is one page of a longer list, which a client
+// continues with next_cursor
+func isPage(v interface{}) bool {
+	obj, ok := v.(*object)
+	if !ok || obj.listKey() == "" {
+		return false
+	}
+	_, ok = obj.vals["total"]
+	return ok
+}
+
+// compact drops null and empty values, and the given fields, at any depth
+func compact(v interface{}, drop []string) interface{} {
+	switch v := v.(type) {
+	case *object:
+		out := &object{vals: map[string]interface{}{}}
+		for _, key := range v.keys {
+			if slices.Contains(drop, key) {
+				continue
+			}
+			if val := compact(v.vals[key], drop); !isEmpty(val) {
+				out.set(key, val)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			out = append(out, compact(item, drop))
+		}
+		return out
+	}
+	return v
+}
+
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case *object:
+		return len(v.keys) == 0
+	}
+	return false
+}
+
+// longestString is the length in runes of the longest string in v
+func longestString(v interface{}) int {
+	switch v := v.(type) {
+	case string:
+		return utf8.RuneCountInString(v)
+	case *object:
+		longest := 0
+		for _, key := range v.keys {
+			if !slices.Contains(wholeFields, key) {
+				longest = max(longest, longestString(v.vals[key]))
+			}
+		}
+		return longest
+	case []interface{}:
+		longest := 0
+		for _, item := range v {
+			longest = max(longest, longestString(item))
+		}
+		return longest
+	}
+	return 0
+}
+
+// cutStrings returns a copy of v with every string longer than size runes
+// cut to size, recording what was cut when cut is not nil. key is the field
+// v is the value of.
+func cutStrings(v interface{}, size int, key string, cut *[]cutString) interface{} {
+	switch v := v.(type) {
+	case string:
+		if slices.Contains(wholeFields, key) || utf8.RuneCountInString(v) <= size {
+			return v
+		}
+		if cut != nil {
+			*cut = append(*cut, cutString{})
+		}
+		return string([]rune(v)[:size]) + "…"
+	case *object:
+		out := &object{vals: make(map[string]interface{}, len(v.keys))}
+		before := 0
+		if cut != nil {
+			before = len(*cut)
+		}
+		for _, k := range v.keys {
+			out.set(k, cutStrings(v.vals[k], size, k, cut))
+		}
+		// Attribute cuts directly in this object's fields to it
+		if cut != nil {
+			typ, _ := v.vals["type"].(string)
+			id := ""
+			if n, ok := v.vals["id"].(json.Number); ok {
+				id = n.String()
+			}
+			for i := before; i < len(*cut); i++ {
+				if (*cut)[i] == (cutString{}) {
+					(*cut)[i] = cutString{typ: typ, id: id}
+				}
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = cutStrings(item, size, key, cut)
+		}
+		return out
+	}
+	return v
+}
+
+// object is a JSON object that keeps its keys in order, so shaped results
+// read like the original
+type object struct {
+	keys []string
+	vals map[string]interface{}
+}
+
+func (o *object) set(key string, val interface{}) {
+	if _, ok := o.vals[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.vals[key] = val
+}
+
+// keep removes every key not in fields
+func (o *object) keep(fields []string) {
+	kept := o.keys[:0]
+	for _, key := range o.keys {
+		if slices.Contains(fields, key) {
+			kept = append(kept, key)
+		} else {
+			delete(o.vals, key)
+		}
+	}
+	o.keys = kept
+}
+
+// listKey is the key of a page's records, or "" if o is not a page
+func (o *object) listKey() string {
+	for _, key := range []string{"items", "results"} {
+		if _, ok := o.vals[key].([]interface{}); ok {
+			return key
+		}
+	}
+	return ""
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		b.Write(k)
+		b.WriteByte(':')
+		val, err := json.Marshal(o.vals[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(val)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// decodeOrdered decodes JSON into objects, []interface{}, strings,
+// json.Numbers, bools and nils
+func decodeOrdered(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return decodeValue(dec)
+}
+
+func decodeValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		o := &object{vals: map[string]interface{}{}}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			val, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			o.set(key.(string), val)
+		}
+		_, err := dec.Token()
+		return o, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			val, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, val)
+		}
+		_, err := dec.Token()
+		return list, err
+	}
+	return tok, nil
+}
+
+// headlineFields name a record in markdown, in order of preference
+var headlineFields = []string{"title", "name", "path", "key", "content"}
+
+// writeMarkdown renders v as a nested markdown list
+func writeMarkdown(b *strings.Builder, v interface{}, indent string) {
+	switch v := v.(type) {
+	case *object:
+		if listKey := v.listKey(); listKey != "" {
+			// A page: its counts on one line, then its records
+			var summary []string
+			for _, key := range v.keys {
+				if !isContainer(v.vals[key]) && key != listKey {
+					summary = append(summary, fmt.Sprintf("**%s**: %s", key, markdownScalar(v.vals[key], indent)))
+				}
+			}
+			if len(summary) > 0 {
+				b.WriteString(indent + strings.Join(summary, " · ") + "\n\n")
+			}
+			writeMarkdown(b, v.vals[listKey], indent)
+			var rest []string
+			for _, key := range v.keys {
+				if isContainer(v.vals[key]) && key != listKey {
+					rest = append(rest, key)
+				}
+			}
+			writeFields(b, v, rest, indent)
+			return
+		}
+		writeFields(b, v, v.keys, indent)
+	case []interface{}:
+		for _, item := range v {
+			obj, ok := item.(*object)
+			if !ok {
+				if item != nil {
+					b.WriteString(indent + "- " + markdownScalar(item, indent+"  ") + "\n")
+				}
+				continue
+			}
+			headline, rest := "", obj.keys
+			for _, key := range headlineFields {
+				if s, ok := obj.vals[key].(string); ok && s != "" {
+					headline = "**" + markdownScalar(s, indent+"  ") + "**"
+					rest = slices.DeleteFunc(slices.Clone(obj.keys), func(k string) bool { return k == key })
+					break
+				}
+			}
+			if id, ok := obj.vals["id"]; ok {
+				headline = strings.TrimSpace(headline + " (id " + markdownScalar(id, indent) + ")")
+				rest = slices.DeleteFunc(rest, func(k string) bool { return k == "id" })
+			}
+			if headline == "" {
+				headline = "item"
+			}
+			b.WriteString(indent + "- " + headline + "\n")
+			writeFields(b, obj, rest, indent+"  ")
+		}
+	default:
+		b.WriteString(indent + markdownScalar(v, indent) + "\n")
+	}
+}
+
+// writeFields lists some fields of an object, one per line
+func writeFields(b *strings.Builder, o *object, keys []string, indent string) {
+	for _, key := range keys {
+		val := o.vals[key]
+		if isContainer(val) {
+			b.WriteString(indent + "- **" + key + "**:\n")
+			writeMarkdown(b, val, indent+"  ")
+			continue
+		}
+		b.WriteString(indent + "- **" + key + "**: " + markdownScalar(val, indent+"  ") + "\n")
+	}
+}
+
+// isContainer reports whether v is an object or a list holding objects
+func isContainer(v interface{}) bool {
+	switch v := v.(type) {
+	case *object:
+		return true
+	case []interface{}:
+		for _, item := range v {
+			if _, ok := item.(*object); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markdownScalar renders a value inline, indenting continuation lines
+func markdownScalar(v interface{}, indent string) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strings.ReplaceAll(v, "\n", "\n"+indent)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, markdownScalar(item, indent))
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprint(v)
+}
@@ -1,84 +1,150 @@
 package mcp
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rocket/mcp-memories/internal/db"
 )
 
 var ErrUnknownTool = errors.New("unknown tool")
 
-// HandleToolCall routes a tool call to the appropriate handler
-func HandleToolCall(database *db.DB, name string, args map[string]interface{}) (interface{}, error) {
+// HandleToolCall routes a tool call to the appropriate handler. Calls that
+// omit a "project" argument use the session's active project.
+func HandleToolCall(sess *Session, name string, args map[string]interface{}) (interface{}, error) {
 	switch name {
 	// Memory tools
 	case "memory_store":
-		return handleMemoryStore(database, args)
+		return handleMemoryStore(sess, args)
 	case "memory_search":
-		return handleMemorySearch(database, args)
+		return handleMemorySearch(sess, args)
+	case "memory_update":
+		return handleMemoryUpdate(sess, args)
+	case "memory_history":
+		return handleMemoryHistory(sess, args)
 	case "memory_delete":
-		return handleMemoryDelete(database, args)
+		return handleMemoryDelete(sess, args)
+	case "memory_prune":
+		return handleMemoryPrune(sess, args)
+	case "memory_find_duplicates":
+		return handleMemoryFindDuplicates(sess, args)
+
+	// Link tools
+	case "link_create":
+		return handleLinkCreate(sess, args)
+	case "link_delete":
+		return handleLinkDelete(sess, args)
+	case "links_get":
+		return handleLinksGet(sess, args)
+
+	// Tag tools
+	case "tag_list":
+		return handleTagList(sess, args)
+	case "tag_rename":
+		return handleTagRename(sess, args)
+	case "tag_merge":
+		return handleTagMerge(sess, args)
 
 	// Task tools
 	case "task_create":
-		return handleTaskCreate(database, args)
+		return handleTaskCreate(sess, args)
 	case "task_update":
-		return handleTaskUpdate(database, args)
+		return handleTaskUpdate(sess, args)
 	case "task_list":
-		return handleTaskList(database, args)
+		return handleTaskList(sess, args)
 	case "task_delete":
-		return handleTaskDelete(database, args)
+		return handleTaskDelete(sess, args)
+	case "task_tree":
+		return handleTaskTree(sess, args)
+	case "task_move":
+		return handleTaskMove(sess, args)
+	case "task_dependency_add":
+		return handleTaskDependencyAdd(sess, args)
+	case "task_dependency_remove":
+		return handleTaskDependencyRemove(sess, args)
+	case "task_comment_add":
+		return handleTaskCommentAdd(sess, args)
+	case "task_comments_list":
+		return handleTaskCommentsList(sess, args)
+	case "task_workflow_get":
+		return handleTaskWorkflowGet(sess, args)
+	case "task_workflow_set":
+		return handleTaskWorkflowSet(sess, args)
 
 	// Metadata tools
 	case "metadata_set":
-		return handleMetadataSet(database, args)
+		return handleMetadataSet(sess, args)
 	case "metadata_get":
-		return handleMetadataGet(database, args)
+		return handleMetadataGet(sess, args)
 	case "metadata_list":
-		return handleMetadataList(database, args)
+		return handleMetadataList(sess, args)
 	case "metadata_delete":
-		return handleMetadataDelete(database, args)
+		return handleMetadataDelete(sess, args)
 
 	// Filetree tools
 	case "filetree_annotate":
-		return handleFiletreeAnnotate(database, args)
+		return handleFiletreeAnnotate(sess, args)
 	case "filetree_get":
-		return handleFiletreeGet(database, args)
+		return handleFiletreeGet(sess, args)
 	case "filetree_delete":
-		return handleFiletreeDelete(database, args)
+		return handleFiletreeDelete(sess, args)
 
 	// Guideline tools
 	case "guideline_create":
-		return handleGuidelineCreate(database, args)
+		return handleGuidelineCreate(sess, args)
 	case "guideline_update":
-		return handleGuidelineUpdate(database, args)
+		return handleGuidelineUpdate(sess, args)
 	case "guideline_list":
-		return handleGuidelineList(database, args)
+		return handleGuidelineList(sess, args)
 	case "guideline_search":
-		return handleGuidelineSearch(database, args)
+		return handleGuidelineSearch(sess, args)
 	case "guideline_get":
-		return handleGuidelineGet(database, args)
+		return handleGuidelineGet(sess, args)
 	case "guideline_delete":
-		return handleGuidelineDelete(database, args)
+		return handleGuidelineDelete(sess, args)
 
 	// Project tools
 	case "project_create":
-		return handleProjectCreate(database, args)
+		return handleProjectCreate(sess, args)
 	case "project_list":
-		return handleProjectList(database, args)
+		return handleProjectList(sess, args)
 	case "project_set_default":
-		return handleProjectSetDefault(database, args)
+		return handleProjectSetDefault(sess, args)
+	case "project_current":
+		return handleProjectCurrent(sess, args)
+	case "project_update":
+		return handleProjectUpdate(sess, args)
+	case "project_rename":
+		return handleProjectRename(sess, args)
+	case "project_archive":
+		return handleProjectArchive(sess, args)
+	case "project_delete":
+		return handleProjectDelete(sess, args)
+	case "project_merge":
+		return handleProjectMerge(sess, args)
+	case "project_export":
+		return handleProjectExport(sess, args)
+	case "project_import":
+		return handleProjectImport(sess, args)
 
 	// Bookmark tools
 	case "bookmark_create":
-		return handleBookmarkCreate(database, args)
+		return handleBookmarkCreate(sess, args)
 	case "bookmark_search":
-		return handleBookmarkSearch(database, args)
+		return handleBookmarkSearch(sess, args)
 	case "bookmark_list":
-		return handleBookmarkList(database, args)
+		return handleBookmarkList(sess, args)
 	case "bookmark_delete":
-		return handleBookmarkDelete(database, args)
+		return handleBookmarkDelete(sess, args)
+
+	// Search tools
+	case "search_all":
+		return handleSearchAll(sess, args)
 
 	default:
 		return nil, fmt.Errorf("%w: %s", ErrUnknownTool, name)
@@ -137,6 +203,22 @@ func getBool(args map[string]interface{}, key string) bool {
 	return false
 }
 
+// getBoolDefault reads an optional boolean argument
+func getBoolDefault(args map[string]interface{}, key string, def bool) bool {
+	if v, ok := args[key].(bool); ok {
+		return v
+	}
+	return def
+}
+
+// getBoolPtr reads an optional boolean argument, nil when absent
+func getBoolPtr(args map[string]interface{}, key string) *bool {
+	if v, ok := args[key].(bool); ok {
+		return &v
+	}
+	return nil
+}
+
 func getStringArray(args map[string]interface{}, key string) []string {
 	if v, ok := args[key].([]interface{}); ok {
 		result := make([]string, 0, len(v))
@@ -157,50 +239,405 @@ func getStringArrayPtr(args map[string]interface{}, key string) *[]string {
 	return nil
 }
 
-func getProjectID(database *db.DB, args map[string]interface{}) *int64 {
-	if slug := getString(args, "project"); slug != "" {
-		if p, err := database.GetOrCreateProject(slug); err == nil {
-			return &p.ID
+// getPage reads the limit and cursor arguments of a list or search tool. An
+// offset argument is honored when there is no cursor.
+func getPage(args map[string]interface{}, defaultLimit int) (db.PageRequest, error) {
+	page := db.PageRequest{Limit: getInt(args, "limit"), Offset: getInt(args, "offset")}
+	if page.Limit <= 0 {
+		page.Limit = defaultLimit
+	}
+	if cursor := getString(args, "cursor"); cursor != "" {
+		var err error
+		if page.Offset, err = db.DecodeCursor(cursor); err != nil {
+			return db.PageRequest{}, err
+		}
+	}
+	if page.Offset < 0 {
+		return db.PageRequest{}, fmt.Errorf("offset must not be negative")
+	}
+	return page, nil
+}
+
+// paginate returns the page of a complete list that the limit and cursor
+// arguments select, DefaultPageSize items by default
+func paginate[T any](args map[string]interface{}, items []T) (interface{}, error) {
+	page, err := getPage(args, db.DefaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	return db.Paginate(items, page), nil
+}
+
+// getTagFilter reads a tag filter from the all-of argument named key and its
+// any_<key> and exclude_<key> variants
+func getTagFilter(args map[string]interface{}, key string) db.TagFilter {
+	return db.TagFilter{
+		All:  getStringArray(args, key),
+		Any:  getStringArray(args, "any_"+key),
+		None: getStringArray(args, "exclude_"+key),
+	}
+}
+
+// timestampLayouts are the formats accepted for date and time arguments.
+// Times without a zone are UTC.
+var timestampLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+func parseTimestamp(v string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, true
 		}
 	}
-	return nil
+	return time.Time{}, false
+}
+
+// getTimePtr reads an optional date or time argument. An empty string gives
+// the zero time, which clears a field.
+func getTimePtr(args map[string]interface{}, key string) (*time.Time, error) {
+	v := getStringPtr(args, key)
+	if v == nil {
+		return nil, nil
+	}
+	if *v == "" {
+		return &time.Time{}, nil
+	}
+	t, ok := parseTimestamp(*v)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a date (2006-01-02) or RFC 3339 time, got %q", key, *v)
+	}
+	return &t, nil
+}
+
+// getSearchMode reads the search mode argument; semantic modes need a query
+func getSearchMode(args map[string]interface{}, query string) (db.SearchMode, error) {
+	mode, err := db.ParseSearchMode(getString(args, "mode"))
+	if err != nil {
+		return "", err
+	}
+	if mode != db.SearchLexical && query == "" {
+		return "", fmt.Errorf("query is required for %s search", mode)
+	}
+	return mode, nil
+}
+
+// getProjectID resolves the "project" argument, or the session's active
+// project when it is omitted. A slug that names no project is an error unless
+// the server auto-creates projects, so a call never lands in a project other
+// than the one it named.
+func getProjectID(sess *Session, args map[string]interface{}) (*int64, error) {
+	slug := getString(args, "project")
+	if slug == "" {
+		id := sess.ProjectID()
+		return &id, nil
+	}
+	p, err := resolveProject(sess, slug)
+	if err != nil {
+		return nil, err
+	}
+	return &p.ID, nil
+}
+
+// resolveProject finds a project by slug, creating it only when the server
+// auto-creates projects
+func resolveProject(sess *Session, slug string) (*db.Project, error) {
+	p, err := sess.db.GetProjectBySlug(slug)
+	if err == nil {
+		return p, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if !sess.autoCreateProjects {
+		return nil, newUnknownProjectError(sess.db, slug)
+	}
+	if p, err = sess.db.CreateProject(slug, "", ""); err != nil {
+		return nil, fmt.Errorf("creating project %s: %w", slug, err)
+	}
+	return p, nil
+}
+
+// UnknownProjectError reports a project slug that names no project, with the
+// existing slugs it most resembles
+type UnknownProjectError struct {
+	Slug        string   `json:"project"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+func (e *UnknownProjectError) Error() string {
+	msg := fmt.Sprintf("unknown project %q", e.Slug)
+	if len(e.Suggestions) > 0 {
+		quoted := make([]string, len(e.Suggestions))
+		for i, s := range e.Suggestions {
+			quoted[i] = strconv.Quote(s)
+		}
+		msg += fmt.Sprintf(", did you mean %s?", strings.Join(quoted, " or "))
+	} else {
+		msg += " (create it with project_create)"
+	}
+	return msg
+}
+
+// newUnknownProjectError builds an UnknownProjectError with suggestions
+func newUnknownProjectError(database *db.DB, slug string) error {
+	e := &UnknownProjectError{Slug: slug}
+	similar, _ := database.SimilarProjects(slug, 3)
+	for _, p := range similar {
+		e.Suggestions = append(e.Suggestions, p.Slug)
+	}
+	return e
 }
 
 // Memory handlers
-func handleMemoryStore(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleMemoryStore(sess *Session, args map[string]interface{}) (interface{}, error) {
 	content := getString(args, "content")
-	if content == "" {
+	if strings.TrimSpace(content) == "" {
 		return nil, fmt.Errorf("content is required")
 	}
 	keywords := getStringArray(args, "keywords")
-	projectID := getProjectID(database, args)
-	return database.CreateMemory(projectID, content, keywords)
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := getMemoryOptions(args)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := db.ParseDedupeMode(getString(args, "dedupe"))
+	if err != nil {
+		return nil, err
+	}
+	m, dup, err := sess.db.StoreMemory(projectID, content, keywords, opts, mode)
+	if dup != nil {
+		return dup, err
+	}
+	return m, err
 }
 
-func handleMemorySearch(database *db.DB, args map[string]interface{}) (interface{}, error) {
+// getMemoryOptions reads the expires_at, pinned and importance arguments
+func getMemoryOptions(args map[string]interface{}) (db.MemoryOptions, error) {
+	expiresAt, err := getTimePtr(args, "expires_at")
+	if err != nil {
+		return db.MemoryOptions{}, err
+	}
+	return db.MemoryOptions{
+		ExpiresAt:  expiresAt,
+		Pinned:     getBoolPtr(args, "pinned"),
+		Importance: getIntPtr(args, "importance"),
+	}, nil
+}
+
+func handleMemorySearch(sess *Session, args map[string]interface{}) (interface{}, error) {
 	query := getString(args, "query")
-	keywords := getStringArray(args, "keywords")
-	projectID := getProjectID(database, args)
-	limit := getInt(args, "limit")
-	if limit == 0 {
-		limit = 20
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	page, err := getPage(args, 20)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := getSearchMode(args, query)
+	if err != nil {
+		return nil, err
+	}
+	filter := db.MemoryFilter{
+		Keywords:       getTagFilter(args, "keywords"),
+		IncludeExpired: getBool(args, "include_expired"),
 	}
-	return database.SearchMemories(projectID, query, keywords, limit)
+	var result *db.Page[db.Memory]
+	if mode != db.SearchLexical {
+		// Semantic and hybrid search score every memory, so they page in memory
+		var memories []db.Memory
+		memories, err = sess.db.SemanticSearchMemories(projectID, query, filter, mode)
+		result = db.Paginate(memories, page)
+	} else {
+		result, err = sess.db.SearchMemoriesPage(projectID, query, filter, page)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !getBool(args, "include_links") {
+		return result, nil
+	}
+	ids := make([]int64, len(result.Items))
+	for i, m := range result.Items {
+		ids[i] = m.ID
+	}
+	links, err := sess.db.LinksFor("memory", ids...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range result.Items {
+		result.Items[i].Links = links[result.Items[i].ID]
+	}
+	return result, nil
 }
 
-func handleMemoryDelete(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleMemoryUpdate(sess *Session, args map[string]interface{}) (interface{}, error) {
 	id := getInt64(args, "id")
 	if id == 0 {
 		return nil, fmt.Errorf("id is required")
 	}
-	if err := database.DeleteMemory(id); err != nil {
+	opts, err := getMemoryOptions(args)
+	if err != nil {
 		return nil, err
 	}
+	return sess.db.UpdateMemoryWithOptions(id, getStringPtr(args, "content"), getStringArrayPtr(args, "keywords"), getStringArray(args, "add_keywords"), getStringArray(args, "remove_keywords"), opts)
+}
+
+func handleMemoryHistory(sess *Session, args map[string]interface{}) (interface{}, error) {
+	id := getInt64(args, "id")
+	if id == 0 {
+		return nil, fmt.Errorf("id is required")
+	}
+	page, err := getPage(args, db.DefaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.GetMemoryHistoryPage(id, page)
+}
+
+func handleMemoryPrune(sess *Session, args map[string]interface{}) (interface{}, error) {
+	var projectID *int64
+	if !getBool(args, "all_projects") {
+		pid, err := getProjectID(sess, args)
+		if err != nil {
+			return nil, err
+		}
+		resolved := sess.db.GetProjectID(pid)
+		projectID = &resolved
+	}
+	dryRun := getBool(args, "dry_run")
+	ids, err := sess.db.PruneMemories(projectID, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"archived": ids, "count": len(ids), "dry_run": dryRun}, nil
+}
+
+func handleMemoryFindDuplicates(sess *Session, args map[string]interface{}) (interface{}, error) {
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	threshold := db.DuplicateThreshold
+	if v, ok := args["threshold"].(float64); ok {
+		if v <= 0 || v > 1 {
+			return nil, fmt.Errorf("threshold must be greater than 0 and at most 1")
+		}
+		threshold = v
+	}
+	// Clusters are found by comparing every memory, so they page in memory
+	clusters, err := sess.db.FindDuplicateMemories(projectID, threshold)
+	if err != nil {
+		return nil, err
+	}
+	return paginate(args, clusters)
+}
+
+func handleMemoryDelete(sess *Session, args map[string]interface{}) (interface{}, error) {
+	id := getInt64(args, "id")
+	if id == 0 {
+		return nil, fmt.Errorf("id is required")
+	}
+	if err := sess.db.DeleteMemory(id); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"deleted": true, "id": id}, nil
+}
+
+// Link handlers
+func handleLinkCreate(sess *Session, args map[string]interface{}) (interface{}, error) {
+	sourceType, targetType := getString(args, "source_type"), getString(args, "target_type")
+	sourceID, targetID := getInt64(args, "source_id"), getInt64(args, "target_id")
+	if sourceType == "" || sourceID == 0 || targetType == "" || targetID == 0 {
+		return nil, fmt.Errorf("source_type, source_id, target_type and target_id are required")
+	}
+	relation := getString(args, "relation")
+	if relation == "" {
+		relation = "relates_to"
+	}
+	return sess.db.CreateLink(sourceType, sourceID, targetType, targetID, relation)
+}
+
+func handleLinkDelete(sess *Session, args map[string]interface{}) (interface{}, error) {
+	id := getInt64(args, "id")
+	if id == 0 {
+		return nil, fmt.Errorf("id is required")
+	}
+	deleted, err := sess.db.DeleteLink(id)
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return nil, fmt.Errorf("link %d not found", id)
+	}
 	return map[string]interface{}{"deleted": true, "id": id}, nil
 }
 
+func handleLinksGet(sess *Session, args map[string]interface{}) (interface{}, error) {
+	typ, id := getString(args, "type"), getInt64(args, "id")
+	if typ == "" || id == 0 {
+		return nil, fmt.Errorf("type and id are required")
+	}
+	exists, err := sess.db.EntityExists(typ, id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%s %d not found", typ, id)
+	}
+	page, err := getPage(args, db.DefaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.GetLinksPage(typ, id, getString(args, "relation"), page)
+}
+
+// Tag handlers
+func handleTagList(sess *Session, args map[string]interface{}) (interface{}, error) {
+	var projectID *int64
+	if !getBool(args, "all_projects") {
+		pid, err := getProjectID(sess, args)
+		if err != nil {
+			return nil, err
+		}
+		resolved := sess.db.GetProjectID(pid)
+		projectID = &resolved
+	}
+	page, err := getPage(args, db.DefaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.ListTagsPage(projectID, page)
+}
+
+func handleTagRename(sess *Session, args map[string]interface{}) (interface{}, error) {
+	from, to := getString(args, "from"), getString(args, "to")
+	if from == "" || to == "" {
+		return nil, fmt.Errorf("from and to are required")
+	}
+	retagged, err := sess.db.RenameTag(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"renamed": true, "from": from, "to": to, "retagged": retagged}, nil
+}
+
+func handleTagMerge(sess *Session, args map[string]interface{}) (interface{}, error) {
+	sources, into := getStringArray(args, "sources"), getString(args, "into")
+	if len(sources) == 0 || into == "" {
+		return nil, fmt.Errorf("sources and into are required")
+	}
+	retagged, err := sess.db.MergeTags(sources, into)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"merged": sources, "into": into, "retagged": retagged}, nil
+}
+
 // Task handlers
-func handleTaskCreate(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleTaskCreate(sess *Session, args map[string]interface{}) (interface{}, error) {
 	title := getString(args, "title")
 	if title == "" {
 		return nil, fmt.Errorf("title is required")
@@ -208,54 +645,290 @@ func handleTaskCreate(database *db.DB, args map[string]interface{}) (interface{}
 	description := getString(args, "description")
 	parentID := getInt64Ptr(args, "parent_id")
 	priority := getInt(args, "priority")
-	projectID := getProjectID(database, args)
-	return database.CreateTask(projectID, parentID, title, description, priority)
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	details, err := getTaskDetails(args)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.CreateTaskWithDetails(projectID, parentID, title, description, priority, details)
 }
 
-func handleTaskUpdate(database *db.DB, args map[string]interface{}) (interface{}, error) {
+// getTaskDetails reads the due_at, estimate_minutes, assignee and labels
+// arguments
+func getTaskDetails(args map[string]interface{}) (db.TaskDetails, error) {
+	dueAt, err := getTimePtr(args, "due_at")
+	if err != nil {
+		return db.TaskDetails{}, err
+	}
+	return db.TaskDetails{
+		DueAt:           dueAt,
+		EstimateMinutes: getIntPtr(args, "estimate_minutes"),
+		Assignee:        getStringPtr(args, "assignee"),
+		Labels:          getStringArrayPtr(args, "labels"),
+	}, nil
+}
+
+func handleTaskUpdate(sess *Session, args map[string]interface{}) (interface{}, error) {
 	id := getInt64(args, "id")
 	if id == 0 {
 		return nil, fmt.Errorf("id is required")
 	}
-	return database.UpdateTask(id, getStringPtr(args, "title"), getStringPtr(args, "description"), getStringPtr(args, "status"), getIntPtr(args, "priority"))
+	details, err := getTaskDetails(args)
+	if err != nil {
+		return nil, err
+	}
+	if comment := getString(args, "comment"); comment != "" {
+		details.Comment = &db.TaskComment{Author: getString(args, "author"), Content: comment}
+	}
+	before, err := sess.db.GetTask(id)
+	if err != nil {
+		return nil, err
+	}
+	task, err := sess.db.UpdateTaskWithDetails(id, getStringPtr(args, "title"), getStringPtr(args, "description"), getStringPtr(args, "status"), getIntPtr(args, "priority"), details)
+	if err != nil {
+		return nil, err
+	}
+	if before.CompletedAt != nil || task.CompletedAt == nil {
+		return task, nil
+	}
+	unblocked, err := sess.db.UnblockedBy(id)
+	if err != nil {
+		return nil, err
+	}
+	return taskUpdateResult{Task: task, Unblocked: unblocked}, nil
 }
 
-func handleTaskList(database *db.DB, args map[string]interface{}) (interface{}, error) {
-	projectID := getProjectID(database, args)
-	status := getStringPtr(args, "status")
-	parentID := getInt64Ptr(args, "parent_id")
-	return database.ListTasks(projectID, status, parentID)
+// taskUpdateResult is a task that was just completed, along with the tasks
+// that completing it unblocked
+type taskUpdateResult struct {
+	*db.Task
+	Unblocked []db.Task `json:"unblocked"`
+}
+
+func handleTaskList(sess *Session, args map[string]interface{}) (interface{}, error) {
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	filter := db.TaskFilter{
+		Statuses: getStringArray(args, "statuses"),
+		ParentID: getInt64Ptr(args, "parent_id"),
+		Ready:    getBool(args, "ready"),
+		Labels:   getStringArray(args, "labels"),
+		Assignee: getStringPtr(args, "assignee"),
+		Query:    getString(args, "query"),
+		Sort:     getString(args, "sort"),
+	}
+	if status := getString(args, "status"); status != "" {
+		filter.Statuses = append(filter.Statuses, status)
+	}
+	if filter.DueBefore, err = getTimePtr(args, "due_before"); err != nil {
+		return nil, err
+	}
+	if filter.DueAfter, err = getTimePtr(args, "due_after"); err != nil {
+		return nil, err
+	}
+	page, err := getPage(args, db.DefaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	result, err := sess.db.ListTasksPage(projectID, filter, page)
+	if err != nil || !getBool(args, "include_links") {
+		return result, err
+	}
+	ids := make([]int64, len(result.Items))
+	for i, t := range result.Items {
+		ids[i] = t.ID
+	}
+	links, err := sess.db.LinksFor("task", ids...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range result.Items {
+		result.Items[i].Links = links[result.Items[i].ID]
+	}
+	return result, nil
 }
 
-func handleTaskDelete(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleTaskDelete(sess *Session, args map[string]interface{}) (interface{}, error) {
 	id := getInt64(args, "id")
 	if id == 0 {
 		return nil, fmt.Errorf("id is required")
 	}
-	if err := database.DeleteTask(id); err != nil {
+	deleted, err := sess.db.DeleteTask(id, getBool(args, "reparent"))
+	if err != nil {
 		return nil, err
 	}
-	return map[string]interface{}{"deleted": true, "id": id}, nil
+	if deleted == 0 {
+		return nil, fmt.Errorf("task %d not found", id)
+	}
+	return map[string]interface{}{"deleted": true, "id": id, "tasks_deleted": deleted}, nil
+}
+
+func handleTaskTree(sess *Session, args map[string]interface{}) (interface{}, error) {
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.GetTaskTree(projectID, getInt64Ptr(args, "id"))
+}
+
+func handleTaskMove(sess *Session, args map[string]interface{}) (interface{}, error) {
+	id := getInt64(args, "id")
+	if id == 0 {
+		return nil, fmt.Errorf("id is required")
+	}
+	parentID := getInt64Ptr(args, "parent_id")
+	if parentID != nil && *parentID == 0 {
+		parentID = nil
+	}
+	return sess.db.MoveTask(id, parentID)
+}
+
+func handleTaskDependencyAdd(sess *Session, args map[string]interface{}) (interface{}, error) {
+	taskID, dependsOnID, err := getDependencyArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := sess.db.AddTaskDependency(taskID, dependsOnID); err != nil {
+		return nil, err
+	}
+	return sess.db.GetTaskDependencies(taskID)
+}
+
+func handleTaskDependencyRemove(sess *Session, args map[string]interface{}) (interface{}, error) {
+	taskID, dependsOnID, err := getDependencyArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	removed, err := sess.db.RemoveTaskDependency(taskID, dependsOnID)
+	if err != nil {
+		return nil, err
+	}
+	if !removed {
+		return nil, fmt.Errorf("task %d does not depend on task %d", taskID, dependsOnID)
+	}
+	return sess.db.GetTaskDependencies(taskID)
+}
+
+func handleTaskCommentAdd(sess *Session, args map[string]interface{}) (interface{}, error) {
+	taskID := getInt64(args, "task_id")
+	if taskID == 0 {
+		return nil, fmt.Errorf("task_id is required")
+	}
+	content := getString(args, "content")
+	if content == "" {
+		return nil, fmt.Errorf("content is required")
+	}
+	return sess.db.AddTaskComment(taskID, getString(args, "author"), content)
+}
+
+func handleTaskCommentsList(sess *Session, args map[string]interface{}) (interface{}, error) {
+	taskID := getInt64(args, "task_id")
+	if taskID == 0 {
+		return nil, fmt.Errorf("task_id is required")
+	}
+	if _, err := sess.db.GetTask(taskID); err != nil {
+		return nil, fmt.Errorf("task %d: %w", taskID, err)
+	}
+	page, err := getPage(args, db.DefaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := sess.db.ListTaskCommentsPage(taskID, page)
+	if err != nil {
+		return nil, err
+	}
+	result := taskCommentsResult{TaskID: taskID, Page: comments}
+	if getBoolDefault(args, "include_activity", true) {
+		if result.Activity, err = sess.db.ListTaskActivity(taskID); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// taskCommentsResult is a page of a task's comments, along with the task's
+// change history
+type taskCommentsResult struct {
+	TaskID int64 `json:"task_id"`
+	*db.Page[db.TaskComment]
+	Activity []db.TaskActivity `json:"activity,omitempty"`
+}
+
+func handleTaskWorkflowGet(sess *Session, args map[string]interface{}) (interface{}, error) {
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.GetWorkflow(projectID)
+}
+
+func handleTaskWorkflowSet(sess *Session, args map[string]interface{}) (interface{}, error) {
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	if getBool(args, "reset") {
+		return sess.db.ResetWorkflow(projectID)
+	}
+	w := db.Workflow{
+		Statuses: getStringArray(args, "statuses"),
+		Started:  getStringArray(args, "started"),
+		Closed:   getStringArray(args, "closed"),
+	}
+	if transitions, ok := args["transitions"].(map[string]interface{}); ok {
+		w.Transitions = make(map[string][]string, len(transitions))
+		for from := range transitions {
+			w.Transitions[from] = getStringArray(transitions, from)
+		}
+	}
+	return sess.db.SetWorkflow(projectID, w)
+}
+
+func getDependencyArgs(args map[string]interface{}) (taskID, dependsOnID int64, err error) {
+	taskID = getInt64(args, "task_id")
+	if taskID == 0 {
+		return 0, 0, fmt.Errorf("task_id is required")
+	}
+	dependsOnID = getInt64(args, "depends_on_id")
+	if dependsOnID == 0 {
+		return 0, 0, fmt.Errorf("depends_on_id is required")
+	}
+	return taskID, dependsOnID, nil
 }
 
 // Metadata handlers
-func handleMetadataSet(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleMetadataSet(sess *Session, args map[string]interface{}) (interface{}, error) {
 	key := getString(args, "key")
 	if key == "" {
 		return nil, fmt.Errorf("key is required")
 	}
 	value := getString(args, "value")
-	projectID := getProjectID(database, args)
-	return database.SetMetadata(projectID, key, value)
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.SetMetadata(projectID, key, value)
 }
 
-func handleMetadataGet(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleMetadataGet(sess *Session, args map[string]interface{}) (interface{}, error) {
 	key := getString(args, "key")
 	if key == "" {
 		return nil, fmt.Errorf("key is required")
 	}
-	projectID := getProjectID(database, args)
-	m, err := database.GetMetadata(projectID, key)
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	get := sess.db.GetMetadata
+	if getBoolDefault(args, "include_inherited", true) {
+		get = sess.db.GetMetadataInherited
+	}
+	m, err := get(projectID, key)
 	if err != nil {
 		return nil, err
 	}
@@ -265,25 +938,35 @@ func handleMetadataGet(database *db.DB, args map[string]interface{}) (interface{
 	return m, nil
 }
 
-func handleMetadataList(database *db.DB, args map[string]interface{}) (interface{}, error) {
-	projectID := getProjectID(database, args)
-	return database.ListMetadata(projectID)
+func handleMetadataList(sess *Session, args map[string]interface{}) (interface{}, error) {
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	page, err := getPage(args, db.DefaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.ListMetadataPage(projectID, getBoolDefault(args, "include_inherited", true), page)
 }
 
-func handleMetadataDelete(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleMetadataDelete(sess *Session, args map[string]interface{}) (interface{}, error) {
 	key := getString(args, "key")
 	if key == "" {
 		return nil, fmt.Errorf("key is required")
 	}
-	projectID := getProjectID(database, args)
-	if err := database.DeleteMetadata(projectID, key); err != nil {
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := sess.db.DeleteMetadata(projectID, key); err != nil {
 		return nil, err
 	}
 	return map[string]interface{}{"deleted": true, "key": key}, nil
 }
 
 // Filetree handlers
-func handleFiletreeAnnotate(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleFiletreeAnnotate(sess *Session, args map[string]interface{}) (interface{}, error) {
 	path := getString(args, "path")
 	if path == "" {
 		return nil, fmt.Errorf("path is required")
@@ -293,32 +976,50 @@ func handleFiletreeAnnotate(database *db.DB, args map[string]interface{}) (inter
 		return nil, fmt.Errorf("note is required")
 	}
 	isDir := getBool(args, "is_dir")
-	projectID := getProjectID(database, args)
-	return database.AnnotateFile(projectID, path, note, isDir)
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.AnnotateFile(projectID, path, note, isDir)
 }
 
-func handleFiletreeGet(database *db.DB, args map[string]interface{}) (interface{}, error) {
-	projectID := getProjectID(database, args)
+func handleFiletreeGet(sess *Session, args map[string]interface{}) (interface{}, error) {
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
 	if path := getString(args, "path"); path != "" {
-		return database.GetFileAnnotation(projectID, path)
+		f, err := sess.db.GetFileAnnotation(projectID, path)
+		if err != nil || f == nil || !getBool(args, "include_links") {
+			return f, err
+		}
+		f.Links, err = sess.db.GetLinks("filetree", f.ID, "")
+		return f, err
 	}
-	return database.ListFileAnnotations(projectID)
+	page, err := getPage(args, db.DefaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.ListFileAnnotationsPage(projectID, page)
 }
 
-func handleFiletreeDelete(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleFiletreeDelete(sess *Session, args map[string]interface{}) (interface{}, error) {
 	path := getString(args, "path")
 	if path == "" {
 		return nil, fmt.Errorf("path is required")
 	}
-	projectID := getProjectID(database, args)
-	if err := database.DeleteFileAnnotation(projectID, path); err != nil {
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := sess.db.DeleteFileAnnotation(projectID, path); err != nil {
 		return nil, err
 	}
 	return map[string]interface{}{"deleted": true, "path": path}, nil
 }
 
 // Guideline handlers
-func handleGuidelineCreate(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleGuidelineCreate(sess *Session, args map[string]interface{}) (interface{}, error) {
 	category := getString(args, "category")
 	if category == "" {
 		return nil, fmt.Errorf("category is required")
@@ -333,83 +1034,275 @@ func handleGuidelineCreate(database *db.DB, args map[string]interface{}) (interf
 	}
 	tags := getStringArray(args, "tags")
 	priority := getInt(args, "priority")
-	projectID := getProjectID(database, args)
-	return database.CreateGuideline(projectID, category, title, content, tags, priority)
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.CreateGuideline(projectID, category, title, content, tags, priority)
 }
 
-func handleGuidelineUpdate(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleGuidelineUpdate(sess *Session, args map[string]interface{}) (interface{}, error) {
 	id := getInt64(args, "id")
 	if id == 0 {
 		return nil, fmt.Errorf("id is required")
 	}
-	return database.UpdateGuideline(id, getStringPtr(args, "content"), getStringArrayPtr(args, "tags"), getIntPtr(args, "priority"))
+	return sess.db.UpdateGuideline(id, getStringPtr(args, "content"), getStringArrayPtr(args, "tags"), getIntPtr(args, "priority"))
 }
 
-func handleGuidelineList(database *db.DB, args map[string]interface{}) (interface{}, error) {
-	projectID := getProjectID(database, args)
-	category := getStringPtr(args, "category")
-	return database.ListGuidelines(projectID, category)
+func handleGuidelineList(sess *Session, args map[string]interface{}) (interface{}, error) {
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	page, err := getPage(args, db.DefaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.ListGuidelinesPage(projectID, getStringPtr(args, "category"), getBoolDefault(args, "include_inherited", true), page)
 }
 
-func handleGuidelineSearch(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleGuidelineSearch(sess *Session, args map[string]interface{}) (interface{}, error) {
 	query := getString(args, "query")
-	if query == "" {
-		return nil, fmt.Errorf("query is required")
+	tags := getTagFilter(args, "tags")
+	if query == "" && len(tags.All)+len(tags.Any)+len(tags.None) == 0 {
+		return nil, fmt.Errorf("query or tags is required")
+	}
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
 	}
-	projectID := getProjectID(database, args)
 	category := getStringPtr(args, "category")
-	return database.SearchGuidelines(projectID, query, category)
+	inherit := getBoolDefault(args, "include_inherited", true)
+	page, err := getPage(args, 20)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := getSearchMode(args, query)
+	if err != nil {
+		return nil, err
+	}
+	if mode == db.SearchLexical {
+		return sess.db.SearchGuidelinesPage(projectID, query, category, tags, inherit, page)
+	}
+	// Semantic and hybrid search score every guideline, so they page in memory
+	guidelines, err := sess.db.SemanticSearchGuidelines(projectID, query, category, tags, 0, mode, inherit)
+	if err != nil {
+		return nil, err
+	}
+	return db.Paginate(guidelines, page), nil
 }
 
-func handleGuidelineGet(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleGuidelineGet(sess *Session, args map[string]interface{}) (interface{}, error) {
 	id := getInt64(args, "id")
 	if id == 0 {
 		return nil, fmt.Errorf("id is required")
 	}
-	return database.GetGuideline(id)
+	g, err := sess.db.GetGuideline(id)
+	if err != nil || g == nil || !getBool(args, "include_links") {
+		return g, err
+	}
+	g.Links, err = sess.db.GetLinks("guideline", id, "")
+	return g, err
 }
 
-func handleGuidelineDelete(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleGuidelineDelete(sess *Session, args map[string]interface{}) (interface{}, error) {
 	id := getInt64(args, "id")
 	if id == 0 {
 		return nil, fmt.Errorf("id is required")
 	}
-	if err := database.DeleteGuideline(id); err != nil {
+	if err := sess.db.DeleteGuideline(id); err != nil {
 		return nil, err
 	}
 	return map[string]interface{}{"deleted": true, "id": id}, nil
 }
 
 // Project handlers
-func handleProjectCreate(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleProjectCreate(sess *Session, args map[string]interface{}) (interface{}, error) {
 	slug := getString(args, "slug")
 	if slug == "" {
 		return nil, fmt.Errorf("slug is required")
 	}
 	name := getString(args, "name")
 	rootPath := getString(args, "root_path")
-	return database.CreateProject(slug, name, rootPath)
+	opts, err := getProjectOptions(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.CreateProjectWithOptions(slug, name, rootPath, opts)
 }
 
-func handleProjectList(database *db.DB, args map[string]interface{}) (interface{}, error) {
-	return database.ListProjects()
+// getProjectOptions reads the parent argument: a project slug, or empty to
+// stop inheriting
+func getProjectOptions(sess *Session, args map[string]interface{}) (db.ProjectOptions, error) {
+	parent := getStringPtr(args, "parent")
+	if parent == nil {
+		return db.ProjectOptions{}, nil
+	}
+	var parentID int64
+	if *parent != "" {
+		p, err := lookupProject(sess, args, "parent")
+		if err != nil {
+			return db.ProjectOptions{}, err
+		}
+		parentID = p.ID
+	}
+	return db.ProjectOptions{Parent: &parentID}, nil
 }
 
-func handleProjectSetDefault(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleProjectList(sess *Session, args map[string]interface{}) (interface{}, error) {
+	page, err := getPage(args, db.DefaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.ListProjectsPage(getBool(args, "include_archived"), page)
+}
+
+func handleProjectSetDefault(sess *Session, args map[string]interface{}) (interface{}, error) {
 	slug := getString(args, "slug")
 	if slug == "" {
 		return nil, fmt.Errorf("slug is required")
 	}
-	p, err := database.GetOrCreateProject(slug)
+	p, err := resolveProject(sess, slug)
 	if err != nil {
 		return nil, err
 	}
-	database.SetDefaultProject(p.ID)
+	previous := sess.ProjectID()
+	sess.SetProjectID(p.ID)
+	if p.ID != previous {
+		sess.toolsChanged()
+	}
 	return map[string]interface{}{"default_project": p}, nil
 }
 
+func handleProjectCurrent(sess *Session, args map[string]interface{}) (interface{}, error) {
+	p, err := sess.db.GetProjectByID(sess.ProjectID())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"project": p, "source": sess.ProjectSource()}, nil
+}
+
+// lookupProject finds an existing project by the slug in args[key]
+func lookupProject(sess *Session, args map[string]interface{}, key string) (*db.Project, error) {
+	slug := getString(args, key)
+	if slug == "" {
+		return nil, fmt.Errorf("%s is required", key)
+	}
+	p, err := sess.db.GetProjectBySlug(slug)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, newUnknownProjectError(sess.db, slug)
+	}
+	return p, err
+}
+
+func handleProjectUpdate(sess *Session, args map[string]interface{}) (interface{}, error) {
+	p, err := lookupProject(sess, args, "slug")
+	if err != nil {
+		return nil, err
+	}
+	opts, err := getProjectOptions(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.UpdateProjectWithOptions(p.ID, getStringPtr(args, "name"), getStringPtr(args, "root_path"), opts)
+}
+
+func handleProjectRename(sess *Session, args map[string]interface{}) (interface{}, error) {
+	p, err := lookupProject(sess, args, "slug")
+	if err != nil {
+		return nil, err
+	}
+	newSlug := getString(args, "new_slug")
+	if newSlug == "" {
+		return nil, fmt.Errorf("new_slug is required")
+	}
+	return sess.db.RenameProject(p.ID, newSlug)
+}
+
+func handleProjectArchive(sess *Session, args map[string]interface{}) (interface{}, error) {
+	p, err := lookupProject(sess, args, "slug")
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.ArchiveProject(p.ID, getBoolDefault(args, "archived", true))
+}
+
+func handleProjectDelete(sess *Session, args map[string]interface{}) (interface{}, error) {
+	p, err := lookupProject(sess, args, "slug")
+	if err != nil {
+		return nil, err
+	}
+	if !getBool(args, "confirm") {
+		return nil, fmt.Errorf("confirm must be true to delete project %s and all of its data", p.Slug)
+	}
+	if err := sess.db.DeleteProject(p.ID); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"deleted": true, "slug": p.Slug}, nil
+}
+
+func handleProjectMerge(sess *Session, args map[string]interface{}) (interface{}, error) {
+	source, err := lookupProject(sess, args, "source")
+	if err != nil {
+		return nil, err
+	}
+	target, err := lookupProject(sess, args, "target")
+	if err != nil {
+		return nil, err
+	}
+	strategy, err := db.ParseMergeStrategy(getString(args, "strategy"))
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.MergeProjects(source.ID, target.ID, strategy)
+}
+
+func handleProjectExport(sess *Session, args map[string]interface{}) (interface{}, error) {
+	var ids []int64
+	if !getBool(args, "all") {
+		id := sess.ProjectID()
+		if slug := getString(args, "project"); slug != "" {
+			p, err := sess.db.GetProjectBySlug(slug)
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, newUnknownProjectError(sess.db, slug)
+			}
+			if err != nil {
+				return nil, err
+			}
+			id = p.ID
+		}
+		ids = append(ids, id)
+	}
+
+	return sess.db.ExportProjects(ids...)
+}
+
+func handleProjectImport(sess *Session, args map[string]interface{}) (interface{}, error) {
+	// Exports only travel inline; reading or writing files is left to the
+	// command line, since any client, including remote HTTP ones, could
+	// otherwise reach every file the server can
+	data, ok := args["data"]
+	if !ok {
+		return nil, fmt.Errorf("data is required")
+	}
+	raw, _ := json.Marshal(data)
+
+	var export db.Export
+	if err := json.Unmarshal(raw, &export); err != nil {
+		return nil, fmt.Errorf("invalid export: %w", err)
+	}
+	strategy, err := db.ParseMergeStrategy(getString(args, "strategy"))
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.Import(&export, db.ImportOptions{
+		Strategy: strategy,
+		Project:  getString(args, "project"),
+	})
+}
+
 // Bookmark handlers
-func handleBookmarkCreate(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleBookmarkCreate(sess *Session, args map[string]interface{}) (interface{}, error) {
 	url := getString(args, "url")
 	if url == "" {
 		return nil, fmt.Errorf("url is required")
@@ -423,30 +1316,108 @@ func handleBookmarkCreate(database *db.DB, args map[string]interface{}) (interfa
 	docType := getString(args, "doc_type")
 	pageOrSection := getString(args, "page_or_section")
 	tags := getStringArray(args, "tags")
-	projectID := getProjectID(database, args)
-	return database.CreateBookmark(projectID, url, title, excerpt, note, docType, pageOrSection, tags)
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.CreateBookmark(projectID, url, title, excerpt, note, docType, pageOrSection, tags)
 }
 
-func handleBookmarkSearch(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleBookmarkSearch(sess *Session, args map[string]interface{}) (interface{}, error) {
 	query := getString(args, "query")
-	tags := getStringArray(args, "tags")
+	tags := getTagFilter(args, "tags")
 	docType := getStringPtr(args, "doc_type")
-	projectID := getProjectID(database, args)
-	return database.SearchBookmarks(projectID, query, tags, docType)
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	inherit := getBoolDefault(args, "include_inherited", true)
+	page, err := getPage(args, 20)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := getSearchMode(args, query)
+	if err != nil {
+		return nil, err
+	}
+	if mode == db.SearchLexical {
+		return sess.db.SearchBookmarksPage(projectID, query, tags, docType, inherit, page)
+	}
+	// Semantic and hybrid search score every bookmark, so they page in memory
+	bookmarks, err := sess.db.SemanticSearchBookmarks(projectID, query, tags, docType, 0, mode, inherit)
+	if err != nil {
+		return nil, err
+	}
+	return db.Paginate(bookmarks, page), nil
 }
 
-func handleBookmarkList(database *db.DB, args map[string]interface{}) (interface{}, error) {
-	projectID := getProjectID(database, args)
-	return database.ListBookmarks(projectID)
+func handleBookmarkList(sess *Session, args map[string]interface{}) (interface{}, error) {
+	projectID, err := getProjectID(sess, args)
+	if err != nil {
+		return nil, err
+	}
+	page, err := getPage(args, db.DefaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	result, err := sess.db.ListBookmarksPage(projectID, getBoolDefault(args, "include_inherited", true), page)
+	if err != nil || !getBool(args, "include_links") {
+		return result, err
+	}
+	ids := make([]int64, len(result.Items))
+	for i, b := range result.Items {
+		ids[i] = b.ID
+	}
+	links, err := sess.db.LinksFor("bookmark", ids...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range result.Items {
+		result.Items[i].Links = links[result.Items[i].ID]
+	}
+	return result, nil
 }
 
-func handleBookmarkDelete(database *db.DB, args map[string]interface{}) (interface{}, error) {
+func handleBookmarkDelete(sess *Session, args map[string]interface{}) (interface{}, error) {
 	id := getInt64(args, "id")
 	if id == 0 {
 		return nil, fmt.Errorf("id is required")
 	}
-	if err := database.DeleteBookmark(id); err != nil {
+	if err := sess.db.DeleteBookmark(id); err != nil {
 		return nil, err
 	}
 	return map[string]interface{}{"deleted": true, "id": id}, nil
 }
+
+// Search handlers
+func handleSearchAll(sess *Session, args map[string]interface{}) (interface{}, error) {
+	query := getString(args, "query")
+	if query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+
+	var projectIDs []int64
+	for _, slug := range getStringArray(args, "projects") {
+		p, err := sess.db.GetProjectBySlug(slug)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, newUnknownProjectError(sess.db, slug)
+		}
+		if err != nil {
+			return nil, err
+		}
+		projectIDs = append(projectIDs, p.ID)
+	}
+
+	page, err := getPage(args, 20)
+	if err != nil {
+		return nil, err
+	}
+	return sess.db.SearchEverything(db.SearchAllOptions{
+		Query:        query,
+		ProjectIDs:   projectIDs,
+		Types:        getStringArray(args, "types"),
+		PerTypeLimit: getInt(args, "per_type_limit"),
+		Limit:        page.Limit,
+		Offset:       page.Offset,
+	})
+}
@@ -1,12 +1,18 @@
 package mcp
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
 	"testing"
 
 	"github.com/rocket/mcp-memories/internal/db"
 )
 
-// TestAllTools is a comprehensive integration test that exercises all 24 MCP tools
+// TestAllTools is a comprehensive integration test that exercises the core MCP tools
 // by storing data and then recalling it to verify functionality.
 func TestAllTools(t *testing.T) {
 	// Setup: Create in-memory database for test isolation
@@ -15,6 +21,7 @@ func TestAllTools(t *testing.T) {
 		t.Fatalf("Failed to open database: %v", err)
 	}
 	defer database.Close()
+	sess := NewSession(database)
 
 	// Track IDs from create operations for use in recall/delete operations
 	var (
@@ -28,7 +35,7 @@ func TestAllTools(t *testing.T) {
 	// PROJECT TOOLS (3 tools)
 	// ========================================
 	t.Run("project_create", func(t *testing.T) {
-		result, err := HandleToolCall(database, "project_create", map[string]interface{}{
+		result, err := HandleToolCall(sess, "project_create", map[string]interface{}{
 			"slug":      "test-project",
 			"name":      "Test Project",
 			"root_path": "/path/to/project",
@@ -43,14 +50,15 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("project_list", func(t *testing.T) {
-		result, err := HandleToolCall(database, "project_list", map[string]interface{}{})
+		result, err := HandleToolCall(sess, "project_list", map[string]interface{}{})
 		if err != nil {
 			t.Fatalf("project_list failed: %v", err)
 		}
-		projects, ok := result.([]db.Project)
+		page, ok := result.(*db.Page[db.Project])
 		if !ok {
 			t.Fatalf("unexpected result type: %T", result)
 		}
+		projects := page.Items
 		// Should have at least the default project and our test project
 		if len(projects) < 1 {
 			t.Error("project_list returned no projects")
@@ -59,7 +67,7 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("project_set_default", func(t *testing.T) {
-		result, err := HandleToolCall(database, "project_set_default", map[string]interface{}{
+		result, err := HandleToolCall(sess, "project_set_default", map[string]interface{}{
 			"slug": "test-project",
 		})
 		if err != nil {
@@ -72,10 +80,10 @@ func TestAllTools(t *testing.T) {
 	})
 
 	// ========================================
-	// MEMORY TOOLS (3 tools)
+	// MEMORY TOOLS (5 tools)
 	// ========================================
 	t.Run("memory_store", func(t *testing.T) {
-		result, err := HandleToolCall(database, "memory_store", map[string]interface{}{
+		result, err := HandleToolCall(sess, "memory_store", map[string]interface{}{
 			"content":  "This is a test memory about Go programming",
 			"keywords": []interface{}{"go", "programming", "test"},
 		})
@@ -94,17 +102,18 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("memory_search", func(t *testing.T) {
-		result, err := HandleToolCall(database, "memory_search", map[string]interface{}{
+		result, err := HandleToolCall(sess, "memory_search", map[string]interface{}{
 			"query":    "Go programming",
 			"keywords": []interface{}{"go"},
 		})
 		if err != nil {
 			t.Fatalf("memory_search failed: %v", err)
 		}
-		memories, ok := result.([]db.Memory)
+		page, ok := result.(*db.Page[db.Memory])
 		if !ok {
 			t.Fatalf("unexpected result type: %T", result)
 		}
+		memories := page.Items
 		if len(memories) == 0 {
 			t.Error("memory_search returned no results")
 		} else {
@@ -112,8 +121,56 @@ func TestAllTools(t *testing.T) {
 		}
 	})
 
+	t.Run("memory_update", func(t *testing.T) {
+		result, err := HandleToolCall(sess, "memory_update", map[string]interface{}{
+			"id":              float64(memoryID),
+			"content":         "This is an updated test memory about Go programming",
+			"add_keywords":    []interface{}{"updated"},
+			"remove_keywords": []interface{}{"test"},
+		})
+		if err != nil {
+			t.Fatalf("memory_update failed: %v", err)
+		}
+		memory, ok := result.(*db.Memory)
+		if !ok {
+			t.Fatalf("unexpected result type: %T", result)
+		}
+		if memory.ID != memoryID {
+			t.Errorf("memory ID changed: %d", memory.ID)
+		}
+		want := []string{"go", "programming", "updated"}
+		if len(memory.Keywords) != len(want) {
+			t.Fatalf("keywords mismatch: %v", memory.Keywords)
+		}
+		for i := range want {
+			if memory.Keywords[i] != want[i] {
+				t.Errorf("keywords mismatch: %v", memory.Keywords)
+				break
+			}
+		}
+		t.Logf("memory_update succeeded: keywords=%v", memory.Keywords)
+	})
+
+	t.Run("memory_history", func(t *testing.T) {
+		result, err := HandleToolCall(sess, "memory_history", map[string]interface{}{
+			"id": float64(memoryID),
+		})
+		if err != nil {
+			t.Fatalf("memory_history failed: %v", err)
+		}
+		page, ok := result.(*db.Page[db.MemoryRevision])
+		if !ok {
+			t.Fatalf("unexpected result type: %T", result)
+		}
+		revisions := page.Items
+		if len(revisions) != 1 || revisions[0].Content != "This is a test memory about Go programming" {
+			t.Errorf("unexpected history: %+v", revisions)
+		}
+		t.Logf("memory_history found %d revisions", len(revisions))
+	})
+
 	t.Run("memory_delete", func(t *testing.T) {
-		result, err := HandleToolCall(database, "memory_delete", map[string]interface{}{
+		result, err := HandleToolCall(sess, "memory_delete", map[string]interface{}{
 			"id": float64(memoryID), // JSON numbers are float64
 		})
 		if err != nil {
@@ -130,7 +187,7 @@ func TestAllTools(t *testing.T) {
 	// TASK TOOLS (4 tools)
 	// ========================================
 	t.Run("task_create", func(t *testing.T) {
-		result, err := HandleToolCall(database, "task_create", map[string]interface{}{
+		result, err := HandleToolCall(sess, "task_create", map[string]interface{}{
 			"title":       "Test Task",
 			"description": "A test task for integration testing",
 			"priority":    float64(1),
@@ -147,14 +204,15 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("task_list", func(t *testing.T) {
-		result, err := HandleToolCall(database, "task_list", map[string]interface{}{})
+		result, err := HandleToolCall(sess, "task_list", map[string]interface{}{})
 		if err != nil {
 			t.Fatalf("task_list failed: %v", err)
 		}
-		tasks, ok := result.([]db.Task)
+		page, ok := result.(*db.Page[db.Task])
 		if !ok {
 			t.Fatalf("unexpected result type: %T", result)
 		}
+		tasks := page.Items
 		if len(tasks) == 0 {
 			t.Error("task_list returned no tasks")
 		}
@@ -162,7 +220,7 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("task_update", func(t *testing.T) {
-		result, err := HandleToolCall(database, "task_update", map[string]interface{}{
+		result, err := HandleToolCall(sess, "task_update", map[string]interface{}{
 			"id":     float64(taskID),
 			"status": "in_progress",
 			"title":  "Updated Test Task",
@@ -181,7 +239,7 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("task_delete", func(t *testing.T) {
-		result, err := HandleToolCall(database, "task_delete", map[string]interface{}{
+		result, err := HandleToolCall(sess, "task_delete", map[string]interface{}{
 			"id": float64(taskID),
 		})
 		if err != nil {
@@ -198,7 +256,7 @@ func TestAllTools(t *testing.T) {
 	// METADATA TOOLS (4 tools)
 	// ========================================
 	t.Run("metadata_set", func(t *testing.T) {
-		result, err := HandleToolCall(database, "metadata_set", map[string]interface{}{
+		result, err := HandleToolCall(sess, "metadata_set", map[string]interface{}{
 			"key":   "test_key",
 			"value": "test_value",
 		})
@@ -212,7 +270,7 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("metadata_get", func(t *testing.T) {
-		result, err := HandleToolCall(database, "metadata_get", map[string]interface{}{
+		result, err := HandleToolCall(sess, "metadata_get", map[string]interface{}{
 			"key": "test_key",
 		})
 		if err != nil {
@@ -229,14 +287,15 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("metadata_list", func(t *testing.T) {
-		result, err := HandleToolCall(database, "metadata_list", map[string]interface{}{})
+		result, err := HandleToolCall(sess, "metadata_list", map[string]interface{}{})
 		if err != nil {
 			t.Fatalf("metadata_list failed: %v", err)
 		}
-		metadata, ok := result.([]db.Metadata)
+		page, ok := result.(*db.Page[db.Metadata])
 		if !ok {
 			t.Fatalf("unexpected result type: %T", result)
 		}
+		metadata := page.Items
 		if len(metadata) == 0 {
 			t.Error("metadata_list returned no metadata")
 		}
@@ -244,7 +303,7 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("metadata_delete", func(t *testing.T) {
-		result, err := HandleToolCall(database, "metadata_delete", map[string]interface{}{
+		result, err := HandleToolCall(sess, "metadata_delete", map[string]interface{}{
 			"key": "test_key",
 		})
 		if err != nil {
@@ -261,7 +320,7 @@ func TestAllTools(t *testing.T) {
 	// FILETREE TOOLS (3 tools)
 	// ========================================
 	t.Run("filetree_annotate", func(t *testing.T) {
-		result, err := HandleToolCall(database, "filetree_annotate", map[string]interface{}{
+		result, err := HandleToolCall(sess, "filetree_annotate", map[string]interface{}{
 			"path":   "/src/main.go",
 			"note":   "Main entry point for the application",
 			"is_dir": false,
@@ -276,7 +335,7 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("filetree_get", func(t *testing.T) {
-		result, err := HandleToolCall(database, "filetree_get", map[string]interface{}{
+		result, err := HandleToolCall(sess, "filetree_get", map[string]interface{}{
 			"path": "/src/main.go",
 		})
 		if err != nil {
@@ -293,7 +352,7 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("filetree_delete", func(t *testing.T) {
-		result, err := HandleToolCall(database, "filetree_delete", map[string]interface{}{
+		result, err := HandleToolCall(sess, "filetree_delete", map[string]interface{}{
 			"path": "/src/main.go",
 		})
 		if err != nil {
@@ -310,7 +369,7 @@ func TestAllTools(t *testing.T) {
 	// GUIDELINE TOOLS (6 tools)
 	// ========================================
 	t.Run("guideline_create", func(t *testing.T) {
-		result, err := HandleToolCall(database, "guideline_create", map[string]interface{}{
+		result, err := HandleToolCall(sess, "guideline_create", map[string]interface{}{
 			"category": "coding_style",
 			"title":    "Go Error Handling",
 			"content":  "Always handle errors explicitly. Never ignore returned errors.",
@@ -329,7 +388,7 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("guideline_get", func(t *testing.T) {
-		result, err := HandleToolCall(database, "guideline_get", map[string]interface{}{
+		result, err := HandleToolCall(sess, "guideline_get", map[string]interface{}{
 			"id": float64(guidelineID),
 		})
 		if err != nil {
@@ -346,7 +405,7 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("guideline_update", func(t *testing.T) {
-		result, err := HandleToolCall(database, "guideline_update", map[string]interface{}{
+		result, err := HandleToolCall(sess, "guideline_update", map[string]interface{}{
 			"id":       float64(guidelineID),
 			"content":  "Always handle errors explicitly. Never ignore returned errors. Use errors.Is and errors.As for error checking.",
 			"priority": float64(20),
@@ -365,16 +424,17 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("guideline_list", func(t *testing.T) {
-		result, err := HandleToolCall(database, "guideline_list", map[string]interface{}{
+		result, err := HandleToolCall(sess, "guideline_list", map[string]interface{}{
 			"category": "coding_style",
 		})
 		if err != nil {
 			t.Fatalf("guideline_list failed: %v", err)
 		}
-		guidelines, ok := result.([]db.Guideline)
+		page, ok := result.(*db.Page[db.Guideline])
 		if !ok {
 			t.Fatalf("unexpected result type: %T", result)
 		}
+		guidelines := page.Items
 		if len(guidelines) == 0 {
 			t.Error("guideline_list returned no guidelines")
 		}
@@ -382,16 +442,17 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("guideline_search", func(t *testing.T) {
-		result, err := HandleToolCall(database, "guideline_search", map[string]interface{}{
+		result, err := HandleToolCall(sess, "guideline_search", map[string]interface{}{
 			"query": "error handling",
 		})
 		if err != nil {
 			t.Fatalf("guideline_search failed: %v", err)
 		}
-		guidelines, ok := result.([]db.Guideline)
+		page, ok := result.(*db.Page[db.Guideline])
 		if !ok {
 			t.Fatalf("unexpected result type: %T", result)
 		}
+		guidelines := page.Items
 		if len(guidelines) == 0 {
 			t.Error("guideline_search returned no results")
 		}
@@ -399,7 +460,7 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("guideline_delete", func(t *testing.T) {
-		result, err := HandleToolCall(database, "guideline_delete", map[string]interface{}{
+		result, err := HandleToolCall(sess, "guideline_delete", map[string]interface{}{
 			"id": float64(guidelineID),
 		})
 		if err != nil {
@@ -416,7 +477,7 @@ func TestAllTools(t *testing.T) {
 	// BOOKMARK TOOLS (4 tools)
 	// ========================================
 	t.Run("bookmark_create", func(t *testing.T) {
-		result, err := HandleToolCall(database, "bookmark_create", map[string]interface{}{
+		result, err := HandleToolCall(sess, "bookmark_create", map[string]interface{}{
 			"url":             "https://go.dev/doc/effective_go",
 			"title":           "Effective Go",
 			"excerpt":         "This document gives tips for writing clear, idiomatic Go code.",
@@ -437,17 +498,18 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("bookmark_search", func(t *testing.T) {
-		result, err := HandleToolCall(database, "bookmark_search", map[string]interface{}{
+		result, err := HandleToolCall(sess, "bookmark_search", map[string]interface{}{
 			"query": "Effective Go",
 			"tags":  []interface{}{"go"},
 		})
 		if err != nil {
 			t.Fatalf("bookmark_search failed: %v", err)
 		}
-		bookmarks, ok := result.([]db.Bookmark)
+		page, ok := result.(*db.Page[db.Bookmark])
 		if !ok {
 			t.Fatalf("unexpected result type: %T", result)
 		}
+		bookmarks := page.Items
 		if len(bookmarks) == 0 {
 			t.Error("bookmark_search returned no results")
 		}
@@ -455,14 +517,15 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("bookmark_list", func(t *testing.T) {
-		result, err := HandleToolCall(database, "bookmark_list", map[string]interface{}{})
+		result, err := HandleToolCall(sess, "bookmark_list", map[string]interface{}{})
 		if err != nil {
 			t.Fatalf("bookmark_list failed: %v", err)
 		}
-		bookmarks, ok := result.([]db.Bookmark)
+		page, ok := result.(*db.Page[db.Bookmark])
 		if !ok {
 			t.Fatalf("unexpected result type: %T", result)
 		}
+		bookmarks := page.Items
 		if len(bookmarks) == 0 {
 			t.Error("bookmark_list returned no bookmarks")
 		}
@@ -470,7 +533,7 @@ func TestAllTools(t *testing.T) {
 	})
 
 	t.Run("bookmark_delete", func(t *testing.T) {
-		result, err := HandleToolCall(database, "bookmark_delete", map[string]interface{}{
+		result, err := HandleToolCall(sess, "bookmark_delete", map[string]interface{}{
 			"id": float64(bookmarkID),
 		})
 		if err != nil {
@@ -483,3 +546,1084 @@ func TestAllTools(t *testing.T) {
 		t.Logf("bookmark_delete succeeded for ID: %d", bookmarkID)
 	})
 }
+
+// TestMemorySearchFullText verifies ranked full-text search, query syntax and snippets.
+func TestMemorySearchFullText(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	sess := NewSession(database)
+
+	for _, args := range []map[string]interface{}{
+		{"content": "The renderer batches sprites into a GPU pipeline for 2D quads", "keywords": []interface{}{"rendering"}},
+		{"content": "Sprites are loaded lazily from the asset cache", "keywords": []interface{}{"assets"}},
+		{"content": "Database migrations run inside a transaction"},
+	} {
+		if _, err := HandleToolCall(sess, "memory_store", args); err != nil {
+			t.Fatalf("memory_store failed: %v", err)
+		}
+	}
+
+	search := func(t *testing.T, args map[string]interface{}) []db.Memory {
+		t.Helper()
+		result, err := HandleToolCall(sess, "memory_search", args)
+		if err != nil {
+			t.Fatalf("memory_search failed: %v", err)
+		}
+		page, ok := result.(*db.Page[db.Memory])
+		if !ok {
+			t.Fatalf("unexpected result type: %T", result)
+		}
+		memories := page.Items
+		return memories
+	}
+
+	t.Run("multi-word query matches out of order", func(t *testing.T) {
+		memories := search(t, map[string]interface{}{"query": "quads sprites"})
+		if len(memories) != 1 {
+			t.Fatalf("expected 1 result, got %d", len(memories))
+		}
+		if memories[0].Snippet == "" || memories[0].Score <= 0 {
+			t.Errorf("expected snippet and positive score, got %q / %f", memories[0].Snippet, memories[0].Score)
+		}
+	})
+
+	t.Run("ranked by relevance", func(t *testing.T) {
+		memories := search(t, map[string]interface{}{"query": "sprites OR rendering"})
+		if len(memories) != 2 {
+			t.Fatalf("expected 2 results, got %d", len(memories))
+		}
+		if memories[0].Score < memories[1].Score {
+			t.Errorf("results not ordered by score: %f < %f", memories[0].Score, memories[1].Score)
+		}
+	})
+
+	t.Run("phrase and prefix syntax", func(t *testing.T) {
+		if memories := search(t, map[string]interface{}{"query": `"asset cache"`}); len(memories) != 1 {
+			t.Errorf("phrase query: expected 1 result, got %d", len(memories))
+		}
+		if memories := search(t, map[string]interface{}{"query": "migrat*"}); len(memories) != 1 {
+			t.Errorf("prefix query: expected 1 result, got %d", len(memories))
+		}
+		if memories := search(t, map[string]interface{}{"query": "sprites NOT cache"}); len(memories) != 1 {
+			t.Errorf("NOT query: expected 1 result, got %d", len(memories))
+		}
+	})
+
+	t.Run("plain text with punctuation", func(t *testing.T) {
+		if memories := search(t, map[string]interface{}{"query": "2D-quads, sprites"}); len(memories) != 1 {
+			t.Errorf("expected 1 result, got %d", len(memories))
+		}
+	})
+}
+
+// conceptEmbedder maps words onto a few hand-picked concept axes so tests can
+// check semantic ranking without a real model.
+type conceptEmbedder struct{}
+
+func (conceptEmbedder) Name() string { return "concepts" }
+
+func (conceptEmbedder) Embed(text string) ([]float32, error) {
+	concepts := [][]string{
+		{"render", "sprites", "gpu", "pipeline", "quads", "draw"},
+		{"database", "migrations", "schema", "sqlite"},
+	}
+	v := make([]float32, len(concepts))
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		for i, words := range concepts {
+			for _, w := range words {
+				if word == w {
+					v[i]++
+				}
+			}
+		}
+	}
+	return v, nil
+}
+
+// TestSemanticSearch verifies semantic and hybrid modes across memories,
+// guidelines and bookmarks.
+func TestSemanticSearch(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	sess := NewSession(database)
+
+	calls := []struct {
+		tool string
+		args map[string]interface{}
+	}{
+		{"memory_store", map[string]interface{}{"content": "GPU pipeline for 2D quads"}},
+		{"memory_store", map[string]interface{}{"content": "Schema migrations run on startup"}},
+		{"guideline_create", map[string]interface{}{"category": "architecture", "title": "Batching", "content": "Draw quads in one GPU pipeline pass"}},
+		{"guideline_create", map[string]interface{}{"category": "workflow", "title": "Migrations", "content": "Append a new SQLite migration"}},
+		{"bookmark_create", map[string]interface{}{"url": "https://example.com/gpu", "title": "GPU pipeline reference"}},
+	}
+	for _, c := range calls {
+		if _, err := HandleToolCall(sess, c.tool, c.args); err != nil {
+			t.Fatalf("%s failed: %v", c.tool, err)
+		}
+	}
+	if _, err := database.IndexEmbeddings(100); err != nil {
+		t.Fatalf("IndexEmbeddings failed: %v", err)
+	}
+
+	t.Run("hash embedder matches shared stems", func(t *testing.T) {
+		result, err := HandleToolCall(sess, "memory_search", map[string]interface{}{"query": "migration schemas", "mode": "semantic"})
+		if err != nil {
+			t.Fatalf("memory_search failed: %v", err)
+		}
+		memories := result.(*db.Page[db.Memory]).Items
+		if len(memories) == 0 || !strings.Contains(memories[0].Content, "Schema migrations") {
+			t.Errorf("unexpected results: %+v", memories)
+		}
+	})
+
+	database.SetEmbedder(conceptEmbedder{})
+	if _, err := database.IndexEmbeddings(100); err != nil {
+		t.Fatalf("IndexEmbeddings failed: %v", err)
+	}
+
+	t.Run("memory_search semantic", func(t *testing.T) {
+		result, err := HandleToolCall(sess, "memory_search", map[string]interface{}{"query": "how do we render sprites", "mode": "semantic"})
+		if err != nil {
+			t.Fatalf("memory_search failed: %v", err)
+		}
+		memories := result.(*db.Page[db.Memory]).Items
+		if len(memories) != 1 || memories[0].Content != "GPU pipeline for 2D quads" {
+			t.Errorf("unexpected results: %+v", memories)
+		}
+	})
+
+	t.Run("guideline_search hybrid", func(t *testing.T) {
+		result, err := HandleToolCall(sess, "guideline_search", map[string]interface{}{"query": "render sprites", "mode": "hybrid"})
+		if err != nil {
+			t.Fatalf("guideline_search failed: %v", err)
+		}
+		guidelines := result.(*db.Page[db.Guideline]).Items
+		if len(guidelines) != 1 || guidelines[0].Title != "Batching" || guidelines[0].Score <= 0 {
+			t.Errorf("unexpected results: %+v", guidelines)
+		}
+	})
+
+	t.Run("bookmark_search semantic", func(t *testing.T) {
+		result, err := HandleToolCall(sess, "bookmark_search", map[string]interface{}{"query": "sprites", "mode": "semantic"})
+		if err != nil {
+			t.Fatalf("bookmark_search failed: %v", err)
+		}
+		if bookmarks := result.(*db.Page[db.Bookmark]).Items; len(bookmarks) != 1 {
+			t.Errorf("unexpected results: %+v", bookmarks)
+		}
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		if _, err := HandleToolCall(sess, "memory_search", map[string]interface{}{"query": "x", "mode": "fuzzy"}); err == nil {
+			t.Error("expected error for invalid mode")
+		}
+	})
+}
+
+// TestSessionDefaultProject verifies that each session keeps its own active project.
+func TestSessionDefaultProject(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	alpha, beta := NewSession(database), NewSession(database)
+	for _, slug := range []string{"alpha", "beta"} {
+		if _, err := HandleToolCall(alpha, "project_create", map[string]interface{}{"slug": slug}); err != nil {
+			t.Fatalf("project_create failed: %v", err)
+		}
+	}
+	if _, err := HandleToolCall(alpha, "project_set_default", map[string]interface{}{"slug": "alpha"}); err != nil {
+		t.Fatalf("project_set_default failed: %v", err)
+	}
+	if _, err := HandleToolCall(beta, "project_set_default", map[string]interface{}{"slug": "beta"}); err != nil {
+		t.Fatalf("project_set_default failed: %v", err)
+	}
+
+	result, err := HandleToolCall(alpha, "memory_store", map[string]interface{}{"content": "alpha note"})
+	if err != nil {
+		t.Fatalf("memory_store failed: %v", err)
+	}
+	stored := result.(*db.Memory)
+
+	project, err := database.GetProjectBySlug("alpha")
+	if err != nil {
+		t.Fatalf("GetProjectBySlug failed: %v", err)
+	}
+	if stored.ProjectID != project.ID {
+		t.Errorf("memory stored in project %d, expected alpha (%d)", stored.ProjectID, project.ID)
+	}
+
+	result, err = HandleToolCall(beta, "memory_search", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("memory_search failed: %v", err)
+	}
+	if memories := result.(*db.Page[db.Memory]).Items; len(memories) != 0 {
+		t.Errorf("beta session sees alpha's memories: %+v", memories)
+	}
+
+	if NewSession(database).ProjectID() != db.GlobalProjectID {
+		t.Error("new sessions should default to the global project")
+	}
+}
+
+// TestProjectExportImport verifies that project_export output can be passed
+// back to project_import as a tool argument
+func TestProjectExportImport(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	sess := NewSession(database)
+
+	HandleToolCall(sess, "project_create", map[string]interface{}{"slug": "src"})
+	HandleToolCall(sess, "memory_store", map[string]interface{}{"project": "src", "content": "Exported memory"})
+
+	result, err := HandleToolCall(sess, "project_export", map[string]interface{}{"project": "src"})
+	if err != nil {
+		t.Fatalf("project_export failed: %v", err)
+	}
+	// Tool arguments arrive as decoded JSON
+	raw, _ := json.Marshal(result)
+	var data map[string]interface{}
+	json.Unmarshal(raw, &data)
+
+	result, err = HandleToolCall(sess, "project_import", map[string]interface{}{"data": data, "project": "dst"})
+	if err != nil {
+		t.Fatalf("project_import failed: %v", err)
+	}
+	if res := result.(*db.ImportResult); res.Created["memories"] != 1 {
+		t.Errorf("Expected one imported memory, got %+v", res)
+	}
+
+	if _, err := HandleToolCall(sess, "project_export", map[string]interface{}{"project": "missing"}); err == nil {
+		t.Error("Expected error exporting an unknown project")
+	}
+	if _, err := HandleToolCall(sess, "project_import", map[string]interface{}{"data": data, "strategy": "merge"}); err == nil {
+		t.Error("Expected error for an invalid strategy")
+	}
+	if _, err := HandleToolCall(sess, "project_import", map[string]interface{}{"path": "/etc/passwd"}); err == nil || !strings.Contains(err.Error(), "data is required") {
+		t.Errorf("Expected files not to be read, got %v", err)
+	}
+}
+
+// TestProjectDeleteMovesSessions verifies that sessions working in a deleted
+// or merged project fall back to a project that still exists
+func TestProjectDeleteMovesSessions(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	server := NewServer(database, Config{})
+	sess := NewSession(database)
+	sess.id = "test"
+	server.sessions.add(sess)
+
+	HandleToolCall(sess, "project_create", map[string]interface{}{"slug": "a"})
+	HandleToolCall(sess, "project_create", map[string]interface{}{"slug": "b"})
+	HandleToolCall(sess, "project_set_default", map[string]interface{}{"slug": "a"})
+
+	result, err := HandleToolCall(sess, "project_merge", map[string]interface{}{"source": "a", "target": "b"})
+	if err != nil {
+		t.Fatalf("project_merge failed: %v", err)
+	}
+	target := result.(*db.MergeResult).Target
+	if sess.ProjectID() != target.ID {
+		t.Errorf("Expected session to follow the merge to %d, got %d", target.ID, sess.ProjectID())
+	}
+
+	if _, err := HandleToolCall(sess, "project_delete", map[string]interface{}{"slug": "b"}); err == nil {
+		t.Error("Expected project_delete to require confirm")
+	}
+	if _, err := HandleToolCall(sess, "project_delete", map[string]interface{}{"slug": "b", "confirm": true}); err != nil {
+		t.Fatalf("project_delete failed: %v", err)
+	}
+	if sess.ProjectID() != db.GlobalProjectID {
+		t.Errorf("Expected session back on the global project, got %d", sess.ProjectID())
+	}
+}
+
+// TestUnknownProject verifies that unknown project slugs fail with suggestions
+// unless the server auto-creates projects
+func TestUnknownProject(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	database.CreateProject("mcp-memories", "", "")
+
+	t.Run("strict by default", func(t *testing.T) {
+		sess := NewSession(database)
+		_, err := HandleToolCall(sess, "memory_store", map[string]interface{}{"project": "mcp-memoreis", "content": "Lost write"})
+		var unknown *UnknownProjectError
+		if !errors.As(err, &unknown) {
+			t.Fatalf("Expected UnknownProjectError, got %v", err)
+		}
+		if len(unknown.Suggestions) != 1 || unknown.Suggestions[0] != "mcp-memories" {
+			t.Errorf("Expected suggestion mcp-memories, got %v", unknown.Suggestions)
+		}
+		if !strings.Contains(err.Error(), `did you mean "mcp-memories"?`) {
+			t.Errorf("Unexpected message: %v", err)
+		}
+
+		// Nothing was written anywhere and no project was created
+		memories, _ := database.SearchMemories(nil, "Lost", db.MemoryFilter{Limit: 10})
+		if len(memories) != 0 {
+			t.Errorf("Write landed in another project: %+v", memories)
+		}
+		if _, err := database.GetProjectBySlug("mcp-memoreis"); err == nil {
+			t.Error("Unknown slug created a project")
+		}
+
+		if _, err := HandleToolCall(sess, "project_set_default", map[string]interface{}{"slug": "nope"}); !errors.As(err, &unknown) {
+			t.Errorf("Expected project_set_default to reject unknown slug, got %v", err)
+		}
+		if sess.ProjectID() != db.GlobalProjectID {
+			t.Error("Active project changed after a rejected project_set_default")
+		}
+	})
+
+	t.Run("structured tool error", func(t *testing.T) {
+		server := NewServer(database, Config{})
+		server.logger = log.New(io.Discard, "", 0)
+		resp := server.dispatch(NewSession(database), &Request{JSONRPC: "2.0", ID: float64(1), Method: "tools/call",
+			Params: json.RawMessage(`{"name":"task_list","arguments":{"project":"mcp"}}`)})
+		result := resp.Result.(map[string]interface{})
+		structured, ok := result["structuredContent"].(map[string]interface{})
+		if result["isError"] != true || !ok || structured["error"] != "unknown_project" {
+			t.Fatalf("Expected a structured unknown_project error, got %+v", result)
+		}
+		if suggestions := structured["suggestions"].([]string); len(suggestions) != 1 || suggestions[0] != "mcp-memories" {
+			t.Errorf("Unexpected suggestions: %v", suggestions)
+		}
+	})
+
+	t.Run("auto-create", func(t *testing.T) {
+		server := NewServer(database, Config{AutoCreateProjects: true})
+		sess := server.newSession()
+		if _, err := HandleToolCall(sess, "memory_store", map[string]interface{}{"project": "fresh", "content": "New project"}); err != nil {
+			t.Fatalf("memory_store failed: %v", err)
+		}
+		p, err := database.GetProjectBySlug("fresh")
+		if err != nil {
+			t.Fatalf("Expected project to be created: %v", err)
+		}
+		if memories, _ := database.SearchMemories(&p.ID, "", db.MemoryFilter{Limit: 10}); len(memories) != 1 {
+			t.Errorf("Expected the memory in the new project, got %d", len(memories))
+		}
+	})
+}
+
+func TestProjectInheritance(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	sess := NewSession(database)
+
+	database.CreateGuideline(nil, "git", "Commit messages", "Imperative mood", nil, 5)
+	if _, err := HandleToolCall(sess, "project_create", map[string]interface{}{"slug": "team"}); err != nil {
+		t.Fatalf("project_create failed: %v", err)
+	}
+	result, err := HandleToolCall(sess, "project_create", map[string]interface{}{"slug": "app", "parent": "team"})
+	if err != nil {
+		t.Fatalf("project_create failed: %v", err)
+	}
+	team, _ := database.GetProjectBySlug("team")
+	if app := result.(*db.Project); app.ParentID == nil || *app.ParentID != team.ID {
+		t.Fatalf("Expected app to inherit from team, got %v", app.ParentID)
+	}
+
+	result, _ = HandleToolCall(sess, "guideline_list", map[string]interface{}{"project": "app"})
+	if guidelines := result.(*db.Page[db.Guideline]).Items; len(guidelines) != 1 || !guidelines[0].Inherited {
+		t.Errorf("Expected the global guideline to be inherited, got %+v", guidelines)
+	}
+	result, _ = HandleToolCall(sess, "guideline_list", map[string]interface{}{"project": "app", "include_inherited": false})
+	if guidelines := result.(*db.Page[db.Guideline]).Items; len(guidelines) != 0 {
+		t.Errorf("Expected no guidelines without inheritance, got %+v", guidelines)
+	}
+
+	if _, err := HandleToolCall(sess, "project_update", map[string]interface{}{"slug": "team", "parent": "app"}); err == nil || !strings.Contains(err.Error(), "descendant") {
+		t.Errorf("Expected an error for an inheritance cycle, got %v", err)
+	}
+	if _, err := HandleToolCall(sess, "project_update", map[string]interface{}{"slug": "app", "parent": ""}); err != nil {
+		t.Fatalf("project_update failed: %v", err)
+	}
+	result, _ = HandleToolCall(sess, "guideline_list", map[string]interface{}{"project": "app"})
+	if guidelines := result.(*db.Page[db.Guideline]).Items; len(guidelines) != 0 {
+		t.Errorf("Expected a detached project to inherit nothing, got %+v", guidelines)
+	}
+
+	// The parent is saved with the rest of the project or not at all
+	database.Exec("CREATE TRIGGER reject_renames BEFORE UPDATE OF name ON projects BEGIN SELECT RAISE(ABORT, 'rejected'); END")
+	if _, err := HandleToolCall(sess, "project_update", map[string]interface{}{"slug": "app", "name": "App", "parent": "team"}); err == nil {
+		t.Error("Expected an error when the update is rejected")
+	}
+	if app, _ := database.GetProjectBySlug("app"); app.ParentID != nil {
+		t.Errorf("Expected the parent to be rolled back, got %v", *app.ParentID)
+	}
+	database.Exec("CREATE TRIGGER reject_parents BEFORE UPDATE OF parent_id ON projects BEGIN SELECT RAISE(ABORT, 'rejected'); END")
+	if _, err := HandleToolCall(sess, "project_create", map[string]interface{}{"slug": "web", "parent": "team"}); err == nil {
+		t.Error("Expected an error when the parent is rejected")
+	}
+	if _, err := database.GetProjectBySlug("web"); err == nil {
+		t.Error("Expected no project to be created when its parent is rejected")
+	}
+}
+
+func TestTaskDependencyTools(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	sess := NewSession(database)
+
+	first, _ := database.CreateTask(nil, nil, "First", "", 0)
+	second, _ := database.CreateTask(nil, nil, "Second", "", 0)
+
+	result, err := HandleToolCall(sess, "task_dependency_add", map[string]interface{}{"task_id": float64(second.ID), "depends_on_id": float64(first.ID)})
+	if err != nil {
+		t.Fatalf("task_dependency_add failed: %v", err)
+	}
+	if deps := result.(*db.TaskDependencies); len(deps.BlockedBy) != 1 || deps.BlockedBy[0].ID != first.ID {
+		t.Errorf("Unexpected dependencies: %+v", deps)
+	}
+	if _, err := HandleToolCall(sess, "task_dependency_add", map[string]interface{}{"task_id": float64(first.ID), "depends_on_id": float64(second.ID)}); !errors.Is(err, db.ErrDependencyCycle) {
+		t.Errorf("Expected a cycle error, got %v", err)
+	}
+
+	result, _ = HandleToolCall(sess, "task_list", map[string]interface{}{"ready": true})
+	if tasks := result.(*db.Page[db.Task]).Items; len(tasks) != 1 || tasks[0].ID != first.ID {
+		t.Errorf("Expected only the first task to be ready, got %+v", tasks)
+	}
+
+	result, err = HandleToolCall(sess, "task_update", map[string]interface{}{"id": float64(first.ID), "status": "done"})
+	if err != nil {
+		t.Fatalf("task_update failed: %v", err)
+	}
+	data, _ := json.Marshal(result)
+	var completed struct {
+		ID        int64     `json:"id"`
+		Status    string    `json:"status"`
+		Unblocked []db.Task `json:"unblocked"`
+	}
+	json.Unmarshal(data, &completed)
+	if completed.ID != first.ID || completed.Status != "done" || len(completed.Unblocked) != 1 || completed.Unblocked[0].ID != second.ID {
+		t.Errorf("Expected completion to report the unblocked task, got %s", data)
+	}
+
+	if _, err := HandleToolCall(sess, "task_dependency_remove", map[string]interface{}{"task_id": float64(second.ID), "depends_on_id": float64(first.ID)}); err != nil {
+		t.Fatalf("task_dependency_remove failed: %v", err)
+	}
+	if _, err := HandleToolCall(sess, "task_dependency_remove", map[string]interface{}{"task_id": float64(second.ID), "depends_on_id": float64(first.ID)}); err == nil {
+		t.Error("Expected an error removing a missing dependency")
+	}
+}
+
+func TestTaskTreeTools(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	sess := NewSession(database)
+
+	parent, _ := database.CreateTask(nil, nil, "Parent", "", 0)
+	child, _ := database.CreateTask(nil, &parent.ID, "Child", "", 0)
+	grandchild, _ := database.CreateTask(nil, &child.ID, "Grandchild", "", 0)
+
+	result, err := HandleToolCall(sess, "task_tree", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("task_tree failed: %v", err)
+	}
+	roots := result.([]*db.TaskNode)
+	if len(roots) != 1 || roots[0].Progress.Total != 2 || roots[0].Subtasks[0].Subtasks[0].ID != grandchild.ID {
+		t.Errorf("Unexpected tree: %+v", roots)
+	}
+
+	if _, err := HandleToolCall(sess, "task_move", map[string]interface{}{"id": float64(parent.ID), "parent_id": float64(grandchild.ID)}); !errors.Is(err, db.ErrTaskCycle) {
+		t.Errorf("Expected a cycle error, got %v", err)
+	}
+	result, err = HandleToolCall(sess, "task_move", map[string]interface{}{"id": float64(grandchild.ID), "parent_id": float64(0)})
+	if err != nil || result.(*db.Task).ParentID != nil {
+		t.Errorf("Expected grandchild at the top level, got %+v, %v", result, err)
+	}
+
+	result, err = HandleToolCall(sess, "task_delete", map[string]interface{}{"id": float64(parent.ID)})
+	if err != nil {
+		t.Fatalf("task_delete failed: %v", err)
+	}
+	if n := result.(map[string]interface{})["tasks_deleted"]; n != int64(2) {
+		t.Errorf("Expected parent and child deleted, got %v", n)
+	}
+	if _, err := HandleToolCall(sess, "task_delete", map[string]interface{}{"id": float64(parent.ID)}); err == nil {
+		t.Error("Expected an error deleting a missing task")
+	}
+}
+
+func TestTaskCommentTools(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	sess := NewSession(database)
+
+	task, _ := database.CreateTask(nil, nil, "Upgrade driver", "", 0)
+	if _, err := HandleToolCall(sess, "task_comment_add", map[string]interface{}{"task_id": float64(task.ID), "content": "Started on a branch"}); err != nil {
+		t.Fatalf("task_comment_add failed: %v", err)
+	}
+	if _, err := HandleToolCall(sess, "task_update", map[string]interface{}{
+		"id": float64(task.ID), "status": "blocked", "comment": "Needs the new CGO toolchain", "author": "agent",
+	}); err != nil {
+		t.Fatalf("task_update failed: %v", err)
+	}
+
+	result, err := HandleToolCall(sess, "task_comments_list", map[string]interface{}{"task_id": float64(task.ID)})
+	if err != nil {
+		t.Fatalf("task_comments_list failed: %v", err)
+	}
+	list := result.(taskCommentsResult)
+	comments := list.Items
+	if len(comments) != 2 || comments[1].Content != "Needs the new CGO toolchain" || comments[1].Author != "agent" {
+		t.Errorf("Unexpected comments: %+v", comments)
+	}
+	activity := list.Activity
+	if len(activity) != 1 || activity[0].Field != "status" || activity[0].NewValue != "blocked" {
+		t.Errorf("Unexpected activity: %+v", activity)
+	}
+
+	result, _ = HandleToolCall(sess, "task_comments_list", map[string]interface{}{"task_id": float64(task.ID), "include_activity": false, "limit": float64(1)})
+	list = result.(taskCommentsResult)
+	if list.Activity != nil {
+		t.Error("Expected no activity with include_activity false")
+	}
+	if len(list.Items) != 1 || list.Total != 2 || list.NextCursor == "" {
+		t.Errorf("Expected the first of 2 comments, got %+v", list.Page)
+	}
+	result, _ = HandleToolCall(sess, "task_comments_list", map[string]interface{}{"task_id": float64(task.ID), "cursor": list.NextCursor})
+	if list = result.(taskCommentsResult); len(list.Items) != 1 || list.Items[0].Author != "agent" || list.NextCursor != "" {
+		t.Errorf("Expected the last comment, got %+v", list.Page)
+	}
+	if _, err := HandleToolCall(sess, "task_comments_list", map[string]interface{}{"task_id": float64(999)}); err == nil {
+		t.Error("Expected an error for a missing task")
+	}
+
+	// A comment that cannot be saved leaves the task unchanged
+	database.Exec("CREATE TRIGGER reject_comments BEFORE INSERT ON task_comments BEGIN SELECT RAISE(ABORT, 'rejected'); END")
+	if _, err := HandleToolCall(sess, "task_update", map[string]interface{}{
+		"id": float64(task.ID), "status": "in_progress", "comment": "Unblocked",
+	}); err == nil {
+		t.Error("Expected an error when the comment is rejected")
+	}
+	if got, _ := database.GetTask(task.ID); got.Status != "blocked" {
+		t.Errorf("Expected the status to be rolled back, got %s", got.Status)
+	}
+}
+
+func TestTaskPlanningTools(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	sess := NewSession(database)
+
+	result, err := HandleToolCall(sess, "task_create", map[string]interface{}{
+		"title": "Ship release", "due_at": "2026-05-01", "estimate_minutes": float64(120),
+		"assignee": "agent", "labels": []interface{}{"release"},
+	})
+	if err != nil {
+		t.Fatalf("task_create failed: %v", err)
+	}
+	task := result.(*db.Task)
+	if task.DueAt == nil || task.DueAt.Format("2006-01-02") != "2026-05-01" || task.EstimateMinutes != 120 || task.Assignee != "agent" || len(task.Labels) != 1 {
+		t.Errorf("Unexpected task: %+v", task)
+	}
+	for i := 0; i < 3; i++ {
+		database.CreateTask(nil, nil, fmt.Sprintf("Chore %d", i), "", 0)
+	}
+
+	if _, err := HandleToolCall(sess, "task_create", map[string]interface{}{"title": "Bad", "due_at": "next week"}); err == nil {
+		t.Error("Expected an error for an unparseable due date")
+	}
+
+	result, err = HandleToolCall(sess, "task_update", map[string]interface{}{"id": float64(task.ID), "due_at": "", "labels": []interface{}{"release", "blocked-upstream"}})
+	if err != nil {
+		t.Fatalf("task_update failed: %v", err)
+	}
+	if task := result.(*db.Task); task.DueAt != nil || len(task.Labels) != 2 {
+		t.Errorf("Expected due date cleared and labels replaced, got %+v", task)
+	}
+
+	result, _ = HandleToolCall(sess, "task_list", map[string]interface{}{"labels": []interface{}{"release"}, "assignee": "agent"})
+	if tasks := result.(*db.Page[db.Task]).Items; len(tasks) != 1 || tasks[0].ID != task.ID {
+		t.Errorf("Expected the release task, got %+v", tasks)
+	}
+	result, _ = HandleToolCall(sess, "task_list", map[string]interface{}{"query": "chore", "sort": "title", "limit": float64(2), "offset": float64(1)})
+	if tasks := result.(*db.Page[db.Task]).Items; len(tasks) != 2 || tasks[0].Title != "Chore 1" {
+		t.Errorf("Expected the second page of chores, got %+v", tasks)
+	}
+	if _, err := HandleToolCall(sess, "task_list", map[string]interface{}{"due_before": "soon"}); err == nil {
+		t.Error("Expected an error for an unparseable due_before")
+	}
+}
+
+func TestTaskWorkflowTools(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	server := NewServer(database, Config{})
+	server.logger = log.New(io.Discard, "", 0)
+	sess := server.newSession()
+	var notified []string
+	sess.deliver = func(msg interface{}) {
+		if req, ok := msg.(*Request); ok {
+			notified = append(notified, req.Method)
+		}
+	}
+	server.sessions.add(sess)
+
+	statusEnum := func() []string {
+		resp := server.dispatch(sess, &Request{JSONRPC: "2.0", ID: float64(1), Method: "tools/list"})
+		for _, tool := range resp.Result.(map[string]interface{})["tools"].([]ToolDefinition) {
+			if tool.Name == "task_update" {
+				return tool.InputSchema["properties"].(map[string]interface{})["status"].(map[string]interface{})["enum"].([]string)
+			}
+		}
+		t.Fatal("task_update not listed")
+		return nil
+	}
+	if enum := statusEnum(); len(enum) != 4 || enum[0] != "todo" {
+		t.Errorf("Expected the default statuses, got %v", enum)
+	}
+
+	result, err := HandleToolCall(sess, "task_workflow_set", map[string]interface{}{
+		"statuses":    []interface{}{"backlog", "doing", "shipped"},
+		"transitions": map[string]interface{}{"backlog": []interface{}{"doing"}, "doing": []interface{}{"shipped", "backlog"}},
+		"started":     []interface{}{"doing"},
+		"closed":      []interface{}{"shipped"},
+	})
+	if err != nil {
+		t.Fatalf("task_workflow_set failed: %v", err)
+	}
+	if w := result.(*db.Workflow); w.ProjectID == nil || len(w.Transitions) != 2 {
+		t.Errorf("Unexpected workflow: %+v", w)
+	}
+	if len(notified) != 1 || notified[0] != "notifications/tools/list_changed" {
+		t.Errorf("Expected a tools/list_changed notification, got %v", notified)
+	}
+	if enum := statusEnum(); len(enum) != 3 || enum[0] != "backlog" {
+		t.Errorf("Expected the workflow's statuses in the schema, got %v", enum)
+	}
+
+	task, _ := database.CreateTask(nil, nil, "Ship it", "", 0)
+	if task.Status != "backlog" {
+		t.Errorf("Expected new tasks to start in backlog, got %s", task.Status)
+	}
+	if _, err := HandleToolCall(sess, "task_update", map[string]interface{}{
+		"id": float64(task.ID), "status": "shipped", "assignee": "agent", "labels": []interface{}{"release"},
+	}); !errors.Is(err, db.ErrInvalidTransition) {
+		t.Errorf("Expected an invalid transition error, got %v", err)
+	}
+	if task, _ = database.GetTask(task.ID); task.Assignee != "" || len(task.Labels) != 0 {
+		t.Errorf("Expected a rejected update to change nothing, got %+v", task)
+	}
+
+	result, _ = HandleToolCall(sess, "task_workflow_set", map[string]interface{}{"reset": true})
+	if w := result.(*db.Workflow); w.ProjectID != nil {
+		t.Errorf("Expected the default workflow after reset, got %+v", w)
+	}
+}
+
+// TestMemoryLifetimeTools verifies expiry, pinning and importance through
+// memory_store, memory_update, memory_search and memory_prune
+func TestMemoryLifetimeTools(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	sess := NewSession(database)
+
+	store := func(args map[string]interface{}) *db.Memory {
+		result, err := HandleToolCall(sess, "memory_store", args)
+		if err != nil {
+			t.Fatalf("memory_store failed: %v", err)
+		}
+		return result.(*db.Memory)
+	}
+	store(map[string]interface{}{"content": "Deploys go through CI"})
+	note := store(map[string]interface{}{"content": "Deploy debugging note", "expires_at": "2020-01-01"})
+	core := store(map[string]interface{}{"content": "Deploy architecture", "importance": float64(5), "pinned": true})
+	if !core.Pinned || core.Importance != 5 {
+		t.Errorf("Expected a pinned, important memory, got %+v", core)
+	}
+	if _, err := HandleToolCall(sess, "memory_store", map[string]interface{}{"content": "x", "importance": float64(9)}); err == nil {
+		t.Error("Expected an error for importance out of range")
+	}
+
+	result, _ := HandleToolCall(sess, "memory_search", map[string]interface{}{"query": "deploy"})
+	if memories := result.(*db.Page[db.Memory]).Items; len(memories) != 2 || memories[0].ID != core.ID {
+		t.Errorf("Expected the pinned memory first and the expired one hidden, got %+v", memories)
+	}
+	result, _ = HandleToolCall(sess, "memory_search", map[string]interface{}{"query": "deploy", "include_expired": true})
+	if memories := result.(*db.Page[db.Memory]).Items; len(memories) != 3 {
+		t.Errorf("Expected 3 memories with include_expired, got %d", len(memories))
+	}
+
+	result, err = HandleToolCall(sess, "memory_prune", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("memory_prune failed: %v", err)
+	}
+	if res := result.(map[string]interface{}); res["count"] != 1 {
+		t.Errorf("Expected one memory archived, got %v", res)
+	}
+
+	result, err = HandleToolCall(sess, "memory_update", map[string]interface{}{"id": float64(note.ID), "expires_at": "", "pinned": true})
+	if err != nil {
+		t.Fatalf("memory_update failed: %v", err)
+	}
+	if m := result.(*db.Memory); m.ExpiresAt != nil || m.ArchivedAt != nil || !m.Pinned {
+		t.Errorf("Expected the memory restored and pinned, got %+v", m)
+	}
+}
+
+// TestLinkTools verifies link_create, links_get, link_delete and the
+// include_links option
+func TestLinkTools(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	sess := NewSession(database)
+
+	memory, _ := database.CreateMemory(nil, "Spec lives in the RFC", nil)
+	guideline, _ := database.CreateGuideline(nil, "api", "Version every endpoint", "", nil, 0)
+
+	result, err := HandleToolCall(sess, "link_create", map[string]interface{}{
+		"source_type": "memory", "source_id": float64(memory.ID),
+		"target_type": "guideline", "target_id": float64(guideline.ID),
+	})
+	if err != nil {
+		t.Fatalf("link_create failed: %v", err)
+	}
+	link := result.(*db.Link)
+	if link.Relation != "relates_to" {
+		t.Errorf("Expected the default relation, got %q", link.Relation)
+	}
+	if _, err := HandleToolCall(sess, "link_create", map[string]interface{}{"source_type": "memory", "source_id": float64(memory.ID)}); err == nil {
+		t.Error("Expected an error without a target")
+	}
+
+	result, err = HandleToolCall(sess, "links_get", map[string]interface{}{"type": "guideline", "id": float64(guideline.ID)})
+	if err != nil {
+		t.Fatalf("links_get failed: %v", err)
+	}
+	if links := result.(*db.Page[db.LinkedEntity]).Items; len(links) != 1 || links[0].Direction != "incoming" || links[0].Title != "Spec lives in the RFC" {
+		t.Errorf("Unexpected links: %+v", links)
+	}
+	if _, err := HandleToolCall(sess, "links_get", map[string]interface{}{"type": "task", "id": float64(42)}); err == nil {
+		t.Error("Expected an error for a missing entity")
+	}
+
+	result, _ = HandleToolCall(sess, "guideline_get", map[string]interface{}{"id": float64(guideline.ID), "include_links": true})
+	if g := result.(*db.Guideline); len(g.Links) != 1 || g.Links[0].ID != memory.ID {
+		t.Errorf("Expected guideline_get to include the link, got %+v", g.Links)
+	}
+	result, _ = HandleToolCall(sess, "memory_search", map[string]interface{}{"include_links": true})
+	if memories := result.(*db.Page[db.Memory]).Items; len(memories) != 1 || len(memories[0].Links) != 1 {
+		t.Errorf("Expected memory_search to include the link, got %+v", memories)
+	}
+	result, _ = HandleToolCall(sess, "memory_search", map[string]interface{}{})
+	if memories := result.(*db.Page[db.Memory]).Items; len(memories[0].Links) != 0 {
+		t.Errorf("Expected no links without include_links, got %+v", memories[0].Links)
+	}
+
+	if _, err := HandleToolCall(sess, "link_delete", map[string]interface{}{"id": float64(link.ID)}); err != nil {
+		t.Fatalf("link_delete failed: %v", err)
+	}
+	if _, err := HandleToolCall(sess, "link_delete", map[string]interface{}{"id": float64(link.ID)}); err == nil {
+		t.Error("Expected an error deleting a missing link")
+	}
+}
+
+// TestMemoryDedupeTools verifies the dedupe option of memory_store and
+// memory_find_duplicates
+func TestMemoryDedupeTools(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	sess := NewSession(database)
+
+	content := "Run migrations before starting the server"
+	result, err := HandleToolCall(sess, "memory_store", map[string]interface{}{"content": content})
+	if err != nil {
+		t.Fatalf("memory_store failed: %v", err)
+	}
+	original := result.(*db.Memory)
+
+	result, err = HandleToolCall(sess, "memory_store", map[string]interface{}{"content": content + ".", "keywords": []interface{}{"ops"}, "dedupe": "merge"})
+	if err != nil {
+		t.Fatalf("memory_store failed: %v", err)
+	}
+	if dup, ok := result.(*db.DuplicateMemory); !ok || dup.ID != original.ID || dup.Dedupe != db.DedupeMerge || len(dup.Keywords) != 1 {
+		t.Errorf("Expected the original with merged keywords, got %#v", result)
+	}
+	if _, err := HandleToolCall(sess, "memory_store", map[string]interface{}{"content": content, "dedupe": "ignore"}); err == nil {
+		t.Error("Expected an error for an invalid dedupe mode")
+	}
+
+	result, _ = HandleToolCall(sess, "memory_store", map[string]interface{}{"content": content, "dedupe": "force"})
+	if _, ok := result.(*db.Memory); !ok {
+		t.Errorf("Expected force to store a new memory, got %#v", result)
+	}
+	result, err = HandleToolCall(sess, "memory_find_duplicates", map[string]interface{}{"threshold": 0.9})
+	if err != nil {
+		t.Fatalf("memory_find_duplicates failed: %v", err)
+	}
+	if clusters := result.(*db.Page[db.MemoryCluster]).Items; len(clusters) != 1 || len(clusters[0].Memories) != 2 {
+		t.Errorf("Expected one cluster of two memories, got %+v", clusters)
+	}
+	if _, err := HandleToolCall(sess, "memory_find_duplicates", map[string]interface{}{"threshold": 1.5}); err == nil {
+		t.Error("Expected an error for a threshold above 1")
+	}
+}
+
+func TestTagTools(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	sess := NewSession(database)
+
+	database.CreateMemory(nil, "Use pgx for Postgres", []string{"Postgres", "go"})
+	database.CreateMemory(nil, "Use sqlc for queries", []string{"go"})
+	database.CreateGuideline(nil, "db", "Name migrations by date", "", []string{"postgres"}, 0)
+
+	result, err := HandleToolCall(sess, "memory_search", map[string]interface{}{
+		"keywords": []interface{}{"go"}, "exclude_keywords": []interface{}{"POSTGRES"},
+	})
+	if err != nil {
+		t.Fatalf("memory_search failed: %v", err)
+	}
+	if memories := result.(*db.Page[db.Memory]).Items; len(memories) != 1 || memories[0].Content != "Use sqlc for queries" {
+		t.Errorf("Expected only the memory without postgres, got %+v", memories)
+	}
+
+	result, err = HandleToolCall(sess, "guideline_search", map[string]interface{}{"any_tags": []interface{}{"postgres", "mysql"}})
+	if err != nil {
+		t.Fatalf("guideline_search failed: %v", err)
+	}
+	if guidelines := result.(*db.Page[db.Guideline]).Items; len(guidelines) != 1 {
+		t.Errorf("Expected a guideline found by tag alone, got %+v", guidelines)
+	}
+	if _, err := HandleToolCall(sess, "guideline_search", map[string]interface{}{}); err == nil {
+		t.Error("Expected an error without a query or tags")
+	}
+
+	if _, err := HandleToolCall(sess, "tag_rename", map[string]interface{}{"from": "go", "to": "postgres"}); err == nil {
+		t.Error("Expected renaming onto an existing tag to fail")
+	}
+	if _, err := HandleToolCall(sess, "tag_merge", map[string]interface{}{"sources": []interface{}{"postgres"}, "into": "sql"}); err != nil {
+		t.Fatalf("tag_merge failed: %v", err)
+	}
+	if _, err := HandleToolCall(sess, "tag_rename", map[string]interface{}{"from": "go", "to": "golang"}); err != nil {
+		t.Fatalf("tag_rename failed: %v", err)
+	}
+
+	result, err = HandleToolCall(sess, "tag_list", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("tag_list failed: %v", err)
+	}
+	tags := result.(*db.Page[db.Tag]).Items
+	if len(tags) != 2 || tags[0].Name != "golang" || tags[0].Count != 2 || tags[1].Name != "sql" || tags[1].Guidelines != 1 {
+		t.Errorf("Unexpected tags: %+v", tags)
+	}
+}
+
+func TestPaginationTools(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	sess := NewSession(database)
+
+	for i := 0; i < 5; i++ {
+		database.CreateBookmark(nil, fmt.Sprintf("https://example.com/%d", i), fmt.Sprintf("Doc %d", i), "", "", "", "", nil)
+	}
+
+	var seen []int64
+	args := map[string]interface{}{"limit": float64(2)}
+	for pages := 0; ; pages++ {
+		result, err := HandleToolCall(sess, "bookmark_list", args)
+		if err != nil {
+			t.Fatalf("bookmark_list failed: %v", err)
+		}
+		page := result.(*db.Page[db.Bookmark])
+		if page.Total != 5 || len(page.Items) > 2 {
+			t.Fatalf("Unexpected page: %+v", page)
+		}
+		for _, b := range page.Items {
+			seen = append(seen, b.ID)
+		}
+		if page.NextCursor == "" {
+			if pages != 2 {
+				t.Errorf("Expected 3 pages, got %d", pages+1)
+			}
+			break
+		}
+		args["cursor"] = page.NextCursor
+	}
+	if len(seen) != 5 {
+		t.Errorf("Expected every bookmark once, got %v", seen)
+	}
+
+	if _, err := HandleToolCall(sess, "guideline_list", map[string]interface{}{"cursor": "bogus"}); err == nil {
+		t.Error("Expected an error for an invalid cursor")
+	}
+
+	result, err := HandleToolCall(sess, "search_all", map[string]interface{}{"query": "doc", "limit": float64(3)})
+	if err != nil {
+		t.Fatalf("search_all failed: %v", err)
+	}
+	first := result.(*db.SearchAllResult)
+	result, _ = HandleToolCall(sess, "search_all", map[string]interface{}{"query": "doc", "cursor": first.NextCursor})
+	if rest := result.(*db.SearchAllResult); first.Total != 5 || len(rest.Results) != 2 || rest.NextCursor != "" {
+		t.Errorf("Expected the cursor to continue after 3 results, got %+v then %+v", first, rest)
+	}
+}
+
+func TestOutputShaping(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	server := NewServer(database, Config{})
+	server.logger = log.New(io.Discard, "", 0)
+	sess := server.newSession()
+	body := strings.Repeat("Wrap every error with the operation that failed. ", 40)
+	for _, title := range []string{"Errors", "Logging"} {
+		if _, err := HandleToolCall(sess, "guideline_create", map[string]interface{}{"category": "style", "title": title, "content": body}); err != nil {
+			t.Fatalf("guideline_create failed: %v", err)
+		}
+	}
+
+	call := func(args string) []string {
+		t.Helper()
+		resp := server.dispatch(sess, &Request{JSONRPC: "2.0", ID: float64(1), Method: "tools/call",
+			Params: json.RawMessage(`{"name":"guideline_list","arguments":` + args + `}`)})
+		if resp.Error != nil {
+			t.Fatalf("tools/call failed: %+v", resp.Error)
+		}
+		result := resp.Result.(map[string]interface{})
+		if result["isError"] != false {
+			t.Fatalf("Tool error: %+v", result)
+		}
+		var texts []string
+		for _, c := range result["content"].([]map[string]interface{}) {
+			texts = append(texts, c["text"].(string))
+		}
+		return texts
+	}
+
+	t.Run("default is unchanged", func(t *testing.T) {
+		result, _ := HandleToolCall(sess, "guideline_list", map[string]interface{}{})
+		want, _ := json.Marshal(result)
+		if texts := call(`{}`); len(texts) != 1 || texts[0] != string(want) {
+			t.Errorf("Expected the plain JSON result, got %v", texts)
+		}
+	})
+
+	t.Run("fields", func(t *testing.T) {
+		texts := call(`{"fields":["title"]}`)
+		var page struct {
+			Items []map[string]interface{} `json:"items"`
+			Total int                      `json:"total"`
+		}
+		json.Unmarshal([]byte(texts[0]), &page)
+		if page.Total != 2 || len(page.Items) != 2 || len(page.Items[0]) != 2 || page.Items[0]["title"] != "Errors" || page.Items[0]["id"] == nil {
+			t.Errorf("Expected only id and title per item, got %s", texts[0])
+		}
+	})
+
+	t.Run("compact", func(t *testing.T) {
+		text := call(`{"format":"compact"}`)[0]
+		if strings.Contains(text, "created_at") || strings.Contains(text, "project_id") || !strings.Contains(text, `"content"`) {
+			t.Errorf("Expected timestamps and project_id dropped, got %s", text)
+		}
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		text := call(`{"format":"markdown","fields":["title","category"]}`)[0]
+		if !strings.HasPrefix(text, "**total**: 2\n\n- **Errors** (id ") || !strings.Contains(text, "  - **category**: style") {
+			t.Errorf("Unexpected markdown:\n%s", text)
+		}
+	})
+
+	t.Run("budget", func(t *testing.T) {
+		texts := call(`{"max_tokens":250}`)
+		if len(texts) != 2 || len([]rune(texts[0])) > 1000 {
+			t.Fatalf("Expected a result within 1000 characters and a note, got %d characters and %v", len([]rune(texts[0])), texts[1:])
+		}
+		var page db.Page[map[string]interface{}]
+		if err := json.Unmarshal([]byte(texts[0]), &page); err != nil || len(page.Items) != 2 {
+			t.Fatalf("Expected both guidelines as valid JSON, got %v: %s", err, texts[0])
+		}
+		if content := page.Items[0]["content"].(string); !strings.HasSuffix(content, "…") {
+			t.Errorf("Expected the content cut with an ellipsis, got %q", content)
+		}
+		if !strings.Contains(texts[1], "use guideline_get for full text") {
+			t.Errorf("Expected a guideline_get hint, got %q", texts[1])
+		}
+
+		texts = call(`{"max_chars":400}`)
+		if len(texts) != 2 || len([]rune(texts[0])) > 400 || !strings.Contains(texts[1], "1 of 2 results shown") {
+			t.Fatalf("Expected results dropped to fit, got %v", texts)
+		}
+		var first db.Page[map[string]interface{}]
+		json.Unmarshal([]byte(texts[0]), &first)
+		if first.NextCursor == "" {
+			t.Fatalf("Expected a cursor to the dropped result, got %s", texts[0])
+		}
+		var rest db.Page[map[string]interface{}]
+		json.Unmarshal([]byte(call(`{"max_chars":400,"cursor":"` + first.NextCursor + `"}`)[0]), &rest)
+		if len(rest.Items) != 1 || rest.Items[0]["id"] == first.Items[0]["id"] || rest.NextCursor != "" {
+			t.Errorf("Expected the cursor to continue with the dropped result, got %+v", rest)
+		}
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		resp := server.dispatch(sess, &Request{JSONRPC: "2.0", ID: float64(1), Method: "tools/call",
+			Params: json.RawMessage(`{"name":"guideline_create","arguments":{"category":"style","title":"Lost","content":"x","format":"yaml"}}`)})
+		if resp.Result.(map[string]interface{})["isError"] != true {
+			t.Errorf("Expected an invalid format to fail, got %+v", resp.Result)
+		}
+		if guidelines, _ := database.ListGuidelines(nil, nil); len(guidelines) != 2 {
+			t.Errorf("Expected the tool not to run, got %d guidelines", len(guidelines))
+		}
+	})
+}
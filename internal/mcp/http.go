@@ -0,0 +1,309 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Header carrying the session ID in the Streamable HTTP transport
+const sessionHeader = "Mcp-Session-Id"
+
+// DefaultSessionIdleTimeout is how long an HTTP session may go without a
+// request or an open stream before the server ends it. Clients that crash or
+// disconnect never send the DELETE that would end it otherwise.
+const DefaultSessionIdleTimeout = 30 * time.Minute
+
+// httpStream is the server-to-client channel of an HTTP session, drained by
+// the client's GET request
+type httpStream struct {
+	outbound chan []byte
+	closed   chan struct{}
+}
+
+// RunHTTP serves clients over the MCP Streamable HTTP transport at addr/mcp
+func (s *Server) RunHTTP(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", s.HTTPHandler())
+	s.logger.Printf("Serving Streamable HTTP on %s/mcp", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// HTTPHandler returns the handler for the Streamable HTTP transport. Clients
+// POST JSON-RPC messages and receive responses as JSON or as an SSE stream,
+// GET opens a stream for server-initiated messages, and DELETE ends a session.
+func (s *Server) HTTPHandler() http.Handler {
+	s.expiry.Do(func() { go s.expireSessions() })
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowedOrigin(r) {
+			http.Error(w, "Forbidden origin", http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			s.handleHTTPPost(w, r)
+		case http.MethodGet:
+			s.handleHTTPGet(w, r)
+		case http.MethodDelete:
+			s.handleHTTPDelete(w, r)
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (s *Server) handleHTTPPost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageBytes))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, newError(nil, ParseError, "Parse error", err.Error()))
+		return
+	}
+
+	reqs, batch, err := parseMessages(body)
+	if err != nil {
+		s.logger.Printf("Parse error: %v", err)
+		writeJSON(w, http.StatusBadRequest, newError(nil, ParseError, "Parse error", err.Error()))
+		return
+	}
+
+	var sess *Session
+	if containsMethod(reqs, "initialize") {
+		if len(reqs) > 1 {
+			writeJSON(w, http.StatusBadRequest, newError(nil, InvalidRequest, "Invalid request", "initialize must not be batched"))
+			return
+		}
+		sess = s.newHTTPSession()
+		w.Header().Set(sessionHeader, sess.id)
+	} else {
+		id := r.Header.Get(sessionHeader)
+		if id == "" {
+			http.Error(w, "Missing "+sessionHeader+" header", http.StatusBadRequest)
+			return
+		}
+		if sess = s.sessions.get(id); sess == nil {
+			http.Error(w, "Unknown session", http.StatusNotFound)
+			return
+		}
+		sess.touch()
+	}
+
+	// Notifications and client responses are accepted without a body
+	if !containsRequest(reqs) {
+		for i := range reqs {
+			s.dispatch(sess, &reqs[i])
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if acceptsEventStream(r) {
+		flusher, ok := w.(http.Flusher)
+		if ok {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.WriteHeader(http.StatusOK)
+			for i := range reqs {
+				if resp := s.dispatch(sess, &reqs[i]); resp != nil {
+					writeEvent(w, resp)
+					flusher.Flush()
+				}
+			}
+			return
+		}
+	}
+
+	var responses []*Response
+	for i := range reqs {
+		if resp := s.dispatch(sess, &reqs[i]); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if batch {
+		writeJSON(w, http.StatusOK, responses)
+		return
+	}
+	writeJSON(w, http.StatusOK, responses[0])
+}
+
+// handleHTTPGet streams server-initiated messages for a session as SSE
+func (s *Server) handleHTTPGet(w http.ResponseWriter, r *http.Request) {
+	if !acceptsEventStream(r) {
+		http.Error(w, "Accept must include text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	sess := s.sessions.get(r.Header.Get(sessionHeader))
+	if sess == nil || sess.stream == nil {
+		http.Error(w, "Unknown session", http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sess.streamOpened()
+	defer sess.streamClosed()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case data := <-sess.stream.outbound:
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-sess.stream.closed:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleHTTPDelete ends a session at the client's request
+func (s *Server) handleHTTPDelete(w http.ResponseWriter, r *http.Request) {
+	sess := s.sessions.remove(r.Header.Get(sessionHeader))
+	if sess == nil {
+		http.Error(w, "Unknown session", http.StatusNotFound)
+		return
+	}
+	close(sess.stream.closed)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// expireSessions ends idle HTTP sessions for the life of the process
+func (s *Server) expireSessions() {
+	timeout := s.cfg.SessionIdleTimeout
+	if timeout <= 0 {
+		timeout = DefaultSessionIdleTimeout
+	}
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.endIdleSessions(now.Add(-timeout))
+	}
+}
+
+// endIdleSessions ends the HTTP sessions idle since t, as a DELETE would,
+// closing any stream the client left behind
+func (s *Server) endIdleSessions(t time.Time) {
+	for _, sess := range s.sessions.removeIdle(t) {
+		close(sess.stream.closed)
+		s.logger.Printf("Ended idle session %s", sess.id)
+	}
+}
+
+func (s *Server) newHTTPSession() *Session {
+	sess := s.newSession()
+	sess.id = newSessionID()
+	sess.lastActive = time.Now()
+	sess.stream = &httpStream{
+		outbound: make(chan []byte, 64),
+		closed:   make(chan struct{}),
+	}
+	sess.deliver = func(msg interface{}) {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			s.logger.Printf("Error marshaling message: %v", err)
+			return
+		}
+		select {
+		case sess.stream.outbound <- data:
+		default:
+			s.logger.Printf("Dropping message for session %s: stream full or not open", sess.id)
+		}
+	}
+	s.sessions.add(sess)
+	return sess
+}
+
+// parseMessages decodes a single JSON-RPC message or a batch
+func parseMessages(body []byte) ([]Request, bool, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var reqs []Request
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			return nil, true, err
+		}
+		if len(reqs) == 0 {
+			return nil, true, fmt.Errorf("empty batch")
+		}
+		return reqs, true, nil
+	}
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, false, err
+	}
+	return []Request{req}, false, nil
+}
+
+func containsMethod(reqs []Request, method string) bool {
+	for _, req := range reqs {
+		if req.Method == method {
+			return true
+		}
+	}
+	return false
+}
+
+// containsRequest reports whether any message expects a response
+func containsRequest(reqs []Request) bool {
+	for i := range reqs {
+		if reqs[i].Method != "" && !isNotification(&reqs[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// allowedOrigin rejects browser requests from non-local origins to guard
+// against DNS rebinding. Requests without an Origin header are not from a
+// browser and are allowed.
+func allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeEvent(w io.Writer, v interface{}) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+}
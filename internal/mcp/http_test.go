@@ -0,0 +1,191 @@
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rocket/mcp-memories/internal/db"
+)
+
+func newTestHTTPServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	server := NewServer(database, Config{})
+	server.logger = log.New(io.Discard, "", 0)
+	ts := httptest.NewServer(server.HTTPHandler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func postMCP(t *testing.T, url, sessionID, accept, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("building request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+	if sessionID != "" {
+		req.Header.Set(sessionHeader, sessionID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// TestHTTPTransport exercises sessions, JSON and SSE responses over Streamable HTTP
+func TestHTTPTransport(t *testing.T) {
+	ts := newTestHTTPServer(t)
+
+	resp := postMCP(t, ts.URL, "", "application/json, text/event-stream",
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`)
+	sessionID := resp.Header.Get(sessionHeader)
+	if sessionID == "" {
+		t.Fatal("initialize did not return a session ID")
+	}
+
+	t.Run("initialize streams its response", func(t *testing.T) {
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("unexpected content type: %s", ct)
+		}
+		scanner := bufio.NewScanner(resp.Body)
+		var data string
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+				data = strings.TrimPrefix(line, "data: ")
+				break
+			}
+		}
+		var msg Response
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatalf("decoding event: %v", err)
+		}
+		result := msg.Result.(map[string]interface{})
+		if result["protocolVersion"] != "2025-03-26" {
+			t.Errorf("protocol version not negotiated: %v", result["protocolVersion"])
+		}
+	})
+
+	t.Run("notification is accepted", func(t *testing.T) {
+		resp := postMCP(t, ts.URL, sessionID, "application/json", `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+		if resp.StatusCode != http.StatusAccepted {
+			t.Errorf("expected 202, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("tools/call over JSON", func(t *testing.T) {
+		resp := postMCP(t, ts.URL, sessionID, "application/json",
+			`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"memory_store","arguments":{"content":"stored over http"}}}`)
+		var msg Response
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		if msg.Error != nil || msg.Result.(map[string]interface{})["isError"] != false {
+			t.Errorf("tool call failed: %+v", msg)
+		}
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		resp := postMCP(t, ts.URL, sessionID, "application/json",
+			`[{"jsonrpc":"2.0","id":3,"method":"ping"},{"jsonrpc":"2.0","id":4,"method":"tools/list"}]`)
+		var msgs []Response
+		if err := json.NewDecoder(resp.Body).Decode(&msgs); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		if len(msgs) != 2 {
+			t.Errorf("expected 2 responses, got %d", len(msgs))
+		}
+	})
+
+	t.Run("missing and unknown sessions", func(t *testing.T) {
+		body := `{"jsonrpc":"2.0","id":5,"method":"tools/list"}`
+		if resp := postMCP(t, ts.URL, "", "application/json", body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("missing session: expected 400, got %d", resp.StatusCode)
+		}
+		if resp := postMCP(t, ts.URL, "nope", "application/json", body); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("unknown session: expected 404, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("foreign origin is rejected", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(`{}`))
+		req.Header.Set("Origin", "https://evil.example")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("expected 403, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("delete ends the session", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL, nil)
+		req.Header.Set(sessionHeader, sessionID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("DELETE failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("expected 204, got %d", resp.StatusCode)
+		}
+		if resp := postMCP(t, ts.URL, sessionID, "application/json", `{"jsonrpc":"2.0","id":6,"method":"ping"}`); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected 404 after delete, got %d", resp.StatusCode)
+		}
+	})
+}
+
+// TestHTTPSessionExpiry verifies that idle HTTP sessions are ended and their
+// streams closed, while a session with an open stream is kept
+func TestHTTPSessionExpiry(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	server := NewServer(database, Config{})
+	server.logger = log.New(io.Discard, "", 0)
+
+	idle, streaming := server.newHTTPSession(), server.newHTTPSession()
+	streaming.streamOpened()
+	server.endIdleSessions(time.Now().Add(-time.Minute))
+	if server.sessions.get(idle.id) == nil {
+		t.Fatal("Expected a recently active session to be kept")
+	}
+
+	server.endIdleSessions(time.Now().Add(time.Minute))
+	if server.sessions.get(idle.id) != nil {
+		t.Error("Expected the idle session to be ended")
+	}
+	select {
+	case <-idle.stream.closed:
+	default:
+		t.Error("Expected the idle session's stream to be closed")
+	}
+	if server.sessions.get(streaming.id) == nil {
+		t.Error("Expected a session with an open stream to be kept")
+	}
+
+	streaming.streamClosed()
+	server.endIdleSessions(time.Now().Add(time.Minute))
+	if server.sessions.get(streaming.id) != nil {
+		t.Error("Expected the session to be ended once its stream closed and it went idle")
+	}
+}
@@ -0,0 +1,325 @@
+package mcp
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rocket/mcp-memories/internal/db"
+)
+
+// Default size budgets for prompts
+const (
+	defaultPromptItems    = 10
+	defaultPromptMaxChars = 8000
+)
+
+// GetPromptDefinitions returns the prompts the server offers
+func GetPromptDefinitions() []map[string]interface{} {
+	projectArg := map[string]interface{}{
+		"name":        "project",
+		"description": "Project slug (defaults to the session's active project)",
+		"required":    false,
+	}
+	maxCharsArg := map[string]interface{}{
+		"name":        "max_chars",
+		"description": fmt.Sprintf("Maximum length of the prompt text (default %d)", defaultPromptMaxChars),
+		"required":    false,
+	}
+
+	return []map[string]interface{}{
+		{
+			"name":        "session_start",
+			"title":       "Start a session",
+			"description": "Load a project's top guidelines, in-progress tasks, recent memories and metadata",
+			"arguments": []map[string]interface{}{
+				projectArg,
+				{"name": "max_guidelines", "description": fmt.Sprintf("Number of guidelines, highest priority first (default %d)", defaultPromptItems), "required": false},
+				{"name": "max_tasks", "description": fmt.Sprintf("Number of in-progress tasks (default %d)", defaultPromptItems), "required": false},
+				{"name": "max_memories", "description": fmt.Sprintf("Number of memories, pinned and most important first, then most recently updated (default %d)", defaultPromptItems), "required": false},
+				maxCharsArg,
+			},
+		},
+		{
+			"name":        "handoff",
+			"title":       "Hand off",
+			"description": "Summarize what changed in a project since a given time",
+			"arguments": []map[string]interface{}{
+				projectArg,
+				{"name": "since", "description": "RFC 3339 timestamp, date (2006-01-02), or age such as 8h or 2d", "required": true},
+				{"name": "max_items", "description": fmt.Sprintf("Number of items per section (default %d)", defaultPromptItems), "required": false},
+				maxCharsArg,
+			},
+		},
+	}
+}
+
+func (s *Server) handlePromptsList(req *Request) *Response {
+	return newResult(req.ID, map[string]interface{}{
+		"prompts": GetPromptDefinitions(),
+	})
+}
+
+func (s *Server) handlePromptsGet(sess *Session, req *Request) *Response {
+	var params struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return newError(req.ID, InvalidParams, "Invalid params", err.Error())
+	}
+
+	var description, text string
+	var err error
+	switch params.Name {
+	case "session_start":
+		description = "Project context for a new session"
+		text, err = s.sessionStartPrompt(sess, params.Arguments)
+	case "handoff":
+		description = "Changes since the last session"
+		text, err = s.handoffPrompt(sess, params.Arguments)
+	default:
+		return newError(req.ID, InvalidParams, "Unknown prompt", params.Name)
+	}
+	if err != nil {
+		return newError(req.ID, InvalidParams, "Invalid params", err.Error())
+	}
+
+	return newResult(req.ID, map[string]interface{}{
+		"description": description,
+		"messages": []map[string]interface{}{
+			{
+				"role":    "user",
+				"content": map[string]interface{}{"type": "text", "text": text},
+			},
+		},
+	})
+}
+
+// sessionStartPrompt replaces the README's "At Session Start" checklist with
+// a single message
+func (s *Server) sessionStartPrompt(sess *Session, args map[string]string) (string, error) {
+	project, err := s.promptProject(sess, args)
+	if err != nil {
+		return "", err
+	}
+	maxGuidelines, err := promptInt(args, "max_guidelines", defaultPromptItems)
+	if err != nil {
+		return "", err
+	}
+	maxTasks, err := promptInt(args, "max_tasks", defaultPromptItems)
+	if err != nil {
+		return "", err
+	}
+	maxMemories, err := promptInt(args, "max_memories", defaultPromptItems)
+	if err != nil {
+		return "", err
+	}
+	if maxMemories < 1 {
+		// SearchMemories reads a zero limit as no limit
+		return "", fmt.Errorf("max_memories must be at least 1")
+	}
+	maxChars, err := promptInt(args, "max_chars", defaultPromptMaxChars)
+	if err != nil {
+		return "", err
+	}
+
+	guidelines, err := s.db.ListGuidelinesInherited(&project.ID, nil)
+	if err != nil {
+		return "", err
+	}
+	workflow, err := s.db.GetWorkflow(&project.ID)
+	if err != nil {
+		return "", err
+	}
+	var tasks []db.Task
+	if len(workflow.Started) > 0 {
+		if tasks, err = s.db.ListTasks(&project.ID, db.TaskFilter{Statuses: workflow.Started}); err != nil {
+			return "", err
+		}
+	}
+	memories, err := s.db.SearchMemories(&project.ID, "", db.MemoryFilter{Limit: maxMemories})
+	if err != nil {
+		return "", err
+	}
+	metadata, err := s.db.ListMetadataInherited(&project.ID)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Context for project %q from mcp-memories. Follow these guidelines and continue the in-progress tasks; store new decisions with memory_store.\n", project.Slug)
+
+	b.WriteString("\n## Guidelines\n")
+	if len(guidelines) == 0 {
+		b.WriteString("\nNone recorded.\n")
+	}
+	for i, g := range guidelines {
+		if i == maxGuidelines {
+			fmt.Fprintf(&b, "\n(%d more; use guideline_list)\n", len(guidelines)-i)
+			break
+		}
+		fmt.Fprintf(&b, "\n### %s (%s, priority %d)\n\n%s\n", g.Title, g.Category, g.Priority, g.Content)
+	}
+
+	b.WriteString("\n## In-progress tasks\n\n")
+	if len(tasks) == 0 {
+		b.WriteString("None.\n")
+	}
+	for i, t := range tasks {
+		if i == maxTasks {
+			fmt.Fprintf(&b, "(%d more; use task_list)\n", len(tasks)-i)
+			break
+		}
+		writeTaskLine(&b, &t)
+	}
+
+	b.WriteString("\n## Recent memories\n\n")
+	if len(memories) == 0 {
+		b.WriteString("None.\n")
+	}
+	for _, m := range memories {
+		writeMemoryLine(&b, &m)
+	}
+
+	if len(metadata) > 0 {
+		b.WriteString("\n## Metadata\n\n")
+		for _, m := range metadata {
+			fmt.Fprintf(&b, "- %s: %s\n", m.Key, m.Value)
+		}
+	}
+
+	return truncatePrompt(b.String(), maxChars), nil
+}
+
+// handoffPrompt summarizes a project's changes since a point in time
+func (s *Server) handoffPrompt(sess *Session, args map[string]string) (string, error) {
+	project, err := s.promptProject(sess, args)
+	if err != nil {
+		return "", err
+	}
+	if args["since"] == "" {
+		return "", fmt.Errorf("since is required")
+	}
+	since, err := parseSince(args["since"], time.Now())
+	if err != nil {
+		return "", err
+	}
+	maxItems, err := promptInt(args, "max_items", defaultPromptItems)
+	if err != nil {
+		return "", err
+	}
+	maxChars, err := promptInt(args, "max_chars", defaultPromptMaxChars)
+	if err != nil {
+		return "", err
+	}
+
+	activity, err := s.db.ActivitySince(&project.ID, since, maxItems)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Changes to project %q since %s (UTC). Review them before continuing the work.\n", project.Slug, since.UTC().Format("2006-01-02 15:04"))
+
+	if len(activity.Tasks) > 0 {
+		b.WriteString("\n## Tasks\n\n")
+		for _, t := range activity.Tasks {
+			writeTaskLine(&b, &t)
+		}
+	}
+	if len(activity.Memories) > 0 {
+		b.WriteString("\n## Memories\n\n")
+		for _, m := range activity.Memories {
+			writeMemoryLine(&b, &m)
+		}
+	}
+	if len(activity.Guidelines) > 0 {
+		b.WriteString("\n## Guidelines\n\n")
+		for _, g := range activity.Guidelines {
+			fmt.Fprintf(&b, "- #%d %s (%s)\n", g.ID, g.Title, g.Category)
+		}
+	}
+	if len(activity.Bookmarks) > 0 {
+		b.WriteString("\n## Bookmarks\n\n")
+		for _, bm := range activity.Bookmarks {
+			fmt.Fprintf(&b, "- %s: %s\n", bm.Title, bm.URL)
+		}
+	}
+	if len(activity.Tasks)+len(activity.Memories)+len(activity.Guidelines)+len(activity.Bookmarks) == 0 {
+		b.WriteString("\nNothing changed.\n")
+	}
+
+	return truncatePrompt(b.String(), maxChars), nil
+}
+
+func writeTaskLine(b *strings.Builder, t *db.Task) {
+	fmt.Fprintf(b, "- #%d [%s] %s", t.ID, t.Status, t.Title)
+	if t.Description != "" {
+		fmt.Fprintf(b, ": %s", t.Description)
+	}
+	b.WriteString("\n")
+}
+
+func writeMemoryLine(b *strings.Builder, m *db.Memory) {
+	fmt.Fprintf(b, "- %s", m.Content)
+	if len(m.Keywords) > 0 {
+		fmt.Fprintf(b, " (%s)", strings.Join(m.Keywords, ", "))
+	}
+	b.WriteString("\n")
+}
+
+// promptProject resolves the project argument without creating projects
+func (s *Server) promptProject(sess *Session, args map[string]string) (*db.Project, error) {
+	if slug := args["project"]; slug != "" {
+		p, err := s.db.GetProjectBySlug(slug)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, newUnknownProjectError(s.db, slug)
+		}
+		return p, err
+	}
+	return s.db.GetProjectByID(sess.ProjectID())
+}
+
+// promptInt parses a numeric prompt argument; prompt arguments are strings
+func promptInt(args map[string]string, key string, def int) (int, error) {
+	v := args[key]
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return n, nil
+}
+
+// parseSince accepts an RFC 3339 timestamp, a date or datetime, or an age
+// like "90m", "8h" or "2d" counted back from now
+func parseSince(v string, now time.Time) (time.Time, error) {
+	if t, ok := parseTimestamp(v); ok {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since: %s", v)
+}
+
+// truncatePrompt cuts text to maxChars runes, noting the cut
+func truncatePrompt(text string, maxChars int) string {
+	runes := []rune(text)
+	if maxChars <= 0 || len(runes) <= maxChars {
+		return text
+	}
+	return string(runes[:maxChars]) + "\n\n[truncated; raise max_chars or use the list tools for the rest]"
+}
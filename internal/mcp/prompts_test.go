@@ -0,0 +1,105 @@
+package mcp
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rocket/mcp-memories/internal/db"
+)
+
+// TestPrompts verifies the session_start and handoff prompts
+func TestPrompts(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	server := NewServer(database, Config{})
+	server.logger = log.New(io.Discard, "", 0)
+	sess := NewSession(database)
+
+	get := func(name string, args map[string]string) *Response {
+		t.Helper()
+		raw, _ := json.Marshal(map[string]interface{}{"name": name, "arguments": args})
+		return server.dispatch(sess, &Request{JSONRPC: "2.0", ID: float64(1), Method: "prompts/get", Params: raw})
+	}
+	text := func(resp *Response) string {
+		t.Helper()
+		if resp.Error != nil {
+			t.Fatalf("prompts/get failed: %+v", resp.Error)
+		}
+		messages := resp.Result.(map[string]interface{})["messages"].([]map[string]interface{})
+		return messages[0]["content"].(map[string]interface{})["text"].(string)
+	}
+
+	app, err := database.CreateProject("app", "App", "")
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	database.CreateGuideline(&app.ID, "style", "Wrap errors", "Use fmt.Errorf.", nil, 9)
+	database.CreateGuideline(&app.ID, "style", "Name tests", "TestXxx per feature.", nil, 1)
+	task, _ := database.CreateTask(&app.ID, nil, "Add prompts", "", 5)
+	inProgress := "in_progress"
+	database.UpdateTask(task.ID, nil, nil, &inProgress, nil)
+	database.CreateTask(&app.ID, nil, "Not started", "", 1)
+	database.CreateMemory(&app.ID, "Prompts use string arguments", []string{"mcp"})
+	database.SetMetadata(&app.ID, "language", "go")
+	database.CreateMemory(nil, "Global memory", nil)
+
+	t.Run("list", func(t *testing.T) {
+		resp := server.dispatch(sess, &Request{JSONRPC: "2.0", ID: float64(1), Method: "prompts/list"})
+		prompts := resp.Result.(map[string]interface{})["prompts"].([]map[string]interface{})
+		if len(prompts) != 2 || prompts[0]["name"] != "session_start" || prompts[1]["name"] != "handoff" {
+			t.Errorf("Unexpected prompts: %v", prompts)
+		}
+	})
+
+	t.Run("session_start", func(t *testing.T) {
+		got := text(get("session_start", map[string]string{"project": "app", "max_guidelines": "1"}))
+		for _, want := range []string{"Wrap errors", "(1 more; use guideline_list)", "Add prompts", "Prompts use string arguments", "language: go"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("session_start missing %q:\n%s", want, got)
+			}
+		}
+		for _, unwanted := range []string{"Name tests", "Not started", "Global memory"} {
+			if strings.Contains(got, unwanted) {
+				t.Errorf("session_start should not contain %q:\n%s", unwanted, got)
+			}
+		}
+
+		got = text(get("session_start", map[string]string{"project": "app", "max_chars": "50"}))
+		if !strings.Contains(got, "[truncated") {
+			t.Errorf("Expected truncated prompt, got %q", got)
+		}
+
+		if resp := get("session_start", map[string]string{"project": "missing"}); resp.Error == nil {
+			t.Error("Expected error for unknown project")
+		}
+		if resp := get("session_start", map[string]string{"project": "app", "max_memories": "0"}); resp.Error == nil {
+			t.Error("Expected error for max_memories 0")
+		}
+	})
+
+	t.Run("handoff", func(t *testing.T) {
+		got := text(get("handoff", map[string]string{"project": "app", "since": "1h"}))
+		for _, want := range []string{"Add prompts", "Prompts use string arguments", "Wrap errors"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("handoff missing %q:\n%s", want, got)
+			}
+		}
+
+		future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		if got := text(get("handoff", map[string]string{"project": "app", "since": future})); !strings.Contains(got, "Nothing changed") {
+			t.Errorf("Expected no changes, got %q", got)
+		}
+
+		if resp := get("handoff", map[string]string{"project": "app"}); resp.Error == nil {
+			t.Error("Expected error without since")
+		}
+	})
+}
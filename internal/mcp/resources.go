@@ -0,0 +1,351 @@
+package mcp
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rocket/mcp-memories/internal/db"
+)
+
+// Resources are addressed as memories://{project}/{kind}[/{key}], where
+// project is a project slug
+const resourceScheme = "memories://"
+
+// ResourceNotFound is the MCP error code for an unknown resource URI
+const ResourceNotFound = -32002
+
+var errResourceNotFound = errors.New("resource not found")
+
+// resourceTemplates describes the URI forms resources/read accepts
+var resourceTemplates = []map[string]interface{}{
+	{
+		"uriTemplate": "memories://{project}/guidelines",
+		"name":        "guidelines",
+		"description": "All guidelines of a project as one markdown document, highest priority first",
+		"mimeType":    "text/markdown",
+	},
+	{
+		"uriTemplate": "memories://{project}/guideline/{id}",
+		"name":        "guideline",
+		"description": "A single guideline as markdown",
+		"mimeType":    "text/markdown",
+	},
+	{
+		"uriTemplate": "memories://{project}/memory/{id}",
+		"name":        "memory",
+		"description": "A single memory and its keywords",
+		"mimeType":    "text/markdown",
+	},
+	{
+		"uriTemplate": "memories://{project}/filetree",
+		"name":        "filetree",
+		"description": "All file and directory annotations of a project",
+		"mimeType":    "text/markdown",
+	},
+	{
+		"uriTemplate": "memories://{project}/filetree/{path}",
+		"name":        "file-annotation",
+		"description": "The note on a single file or directory",
+		"mimeType":    "text/plain",
+	},
+}
+
+// resourceURI is a parsed memories:// URI
+type resourceURI struct {
+	project string
+	kind    string
+	key     string
+}
+
+func parseResourceURI(uri string) (resourceURI, error) {
+	rest, ok := strings.CutPrefix(uri, resourceScheme)
+	if !ok {
+		return resourceURI{}, fmt.Errorf("unsupported URI scheme: %s", uri)
+	}
+	project, rest, _ := strings.Cut(rest, "/")
+	kind, key, _ := strings.Cut(rest, "/")
+	key, err := url.PathUnescape(key)
+	if err != nil {
+		return resourceURI{}, fmt.Errorf("invalid URI %s: %w", uri, err)
+	}
+	if project == "" || kind == "" {
+		return resourceURI{}, fmt.Errorf("invalid URI: %s", uri)
+	}
+	return resourceURI{project: project, kind: kind, key: key}, nil
+}
+
+// resourceURIFor builds the URI of a resource; key is escaped segment by
+// segment so file paths keep their slashes
+func resourceURIFor(project, kind, key string) string {
+	uri := resourceScheme + project + "/" + kind
+	if key == "" {
+		return uri
+	}
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	return uri + "/" + strings.Join(segments, "/")
+}
+
+func (s *Server) handleResourcesList(sess *Session, req *Request) *Response {
+	project, err := s.db.GetProjectByID(sess.ProjectID())
+	if err != nil {
+		return newError(req.ID, InternalError, "Internal error", err.Error())
+	}
+
+	resources := []map[string]interface{}{
+		{
+			"uri":      resourceURIFor(project.Slug, "guidelines", ""),
+			"name":     "guidelines",
+			"title":    fmt.Sprintf("Guidelines for %s", project.Slug),
+			"mimeType": "text/markdown",
+		},
+		{
+			"uri":      resourceURIFor(project.Slug, "filetree", ""),
+			"name":     "filetree",
+			"title":    fmt.Sprintf("File annotations for %s", project.Slug),
+			"mimeType": "text/markdown",
+		},
+	}
+
+	guidelines, err := s.db.ListGuidelines(&project.ID, nil)
+	if err != nil {
+		return newError(req.ID, InternalError, "Internal error", err.Error())
+	}
+	for _, g := range guidelines {
+		resources = append(resources, map[string]interface{}{
+			"uri":         resourceURIFor(project.Slug, "guideline", strconv.FormatInt(g.ID, 10)),
+			"name":        fmt.Sprintf("guideline-%d", g.ID),
+			"title":       g.Title,
+			"description": fmt.Sprintf("%s guideline, priority %d", g.Category, g.Priority),
+			"mimeType":    "text/markdown",
+		})
+	}
+
+	annotations, err := s.db.ListFileAnnotations(&project.ID)
+	if err != nil {
+		return newError(req.ID, InternalError, "Internal error", err.Error())
+	}
+	for _, f := range annotations {
+		resources = append(resources, map[string]interface{}{
+			"uri":         resourceURIFor(project.Slug, "filetree", f.Path),
+			"name":        f.Path,
+			"description": f.Note,
+			"mimeType":    "text/plain",
+		})
+	}
+
+	return newResult(req.ID, map[string]interface{}{"resources": resources})
+}
+
+func (s *Server) handleResourceTemplatesList(req *Request) *Response {
+	return newResult(req.ID, map[string]interface{}{"resourceTemplates": resourceTemplates})
+}
+
+func (s *Server) handleResourcesRead(req *Request) *Response {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.URI == "" {
+		return newError(req.ID, InvalidParams, "Invalid params", "uri is required")
+	}
+
+	mimeType, text, err := s.readResource(params.URI)
+	if err != nil {
+		if errors.Is(err, errResourceNotFound) {
+			return newError(req.ID, ResourceNotFound, "Resource not found", map[string]string{"uri": params.URI})
+		}
+		return newError(req.ID, InvalidParams, "Invalid params", err.Error())
+	}
+
+	return newResult(req.ID, map[string]interface{}{
+		"contents": []map[string]interface{}{
+			{"uri": params.URI, "mimeType": mimeType, "text": text},
+		},
+	})
+}
+
+// readResource renders the resource a URI points at
+func (s *Server) readResource(uri string) (mimeType, text string, err error) {
+	ref, err := parseResourceURI(uri)
+	if err != nil {
+		return "", "", err
+	}
+	project, err := s.db.GetProjectBySlug(ref.project)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", errResourceNotFound
+		}
+		return "", "", err
+	}
+
+	switch ref.kind {
+	case "guidelines":
+		guidelines, err := s.db.ListGuidelines(&project.ID, nil)
+		if err != nil {
+			return "", "", err
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "# Guidelines for %s\n", project.Slug)
+		for _, g := range guidelines {
+			b.WriteString("\n")
+			writeGuideline(&b, &g, "##")
+		}
+		return "text/markdown", b.String(), nil
+
+	case "guideline":
+		id, err := strconv.ParseInt(ref.key, 10, 64)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid guideline id: %s", ref.key)
+		}
+		g, err := s.db.GetGuideline(id)
+		if err != nil || g.ProjectID != project.ID {
+			return "", "", errResourceNotFound
+		}
+		var b strings.Builder
+		writeGuideline(&b, g, "#")
+		return "text/markdown", b.String(), nil
+
+	case "memory":
+		id, err := strconv.ParseInt(ref.key, 10, 64)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid memory id: %s", ref.key)
+		}
+		m, err := s.db.GetMemory(id)
+		if err != nil || m.ProjectID != project.ID {
+			return "", "", errResourceNotFound
+		}
+		text := m.Content
+		if len(m.Keywords) > 0 {
+			text += "\n\nKeywords: " + strings.Join(m.Keywords, ", ")
+		}
+		return "text/markdown", text, nil
+
+	case "filetree":
+		if ref.key == "" {
+			annotations, err := s.db.ListFileAnnotations(&project.ID)
+			if err != nil {
+				return "", "", err
+			}
+			var b strings.Builder
+			fmt.Fprintf(&b, "# File annotations for %s\n\n", project.Slug)
+			for _, f := range annotations {
+				fmt.Fprintf(&b, "- `%s`: %s\n", f.Path, f.Note)
+			}
+			return "text/markdown", b.String(), nil
+		}
+		f, err := s.db.GetFileAnnotation(&project.ID, ref.key)
+		if err != nil {
+			return "", "", err
+		}
+		if f == nil {
+			return "", "", errResourceNotFound
+		}
+		return "text/plain", f.Note, nil
+	}
+
+	return "", "", errResourceNotFound
+}
+
+// writeGuideline renders a guideline as a markdown section
+func writeGuideline(b *strings.Builder, g *db.Guideline, heading string) {
+	fmt.Fprintf(b, "%s %s\n\n", heading, g.Title)
+	fmt.Fprintf(b, "Category: %s · Priority: %d", g.Category, g.Priority)
+	if len(g.Tags) > 0 {
+		fmt.Fprintf(b, " · Tags: %s", strings.Join(g.Tags, ", "))
+	}
+	fmt.Fprintf(b, "\n\n%s\n", g.Content)
+}
+
+func (s *Server) handleResourcesSubscribe(sess *Session, req *Request, subscribe bool) *Response {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.URI == "" {
+		return newError(req.ID, InvalidParams, "Invalid params", "uri is required")
+	}
+	if _, err := parseResourceURI(params.URI); err != nil {
+		return newError(req.ID, InvalidParams, "Invalid params", err.Error())
+	}
+
+	if subscribe {
+		sess.subscribe(params.URI)
+	} else {
+		sess.unsubscribe(params.URI)
+	}
+	return newResult(req.ID, map[string]interface{}{})
+}
+
+// resourceChanged notifies sessions about a committed write, and moves
+// sessions off a project that was deleted or merged away. Subscribers of
+// an affected URI get notifications/resources/updated, and sessions working
+// in the project get notifications/resources/list_changed when a listed
+// resource is added or removed. A workflow change can alter any session's
+// tool schemas, since projects inherit workflows.
+func (s *Server) resourceChanged(c db.Change) {
+	switch c.Entity {
+	case "project":
+		for _, sess := range s.sessions.all() {
+			sess.replaceProject(c.ProjectID, c.ID)
+		}
+		return
+	case "workflow":
+		for _, sess := range s.sessions.all() {
+			sess.toolsChanged()
+		}
+		return
+	}
+
+	project, err := s.db.GetProjectByID(c.ProjectID)
+	if err != nil {
+		s.logger.Printf("Resolving project %d for change notification: %v", c.ProjectID, err)
+		return
+	}
+
+	var uris []string
+	listed := false
+	switch c.Entity {
+	case "guideline":
+		uris = []string{
+			resourceURIFor(project.Slug, "guideline", strconv.FormatInt(c.ID, 10)),
+			resourceURIFor(project.Slug, "guidelines", ""),
+		}
+		listed = true
+	case "filetree":
+		uris = []string{
+			resourceURIFor(project.Slug, "filetree", c.Key),
+			resourceURIFor(project.Slug, "filetree", ""),
+		}
+		listed = true
+	case "memory":
+		uris = []string{resourceURIFor(project.Slug, "memory", strconv.FormatInt(c.ID, 10))}
+	default:
+		return
+	}
+
+	for _, sess := range s.sessions.all() {
+		for _, uri := range uris {
+			if sess.subscribed(uri) {
+				sess.deliver(newNotification("notifications/resources/updated", map[string]string{"uri": uri}))
+			}
+		}
+		if listed && c.Op != db.OpUpdate && sess.ProjectID() == c.ProjectID {
+			sess.deliver(newNotification("notifications/resources/list_changed", nil))
+		}
+	}
+}
+
+// newNotification builds a server-to-client notification
+func newNotification(method string, params interface{}) *Request {
+	n := &Request{JSONRPC: "2.0", Method: method}
+	if params != nil {
+		n.Params, _ = json.Marshal(params)
+	}
+	return n
+}
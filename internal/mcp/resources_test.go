@@ -0,0 +1,149 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/rocket/mcp-memories/internal/db"
+)
+
+// TestResources verifies listing, reading and subscribing to resources
+func TestResources(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	server := NewServer(database, Config{})
+	server.logger = log.New(io.Discard, "", 0)
+
+	sess := NewSession(database)
+	sess.id = "test"
+	var sent []*Request
+	sess.deliver = func(msg interface{}) {
+		if req, ok := msg.(*Request); ok {
+			sent = append(sent, req)
+		}
+	}
+	server.sessions.add(sess)
+
+	call := func(method string, params interface{}) *Response {
+		t.Helper()
+		raw, _ := json.Marshal(params)
+		return server.dispatch(sess, &Request{JSONRPC: "2.0", ID: float64(1), Method: method, Params: raw})
+	}
+	read := func(uri string) string {
+		t.Helper()
+		resp := call("resources/read", map[string]string{"uri": uri})
+		if resp.Error != nil {
+			t.Fatalf("resources/read %s failed: %+v", uri, resp.Error)
+		}
+		contents := resp.Result.(map[string]interface{})["contents"].([]map[string]interface{})
+		return contents[0]["text"].(string)
+	}
+
+	resp := call("initialize", map[string]interface{}{"protocolVersion": "2025-06-18"})
+	caps := resp.Result.(map[string]interface{})["capabilities"].(map[string]interface{})
+	if _, ok := caps["resources"]; !ok {
+		t.Fatalf("resources capability not advertised: %v", caps)
+	}
+
+	g, err := database.CreateGuideline(nil, "style", "Wrap errors", "Use fmt.Errorf with %w.", []string{"go"}, 5)
+	if err != nil {
+		t.Fatalf("CreateGuideline failed: %v", err)
+	}
+	if _, err := database.AnnotateFile(nil, "internal/db/db.go", "Connection setup", false); err != nil {
+		t.Fatalf("AnnotateFile failed: %v", err)
+	}
+	m, err := database.CreateMemory(nil, "Migrations run in one transaction each", []string{"schema"})
+	if err != nil {
+		t.Fatalf("CreateMemory failed: %v", err)
+	}
+
+	guidelineURI := fmt.Sprintf("memories://global/guideline/%d", g.ID)
+	fileURI := "memories://global/filetree/internal/db/db.go"
+
+	t.Run("list", func(t *testing.T) {
+		resp := call("resources/list", nil)
+		resources := resp.Result.(map[string]interface{})["resources"].([]map[string]interface{})
+		uris := map[string]bool{}
+		for _, r := range resources {
+			uris[r["uri"].(string)] = true
+		}
+		for _, want := range []string{"memories://global/guidelines", "memories://global/filetree", guidelineURI, fileURI} {
+			if !uris[want] {
+				t.Errorf("resources/list missing %s: %v", want, uris)
+			}
+		}
+
+		resp = call("resources/templates/list", nil)
+		templates := resp.Result.(map[string]interface{})["resourceTemplates"].([]map[string]interface{})
+		if len(templates) != len(resourceTemplates) {
+			t.Errorf("Expected %d templates, got %d", len(resourceTemplates), len(templates))
+		}
+	})
+
+	t.Run("read", func(t *testing.T) {
+		if text := read(guidelineURI); !strings.Contains(text, "# Wrap errors") || !strings.Contains(text, "fmt.Errorf") {
+			t.Errorf("Unexpected guideline text: %q", text)
+		}
+		if text := read("memories://global/guidelines"); !strings.Contains(text, "## Wrap errors") {
+			t.Errorf("Unexpected guidelines text: %q", text)
+		}
+		if text := read(fileURI); text != "Connection setup" {
+			t.Errorf("Unexpected annotation text: %q", text)
+		}
+		if text := read(fmt.Sprintf("memories://global/memory/%d", m.ID)); !strings.Contains(text, "Keywords: schema") {
+			t.Errorf("Unexpected memory text: %q", text)
+		}
+
+		for _, uri := range []string{
+			"memories://global/guideline/9999",
+			"memories://nope/guidelines",
+			"memories://global/filetree/missing.go",
+		} {
+			resp := call("resources/read", map[string]string{"uri": uri})
+			if resp.Error == nil || resp.Error.Code != ResourceNotFound {
+				t.Errorf("Expected resource not found for %s, got %+v", uri, resp.Error)
+			}
+		}
+	})
+
+	t.Run("subscribe", func(t *testing.T) {
+		if resp := call("resources/subscribe", map[string]string{"uri": guidelineURI}); resp.Error != nil {
+			t.Fatalf("subscribe failed: %+v", resp.Error)
+		}
+
+		sent = nil
+		content := "Always wrap errors with %w."
+		if _, err := database.UpdateGuideline(g.ID, &content, nil, nil); err != nil {
+			t.Fatalf("UpdateGuideline failed: %v", err)
+		}
+		if len(sent) != 1 || sent[0].Method != "notifications/resources/updated" || !strings.Contains(string(sent[0].Params), guidelineURI) {
+			t.Fatalf("Expected one update notification for %s, got %+v", guidelineURI, sent)
+		}
+
+		// Creating a guideline changes the list but not the subscribed resource
+		sent = nil
+		if _, err := database.CreateGuideline(nil, "testing", "Table tests", "Prefer subtests.", nil, 1); err != nil {
+			t.Fatalf("CreateGuideline failed: %v", err)
+		}
+		if len(sent) != 1 || sent[0].Method != "notifications/resources/list_changed" {
+			t.Fatalf("Expected a list_changed notification, got %+v", sent)
+		}
+
+		call("resources/unsubscribe", map[string]string{"uri": guidelineURI})
+		sent = nil
+		if _, err := database.UpdateGuideline(g.ID, &content, nil, nil); err != nil {
+			t.Fatalf("UpdateGuideline failed: %v", err)
+		}
+		if len(sent) != 0 {
+			t.Errorf("Expected no notifications after unsubscribe, got %+v", sent)
+		}
+	})
+}
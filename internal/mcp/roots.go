@@ -0,0 +1,204 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/rocket/mcp-memories/internal/db"
+)
+
+// refreshRoots asks the client for its workspace roots and picks the session's
+// project from them. Stdio clients without the roots capability fall back to
+// the server's working directory, which the client launched it in.
+func (s *Server) refreshRoots(sess *Session) {
+	if !sess.hasClientRoots() {
+		s.detectFromWorkingDir(sess)
+		return
+	}
+
+	err := sess.request("roots/list", nil, func(result json.RawMessage, rpcErr *Error) {
+		if rpcErr != nil {
+			s.logger.Printf("roots/list failed: %s", rpcErr.Message)
+			s.detectFromWorkingDir(sess)
+			return
+		}
+
+		var list struct {
+			Roots []struct {
+				URI string `json:"uri"`
+			} `json:"roots"`
+		}
+		if err := json.Unmarshal(result, &list); err != nil {
+			s.logger.Printf("Invalid roots/list result: %v", err)
+			return
+		}
+
+		var paths []string
+		for _, root := range list.Roots {
+			if path, ok := fileURIToPath(root.URI); ok {
+				paths = append(paths, path)
+			}
+		}
+		if len(paths) == 0 {
+			s.detectFromWorkingDir(sess)
+			return
+		}
+		s.detectProject(sess, paths)
+	})
+	if err != nil {
+		s.logger.Printf("Requesting roots: %v", err)
+	}
+}
+
+// detectFromWorkingDir uses the process working directory as the workspace.
+// A shared HTTP server's working directory says nothing about its clients, so
+// it is only used for stdio.
+func (s *Server) detectFromWorkingDir(sess *Session) {
+	if sess.stream != nil {
+		return
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		s.detectProject(sess, []string{cwd})
+	}
+}
+
+// detectProject makes the first project that covers one of the workspace paths
+// the session's active project, unless the client has already chosen one. A
+// path matches a project whose root_path is the path itself, one of its
+// parents, or its git repository root. If nothing matches and
+// CreateWorkspaceProjects is set, a project is created for the first path's
+// git repository.
+func (s *Server) detectProject(sess *Session, paths []string) {
+	if sess.ProjectSource() == sourceExplicit {
+		return
+	}
+
+	for _, path := range paths {
+		for _, candidate := range workspaceCandidates(path) {
+			p, err := s.db.FindProjectByPath(candidate)
+			if err != nil {
+				s.logger.Printf("Matching workspace %s: %v", candidate, err)
+				return
+			}
+			if p != nil {
+				if sess.setDetectedProject(p.ID, "workspace "+path) {
+					s.logger.Printf("Detected project %s from %s", p.Slug, path)
+					sess.toolsChanged()
+				}
+				return
+			}
+		}
+	}
+
+	if !s.cfg.CreateWorkspaceProjects {
+		return
+	}
+	for _, path := range paths {
+		root := gitRoot(path)
+		if root == "" {
+			continue
+		}
+		p, err := s.createWorkspaceProject(root)
+		if err != nil {
+			s.logger.Printf("Creating project for %s: %v", root, err)
+			return
+		}
+		if sess.setDetectedProject(p.ID, "created for "+root) {
+			s.logger.Printf("Created project %s for %s", p.Slug, root)
+			sess.toolsChanged()
+		}
+		return
+	}
+}
+
+// workspaceCandidates lists the paths to match for a workspace path: the path
+// itself, its resolved form if it contains symlinks, and its git root
+func workspaceCandidates(path string) []string {
+	candidates := []string{path}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil && resolved != path {
+		candidates = append(candidates, resolved)
+	}
+	if root := gitRoot(path); root != "" && root != path {
+		candidates = append(candidates, root)
+	}
+	return candidates
+}
+
+// createWorkspaceProject creates a project rooted at a git repository, named
+// after the repository directory
+func (s *Server) createWorkspaceProject(root string) (*db.Project, error) {
+	name := filepath.Base(root)
+	base := slugify(name)
+	if base == "" {
+		base = "workspace"
+	}
+
+	slug := base
+	for i := 2; ; i++ {
+		if _, err := s.db.GetProjectBySlug(slug); err != nil {
+			break
+		}
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+	return s.db.CreateProject(slug, name, root)
+}
+
+// gitRoot returns the nearest directory at or above path that contains .git,
+// or "" if path is not inside a git repository
+func gitRoot(path string) string {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// fileURIToPath converts a file:// root URI into a local path
+func fileURIToPath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	path := u.Path
+	if runtime.GOOS == "windows" {
+		if u.Host != "" {
+			// UNC path: file://server/share/dir
+			return `\\` + u.Host + filepath.FromSlash(path), true
+		}
+		// file:///C:/dir parses with a leading slash before the drive letter
+		if len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+			path = path[1:]
+		}
+	}
+	return filepath.FromSlash(path), path != ""
+}
+
+// slugify turns a directory name into a project slug
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
@@ -0,0 +1,117 @@
+package mcp
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rocket/mcp-memories/internal/db"
+)
+
+// newRootsSession initializes a session that advertises the roots capability
+// and captures the messages the server sends it
+func newRootsSession(t *testing.T, server *Server) (*Session, *[]*Request) {
+	t.Helper()
+	sess := NewSession(server.db)
+	sent := &[]*Request{}
+	sess.deliver = func(msg interface{}) {
+		if req, ok := msg.(*Request); ok {
+			*sent = append(*sent, req)
+		}
+	}
+
+	server.dispatch(sess, &Request{JSONRPC: "2.0", ID: float64(1), Method: "initialize",
+		Params: json.RawMessage(`{"protocolVersion":"2025-06-18","capabilities":{"roots":{"listChanged":true}}}`)})
+	server.dispatch(sess, &Request{JSONRPC: "2.0", Method: "notifications/initialized"})
+	return sess, sent
+}
+
+// answerRoots replies to the last roots/list request with the given directories
+func answerRoots(t *testing.T, server *Server, sess *Session, sent []*Request, dirs ...string) {
+	t.Helper()
+	if len(sent) == 0 || sent[len(sent)-1].Method != "roots/list" {
+		t.Fatalf("expected a roots/list request, got %+v", sent)
+	}
+	var roots []map[string]string
+	for _, dir := range dirs {
+		roots = append(roots, map[string]string{"uri": (&url.URL{Scheme: "file", Path: filepath.ToSlash(dir)}).String()})
+	}
+	result, _ := json.Marshal(map[string]interface{}{"roots": roots})
+	server.dispatch(sess, &Request{JSONRPC: "2.0", ID: sent[len(sent)-1].ID, Result: result})
+}
+
+// TestWorkspaceProjectDetection verifies that sessions pick their project from
+// the client's workspace roots
+func TestWorkspaceProjectDetection(t *testing.T) {
+	database, err := db.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	repo := t.TempDir()
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatalf("creating .git: %v", err)
+	}
+	nested := filepath.Join(repo, "internal", "pkg")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("creating nested dir: %v", err)
+	}
+
+	t.Run("nested root matches project root_path", func(t *testing.T) {
+		server := NewServer(database, Config{})
+		server.logger = log.New(io.Discard, "", 0)
+		project, err := database.CreateProject("known", "", repo)
+		if err != nil {
+			t.Fatalf("CreateProject failed: %v", err)
+		}
+		defer database.Exec("DELETE FROM projects WHERE id = ?", project.ID)
+
+		sess, sent := newRootsSession(t, server)
+		answerRoots(t, server, sess, *sent, nested)
+		if sess.ProjectID() != project.ID {
+			t.Errorf("expected project %d, got %d (%s)", project.ID, sess.ProjectID(), sess.ProjectSource())
+		}
+	})
+
+	t.Run("explicit project is kept", func(t *testing.T) {
+		server := NewServer(database, Config{CreateWorkspaceProjects: true})
+		server.logger = log.New(io.Discard, "", 0)
+		sess, sent := newRootsSession(t, server)
+		sess.SetProjectID(db.GlobalProjectID)
+		answerRoots(t, server, sess, *sent, repo)
+		if sess.ProjectID() != db.GlobalProjectID {
+			t.Errorf("explicit project was replaced by %d", sess.ProjectID())
+		}
+	})
+
+	t.Run("unknown repository is not created by default", func(t *testing.T) {
+		server := NewServer(database, Config{})
+		server.logger = log.New(io.Discard, "", 0)
+		sess, sent := newRootsSession(t, server)
+		answerRoots(t, server, sess, *sent, nested)
+		if sess.ProjectID() != db.GlobalProjectID {
+			t.Errorf("expected global project, got %d", sess.ProjectID())
+		}
+	})
+
+	t.Run("unknown repository is created when enabled", func(t *testing.T) {
+		server := NewServer(database, Config{CreateWorkspaceProjects: true})
+		server.logger = log.New(io.Discard, "", 0)
+		sess, sent := newRootsSession(t, server)
+		answerRoots(t, server, sess, *sent, nested)
+
+		result, err := HandleToolCall(sess, "project_current", map[string]interface{}{})
+		if err != nil {
+			t.Fatalf("project_current failed: %v", err)
+		}
+		project := result.(map[string]interface{})["project"].(*db.Project)
+		if project.Slug != slugify(filepath.Base(repo)) || project.RootPath != repo {
+			t.Errorf("unexpected project: %+v", project)
+		}
+	})
+}
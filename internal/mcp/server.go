@@ -10,25 +10,48 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"log"
 
 	"github.com/rocket/mcp-memories/internal/db"
 )
 
-// Server implements the MCP protocol over stdio
+// Server implements the MCP protocol. It serves a single client over stdio
+// with Run, or many clients over Streamable HTTP with RunHTTP.
 type Server struct {
-	db     *db.DB
-	reader *bufio.Reader
-	writer io.Writer
-	mu     sync.Mutex
-	logger *log.Logger
+	db       *db.DB
+	cfg      Config
+	reader   *bufio.Reader
+	writer   io.Writer
+	mu       sync.Mutex
+	logger   *log.Logger
+	sessions sessionStore
+	expiry   sync.Once // starts ending idle HTTP sessions
+}
+
+// Config holds server options
+type Config struct {
+	// CreateWorkspaceProjects creates a project for a git repository that no
+	// project's root_path covers when detecting a session's active project
+	CreateWorkspaceProjects bool
+
+	// AutoCreateProjects creates a project when a tool call names an unknown
+	// slug. By default such calls fail with an UnknownProjectError.
+	AutoCreateProjects bool
+
+	// SessionIdleTimeout ends an HTTP session that has gone this long without
+	// a request or an open stream; DefaultSessionIdleTimeout when zero
+	SessionIdleTimeout time.Duration
 }
 
 const maxMessageBytes = 8 * 1024 * 1024
 
+// Protocol versions this server can speak, newest first
+var supportedProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
 // NewServer creates a new MCP server
-func NewServer(database *db.DB) *Server {
+func NewServer(database *db.DB, cfg Config) *Server {
 	// Setup logging to file
 	homeDir, _ := os.UserHomeDir()
 	logDir := filepath.Join(homeDir, ".mcp-memory")
@@ -42,20 +65,27 @@ func NewServer(database *db.DB) *Server {
 		logger = log.New(os.Stderr, "[MCP] ", log.LstdFlags)
 	}
 
-	return &Server{
-		db:     database,
-		reader: bufio.NewReaderSize(os.Stdin, 64*1024),
-		writer: os.Stdout,
-		logger: logger,
+	s := &Server{
+		db:       database,
+		cfg:      cfg,
+		reader:   bufio.NewReaderSize(os.Stdin, 64*1024),
+		writer:   os.Stdout,
+		logger:   logger,
+		sessions: sessionStore{sessions: make(map[string]*Session)},
 	}
+	database.OnChange(s.resourceChanged)
+	return s
 }
 
-// Request represents a JSON-RPC 2.0 request
+// Request represents a JSON-RPC 2.0 request. Result and Error are only set
+// when the message is the client's response to a server-initiated request.
 type Request struct {
 	JSONRPC string          `json:"jsonrpc"`
 	ID      interface{}     `json:"id,omitempty"`
-	Method  string          `json:"method"`
+	Method  string          `json:"method,omitempty"`
 	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
 }
 
 // Response represents a JSON-RPC 2.0 response
@@ -82,7 +112,7 @@ const (
 	InternalError  = -32603
 )
 
-// Run starts the server's main loop
+// Run serves a single client over stdin/stdout
 func (s *Server) Run() error {
 	s.logger.Println("Server started")
 	defer func() {
@@ -91,6 +121,12 @@ func (s *Server) Run() error {
 		}
 	}()
 
+	sess := s.newSession()
+	sess.id = "stdio"
+	sess.deliver = s.write
+	s.sessions.add(sess)
+	defer s.sessions.remove(sess.id)
+
 	for {
 		line, err := readLineLimited(s.reader, maxMessageBytes)
 		if err != nil {
@@ -109,25 +145,36 @@ func (s *Server) Run() error {
 		var req Request
 		if err := json.Unmarshal(line, &req); err != nil {
 			s.logger.Printf("Parse error: %v", err)
-			s.sendError(nil, ParseError, "Parse error", err.Error())
+			s.write(newError(nil, ParseError, "Parse error", err.Error()))
 			continue
 		}
 
-		// Handle request in a goroutine to allow concurrent processing?
-		// For now, keep it synchronous to avoid race conditions with DB if not thread safe (DB is thread safe mostly but let's be safe)
-		// But we should recover individually per request too
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					s.logger.Printf("Panic handling request: %v", r)
-					s.sendError(req.ID, InternalError, "Internal error", fmt.Sprintf("Panic: %v", r))
-				}
-			}()
-			s.handleRequest(&req)
-		}()
+		// Requests are handled one at a time so responses keep their order
+		if resp := s.dispatch(sess, &req); resp != nil {
+			s.write(resp)
+		}
 	}
 }
 
+// newSession creates a session configured by the server's options
+func (s *Server) newSession() *Session {
+	sess := NewSession(s.db)
+	sess.autoCreateProjects = s.cfg.AutoCreateProjects
+	return sess
+}
+
+// dispatch handles one message, recovering from panics so a single bad
+// request cannot take the server down. It returns nil for notifications.
+func (s *Server) dispatch(sess *Session, req *Request) (resp *Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Printf("Panic handling request: %v", r)
+			resp = newError(req.ID, InternalError, "Internal error", fmt.Sprintf("Panic: %v", r))
+		}
+	}()
+	return s.handleRequest(sess, req)
+}
+
 func bytesTrimSpaceCRLF(b []byte) []byte {
 	// json.Unmarshal allows whitespace, but trimming avoids surprises with CRLF and empty lines.
 	s := strings.TrimSpace(string(b))
@@ -177,27 +224,63 @@ func readLineLimited(r *bufio.Reader, max int) ([]byte, error) {
 	}
 }
 
-func (s *Server) handleRequest(req *Request) {
+func (s *Server) handleRequest(sess *Session, req *Request) *Response {
+	if isClientResponse(req) {
+		sess.resolve(req)
+		return nil
+	}
 	s.logger.Printf("Handling request: %s", req.Method)
-	if req.Method != "notifications/initialized" {
-		if err := validateRequestID(req.ID); err != nil {
-			s.sendError(nil, InvalidRequest, "Invalid request", err.Error())
-			return
-		}
+	if isNotification(req) {
+		s.handleNotification(sess, req)
+		return nil
+	}
+	if err := validateRequestID(req.ID); err != nil {
+		return newError(nil, InvalidRequest, "Invalid request", err.Error())
 	}
 
 	switch req.Method {
 	case "initialize":
-		s.handleInitialize(req)
+		return s.handleInitialize(sess, req)
+	case "ping":
+		return newResult(req.ID, map[string]interface{}{})
 	case "tools/list":
-		s.handleToolsList(req)
+		return s.handleToolsList(sess, req)
 	case "tools/call":
-		s.handleToolsCall(req)
-	case "notifications/initialized":
-		// Acknowledgment, no response needed
+		return s.handleToolsCall(sess, req)
+	case "prompts/list":
+		return s.handlePromptsList(req)
+	case "prompts/get":
+		return s.handlePromptsGet(sess, req)
+	case "resources/list":
+		return s.handleResourcesList(sess, req)
+	case "resources/templates/list":
+		return s.handleResourceTemplatesList(req)
+	case "resources/read":
+		return s.handleResourcesRead(req)
+	case "resources/subscribe":
+		return s.handleResourcesSubscribe(sess, req, true)
+	case "resources/unsubscribe":
+		return s.handleResourcesSubscribe(sess, req, false)
 	default:
 		s.logger.Printf("Method not found: %s", req.Method)
-		s.sendError(req.ID, MethodNotFound, "Method not found", req.Method)
+		return newError(req.ID, MethodNotFound, "Method not found", req.Method)
+	}
+}
+
+// isNotification reports whether a message expects no response
+func isNotification(req *Request) bool {
+	return strings.HasPrefix(req.Method, "notifications/")
+}
+
+// isClientResponse reports whether a message answers a server-initiated request
+func isClientResponse(req *Request) bool {
+	return req.Method == "" && req.ID != nil && (req.Result != nil || req.Error != nil)
+}
+
+func (s *Server) handleNotification(sess *Session, req *Request) {
+	switch req.Method {
+	case "notifications/initialized", "notifications/roots/list_changed":
+		s.refreshRoots(sess)
 	}
 }
 
@@ -222,27 +305,77 @@ func validateRequestID(id interface{}) error {
 	}
 }
 
-func (s *Server) handleInitialize(req *Request) {
+func (s *Server) handleInitialize(sess *Session, req *Request) *Response {
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		Capabilities    struct {
+			Roots *struct{} `json:"roots"`
+		} `json:"capabilities"`
+	}
+	_ = json.Unmarshal(req.Params, &params)
+	sess.setClientRoots(params.Capabilities.Roots != nil)
+
 	result := map[string]interface{}{
-		"protocolVersion": "2024-11-05",
+		"protocolVersion": negotiateProtocolVersion(params.ProtocolVersion),
 		"capabilities": map[string]interface{}{
-			"tools": map[string]interface{}{"listChanged": false},
+			"tools":     map[string]interface{}{"listChanged": true},
+			"resources": map[string]interface{}{"subscribe": true, "listChanged": true},
+			"prompts":   map[string]interface{}{"listChanged": false},
 		},
 		"serverInfo": map[string]interface{}{
 			"name":    "mcp-memories",
 			"version": "1.0.0",
 		},
 	}
-	s.sendResult(req.ID, result)
+	return newResult(req.ID, result)
+}
+
+// negotiateProtocolVersion echoes the client's version if supported, and
+// otherwise offers the newest version this server speaks
+func negotiateProtocolVersion(requested string) string {
+	for _, v := range supportedProtocolVersions {
+		if v == requested {
+			return v
+		}
+	}
+	return supportedProtocolVersions[0]
 }
 
-func (s *Server) handleToolsList(req *Request) {
-	s.sendResult(req.ID, map[string]interface{}{
-		"tools": GetToolDefinitions(),
+func (s *Server) handleToolsList(sess *Session, req *Request) *Response {
+	tools := GetToolDefinitions()
+	id := sess.ProjectID()
+	if workflow, err := s.db.GetWorkflow(&id); err != nil {
+		s.logger.Printf("Resolving task workflow for tools/list: %v", err)
+	} else {
+		setStatusEnums(tools, workflow.Statuses)
+	}
+	addOutputOptions(tools)
+	return newResult(req.ID, map[string]interface{}{
+		"tools": tools,
 	})
 }
 
-func (s *Server) handleToolsCall(req *Request) {
+// setStatusEnums replaces the task status enums in the tool schemas with the
+// statuses of the session's workflow
+func setStatusEnums(tools []ToolDefinition, statuses []string) {
+	for _, tool := range tools {
+		props, _ := tool.InputSchema["properties"].(map[string]interface{})
+		for _, key := range []string{"status", "statuses"} {
+			prop, ok := props[key].(map[string]interface{})
+			if !ok || !strings.HasPrefix(tool.Name, "task_") {
+				continue
+			}
+			if items, ok := prop["items"].(map[string]interface{}); ok {
+				prop = items
+			}
+			if _, ok := prop["enum"]; ok {
+				prop["enum"] = statuses
+			}
+		}
+	}
+}
+
+func (s *Server) handleToolsCall(sess *Session, req *Request) *Response {
 	var params struct {
 		Name      string                 `json:"name"`
 		Arguments map[string]interface{} `json:"arguments"`
@@ -250,23 +383,24 @@ func (s *Server) handleToolsCall(req *Request) {
 
 	if err := json.Unmarshal(req.Params, &params); err != nil {
 		s.logger.Printf("Invalid params for tool call: %v", err)
-		s.sendError(req.ID, InvalidParams, "Invalid params", err.Error())
-		return
+		return newError(req.ID, InvalidParams, "Invalid params", err.Error())
 	}
 	if params.Name == "" {
-		s.sendError(req.ID, InvalidParams, "Invalid params", "tool name is required")
-		return
+		return newError(req.ID, InvalidParams, "Invalid params", "tool name is required")
 	}
 
 	s.logger.Printf("Calling tool: %s", params.Name)
-	result, err := HandleToolCall(s.db, params.Name, params.Arguments)
+	output, err := getOutputOptions(params.Arguments)
+	var result interface{}
+	if err == nil {
+		result, err = HandleToolCall(sess, params.Name, params.Arguments)
+	}
 	if err != nil {
 		s.logger.Printf("Tool error: %v", err)
 		if errors.Is(err, ErrUnknownTool) {
-			s.sendError(req.ID, InvalidParams, "Unknown tool", err.Error())
-			return
+			return newError(req.ID, InvalidParams, "Unknown tool", err.Error())
 		}
-		s.sendResult(req.ID, map[string]interface{}{
+		result := map[string]interface{}{
 			"content": []map[string]interface{}{
 				{
 					"type": "text",
@@ -274,33 +408,44 @@ func (s *Server) handleToolsCall(req *Request) {
 				},
 			},
 			"isError": true,
-		})
-		return
+		}
+		var unknown *UnknownProjectError
+		if errors.As(err, &unknown) {
+			result["structuredContent"] = map[string]interface{}{
+				"error":       "unknown_project",
+				"project":     unknown.Slug,
+				"suggestions": unknown.Suggestions,
+			}
+		}
+		return newResult(req.ID, result)
 	}
 
-	// Format result as text content
-	resultJSON, _ := json.Marshal(result) // keep compact
-	s.sendResult(req.ID, map[string]interface{}{
-		"content": []map[string]interface{}{
-			{
-				"type": "text",
-				"text": string(resultJSON),
-			},
-		},
+	// Format result as text content, shaped by the output options
+	texts, err := formatResult(params.Name, result, output)
+	if err != nil {
+		s.logger.Printf("Formatting %s result: %v", params.Name, err)
+		return newError(req.ID, InternalError, "Internal error", err.Error())
+	}
+	content := make([]map[string]interface{}, len(texts))
+	for i, text := range texts {
+		content[i] = map[string]interface{}{"type": "text", "text": text}
+	}
+	return newResult(req.ID, map[string]interface{}{
+		"content": content,
 		"isError": false,
 	})
 }
 
-func (s *Server) sendResult(id interface{}, result interface{}) {
-	s.send(&Response{
+func newResult(id interface{}, result interface{}) *Response {
+	return &Response{
 		JSONRPC: "2.0",
 		ID:      id,
 		Result:  result,
-	})
+	}
 }
 
-func (s *Server) sendError(id interface{}, code int, message string, data interface{}) {
-	s.send(&Response{
+func newError(id interface{}, code int, message string, data interface{}) *Response {
+	return &Response{
 		JSONRPC: "2.0",
 		ID:      id,
 		Error: &Error{
@@ -308,14 +453,15 @@ func (s *Server) sendError(id interface{}, code int, message string, data interf
 			Message: message,
 			Data:    data,
 		},
-	})
+	}
 }
 
-func (s *Server) send(resp *Response) {
+// write sends a message to the stdio client
+func (s *Server) write(msg interface{}) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := json.Marshal(resp)
+	data, err := json.Marshal(msg)
 	if err != nil {
 		s.logger.Printf("Error marshaling response: %v", err)
 		return
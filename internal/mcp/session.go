@@ -0,0 +1,273 @@
+package mcp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rocket/mcp-memories/internal/db"
+)
+
+// Session holds the state of one connected client and is threaded through
+// every tool handler. The stdio transport has a single session for the life
+// of the process; the HTTP transport creates one per initialize request and
+// identifies it by the Mcp-Session-Id header.
+type Session struct {
+	id string
+	db *db.DB
+
+	// autoCreateProjects creates projects for unknown "project" slugs
+	autoCreateProjects bool
+
+	mu            sync.Mutex
+	projectID     int64  // active project for calls that omit "project"
+	projectSource string // how the active project was chosen
+	clientRoots   bool   // client supports roots/list
+
+	// Resource URIs the client subscribed to
+	subscriptions map[string]bool
+
+	// Server-initiated requests awaiting the client's response, by ID
+	nextRequestID int
+	pending       map[string]func(result json.RawMessage, rpcErr *Error)
+
+	// deliver sends a server-initiated message to the client
+	deliver func(msg interface{})
+
+	// stream is set for HTTP sessions, which end once they have gone
+	// without requests or an open stream for the server's idle timeout
+	stream      *httpStream
+	lastActive  time.Time
+	openStreams int
+}
+
+// NewSession creates a session whose active project is the global project
+func NewSession(database *db.DB) *Session {
+	return &Session{
+		db:            database,
+		projectID:     db.GlobalProjectID,
+		projectSource: sourceDefault,
+		deliver:       func(interface{}) {},
+		pending:       make(map[string]func(json.RawMessage, *Error)),
+		subscriptions: make(map[string]bool),
+	}
+}
+
+// How a session's active project was chosen
+const (
+	sourceDefault  = "default"
+	sourceExplicit = "project_set_default"
+)
+
+// ProjectID returns the session's active project
+func (s *Session) ProjectID() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.projectID
+}
+
+// ProjectSource describes how the active project was chosen
+func (s *Session) ProjectSource() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.projectSource
+}
+
+// SetProjectID changes the session's active project. An explicitly chosen
+// project is never replaced by workspace detection.
+func (s *Session) SetProjectID(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.projectID = id
+	s.projectSource = sourceExplicit
+}
+
+// setDetectedProject applies a project found from the client's workspace,
+// unless the client already chose one
+func (s *Session) setDetectedProject(id int64, source string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.projectSource == sourceExplicit {
+		return false
+	}
+	s.projectID = id
+	s.projectSource = source
+	return true
+}
+
+// replaceProject moves the session off a deleted project: to the project it
+// was merged into, or back to the global default
+func (s *Session) replaceProject(deletedID, replacementID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.projectID != deletedID {
+		return
+	}
+	s.projectID = replacementID
+	if replacementID == db.GlobalProjectID {
+		s.projectSource = sourceDefault
+	}
+}
+
+// toolsChanged tells the client to list tools again, since their schemas
+// depend on the active project's task workflow
+func (s *Session) toolsChanged() {
+	s.deliver(newNotification("notifications/tools/list_changed", nil))
+}
+
+// touch records a request from the client
+func (s *Session) touch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastActive = time.Now()
+}
+
+// streamOpened and streamClosed track the client's open GET streams, which
+// keep the session alive
+func (s *Session) streamOpened() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.openStreams++
+}
+
+func (s *Session) streamClosed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.openStreams--
+	s.lastActive = time.Now()
+}
+
+// idleSince reports whether the client has neither sent a request nor held
+// a stream open since t
+func (s *Session) idleSince(t time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.openStreams == 0 && s.lastActive.Before(t)
+}
+
+func (s *Session) setClientRoots(supported bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clientRoots = supported
+}
+
+func (s *Session) hasClientRoots() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clientRoots
+}
+
+func (s *Session) subscribe(uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscriptions[uri] = true
+}
+
+func (s *Session) unsubscribe(uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscriptions, uri)
+}
+
+func (s *Session) subscribed(uri string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscriptions[uri]
+}
+
+// request sends a server-initiated request to the client; handle is called
+// when the client's response arrives
+func (s *Session) request(method string, params interface{}, handle func(result json.RawMessage, rpcErr *Error)) error {
+	var raw json.RawMessage
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		raw = data
+	}
+
+	s.mu.Lock()
+	s.nextRequestID++
+	id := fmt.Sprintf("srv-%d", s.nextRequestID)
+	s.pending[id] = handle
+	s.mu.Unlock()
+
+	s.deliver(&Request{JSONRPC: "2.0", ID: id, Method: method, Params: raw})
+	return nil
+}
+
+// resolve passes a client's response to the handler of the matching request
+func (s *Session) resolve(resp *Request) {
+	id := fmt.Sprint(resp.ID)
+	s.mu.Lock()
+	handle := s.pending[id]
+	delete(s.pending, id)
+	s.mu.Unlock()
+
+	if handle != nil {
+		handle(resp.Result, resp.Error)
+	}
+}
+
+// newSessionID returns a random, URL-safe session identifier
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// sessionStore tracks the live sessions of a server
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func (st *sessionStore) add(sess *Session) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.sessions[sess.id] = sess
+}
+
+func (st *sessionStore) get(id string) *Session {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.sessions[id]
+}
+
+func (st *sessionStore) remove(id string) *Session {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sess := st.sessions[id]
+	delete(st.sessions, id)
+	return sess
+}
+
+// removeIdle removes and returns the HTTP sessions idle since t
+func (st *sessionStore) removeIdle(t time.Time) []*Session {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var idle []*Session
+	for id, sess := range st.sessions {
+		if sess.stream != nil && sess.idleSince(t) {
+			idle = append(idle, sess)
+			delete(st.sessions, id)
+		}
+	}
+	return idle
+}
+
+func (st *sessionStore) all() []*Session {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sessions := make([]*Session, 0, len(st.sessions))
+	for _, sess := range st.sessions {
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
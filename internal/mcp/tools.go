@@ -13,28 +13,69 @@ func GetToolDefinitions() []ToolDefinition {
 		// Memory tools
 		{
 			Name:        "memory_store",
-			Description: "Store a new memory with optional keywords for later retrieval",
+			Description: "Store a new memory with optional keywords for later retrieval. By default a memory that duplicates or nearly duplicates an existing one returns that memory instead, with its similarity",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"content":  map[string]interface{}{"type": "string", "description": "The content to remember"},
-					"keywords": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Keywords for categorization and search"},
-					"project":  map[string]interface{}{"type": "string", "description": "Project slug (optional, defaults to current project)"},
+					"content":    map[string]interface{}{"type": "string", "description": "The content to remember"},
+					"keywords":   map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Keywords for categorization and search"},
+					"expires_at": map[string]interface{}{"type": "string", "description": "When the memory expires and is hidden from searches (date or RFC 3339 time)"},
+					"pinned":     map[string]interface{}{"type": "boolean", "description": "Pinned memories are always ranked first"},
+					"importance": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 5, "description": "1 (trivial) to 5 (essential), default 3; scales search relevance"},
+					"dedupe":     map[string]interface{}{"type": "string", "enum": []string{"skip", "merge", "force"}, "description": "On a duplicate, return the existing memory (skip, default), add the keywords to it (merge), or store anyway (force)"},
+					"project":    map[string]interface{}{"type": "string", "description": "Project slug (optional, defaults to current project)"},
 				},
 				"required": []string{"content"},
 			},
 		},
 		{
 			Name:        "memory_search",
-			Description: "Search memories by content and/or keywords",
+			Description: "Search memories by content and/or keywords, ranked by relevance with highlighted snippets",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"query":    map[string]interface{}{"type": "string", "description": "Text to search for in content"},
-					"keywords": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Keywords to filter by"},
-					"project":  map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
-					"limit":    map[string]interface{}{"type": "integer", "description": "Maximum results to return"},
+					"query":            map[string]interface{}{"type": "string", "description": "Full-text query over content and keywords. Supports \"exact phrases\", prefix* terms and AND/OR/NOT"},
+					"keywords":         map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Memories must have every one of these keywords"},
+					"any_keywords":     map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Memories must have at least one of these keywords"},
+					"exclude_keywords": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Memories must have none of these keywords"},
+					"project":          map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"mode":             map[string]interface{}{"type": "string", "enum": []string{"lexical", "semantic", "hybrid"}, "description": "Match by text (lexical, default), by meaning (semantic), or both (hybrid)"},
+					"include_expired":  map[string]interface{}{"type": "boolean", "description": "Also return expired and archived memories"},
+					"include_links":    map[string]interface{}{"type": "boolean", "description": "Include each memory's linked entities"},
+					"limit":            map[string]interface{}{"type": "integer", "description": "Maximum results per page (default 20)"},
+					"cursor":           map[string]interface{}{"type": "string", "description": "Pass next_cursor from the previous page to get the next one"},
+				},
+			},
+		},
+		{
+			Name:        "memory_update",
+			Description: "Update a memory's content and keywords in place, keeping the previous version in its history, or change its expiry, pin and importance",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id":              map[string]interface{}{"type": "integer", "description": "Memory ID"},
+					"content":         map[string]interface{}{"type": "string", "description": "New content"},
+					"keywords":        map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Replace all keywords"},
+					"add_keywords":    map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Keywords to add"},
+					"remove_keywords": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Keywords to remove"},
+					"expires_at":      map[string]interface{}{"type": "string", "description": "New expiry (date or RFC 3339 time), or empty to never expire. Restores an archived memory"},
+					"pinned":          map[string]interface{}{"type": "boolean", "description": "Pinned memories are always ranked first"},
+					"importance":      map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 5, "description": "1 (trivial) to 5 (essential)"},
+				},
+				"required": []string{"id"},
+			},
+		},
+		{
+			Name:        "memory_history",
+			Description: "List the previous versions of a memory, newest first",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id":     map[string]interface{}{"type": "integer", "description": "Memory ID"},
+					"limit":  map[string]interface{}{"type": "integer", "description": "Maximum items per page (default 50)"},
+					"cursor": map[string]interface{}{"type": "string", "description": "Pass next_cursor from the previous page to get the next one"},
 				},
+				"required": []string{"id"},
 			},
 		},
 		{
@@ -48,6 +89,31 @@ func GetToolDefinitions() []ToolDefinition {
 				"required": []string{"id"},
 			},
 		},
+		{
+			Name:        "memory_find_duplicates",
+			Description: "Find clusters of duplicate and near-duplicate memories in a project so they can be consolidated",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"project":   map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"threshold": map[string]interface{}{"type": "number", "description": "Similarity from 0 to 1 at which memories are near-duplicates (default 0.7)"},
+					"limit":     map[string]interface{}{"type": "integer", "description": "Maximum items per page (default 50)"},
+					"cursor":    map[string]interface{}{"type": "string", "description": "Pass next_cursor from the previous page to get the next one"},
+				},
+			},
+		},
+		{
+			Name:        "memory_prune",
+			Description: "Archive expired memories. Archived memories are kept, but only returned by memory_search with include_expired",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"project":      map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"all_projects": map[string]interface{}{"type": "boolean", "description": "Prune every project"},
+					"dry_run":      map[string]interface{}{"type": "boolean", "description": "List the memories that would be archived without archiving them"},
+				},
+			},
+		},
 
 		// Task tools
 		{
@@ -56,53 +122,175 @@ func GetToolDefinitions() []ToolDefinition {
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"title":       map[string]interface{}{"type": "string", "description": "Task title"},
-					"description": map[string]interface{}{"type": "string", "description": "Detailed description"},
-					"parent_id":   map[string]interface{}{"type": "integer", "description": "Parent task ID for subtasks"},
-					"priority":    map[string]interface{}{"type": "integer", "description": "Priority (higher = more important)"},
-					"project":     map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"title":            map[string]interface{}{"type": "string", "description": "Task title"},
+					"description":      map[string]interface{}{"type": "string", "description": "Detailed description"},
+					"parent_id":        map[string]interface{}{"type": "integer", "description": "Parent task ID for subtasks"},
+					"priority":         map[string]interface{}{"type": "integer", "description": "Priority (higher = more important)"},
+					"due_at":           map[string]interface{}{"type": "string", "description": "Due date (2006-01-02) or RFC 3339 time"},
+					"estimate_minutes": map[string]interface{}{"type": "integer", "description": "Estimated effort in minutes"},
+					"assignee":         map[string]interface{}{"type": "string", "description": "Agent or person who owns the task"},
+					"labels":           map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Free-form labels"},
+					"project":          map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
 				},
 				"required": []string{"title"},
 			},
 		},
 		{
 			Name:        "task_update",
-			Description: "Update a task's status, title, description, or priority",
+			Description: "Update a task's status, title, description, or priority. Status changes must follow the project's workflow; closing a task also returns the tasks it unblocked",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"id":          map[string]interface{}{"type": "integer", "description": "Task ID"},
-					"status":      map[string]interface{}{"type": "string", "enum": []string{"todo", "in_progress", "done", "blocked"}, "description": "Task status"},
-					"title":       map[string]interface{}{"type": "string", "description": "New title"},
-					"description": map[string]interface{}{"type": "string", "description": "New description"},
-					"priority":    map[string]interface{}{"type": "integer", "description": "New priority"},
+					"id":               map[string]interface{}{"type": "integer", "description": "Task ID"},
+					"status":           map[string]interface{}{"type": "string", "enum": []string{"todo", "in_progress", "done", "blocked"}, "description": "Task status"},
+					"title":            map[string]interface{}{"type": "string", "description": "New title"},
+					"description":      map[string]interface{}{"type": "string", "description": "New description"},
+					"priority":         map[string]interface{}{"type": "integer", "description": "New priority"},
+					"due_at":           map[string]interface{}{"type": "string", "description": "New due date (2006-01-02) or RFC 3339 time; empty to clear"},
+					"estimate_minutes": map[string]interface{}{"type": "integer", "description": "New estimate in minutes; 0 to clear"},
+					"assignee":         map[string]interface{}{"type": "string", "description": "New assignee; empty to unassign"},
+					"labels":           map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Replacement labels"},
+					"comment":          map[string]interface{}{"type": "string", "description": "Comment to add explaining the change, e.g. why the task is blocked"},
+					"author":           map[string]interface{}{"type": "string", "description": "Who is making the change, recorded with the comment"},
 				},
 				"required": []string{"id"},
 			},
 		},
 		{
 			Name:        "task_list",
-			Description: "List tasks with optional filters",
+			Description: "List tasks with optional filters, sorted and paginated",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"project":   map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
-					"status":    map[string]interface{}{"type": "string", "enum": []string{"todo", "in_progress", "done", "blocked"}, "description": "Filter by status"},
-					"parent_id": map[string]interface{}{"type": "integer", "description": "Filter by parent (0 for root tasks)"},
+					"project":       map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"status":        map[string]interface{}{"type": "string", "enum": []string{"todo", "in_progress", "done", "blocked"}, "description": "Filter by status"},
+					"statuses":      map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "enum": []string{"todo", "in_progress", "done", "blocked"}}, "description": "Filter by any of several statuses"},
+					"parent_id":     map[string]interface{}{"type": "integer", "description": "Filter by parent (0 for root tasks)"},
+					"ready":         map[string]interface{}{"type": "boolean", "description": "Only tasks that are not closed and whose dependencies are all closed"},
+					"labels":        map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Only tasks with all of these labels"},
+					"assignee":      map[string]interface{}{"type": "string", "description": "Only tasks with this assignee (empty for unassigned)"},
+					"due_before":    map[string]interface{}{"type": "string", "description": "Only tasks due before this date or time"},
+					"due_after":     map[string]interface{}{"type": "string", "description": "Only tasks due at or after this date or time"},
+					"query":         map[string]interface{}{"type": "string", "description": "Text to find in the title or description"},
+					"sort":          map[string]interface{}{"type": "string", "enum": []string{"priority", "due", "created", "updated", "title"}, "description": "Sort order (default priority)"},
+					"offset":        map[string]interface{}{"type": "integer", "description": "Number of results to skip when no cursor is given"},
+					"include_links": map[string]interface{}{"type": "boolean", "description": "Include each task's linked entities"},
+					"limit":         map[string]interface{}{"type": "integer", "description": "Maximum items per page (default 50)"},
+					"cursor":        map[string]interface{}{"type": "string", "description": "Pass next_cursor from the previous page to get the next one"},
 				},
 			},
 		},
 		{
 			Name:        "task_delete",
-			Description: "Delete a task and its subtasks",
+			Description: "Delete a task and all its subtasks, or only the task with its subtasks moved up to its parent",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"id": map[string]interface{}{"type": "integer", "description": "Task ID to delete"},
+					"id":       map[string]interface{}{"type": "integer", "description": "Task ID to delete"},
+					"reparent": map[string]interface{}{"type": "boolean", "description": "Keep the subtasks, moving them to the deleted task's parent (default false)"},
 				},
 				"required": []string{"id"},
 			},
 		},
+		{
+			Name:        "task_tree",
+			Description: "Get tasks as a tree of nested subtasks, with done/total progress rolled up from all descendants",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id":      map[string]interface{}{"type": "integer", "description": "Root task ID (optional; defaults to every task in the project)"},
+					"project": map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+				},
+			},
+		},
+		{
+			Name:        "task_move",
+			Description: "Move a task, with its subtasks, under another task in the same project or to the top level",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id":        map[string]interface{}{"type": "integer", "description": "Task ID to move"},
+					"parent_id": map[string]interface{}{"type": "integer", "description": "New parent task ID (0 or omitted for the top level)"},
+				},
+				"required": []string{"id"},
+			},
+		},
+		{
+			Name:        "task_dependency_add",
+			Description: "Record that a task is blocked by another until that one is done. Dependencies that would form a cycle are rejected",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"task_id":       map[string]interface{}{"type": "integer", "description": "The blocked task"},
+					"depends_on_id": map[string]interface{}{"type": "integer", "description": "The task it waits on"},
+				},
+				"required": []string{"task_id", "depends_on_id"},
+			},
+		},
+		{
+			Name:        "task_dependency_remove",
+			Description: "Remove a dependency between two tasks",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"task_id":       map[string]interface{}{"type": "integer", "description": "The blocked task"},
+					"depends_on_id": map[string]interface{}{"type": "integer", "description": "The task it waits on"},
+				},
+				"required": []string{"task_id", "depends_on_id"},
+			},
+		},
+		{
+			Name:        "task_comment_add",
+			Description: "Add a comment to a task, e.g. a finding, an attempt that failed, or why it is blocked",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"task_id": map[string]interface{}{"type": "integer", "description": "Task ID"},
+					"content": map[string]interface{}{"type": "string", "description": "Comment text"},
+					"author":  map[string]interface{}{"type": "string", "description": "Who wrote the comment (optional)"},
+				},
+				"required": []string{"task_id", "content"},
+			},
+		},
+		{
+			Name:        "task_comments_list",
+			Description: "List a page of a task's comments and the task's history of title, status and priority changes, oldest first",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"task_id":          map[string]interface{}{"type": "integer", "description": "Task ID"},
+					"include_activity": map[string]interface{}{"type": "boolean", "description": "Include the change history (default true)"},
+					"limit":            map[string]interface{}{"type": "integer", "description": "Maximum items per page (default 50)"},
+					"cursor":           map[string]interface{}{"type": "string", "description": "Pass next_cursor from the previous page to get the next one"},
+				},
+				"required": []string{"task_id"},
+			},
+		},
+		{
+			Name:        "task_workflow_get",
+			Description: "Get the task workflow that applies to a project: its statuses, allowed transitions, and which statuses count as started and closed",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"project": map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+				},
+			},
+		},
+		{
+			Name:        "task_workflow_set",
+			Description: "Define a project's task workflow, inherited by its child projects. Status changes are validated against it",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"statuses":    map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Allowed statuses; new tasks start in the first"},
+					"transitions": map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}, "description": "Map of status to the statuses a task may move to from it; omit to allow any move"},
+					"started":     map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Statuses that set started_at"},
+					"closed":      map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Statuses that count as finished and set completed_at"},
+					"reset":       map[string]interface{}{"type": "boolean", "description": "Remove the project's own workflow and inherit one again"},
+					"project":     map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+				},
+			},
+		},
 
 		// Metadata tools
 		{
@@ -124,8 +312,9 @@ func GetToolDefinitions() []ToolDefinition {
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"key":     map[string]interface{}{"type": "string", "description": "Metadata key"},
-					"project": map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"include_inherited": map[string]interface{}{"type": "boolean", "description": "Include values inherited from parent projects; the project's own override them (default true)"},
+					"key":               map[string]interface{}{"type": "string", "description": "Metadata key"},
+					"project":           map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
 				},
 				"required": []string{"key"},
 			},
@@ -136,7 +325,10 @@ func GetToolDefinitions() []ToolDefinition {
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"project": map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"include_inherited": map[string]interface{}{"type": "boolean", "description": "Include keys inherited from parent projects; the project's own override them (default true)"},
+					"project":           map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"limit":             map[string]interface{}{"type": "integer", "description": "Maximum items per page (default 50)"},
+					"cursor":            map[string]interface{}{"type": "string", "description": "Pass next_cursor from the previous page to get the next one"},
 				},
 			},
 		},
@@ -174,8 +366,11 @@ func GetToolDefinitions() []ToolDefinition {
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"path":    map[string]interface{}{"type": "string", "description": "Specific path (optional, returns all if omitted)"},
-					"project": map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"path":          map[string]interface{}{"type": "string", "description": "Specific path (optional, returns all if omitted)"},
+					"project":       map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"include_links": map[string]interface{}{"type": "boolean", "description": "Include the linked entities of the annotation at path"},
+					"limit":         map[string]interface{}{"type": "integer", "description": "Maximum annotations per page when listing without a path (default 50)"},
+					"cursor":        map[string]interface{}{"type": "string", "description": "Pass next_cursor from the previous page to get the next one"},
 				},
 			},
 		},
@@ -229,22 +424,31 @@ func GetToolDefinitions() []ToolDefinition {
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"category": map[string]interface{}{"type": "string", "description": "Filter by category"},
-					"project":  map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"include_inherited": map[string]interface{}{"type": "boolean", "description": "Include guidelines inherited from parent projects; the project's own override them (default true)"},
+					"category":          map[string]interface{}{"type": "string", "description": "Filter by category"},
+					"project":           map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"limit":             map[string]interface{}{"type": "integer", "description": "Maximum items per page (default 50)"},
+					"cursor":            map[string]interface{}{"type": "string", "description": "Pass next_cursor from the previous page to get the next one"},
 				},
 			},
 		},
 		{
 			Name:        "guideline_search",
-			Description: "Search guidelines by content, title, or tags",
+			Description: "Search guidelines by content, title, or tags. Needs a query, a tag filter, or both",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"query":    map[string]interface{}{"type": "string", "description": "Search query"},
-					"category": map[string]interface{}{"type": "string", "description": "Filter by category"},
-					"project":  map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"include_inherited": map[string]interface{}{"type": "boolean", "description": "Include guidelines inherited from parent projects; the project's own override them (default true)"},
+					"query":             map[string]interface{}{"type": "string", "description": "Search query"},
+					"category":          map[string]interface{}{"type": "string", "description": "Filter by category"},
+					"tags":              map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Guidelines must have every one of these tags"},
+					"any_tags":          map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Guidelines must have at least one of these tags"},
+					"exclude_tags":      map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Guidelines must have none of these tags"},
+					"project":           map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"mode":              map[string]interface{}{"type": "string", "enum": []string{"lexical", "semantic", "hybrid"}, "description": "Match by text (lexical, default), by meaning (semantic), or both (hybrid)"},
+					"limit":             map[string]interface{}{"type": "integer", "description": "Maximum results per page (default 20)"},
+					"cursor":            map[string]interface{}{"type": "string", "description": "Pass next_cursor from the previous page to get the next one"},
 				},
-				"required": []string{"query"},
 			},
 		},
 		{
@@ -253,7 +457,8 @@ func GetToolDefinitions() []ToolDefinition {
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"id": map[string]interface{}{"type": "integer", "description": "Guideline ID"},
+					"id":            map[string]interface{}{"type": "integer", "description": "Guideline ID"},
+					"include_links": map[string]interface{}{"type": "boolean", "description": "Include the guideline's linked entities"},
 				},
 				"required": []string{"id"},
 			},
@@ -280,6 +485,7 @@ func GetToolDefinitions() []ToolDefinition {
 					"slug":      map[string]interface{}{"type": "string", "description": "Unique project identifier"},
 					"name":      map[string]interface{}{"type": "string", "description": "Human-readable name"},
 					"root_path": map[string]interface{}{"type": "string", "description": "Project root directory path"},
+					"parent":    map[string]interface{}{"type": "string", "description": "Slug of the project to inherit guidelines, metadata and bookmarks from (default \"global\"; empty for none)"},
 				},
 				"required": []string{"slug"},
 			},
@@ -288,8 +494,12 @@ func GetToolDefinitions() []ToolDefinition {
 			Name:        "project_list",
 			Description: "List all projects",
 			InputSchema: map[string]interface{}{
-				"type":       "object",
-				"properties": map[string]interface{}{},
+				"type": "object",
+				"properties": map[string]interface{}{
+					"include_archived": map[string]interface{}{"type": "boolean", "description": "Include archived projects"},
+					"limit":            map[string]interface{}{"type": "integer", "description": "Maximum items per page (default 50)"},
+					"cursor":           map[string]interface{}{"type": "string", "description": "Pass next_cursor from the previous page to get the next one"},
+				},
 			},
 		},
 		{
@@ -304,6 +514,102 @@ func GetToolDefinitions() []ToolDefinition {
 			},
 		},
 
+		{
+			Name:        "project_current",
+			Description: "Show this session's active project and how it was chosen (detected from the workspace, set explicitly, or the global default)",
+			InputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+		{
+			Name:        "project_update",
+			Description: "Change a project's name, root path or parent project",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"slug":      map[string]interface{}{"type": "string", "description": "Project slug"},
+					"name":      map[string]interface{}{"type": "string", "description": "New human-readable name"},
+					"root_path": map[string]interface{}{"type": "string", "description": "New project root directory path"},
+					"parent":    map[string]interface{}{"type": "string", "description": "Slug of the project to inherit from; empty to stop inheriting"},
+				},
+				"required": []string{"slug"},
+			},
+		},
+		{
+			Name:        "project_rename",
+			Description: "Change a project's slug",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"slug":     map[string]interface{}{"type": "string", "description": "Current project slug"},
+					"new_slug": map[string]interface{}{"type": "string", "description": "New unique project slug"},
+				},
+				"required": []string{"slug", "new_slug"},
+			},
+		},
+		{
+			Name:        "project_archive",
+			Description: "Archive a project, hiding it from project_list and workspace detection while keeping its data, or restore it",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"slug":     map[string]interface{}{"type": "string", "description": "Project slug"},
+					"archived": map[string]interface{}{"type": "boolean", "description": "false restores an archived project (default: true)"},
+				},
+				"required": []string{"slug"},
+			},
+		},
+		{
+			Name:        "project_delete",
+			Description: "Permanently delete a project with all its memories, tasks, metadata, file annotations, guidelines and bookmarks",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"slug":    map[string]interface{}{"type": "string", "description": "Project slug"},
+					"confirm": map[string]interface{}{"type": "boolean", "description": "Must be true"},
+				},
+				"required": []string{"slug", "confirm"},
+			},
+		},
+		{
+			Name:        "project_merge",
+			Description: "Move everything from one project into another and delete the source project",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"source":   map[string]interface{}{"type": "string", "description": "Slug of the project to merge away"},
+					"target":   map[string]interface{}{"type": "string", "description": "Slug of the project that receives the data"},
+					"strategy": map[string]interface{}{"type": "string", "enum": []string{"skip", "overwrite", "duplicate"}, "description": "For metadata keys, file paths and guideline titles in both projects: keep the target's (skip, default), take the source's (overwrite) or keep both with a suffixed name (duplicate)"},
+				},
+				"required": []string{"source", "target"},
+			},
+		},
+		{
+			Name:        "project_export",
+			Description: "Export a project (or every project) with its memories, tasks, metadata, file annotations, guidelines and bookmarks as JSON",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"project": map[string]interface{}{"type": "string", "description": "Project slug (defaults to the active project)"},
+					"all":     map[string]interface{}{"type": "boolean", "description": "Export every project"},
+				},
+			},
+		},
+		{
+			Name:        "project_import",
+			Description: "Import a project_export result, assigning new IDs. Projects are matched by slug; rows matching existing ones are resolved by strategy",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"data":     map[string]interface{}{"type": "object", "description": "Export document"},
+					"strategy": map[string]interface{}{"type": "string", "enum": []string{"skip", "overwrite", "duplicate"}, "description": "For memories (same content), tasks (same title), bookmarks (same URL and page), metadata keys, file paths and guideline titles that already exist: keep existing (skip, default), replace (overwrite) or keep both, suffixing unique names (duplicate)"},
+					"project":  map[string]interface{}{"type": "string", "description": "Import a single-project export under this slug"},
+				},
+				"required": []string{"data"},
+			},
+		},
+
 		// Bookmark tools
 		{
 			Name:        "bookmark_create",
@@ -329,10 +635,16 @@ func GetToolDefinitions() []ToolDefinition {
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"query":    map[string]interface{}{"type": "string", "description": "Search in title, excerpt, note, or URL"},
-					"tags":     map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Filter by tags"},
-					"doc_type": map[string]interface{}{"type": "string", "description": "Filter by document type"},
-					"project":  map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"include_inherited": map[string]interface{}{"type": "boolean", "description": "Include bookmarks inherited from parent projects; the project's own override them (default true)"},
+					"query":             map[string]interface{}{"type": "string", "description": "Search in title, excerpt, note, or URL"},
+					"tags":              map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Bookmarks must have every one of these tags"},
+					"any_tags":          map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Bookmarks must have at least one of these tags"},
+					"exclude_tags":      map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Bookmarks must have none of these tags"},
+					"doc_type":          map[string]interface{}{"type": "string", "description": "Filter by document type"},
+					"project":           map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"mode":              map[string]interface{}{"type": "string", "enum": []string{"lexical", "semantic", "hybrid"}, "description": "Match by text (lexical, default), by meaning (semantic), or both (hybrid)"},
+					"limit":             map[string]interface{}{"type": "integer", "description": "Maximum results per page (default 20)"},
+					"cursor":            map[string]interface{}{"type": "string", "description": "Pass next_cursor from the previous page to get the next one"},
 				},
 			},
 		},
@@ -342,7 +654,11 @@ func GetToolDefinitions() []ToolDefinition {
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"project": map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"include_inherited": map[string]interface{}{"type": "boolean", "description": "Include bookmarks inherited from parent projects; the project's own override them (default true)"},
+					"project":           map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"include_links":     map[string]interface{}{"type": "boolean", "description": "Include each bookmark's linked entities"},
+					"limit":             map[string]interface{}{"type": "integer", "description": "Maximum items per page (default 50)"},
+					"cursor":            map[string]interface{}{"type": "string", "description": "Pass next_cursor from the previous page to get the next one"},
 				},
 			},
 		},
@@ -357,5 +673,106 @@ func GetToolDefinitions() []ToolDefinition {
 				"required": []string{"id"},
 			},
 		},
+
+		// Link tools
+		{
+			Name:        "link_create",
+			Description: "Link two entities with a typed relation that reads from source to target, e.g. a memory explains a task. Entities may be in different projects",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"source_type": map[string]interface{}{"type": "string", "enum": []string{"memory", "task", "guideline", "bookmark", "filetree"}, "description": "Type of the source entity"},
+					"source_id":   map[string]interface{}{"type": "integer", "description": "ID of the source entity"},
+					"target_type": map[string]interface{}{"type": "string", "enum": []string{"memory", "task", "guideline", "bookmark", "filetree"}, "description": "Type of the target entity"},
+					"target_id":   map[string]interface{}{"type": "integer", "description": "ID of the target entity"},
+					"relation":    map[string]interface{}{"type": "string", "enum": []string{"relates_to", "explains", "supersedes", "implements"}, "description": "Relation (default relates_to)"},
+				},
+				"required": []string{"source_type", "source_id", "target_type", "target_id"},
+			},
+		},
+		{
+			Name:        "link_delete",
+			Description: "Delete a link by ID",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id": map[string]interface{}{"type": "integer", "description": "Link ID, as link_id in links_get"},
+				},
+				"required": []string{"id"},
+			},
+		},
+		{
+			Name:        "links_get",
+			Description: "List the entities linked to or from an entity, with their relation, direction, project and title",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"type":     map[string]interface{}{"type": "string", "enum": []string{"memory", "task", "guideline", "bookmark", "filetree"}, "description": "Entity type"},
+					"id":       map[string]interface{}{"type": "integer", "description": "Entity ID"},
+					"relation": map[string]interface{}{"type": "string", "enum": []string{"relates_to", "explains", "supersedes", "implements"}, "description": "Only links with this relation"},
+					"limit":    map[string]interface{}{"type": "integer", "description": "Maximum items per page (default 50)"},
+					"cursor":   map[string]interface{}{"type": "string", "description": "Pass next_cursor from the previous page to get the next one"},
+				},
+				"required": []string{"type", "id"},
+			},
+		},
+
+		// Tag tools
+		{
+			Name:        "tag_list",
+			Description: "List the tags on memories (their keywords), guidelines and bookmarks, most used first, with counts per type",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"project":      map[string]interface{}{"type": "string", "description": "Project slug (optional)"},
+					"all_projects": map[string]interface{}{"type": "boolean", "description": "Count tags across every project"},
+					"limit":        map[string]interface{}{"type": "integer", "description": "Maximum items per page (default 50)"},
+					"cursor":       map[string]interface{}{"type": "string", "description": "Pass next_cursor from the previous page to get the next one"},
+				},
+			},
+		},
+		{
+			Name:        "tag_rename",
+			Description: "Rename a tag on every memory, guideline and bookmark in all projects. Use tag_merge if the new name is already a tag",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"from": map[string]interface{}{"type": "string", "description": "Current tag name"},
+					"to":   map[string]interface{}{"type": "string", "description": "New tag name"},
+				},
+				"required": []string{"from", "to"},
+			},
+		},
+		{
+			Name:        "tag_merge",
+			Description: "Replace one or more tags with another on every memory, guideline and bookmark in all projects, deleting the merged tags",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sources": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Tags to merge away"},
+					"into":    map[string]interface{}{"type": "string", "description": "Tag to keep, created if needed"},
+				},
+				"required": []string{"sources", "into"},
+			},
+		},
+
+		// Search tools
+		{
+			Name:        "search_all",
+			Description: "Search memories, guidelines, bookmarks, tasks and file annotations across projects in one ranked list. Each result names its type and project",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"query":          map[string]interface{}{"type": "string", "description": "Words to search for"},
+					"projects":       map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Project slugs to search (default: every unarchived project)"},
+					"types":          map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "enum": []string{"memory", "guideline", "bookmark", "task", "filetree"}}, "description": "Entity types to search (default: all)"},
+					"per_type_limit": map[string]interface{}{"type": "integer", "description": "Best matches kept per type before merging (default 20)"},
+					"offset":         map[string]interface{}{"type": "integer", "description": "Results to skip when no cursor is given; pass next_offset from the previous page"},
+					"limit":          map[string]interface{}{"type": "integer", "description": "Maximum results per page (default 20)"},
+					"cursor":         map[string]interface{}{"type": "string", "description": "Pass next_cursor from the previous page to get the next one"},
+				},
+				"required": []string{"query"},
+			},
+		},
 	}
 }
@@ -1,7 +1,41 @@
 package schema
 
-// Schema contains the SQL to initialize the database
-const Schema = `
+// Migration is a single numbered schema change. Migrations are applied in
+// order, each inside its own transaction, and the database records the last
+// applied version in PRAGMA user_version.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Migrations lists every schema change in the order it must be applied.
+// Never edit or reorder a released migration; append a new one instead.
+var Migrations = []Migration{
+	{Version: 1, Name: "initial schema", SQL: initialSchema},
+	{Version: 2, Name: "memories full-text index", SQL: memoriesFTS},
+	{Version: 3, Name: "memory edit history", SQL: memoryHistory},
+	{Version: 4, Name: "embedding vectors", SQL: embeddings},
+	{Version: 5, Name: "project archiving", SQL: projectArchive},
+	{Version: 6, Name: "project inheritance", SQL: projectParent},
+	{Version: 7, Name: "task dependencies", SQL: taskDependencies},
+	{Version: 8, Name: "task comments and activity", SQL: taskComments},
+	{Version: 9, Name: "task planning fields and labels", SQL: taskPlanning},
+	{Version: 10, Name: "task workflows", SQL: taskWorkflows},
+	{Version: 11, Name: "memory expiry and ranking", SQL: memoryLifetime},
+	{Version: 12, Name: "entity links", SQL: links},
+	{Version: 13, Name: "memory content hashes", SQL: memoryHashes},
+	{Version: 14, Name: "normalized tags", SQL: tags},
+}
+
+// Latest returns the newest schema version this build understands
+func Latest() int {
+	return Migrations[len(Migrations)-1].Version
+}
+
+// initialSchema is the schema as it existed before versioned migrations. Every
+// statement is idempotent so databases created by older builds upgrade cleanly.
+const initialSchema = `
 -- Project namespacing (default = "global")
 CREATE TABLE IF NOT EXISTS projects (
     id INTEGER PRIMARY KEY,
@@ -95,3 +129,290 @@ CREATE INDEX IF NOT EXISTS idx_metadata_project ON metadata(project_id);
 CREATE INDEX IF NOT EXISTS idx_bookmarks_project ON bookmarks(project_id);
 CREATE INDEX IF NOT EXISTS idx_bookmarks_tags ON bookmarks(tags);
 `
+
+// memoriesFTS adds a full-text index over memory content and keywords, kept in
+// sync by triggers, and indexes any memories that already exist.
+const memoriesFTS = `
+-- Full-text index over memory content and keywords, kept in sync by triggers
+CREATE VIRTUAL TABLE IF NOT EXISTS memories_fts USING fts5(
+    content,
+    keywords,
+    content='memories',
+    content_rowid='id',
+    tokenize='porter unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS memories_fts_insert AFTER INSERT ON memories BEGIN
+    INSERT INTO memories_fts(rowid, content, keywords) VALUES (new.id, new.content, new.keywords);
+END;
+
+CREATE TRIGGER IF NOT EXISTS memories_fts_delete AFTER DELETE ON memories BEGIN
+    INSERT INTO memories_fts(memories_fts, rowid, content, keywords) VALUES ('delete', old.id, old.content, old.keywords);
+END;
+
+CREATE TRIGGER IF NOT EXISTS memories_fts_update AFTER UPDATE ON memories BEGIN
+    INSERT INTO memories_fts(memories_fts, rowid, content, keywords) VALUES ('delete', old.id, old.content, old.keywords);
+    INSERT INTO memories_fts(rowid, content, keywords) VALUES (new.id, new.content, new.keywords);
+END;
+
+INSERT INTO memories_fts(memories_fts) VALUES ('rebuild');
+`
+
+// memoryHistory keeps every prior revision of a memory
+const memoryHistory = `
+CREATE TABLE memory_history (
+    id INTEGER PRIMARY KEY,
+    memory_id INTEGER NOT NULL REFERENCES memories(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    keywords TEXT,                                  -- JSON array of strings
+    valid_from DATETIME,                            -- when this revision was written
+    replaced_at DATETIME DEFAULT CURRENT_TIMESTAMP  -- when it was superseded
+);
+
+CREATE INDEX idx_memory_history_memory ON memory_history(memory_id);
+`
+
+// embeddings stores one vector per searchable row for semantic search. Rows are
+// embedded lazily at search time and re-embedded when their text or the
+// embedding model changes.
+const embeddings = `
+CREATE TABLE embeddings (
+    entity_type TEXT NOT NULL,    -- memory, guideline, bookmark
+    entity_id INTEGER NOT NULL,
+    model TEXT NOT NULL,          -- embedder that produced the vector
+    content_hash TEXT NOT NULL,   -- hash of the embedded text, to detect edits
+    vector BLOB NOT NULL,         -- little-endian float32 array
+    PRIMARY KEY (entity_type, entity_id)
+);
+
+CREATE TRIGGER memories_embeddings_delete AFTER DELETE ON memories BEGIN
+    DELETE FROM embeddings WHERE entity_type = 'memory' AND entity_id = old.id;
+END;
+
+CREATE TRIGGER guidelines_embeddings_delete AFTER DELETE ON guidelines BEGIN
+    DELETE FROM embeddings WHERE entity_type = 'guideline' AND entity_id = old.id;
+END;
+
+CREATE TRIGGER bookmarks_embeddings_delete AFTER DELETE ON bookmarks BEGIN
+    DELETE FROM embeddings WHERE entity_type = 'bookmark' AND entity_id = old.id;
+END;
+`
+
+// projectArchive lets a project be archived: hidden from listings and
+// workspace detection, but kept with all its data
+const projectArchive = `
+ALTER TABLE projects ADD COLUMN archived_at DATETIME;
+`
+
+// projectParent lets a project inherit guidelines, metadata and bookmarks from
+// a parent. Existing projects inherit from the global project.
+const projectParent = `
+ALTER TABLE projects ADD COLUMN parent_id INTEGER REFERENCES projects(id) ON DELETE SET NULL;
+
+UPDATE projects SET parent_id = 1 WHERE id <> 1;
+`
+
+// taskDependencies records that a task cannot start until another is done.
+// Edges go away with either task.
+const taskDependencies = `
+CREATE TABLE task_dependencies (
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    depends_on_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (task_id, depends_on_id)
+);
+
+CREATE INDEX idx_task_dependencies_depends_on ON task_dependencies(depends_on_id);
+`
+
+// taskComments adds free-form comments on tasks and an activity log of their
+// title, status and priority changes
+const taskComments = `
+CREATE TABLE task_comments (
+    id INTEGER PRIMARY KEY,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    author TEXT,
+    content TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_task_comments_task ON task_comments(task_id);
+
+CREATE TABLE task_activity (
+    id INTEGER PRIMARY KEY,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    field TEXT NOT NULL,
+    old_value TEXT,
+    new_value TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_task_activity_task ON task_activity(task_id);
+`
+
+// taskPlanning adds a due date, time estimate and assignee to tasks, and
+// free-form labels stored one row per label
+const taskPlanning = `
+ALTER TABLE tasks ADD COLUMN due_at DATETIME;
+ALTER TABLE tasks ADD COLUMN estimate_minutes INTEGER;
+ALTER TABLE tasks ADD COLUMN assignee TEXT;
+
+CREATE TABLE task_labels (
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    label TEXT NOT NULL,
+    PRIMARY KEY (task_id, label)
+);
+
+CREATE INDEX idx_task_labels_label ON task_labels(label);
+`
+
+// taskWorkflows lets a project define its own task statuses and transitions,
+// and records when tasks were started and completed. Existing tasks use the
+// default workflow, where in_progress is started and done is closed.
+const taskWorkflows = `
+CREATE TABLE task_workflows (
+    project_id INTEGER PRIMARY KEY REFERENCES projects(id) ON DELETE CASCADE,
+    statuses TEXT NOT NULL,    -- JSON array; the first is the initial status
+    transitions TEXT NOT NULL, -- JSON object of status -> allowed next statuses
+    started TEXT NOT NULL,     -- JSON array
+    closed TEXT NOT NULL,      -- JSON array
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE tasks ADD COLUMN started_at DATETIME;
+ALTER TABLE tasks ADD COLUMN completed_at DATETIME;
+
+UPDATE tasks SET started_at = updated_at WHERE status IN ('in_progress', 'done');
+UPDATE tasks SET completed_at = updated_at WHERE status = 'done';
+`
+
+// memoryLifetime lets memories expire, be pinned and carry an importance
+// from 1 to 5. Pruned memories are archived rather than deleted.
+const memoryLifetime = `
+ALTER TABLE memories ADD COLUMN expires_at DATETIME;
+ALTER TABLE memories ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE memories ADD COLUMN importance INTEGER NOT NULL DEFAULT 3;
+ALTER TABLE memories ADD COLUMN archived_at DATETIME;
+
+CREATE INDEX idx_memories_expires ON memories(expires_at) WHERE expires_at IS NOT NULL;
+`
+
+// links connects any two memories, tasks, guidelines, bookmarks or file
+// annotations with a typed relation. Links are removed with either end.
+const links = `
+CREATE TABLE links (
+    id INTEGER PRIMARY KEY,
+    source_type TEXT NOT NULL, -- memory, task, guideline, bookmark, filetree
+    source_id INTEGER NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id INTEGER NOT NULL,
+    relation TEXT NOT NULL,    -- relates_to, explains, supersedes, implements
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (source_type, source_id, target_type, target_id, relation)
+);
+
+CREATE INDEX idx_links_target ON links(target_type, target_id);
+
+CREATE TRIGGER memories_links_delete AFTER DELETE ON memories BEGIN
+    DELETE FROM links WHERE (source_type = 'memory' AND source_id = old.id) OR (target_type = 'memory' AND target_id = old.id);
+END;
+
+CREATE TRIGGER tasks_links_delete AFTER DELETE ON tasks BEGIN
+    DELETE FROM links WHERE (source_type = 'task' AND source_id = old.id) OR (target_type = 'task' AND target_id = old.id);
+END;
+
+CREATE TRIGGER guidelines_links_delete AFTER DELETE ON guidelines BEGIN
+    DELETE FROM links WHERE (source_type = 'guideline' AND source_id = old.id) OR (target_type = 'guideline' AND target_id = old.id);
+END;
+
+CREATE TRIGGER bookmarks_links_delete AFTER DELETE ON bookmarks BEGIN
+    DELETE FROM links WHERE (source_type = 'bookmark' AND source_id = old.id) OR (target_type = 'bookmark' AND target_id = old.id);
+END;
+
+CREATE TRIGGER filetree_links_delete AFTER DELETE ON filetree BEGIN
+    DELETE FROM links WHERE (source_type = 'filetree' AND source_id = old.id) OR (target_type = 'filetree' AND target_id = old.id);
+END;
+`
+
+// memoryHashes records a hash of each memory's normalized content to find
+// duplicates. Existing memories are hashed when first needed.
+const memoryHashes = `
+ALTER TABLE memories ADD COLUMN content_hash TEXT;
+
+CREATE INDEX idx_memories_hash ON memories(project_id, content_hash);
+`
+
+// tags moves memory keywords and guideline and bookmark tags into a shared,
+// case-insensitive tags table. The JSON columns stay as the ordered copy that
+// is displayed and full-text indexed.
+const tags = `
+CREATE TABLE tags (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE -- lowercase and trimmed
+);
+
+CREATE TABLE memory_tags (
+    memory_id INTEGER NOT NULL REFERENCES memories(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (memory_id, tag_id)
+);
+
+CREATE INDEX idx_memory_tags_tag ON memory_tags(tag_id);
+
+CREATE TABLE guideline_tags (
+    guideline_id INTEGER NOT NULL REFERENCES guidelines(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (guideline_id, tag_id)
+);
+
+CREATE INDEX idx_guideline_tags_tag ON guideline_tags(tag_id);
+
+CREATE TABLE bookmark_tags (
+    bookmark_id INTEGER NOT NULL REFERENCES bookmarks(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (bookmark_id, tag_id)
+);
+
+CREATE INDEX idx_bookmark_tags_tag ON bookmark_tags(tag_id);
+
+DROP INDEX IF EXISTS idx_memories_keywords;
+DROP INDEX IF EXISTS idx_bookmarks_tags;
+
+UPDATE memories SET keywords = (
+    SELECT json_group_array(name) FROM (
+        SELECT lower(trim(value)) AS name, min(key) AS pos FROM json_each(memories.keywords)
+        WHERE trim(value) != '' GROUP BY name ORDER BY pos
+    )
+) WHERE json_valid(keywords);
+
+UPDATE guidelines SET tags = (
+    SELECT json_group_array(name) FROM (
+        SELECT lower(trim(value)) AS name, min(key) AS pos FROM json_each(guidelines.tags)
+        WHERE trim(value) != '' GROUP BY name ORDER BY pos
+    )
+) WHERE json_valid(tags);
+
+UPDATE bookmarks SET tags = (
+    SELECT json_group_array(name) FROM (
+        SELECT lower(trim(value)) AS name, min(key) AS pos FROM json_each(bookmarks.tags)
+        WHERE trim(value) != '' GROUP BY name ORDER BY pos
+    )
+) WHERE json_valid(tags);
+
+INSERT OR IGNORE INTO tags (name)
+SELECT j.value FROM memories e, json_each(CASE WHEN json_valid(e.keywords) THEN e.keywords ELSE '[]' END) j
+UNION SELECT j.value FROM guidelines e, json_each(CASE WHEN json_valid(e.tags) THEN e.tags ELSE '[]' END) j
+UNION SELECT j.value FROM bookmarks e, json_each(CASE WHEN json_valid(e.tags) THEN e.tags ELSE '[]' END) j;
+
+INSERT OR IGNORE INTO memory_tags (memory_id, tag_id)
+SELECT e.id, t.id FROM memories e, json_each(CASE WHEN json_valid(e.keywords) THEN e.keywords ELSE '[]' END) j
+JOIN tags t ON t.name = j.value;
+
+INSERT OR IGNORE INTO guideline_tags (guideline_id, tag_id)
+SELECT e.id, t.id FROM guidelines e, json_each(CASE WHEN json_valid(e.tags) THEN e.tags ELSE '[]' END) j
+JOIN tags t ON t.name = j.value;
+
+INSERT OR IGNORE INTO bookmark_tags (bookmark_id, tag_id)
+SELECT e.id, t.id FROM bookmarks e, json_each(CASE WHEN json_valid(e.tags) THEN e.tags ELSE '[]' END) j
+JOIN tags t ON t.name = j.value;
+`